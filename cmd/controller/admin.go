@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"knative.dev/pkg/logging"
+)
+
+// adminSweepPath is the path of the admin endpoint which enqueues all the completed runs for a re-evaluation
+const adminSweepPath = "/admin/sweep"
+
+// debugExplainPath is the path of the admin endpoint which explains the config resolved for a run
+const debugExplainPath = "/debug/explain"
+
+// sweepResponse is the body of the response to a sweep request
+type sweepResponse struct {
+	Enqueued int `json:"enqueued"`
+}
+
+// adminSweepHandler enqueues all the completed runs on a POST request authenticated with the bearer token
+func adminSweepHandler(ctx context.Context, token string, sweep func() int) http.HandlerFunc {
+	logger := logging.FromContext(ctx)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !authorize(w, r, token) {
+			return
+		}
+
+		enqueued := sweep()
+		logger.Infow("sweep requested on the admin endpoint", "enqueued", enqueued, "remoteAddr", r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(sweepResponse{Enqueued: enqueued}); err != nil {
+			logger.Errorw("error on writing the sweep response", zap.Error(err))
+		}
+	}
+}
+
+// debugExplainHandler returns the step by step resolution of the config of the run given by the namespace,
+// name and type query parameters, on a GET request authenticated with the bearer token
+func debugExplainHandler(ctx context.Context, token string, explain func(ctx context.Context, kind, namespace, name string) (*config.ConfigExplanation, error)) http.HandlerFunc {
+	logger := logging.FromContext(ctx)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !authorize(w, r, token) {
+			return
+		}
+
+		query := r.URL.Query()
+		namespace, name := query.Get("namespace"), query.Get("name")
+		if namespace == "" || name == "" {
+			http.Error(w, "the namespace and name query parameters are required", http.StatusBadRequest)
+			return
+		}
+		var kind string
+		switch strings.ToLower(query.Get("type")) {
+		case "pipelinerun":
+			kind = config.KindPipelineRun
+		case "taskrun":
+			kind = config.KindTaskRun
+		default:
+			http.Error(w, "the type query parameter must be pipelinerun or taskrun", http.StatusBadRequest)
+			return
+		}
+
+		explanation, err := explain(r.Context(), kind, namespace, name)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			logger.Errorw("error on explaining the config", "kind", kind, "namespace", namespace, "name", name, zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(explanation); err != nil {
+			logger.Errorw("error on writing the explain response", zap.Error(err))
+		}
+	}
+}
+
+// authorize checks the bearer token of the request, the unauthorized request is answered
+func authorize(w http.ResponseWriter, r *http.Request, token string) bool {
+	bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/pipelinerun"
+	"github.com/stretchr/testify/assert"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	fakepipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"knative.dev/pkg/ptr"
+)
+
+func TestAdminSweep(t *testing.T) {
+	runs := []interface{}{
+		&metav1.ObjectMeta{Namespace: "dev", Name: "completed", Labels: map[string]string{"completed": "true"}},
+		&metav1.ObjectMeta{Namespace: "dev", Name: "running"},
+		&metav1.ObjectMeta{Namespace: "other-shard", Name: "completed", Labels: map[string]string{"completed": "true"}},
+		&metav1.ObjectMeta{Namespace: "prod", Name: "completed", Labels: map[string]string{"completed": "true"}},
+	}
+	var enqueued []string
+	sweep := func() int {
+		return config.EnqueueCompleted(runs,
+			func(obj interface{}) bool { return obj.(metav1.Object).GetNamespace() != "other-shard" },
+			func(resource metav1.Object) bool { return resource.GetLabels()["completed"] == "true" },
+			func(obj interface{}) {
+				enqueued = append(enqueued, obj.(metav1.Object).GetNamespace()+"/"+obj.(metav1.Object).GetName())
+			},
+		)
+	}
+	handler := adminSweepHandler(context.Background(), "secret", sweep)
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		wantStatus    int
+		wantEnqueued  []string
+	}{
+		{
+			name:          "sweep",
+			method:        http.MethodPost,
+			authorization: "Bearer secret",
+			wantStatus:    http.StatusAccepted,
+			wantEnqueued:  []string{"dev/completed", "prod/completed"},
+		},
+		{
+			name:       "no token",
+			method:     http.MethodPost,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "wrong token",
+			method:        http.MethodPost,
+			authorization: "Bearer guess",
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "not a bearer token",
+			method:        http.MethodPost,
+			authorization: "Basic secret",
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "get",
+			method:        http.MethodGet,
+			authorization: "Bearer secret",
+			wantStatus:    http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enqueued = nil
+			req := httptest.NewRequest(tt.method, adminSweepPath, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantEnqueued, enqueued)
+			if tt.wantStatus == http.StatusAccepted {
+				response := sweepResponse{}
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+				assert.Equal(t, len(tt.wantEnqueued), response.Enqueued)
+			}
+		})
+	}
+}
+
+func TestDebugExplain(t *testing.T) {
+	ctx := context.Background()
+	if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{Data: map[string]string{config.PrunerGlobalConfigKey: `enforcedConfigLevel: resource
+ttlSecondsAfterFinished: 600
+namespaces:
+  dev:
+    successfulHistoryLimit: 3
+    pipelineRuns:
+      - name: build
+        ttlSecondsAfterFinished: 60`}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{}) })
+
+	completionTime := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	client := fakepipelineclientset.NewSimpleClientset(&pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "build-1", Labels: map[string]string{config.LabelPipelineName: "build"}},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				StartTime:      &metav1.Time{Time: completionTime.Add(-time.Minute)},
+				CompletionTime: &metav1.Time{Time: completionTime},
+			},
+		},
+	})
+	ttlHandler, err := config.NewTTLHandler(clocktesting.NewFakeClock(completionTime.Add(time.Hour)), pipelinerun.NewPrFuncs(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.RegisterExplainer(config.KindPipelineRun, ttlHandler.ExplainConfig)
+	handler := debugExplainHandler(ctx, "secret", config.ExplainConfig)
+
+	tests := []struct {
+		name          string
+		query         string
+		authorization string
+		wantStatus    int
+		want          *config.ConfigExplanation
+	}{
+		{
+			name:          "explain",
+			query:         "namespace=dev&name=build-1&type=pipelinerun",
+			authorization: "Bearer secret",
+			wantStatus:    http.StatusOK,
+			want: &config.ConfigExplanation{
+				Kind:                    config.KindPipelineRun,
+				Namespace:               "dev",
+				Name:                    "build-1",
+				ResourceName:            "build",
+				EnforcedConfigLevel:     config.EnforcedConfigLevelResource,
+				TTLSecondsAfterFinished: ptr.Int32(60),
+				SuccessfulHistoryLimit:  ptr.Int32(3),
+				DeleteAt:                &metav1.Time{Time: completionTime.Add(time.Minute)},
+				DeleteNow:               true,
+				Reason:                  "the ttl of 60 seconds expired at 2025-01-01T10:01:00Z",
+				Steps: []string{
+					"the global config enforces the resource level",
+					"ttlSecondsAfterFinished=60 from the pipelineRun spec of the namespace matched by name",
+					"successfulHistoryLimit: no pipelineRun spec of the namespace sets it, falling through to the namespace level",
+					"successfulHistoryLimit=3 from the namespace config",
+					"failedHistoryLimit: no pipelineRun spec of the namespace sets it, falling through to the namespace level",
+					"failedHistoryLimit=unset from the namespace config",
+				},
+			},
+		},
+		{
+			name:          "not found",
+			query:         "namespace=dev&name=build-2&type=pipelinerun",
+			authorization: "Bearer secret",
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "unsupported type",
+			query:         "namespace=dev&name=build-1&type=pod",
+			authorization: "Bearer secret",
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "missing name",
+			query:         "namespace=dev&type=pipelinerun",
+			authorization: "Bearer secret",
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:       "no token",
+			query:      "namespace=dev&name=build-1&type=pipelinerun",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, debugExplainPath+"?"+tt.query, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			if tt.want != nil {
+				got := &config.ConfigExplanation{}
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), got))
+				assert.Equal(t, tt.want.DeleteAt.UTC(), got.DeleteAt.UTC())
+				got.DeleteAt = tt.want.DeleteAt
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
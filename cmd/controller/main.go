@@ -2,11 +2,17 @@ package main
 
 import (
 	"flag"
+	"net/http"
+	"os"
 	"strings"
 
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/pipelinerun"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/taskrun"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/tektonpruner"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
 	"knative.dev/pkg/controller"
@@ -22,6 +28,11 @@ func main() {
 	flag.IntVar(&controller.DefaultThreadsPerController, "threads-per-controller", controller.DefaultThreadsPerController, "Threads (goroutines) to create per controller")
 	namespace := flag.String("namespace", corev1.NamespaceAll, "Namespace to restrict informer to. Optional, defaults to all namespaces.")
 	disableHighAvailability := flag.Bool("disable-ha", true, "Whether to disable high-availability functionality for this component.")
+	shardIndex := flag.Int("shard-index", 0, "Index of this replica's shard, the replica processes only the namespaces hashed to this shard.")
+	shardCount := flag.Int("shard-count", 1, "Total number of shards, to be used with multiple replicas when high-availability is disabled.")
+	enableAdmin := flag.Bool("enable-admin-endpoint", false, "Whether to serve the admin endpoints, which trigger an immediate sweep of all the completed runs and explain the config of a run.")
+	adminPort := flag.Int("admin-port", 8090, "Port the admin endpoint listens on.")
+	namespacedMetricsPort := flag.Int("namespaced-metrics-port", 0, "Port the metrics endpoint filtered by namespace listens on. Optional, disabled when 0.")
 	flag.Parse()
 
 	// Parse and get REST config
@@ -50,11 +61,45 @@ func main() {
 		logger.Infof("controller is scoped to the following namespaces: %s\n", namespaces)
 	}
 
+	// Add namespace sharding
+	shard, err := config.NewShard(*shardIndex, *shardCount)
+	if err != nil {
+		logger.Fatalw("invalid shard configuration", zap.Error(err))
+	}
+	if shard.Count > 1 {
+		logger.Infow("controller is sharded by namespace", "shardIndex", shard.Index, "shardCount", shard.Count)
+	}
+	ctx = config.WithShard(ctx, shard)
+
+	// Add the OTel logger provider the logs correlated with the traces are exported to
+	if err := config.SetupLoggerProvider(ctx); err != nil {
+		logger.Fatalw("failed to set up the logger provider", zap.Error(err))
+	}
+
 	// Add High Availability flag
 	if *disableHighAvailability {
 		ctx = sharedmain.WithHADisabled(ctx)
 	}
 
+	// Add the admin endpoint, the requests are authenticated with the token of the environment
+	if *enableAdmin {
+		token := os.Getenv(config.EnvAdminToken)
+		if token == "" {
+			logger.Fatalw("the admin endpoint requires a token", "environmentKey", config.EnvAdminToken)
+		}
+		mux := http.NewServeMux()
+		mux.Handle(adminSweepPath, adminSweepHandler(ctx, token, config.SweepAll))
+		mux.Handle(debugExplainPath, debugExplainHandler(ctx, token, config.ExplainConfig))
+		startServer(ctx, "admin", *adminPort, mux)
+	}
+
+	// Add the metrics endpoint serving the series of a single namespace, for multi-tenant scraping
+	if *namespacedMetricsPort != 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.NamespaceHandler(prometheus.DefaultGatherer))
+		startServer(ctx, "namespaced metrics", *namespacedMetricsPort, mux)
+	}
+
 	// Use sharedmain to handle controller lifecycle
 	sharedmain.MainWithConfig(ctx, "tekton-pruner-controller", cfg,
 		tektonpruner.NewController,
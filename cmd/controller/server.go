@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"knative.dev/pkg/logging"
+)
+
+// startServer starts a server of the controller on the port, it is shut down once the context is done
+func startServer(ctx context.Context, name string, port int, handler http.Handler) {
+	logger := logging.FromContext(ctx)
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			logger.Errorw("error on shutting down the server", "server", name, zap.Error(err))
+		}
+	}()
+
+	go func() {
+		logger.Infow("starting the server", "server", name, "port", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Errorw("server stopped", "server", name, zap.Error(err))
+		}
+	}()
+}
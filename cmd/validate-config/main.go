@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// envConfigFile is the environment variable name used to set the config file, when the flag is not given
+const envConfigFile = "PRUNER_CONFIG_FILE"
+
+// sample represents a run the config is resolved for, the name is the name of its Pipeline or Task
+type sample struct {
+	Kind        string            `json:"kind"`
+	Namespace   string            `json:"namespace"`
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// main validates a pruner config file offline, it exits with a non-zero code on an invalid config
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run validates the config file and resolves the config of the sample runs, returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configFile := flags.String("config", os.Getenv(envConfigFile), "Path of the pruner config file, the content of the global config key. Defaults to $"+envConfigFile+".")
+	samplesFile := flags.String("samples", "", "Path of a file listing the sample runs to resolve the config for. Optional.")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *configFile == "" {
+		fmt.Fprintln(stderr, "the config file is required, set with -config or $"+envConfigFile)
+		return 2
+	}
+
+	data, err := os.ReadFile(*configFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to read the config file: %v\n", err)
+		return 1
+	}
+
+	warnings, err := config.ValidatePrunerConfig(string(data), config.ConfigLimits{})
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid config: %v\n", err)
+		return 1
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(stderr, "warning: %s\n", warning)
+	}
+
+	if *samplesFile == "" {
+		fmt.Fprintln(stdout, "config is valid")
+		return 0
+	}
+
+	if err := resolveSamples(string(data), *samplesFile, stdout); err != nil {
+		fmt.Fprintf(stderr, "failed to resolve the samples: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// resolveSamples loads the config and prints the config resolved for each of the sample runs
+func resolveSamples(data, samplesFile string, stdout io.Writer) error {
+	content, err := os.ReadFile(samplesFile)
+	if err != nil {
+		return err
+	}
+	var samples []sample
+	if err := yaml.Unmarshal(content, &samples); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", samplesFile, err)
+	}
+
+	configMap := &corev1.ConfigMap{Data: map[string]string{config.PrunerGlobalConfigKey: data}}
+	if err := config.PrunerConfigStore.LoadGlobalConfig(context.Background(), configMap); err != nil {
+		return err
+	}
+
+	store := &config.PrunerConfigStore
+	for _, s := range samples {
+		selector := config.SelectorSpec{MatchLabels: s.Labels, MatchAnnotations: s.Annotations}
+		var ttl, successLimit, failedLimit *int32
+		var level config.EnforcedConfigLevel
+		switch s.Kind {
+		case config.KindPipelineRun:
+			ttl, _ = store.GetPipelineTTLSecondsAfterFinished(s.Namespace, s.Name, selector)
+			successLimit, _ = store.GetPipelineSuccessHistoryLimitCount(s.Namespace, s.Name, selector)
+			failedLimit, _ = store.GetPipelineFailedHistoryLimitCount(s.Namespace, s.Name, selector)
+			level = store.GetPipelineEnforcedConfigLevel(s.Namespace, s.Name, selector)
+		case config.KindTaskRun:
+			ttl, _ = store.GetTaskTTLSecondsAfterFinished(s.Namespace, s.Name, selector)
+			successLimit, _ = store.GetTaskSuccessHistoryLimitCount(s.Namespace, s.Name, selector)
+			failedLimit, _ = store.GetTaskFailedHistoryLimitCount(s.Namespace, s.Name, selector)
+			level = store.GetTaskEnforcedConfigLevel(s.Namespace, s.Name, selector)
+		default:
+			return fmt.Errorf("unsupported kind %q of the sample %s/%s, expected %s or %s", s.Kind, s.Namespace, s.Name, config.KindPipelineRun, config.KindTaskRun)
+		}
+		fmt.Fprintf(stdout, "%s %s/%s: enforcedConfigLevel=%s ttlSecondsAfterFinished=%s successfulHistoryLimit=%s failedHistoryLimit=%s\n",
+			s.Kind, s.Namespace, s.Name, level, formatValue(ttl), formatValue(successLimit), formatValue(failedLimit))
+	}
+	return nil
+}
+
+// formatValue returns the resolved value, or "unset" when it is not configured
+func formatValue(value *int32) string {
+	if value == nil {
+		return "unset"
+	}
+	return fmt.Sprint(*value)
+}
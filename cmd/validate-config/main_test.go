@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	validConfig := writeFile(t, "valid.yaml", `enforcedConfigLevel: resource
+ttlSecondsAfterFinished: 300
+successfulHistoryLimit: 3
+namespaces:
+  dev:
+    pipelineRuns:
+      - name: build
+        ttlSecondsAfterFinished: 60`)
+	invalidConfig := writeFile(t, "invalid.yaml", `enforcedConfigLevel: bogus
+ttlSecondsAfterFinished: -5`)
+	samples := writeFile(t, "samples.yaml", `- kind: PipelineRun
+  namespace: dev
+  name: build
+- kind: TaskRun
+  namespace: prod
+  name: lint`)
+	invalidSamples := writeFile(t, "invalid-samples.yaml", `- kind: Deployment
+  namespace: dev
+  name: build`)
+
+	tests := []struct {
+		name         string
+		args         []string
+		env          string
+		expectedCode int
+		expectedOut  []string
+	}{
+		{
+			name:         "valid config",
+			args:         []string{"-config", validConfig},
+			expectedCode: 0,
+			expectedOut:  []string{"config is valid"},
+		},
+		{
+			name:         "config file from the environment",
+			env:          validConfig,
+			expectedCode: 0,
+			expectedOut:  []string{"config is valid"},
+		},
+		{
+			name:         "valid config resolved for the samples",
+			args:         []string{"-config", validConfig, "-samples", samples},
+			expectedCode: 0,
+			expectedOut: []string{
+				"PipelineRun dev/build: enforcedConfigLevel=resource ttlSecondsAfterFinished=60 successfulHistoryLimit=unset",
+				"TaskRun prod/lint: enforcedConfigLevel=resource ttlSecondsAfterFinished=300 successfulHistoryLimit=3",
+			},
+		},
+		{
+			name:         "invalid config",
+			args:         []string{"-config", invalidConfig, "-samples", samples},
+			expectedCode: 1,
+		},
+		{
+			name:         "invalid samples",
+			args:         []string{"-config", validConfig, "-samples", invalidSamples},
+			expectedCode: 1,
+		},
+		{
+			name:         "missing config file",
+			args:         []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+			expectedCode: 1,
+		},
+		{
+			name:         "no config file",
+			expectedCode: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envConfigFile, tc.env)
+			var stdout, stderr bytes.Buffer
+			code := run(tc.args, &stdout, &stderr)
+			assert.Equal(t, tc.expectedCode, code, "stderr: %s", stderr.String())
+			for _, out := range tc.expectedOut {
+				assert.Contains(t, stdout.String(), out)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"go.uber.org/zap"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"knative.dev/pkg/injection"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/signals"
+	"knative.dev/pkg/system"
+	"knative.dev/pkg/webhook/certificates/resources"
+)
+
+const (
+	// webhookServiceName is the name of the service which exposes the webhook server
+	webhookServiceName = "tekton-pruner-webhook"
+	// webhookConfigurationName is the name of the ValidatingWebhookConfiguration of the pruner
+	webhookConfigurationName = "validation.webhook.pruner.tekton.dev"
+	// validateConfigMapPath is the path which validates the pruner config map
+	validateConfigMapPath = "/validate-configmap"
+	// validateTektonPrunerPath is the path which validates the TektonPruner resources
+	validateTektonPrunerPath = "/validate-tektonpruner"
+	// envReportOnly enables the report-only mode, the invalid requests are accepted with warnings instead of being rejected
+	envReportOnly = "WEBHOOK_REPORT_ONLY"
+	// envMaxNamespaces limits the number of namespaces of the pruner config, not limited when unset or not positive
+	envMaxNamespaces = "WEBHOOK_MAX_NAMESPACES"
+	// envMaxSelectors limits the number of the pipelineRuns and taskRuns entries of all the namespaces,
+	// not limited when unset or not positive
+	envMaxSelectors = "WEBHOOK_MAX_SELECTORS"
+)
+
+// kubeClient is used to update the webhook configuration and to read the referenced config sources
+var kubeClient kubernetes.Interface
+
+// main function of the program
+func main() {
+	port := flag.Int("port", 8443, "Port number the webhook server listens on")
+	metricsPort := flag.Int("metrics-port", 9090, "Port number the metrics of the webhook are served on")
+	flag.Parse()
+
+	ctx := signals.NewContext()
+	logger := logging.FromContext(ctx)
+
+	// the servers can not share a port, the later one would fail to start or be shadowed
+	if err := validatePorts([]serverPort{
+		{name: "webhook", flag: "port", port: *port},
+		{name: "metrics", flag: "metrics-port", port: *metricsPort},
+	}); err != nil {
+		logger.Fatalw("invalid port configuration", zap.Error(err))
+	}
+
+	if err := serveMetrics(ctx, *metricsPort); err != nil {
+		logger.Fatalw("error on setting up the webhook metrics", zap.Error(err))
+	}
+
+	cfg := injection.ParseAndGetRESTConfigOrDie()
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		logger.Fatalw("error on creating kubernetes client", zap.Error(err))
+	}
+	kubeClient = client
+
+	// generate a self signed certificate and inject the CA into the webhook configuration
+	serverKey, serverCert, caCert, err := resources.CreateCerts(ctx, webhookServiceName, system.Namespace(), time.Now().AddDate(1, 0, 0))
+	if err != nil {
+		logger.Fatalw("error on creating webhook certificates", zap.Error(err))
+	}
+	certificate, err := tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		logger.Fatalw("error on loading webhook certificates", zap.Error(err))
+	}
+	if err := updateCABundle(ctx, caCert); err != nil {
+		logger.Fatalw("error on updating the webhook configuration", "name", webhookConfigurationName, zap.Error(err))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(validateConfigMapPath, validateConfigMap)
+	mux.HandleFunc(validateTektonPrunerPath, validateTektonPruner)
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", *port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			MinVersion:   tls.VersionTLS12,
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			logger.Errorw("error on shutting down the webhook server", zap.Error(err))
+		}
+	}()
+
+	logger.Infow("starting the webhook server", "port", *port)
+	if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		logger.Fatalw("webhook server stopped", zap.Error(err))
+	}
+}
+
+// serverPort is the port a server of the webhook listens on, set by the flag
+type serverPort struct {
+	name string
+	flag string
+	port int
+}
+
+// validatePorts returns an error when a port is out of range or when more than one server listens on the same port
+func validatePorts(ports []serverPort) error {
+	used := map[int]serverPort{}
+	for _, p := range ports {
+		if p.port < 1 || p.port > 65535 {
+			return fmt.Errorf("%s port %d set by -%s is out of range, must be between 1 and 65535", p.name, p.port, p.flag)
+		}
+		if other, found := used[p.port]; found {
+			return fmt.Errorf("%s port %d set by -%s collides with the %s port set by -%s, the servers must listen on different ports",
+				p.name, p.port, p.flag, other.name, other.flag)
+		}
+		used[p.port] = p
+	}
+	return nil
+}
+
+// updateCABundle injects the CA certificate into all the webhooks of the pruner webhook configuration
+func updateCABundle(ctx context.Context, caCert []byte) error {
+	webhookConfig, err := kubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, webhookConfigurationName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	for index := range webhookConfig.Webhooks {
+		webhookConfig.Webhooks[index].ClientConfig.CABundle = caCert
+	}
+
+	_, err = kubeClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Update(ctx, webhookConfig, metav1.UpdateOptions{})
+	return err
+}
+
+// validateConfigMap handles the AdmissionReview requests of the pruner config map
+func validateConfigMap(w http.ResponseWriter, r *http.Request) {
+	serveAdmission(w, r, validateConfigMapAdmission)
+}
+
+// validateTektonPruner handles the AdmissionReview requests of the TektonPruner resources
+func validateTektonPruner(w http.ResponseWriter, r *http.Request) {
+	serveAdmission(w, r, validateTektonPrunerAdmission)
+}
+
+// serveAdmission decodes the AdmissionReview request, admits it with the given function and writes the response
+func serveAdmission(w http.ResponseWriter, r *http.Request, admit func(context.Context, *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) {
+	logger := logging.FromContext(r.Context())
+	start := time.Now()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		admissionMetrics.recordAdmission(r.Context(), r.URL.Path, nil, reasonBadRequest, start)
+		http.Error(w, fmt.Sprintf("failed to read the request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ar := admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, &ar); err != nil {
+		admissionMetrics.recordAdmission(r.Context(), r.URL.Path, nil, reasonBadRequest, start)
+		http.Error(w, fmt.Sprintf("failed to decode the admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// a malformed review may have no request to admit
+	if ar.Request == nil {
+		admissionMetrics.recordAdmission(r.Context(), r.URL.Path, nil, reasonMissingRequest, start)
+		http.Error(w, "the admission review has no request", http.StatusBadRequest)
+		return
+	}
+
+	response := admit(r.Context(), ar.Request)
+	if isReportOnly() {
+		response = reportOnly(response)
+	}
+	admissionMetrics.recordAdmission(r.Context(), r.URL.Path, response, "", start)
+	response.UID = ar.Request.UID
+
+	responseReview := admissionv1.AdmissionReview{
+		TypeMeta: ar.TypeMeta,
+		Response: response,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(responseReview); err != nil {
+		logger.Errorw("error on writing the admission response", zap.Error(err))
+	}
+}
+
+// validateConfigMapAdmission validates the pruner config map. When the config map carries the
+// config source annotation, the referenced config is validated as well on best-effort basis,
+// the referenced config which can not be read does not block the request
+func validateConfigMapAdmission(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	logger := logging.FromContext(ctx)
+
+	configMap := &corev1.ConfigMap{}
+	if err := json.Unmarshal(req.Object.Raw, configMap); err != nil {
+		return denied(reasonDecode, fmt.Sprintf("failed to decode the config map: %v", err))
+	}
+
+	// only the pruner config map is validated
+	if configMap.Name != config.PrunerConfigMapName {
+		return allowed()
+	}
+
+	warnings, err := config.ValidatePrunerConfig(configMap.Data[config.PrunerGlobalConfigKey], configLimits())
+	if err != nil {
+		return denied(reasonInvalidConfig, fmt.Sprintf("invalid %s: %v", config.PrunerGlobalConfigKey, err))
+	}
+
+	if _, err := config.ParseLogLevel(configMap.Data[config.PrunerLogLevelKey]); err != nil {
+		return denied(reasonInvalidLogLevel, fmt.Sprintf("invalid %s: %v", config.PrunerLogLevelKey, err))
+	}
+
+	reference := configMap.Annotations[config.AnnotationConfigSource]
+	if reference == "" {
+		return allowedWithWarnings(warnings)
+	}
+
+	source, err := parseConfigSource(reference)
+	if err != nil {
+		return denied(reasonInvalidConfigSource, fmt.Sprintf("invalid annotation %s: %v", config.AnnotationConfigSource, err))
+	}
+
+	data, err := resolveConfigSource(ctx, configMap, source)
+	if err != nil {
+		logger.Warnw("unable to read the referenced config, skipping its validation",
+			"annotation", config.AnnotationConfigSource, "reference", reference, zap.Error(err))
+		warnings = append(warnings, fmt.Sprintf("config referenced by %s=%s was not validated: %v", config.AnnotationConfigSource, reference, err))
+		return allowedWithWarnings(warnings)
+	}
+
+	sourceWarnings, err := config.ValidatePrunerConfig(data, configLimits())
+	if err != nil {
+		// the validation error can quote the content, which is not echoed when it is read from another object
+		if source.external() {
+			return denied(reasonInvalidReferencedConfig, fmt.Sprintf("invalid config referenced by %s=%s", config.AnnotationConfigSource, reference))
+		}
+		return denied(reasonInvalidReferencedConfig, fmt.Sprintf("invalid config referenced by %s=%s: %v", config.AnnotationConfigSource, reference, err))
+	}
+
+	return allowedWithWarnings(append(warnings, sourceWarnings...))
+}
+
+// validateTektonPrunerAdmission validates the spec of a TektonPruner resource with the same rules
+// as a namespace entry of the pruner config map
+func validateTektonPrunerAdmission(_ context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	tektonPruner := struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		Spec              json.RawMessage `json:"spec,omitempty"`
+	}{}
+	if err := json.Unmarshal(req.Object.Raw, &tektonPruner); err != nil {
+		return denied(reasonDecode, fmt.Sprintf("failed to decode the TektonPruner: %v", err))
+	}
+
+	namespace := tektonPruner.Namespace
+	if namespace == "" {
+		namespace = req.Namespace
+	}
+
+	warnings, err := config.ValidateTektonPrunerSpec(namespace, tektonPruner.Spec, configLimits())
+	if err != nil {
+		return denied(reasonInvalidTektonPruner, fmt.Sprintf("invalid TektonPruner %s: %v", tektonPruner.Name, err))
+	}
+	return allowedWithWarnings(warnings)
+}
+
+// allowed returns an AdmissionResponse which accepts the request
+func allowed() *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+// allowedWithWarnings returns an AdmissionResponse which accepts the request with the given warnings
+func allowedWithWarnings(warnings []string) *admissionv1.AdmissionResponse {
+	response := allowed()
+	response.Warnings = warnings
+	return response
+}
+
+// isReportOnly returns true when the report-only mode is enabled on the webhook
+func isReportOnly() bool {
+	enabled, err := strconv.ParseBool(os.Getenv(envReportOnly))
+	return err == nil && enabled
+}
+
+// reportOnly turns a rejection into an AdmissionResponse which accepts the request,
+// the reason of the rejection is reported as a warning
+func reportOnly(response *admissionv1.AdmissionResponse) *admissionv1.AdmissionResponse {
+	if response.Allowed {
+		return response
+	}
+	message := "request would be denied"
+	if response.Result != nil && response.Result.Message != "" {
+		message = fmt.Sprintf("%s: %s", message, response.Result.Message)
+	}
+	return allowedWithWarnings(append(response.Warnings, message))
+}
+
+// denied returns an AdmissionResponse which rejects the request with the given message,
+// the category of the denial is kept as an audit annotation
+func denied(reason, message string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed:          false,
+		AuditAnnotations: map[string]string{auditAnnotationReason: reason},
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: message,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		},
+	}
+}
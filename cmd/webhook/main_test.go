@@ -0,0 +1,759 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	validConfig = `enforcedConfigLevel: namespace
+ttlSecondsAfterFinished: 300
+namespaces:
+  dev:
+    successfulHistoryLimit: 5
+    pipelineRuns:
+      - name: build
+        ttlSecondsAfterFinished: 60`
+
+	invalidConfig = `enforcedConfigLevel: bogus
+ttlSecondsAfterFinished: -5`
+)
+
+func newAdmissionRequest(t *testing.T, configMap *corev1.ConfigMap) *admissionv1.AdmissionRequest {
+	t.Helper()
+	raw, err := json.Marshal(configMap)
+	if err != nil {
+		t.Fatalf("failed to marshal the config map: %v", err)
+	}
+	return &admissionv1.AdmissionRequest{
+		UID:    types.UID("test-uid"),
+		Object: runtime.RawExtension{Raw: raw},
+	}
+}
+
+func newPrunerConfigMap(data map[string]string, annotations map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        config.PrunerConfigMapName,
+			Namespace:   "tekton-pipelines",
+			Annotations: annotations,
+		},
+		Data: data,
+	}
+}
+
+func TestValidateConfigMapAdmission(t *testing.T) {
+	tests := []struct {
+		name             string
+		configMap        *corev1.ConfigMap
+		wantAllowed      bool
+		wantMessage      string
+		wantNotInMessage string
+		wantWarnings     bool
+		clientObjects    []runtime.Object
+	}{
+		{
+			name:        "valid config",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: validConfig}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "empty config",
+			configMap:   newPrunerConfigMap(nil, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "invalid config",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: invalidConfig}, nil),
+			wantAllowed: false,
+			wantMessage: "ttlSecondsAfterFinished: Invalid value: -5",
+		},
+		{
+			name: "malformed yaml",
+			configMap: newPrunerConfigMap(map[string]string{
+				config.PrunerGlobalConfigKey: "ttlSecondsAfterFinished: [",
+			}, nil),
+			wantAllowed: false,
+			wantMessage: "failed to parse",
+		},
+		{
+			name: "other config maps are not validated",
+			configMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "tekton-pipelines"},
+				Data:       map[string]string{config.PrunerGlobalConfigKey: invalidConfig},
+			},
+			wantAllowed: true,
+		},
+		{
+			name: "resource spec without name and selector",
+			configMap: newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: `namespaces:
+  dev:
+    taskRuns:
+      - ttlSecondsAfterFinished: 60`}, nil),
+			wantAllowed: false,
+			wantMessage: "namespaces[dev].taskRuns[0]: Required value",
+		},
+		{
+			name: "enforced globally without a retention setting",
+			configMap: newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: `enforcedConfigLevel: global
+namespaces:
+  dev:
+    ttlSecondsAfterFinished: 60`}, nil),
+			wantAllowed:  true,
+			wantWarnings: true,
+		},
+		{
+			name:        "enforced globally with a ttl",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "enforcedConfigLevel: global\nttlSecondsAfterFinished: 60"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "enforced globally with a history limit",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "enforcedConfigLevel: global\nfailedHistoryLimit: 3"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "enforced on namespace without a global retention setting",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "enforcedConfigLevel: namespace\nnamespaces:\n  dev:\n    ttlSecondsAfterFinished: 60"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:         "historyLimit along with the split limits",
+			configMap:    newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "historyLimit: 5\nsuccessfulHistoryLimit: 3"}, nil),
+			wantAllowed:  true,
+			wantWarnings: true,
+		},
+		{
+			name: "historyLimit along with the split limits on a resource",
+			configMap: newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: `namespaces:
+  dev:
+    pipelineRuns:
+      - name: build
+        historyLimit: 5
+        failedHistoryLimit: 2`}, nil),
+			wantAllowed:  true,
+			wantWarnings: true,
+		},
+		{
+			name:        "historyLimit alone",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "historyLimit: 5"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "successfulHistoryLimit alone",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "successfulHistoryLimit: 5"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "failedHistoryLimit alone",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "failedHistoryLimit: 5"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "valid exclude annotations",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "excludeAnnotations:\n  backup: required\n  example.com/keep: \"\""}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "retention",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "successfulHistoryLimit: 20\nminRetained: 5\nmaxRetentionAgeSeconds: 604800"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "invalid retention",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "minRetained: -1\nmaxRetentionAgeSeconds: -5"}, nil),
+			wantAllowed: false,
+			wantMessage: "maxRetentionAgeSeconds: Invalid value: -5",
+		},
+		{
+			name:        "failure buckets",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "failureReasonMapping:\n  PipelineRunTimeout: timeout\nfailedHistoryLimitsByBucket:\n  timeout: 3"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "invalid failure bucket limit",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "failureReasonMapping:\n  PipelineRunTimeout: timeout\nfailedHistoryLimitsByBucket:\n  timeout: -1"}, nil),
+			wantAllowed: false,
+			wantMessage: "failedHistoryLimitsByBucket[timeout]: Invalid value: -1",
+		},
+		{
+			name:        "timezone",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "timezone: Europe/Berlin\nretainCalendarDays: 1"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "invalid timezone",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "timezone: Nowhere/Atlantis"}, nil),
+			wantAllowed: false,
+			wantMessage: "timezone: Invalid value: \"Nowhere/Atlantis\"",
+		},
+		{
+			name:        "local timezone",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "timezone: Local"}, nil),
+			wantAllowed: false,
+			wantMessage: "timezone: Invalid value: \"Local\": must be an IANA timezone name",
+		},
+		{
+			name:        "quarantine",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "quarantine:\n  matchLabels:\n    security.example.com/scan: failed\n  ttlSecondsAfterFinished: 2592000\n  historyLimit: 50"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "ephemeral",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "ephemeral:\n  annotationKey: tekton-pruner.io/ephemeral\n  ttlSecondsAfterFinished: 60\n  historyLimit: 1"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "ephemeral without a ttl or a limit",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "ephemeral:\n  annotationKey: tekton-pruner.io/ephemeral"}, nil),
+			wantAllowed: false,
+			wantMessage: "ephemeral: Required value: ttlSecondsAfterFinished or historyLimit must be set",
+		},
+		{
+			name:        "negative ephemeral ttl",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "ephemeral:\n  ttlSecondsAfterFinished: -1"}, nil),
+			wantAllowed: false,
+			wantMessage: "ephemeral.ttlSecondsAfterFinished: Invalid value: -1: must be greater than or equal to 0",
+		},
+		{
+			name:        "feature flags",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "featureFlags:\n  ttlKeepLatest: true\n  retainedByAnnotation: false"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "unknown feature flag",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "featureFlags:\n  softDelete: true"}, nil),
+			wantAllowed: false,
+			wantMessage: "featureFlags[softDelete]: Unsupported value: \"softDelete\": supported values: \"retainedByAnnotation\", \"ttlKeepLatest\"",
+		},
+		{
+			name:        "max completed runs per namespace",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "maxCompletedRunsPerNamespace: 500"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "negative max completed runs per namespace",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "maxCompletedRunsPerNamespace: -1"}, nil),
+			wantAllowed: false,
+			wantMessage: "maxCompletedRunsPerNamespace: Invalid value: -1: must be greater than or equal to 0",
+		},
+		{
+			name:        "max running age",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "maxRunningAgeSeconds: 86400\ndeleteStuckRuns: true"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "zero max running age",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "maxRunningAgeSeconds: 0"}, nil),
+			wantAllowed: false,
+			wantMessage: "maxRunningAgeSeconds: Invalid value: 0: must be greater than 0",
+		},
+		{
+			name:        "delete stuck runs without a max running age",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "deleteStuckRuns: true"}, nil),
+			wantAllowed: false,
+			wantMessage: "maxRunningAgeSeconds: Required value: must be set when deleteStuckRuns is set",
+		},
+		{
+			name:        "quarantine without a match",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "quarantine:\n  historyLimit: 50"}, nil),
+			wantAllowed: false,
+			wantMessage: "quarantine: Required value: matchLabels or matchAnnotations must be set",
+		},
+		{
+			name:        "invalid quarantine history limit",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "quarantine:\n  matchAnnotations:\n    security.example.com/quarantine: \"\"\n  historyLimit: -1"}, nil),
+			wantAllowed: false,
+			wantMessage: "quarantine.historyLimit: Invalid value: -1",
+		},
+		{
+			name:        "invalid ttl jitter",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "ttlSecondsAfterFinished: 600\nttlJitterSeconds: -10"}, nil),
+			wantAllowed: false,
+			wantMessage: "ttlJitterSeconds: Invalid value: -10",
+		},
+		{
+			name:        "invalid exclude annotation key",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "excludeAnnotations:\n  \"bad key\": required"}, nil),
+			wantAllowed: false,
+			wantMessage: "excludeAnnotations[bad key]: Invalid value",
+		},
+		{
+			name: "resource spec selecting by owner reference",
+			configMap: newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: `namespaces:
+  dev:
+    pipelineRuns:
+      - selector:
+          - matchOwnerReferences:
+              - kind: EventListener
+        successfulHistoryLimit: 1`}, nil),
+			wantAllowed: true,
+		},
+		{
+			name: "owner reference selector without kind",
+			configMap: newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: `namespaces:
+  dev:
+    pipelineRuns:
+      - selector:
+          - matchOwnerReferences:
+              - name: listener
+        successfulHistoryLimit: 1`}, nil),
+			wantAllowed: false,
+			wantMessage: "namespaces[dev].pipelineRuns[0].selector[0].matchOwnerReferences[0].kind: Required value",
+		},
+		{
+			name: "invalid ttl override",
+			configMap: newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: `namespaces:
+  dev:
+    ttlOverrides:
+      - labelSelector: "priority in (low"
+        ttlSecondsAfterFinished: 60`}, nil),
+			wantAllowed: false,
+			wantMessage: "namespaces[dev].ttlOverrides[0].labelSelector: Invalid value",
+		},
+		{
+			name: "valid reference to a key of the same config map",
+			configMap: newPrunerConfigMap(
+				map[string]string{"source": validConfig},
+				map[string]string{config.AnnotationConfigSource: "source"},
+			),
+			wantAllowed: true,
+		},
+		{
+			name: "invalid reference to a key of the same config map",
+			configMap: newPrunerConfigMap(
+				map[string]string{"source": invalidConfig},
+				map[string]string{config.AnnotationConfigSource: "source"},
+			),
+			wantAllowed: false,
+			wantMessage: "invalid config referenced by " + config.AnnotationConfigSource + "=source",
+		},
+		{
+			name:      "valid reference to a secret",
+			configMap: newPrunerConfigMap(nil, map[string]string{config.AnnotationConfigSource: "secret/tekton-pruner-config-source/config"}),
+			clientObjects: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: config.PrunerConfigSourceName, Namespace: "tekton-pipelines"},
+				Data:       map[string][]byte{"config": []byte(validConfig)},
+			}},
+			wantAllowed: true,
+		},
+		{
+			name:      "invalid reference to a config map",
+			configMap: newPrunerConfigMap(nil, map[string]string{config.AnnotationConfigSource: "configmap/tekton-pruner-config-source/config"}),
+			clientObjects: []runtime.Object{&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: config.PrunerConfigSourceName, Namespace: "tekton-pipelines"},
+				Data:       map[string]string{"config": invalidConfig},
+			}},
+			wantAllowed:      false,
+			wantMessage:      "invalid config referenced by " + config.AnnotationConfigSource + "=configmap/tekton-pruner-config-source/config",
+			wantNotInMessage: "bogus",
+		},
+		{
+			name:      "invalid reference to a secret does not echo its content",
+			configMap: newPrunerConfigMap(nil, map[string]string{config.AnnotationConfigSource: "secret/tekton-pruner-config-source/config"}),
+			clientObjects: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: config.PrunerConfigSourceName, Namespace: "tekton-pipelines"},
+				Data:       map[string][]byte{"config": []byte("s3cr3t-token")},
+			}},
+			wantAllowed:      false,
+			wantMessage:      "invalid config referenced by " + config.AnnotationConfigSource,
+			wantNotInMessage: "s3cr3t-token",
+		},
+		{
+			name:         "unreadable reference is allowed with a warning",
+			configMap:    newPrunerConfigMap(nil, map[string]string{config.AnnotationConfigSource: "secret/tekton-pruner-config-source/config"}),
+			wantAllowed:  true,
+			wantWarnings: true,
+		},
+		{
+			name:        "reference to another secret",
+			configMap:   newPrunerConfigMap(nil, map[string]string{config.AnnotationConfigSource: "secret/registry-credentials/token"}),
+			wantAllowed: false,
+			wantMessage: "unsupported config source reference",
+		},
+		{
+			name:        "malformed reference",
+			configMap:   newPrunerConfigMap(nil, map[string]string{config.AnnotationConfigSource: "deployment/foo/bar"}),
+			wantAllowed: false,
+			wantMessage: "unsupported config source reference",
+		},
+		{
+			name:        "log level",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: validConfig, config.PrunerLogLevelKey: "debug"}, nil),
+			wantAllowed: true,
+		},
+		{
+			name:        "invalid log level",
+			configMap:   newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: validConfig, config.PrunerLogLevelKey: "verbose"}, nil),
+			wantAllowed: false,
+			wantMessage: "invalid log-level",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeClient = fake.NewSimpleClientset(tt.clientObjects...)
+			defer func() { kubeClient = nil }()
+
+			response := validateConfigMapAdmission(context.Background(), newAdmissionRequest(t, tt.configMap))
+			assert.Equal(t, tt.wantAllowed, response.Allowed)
+			if tt.wantMessage != "" && assert.NotNil(t, response.Result) {
+				assert.Contains(t, response.Result.Message, tt.wantMessage)
+			}
+			if tt.wantNotInMessage != "" && response.Result != nil {
+				assert.NotContains(t, response.Result.Message, tt.wantNotInMessage)
+			}
+			assert.Equal(t, tt.wantWarnings, len(response.Warnings) > 0)
+		})
+	}
+}
+
+func TestValidateConfigMap(t *testing.T) {
+	configMap := newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: invalidConfig}, nil)
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request:  newAdmissionRequest(t, configMap),
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("failed to marshal the admission review: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	validateConfigMap(recorder, httptest.NewRequest(http.MethodPost, validateConfigMapPath, bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	responseReview := admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &responseReview); err != nil {
+		t.Fatalf("failed to decode the admission response: %v", err)
+	}
+	if responseReview.Response == nil {
+		t.Fatal("admission response is missing")
+	}
+	assert.Equal(t, types.UID("test-uid"), responseReview.Response.UID)
+	assert.False(t, responseReview.Response.Allowed)
+	assert.True(t, strings.HasPrefix(responseReview.Response.Result.Message, "invalid "+config.PrunerGlobalConfigKey))
+}
+
+func TestValidateConfigMapWithoutRequest(t *testing.T) {
+	body := []byte(`{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview"}`)
+
+	recorder := httptest.NewRecorder()
+	validateConfigMap(recorder, httptest.NewRequest(http.MethodPost, validateConfigMapPath, bytes.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestValidateEnforcedConfigLevels(t *testing.T) {
+	levels := []config.EnforcedConfigLevel{config.EnforcedConfigLevelGlobal, config.EnforcedConfigLevelNamespace, config.EnforcedConfigLevelResource}
+	// narrower lists the nested levels which open the config to a narrower scope than the enclosing level
+	narrower := map[config.EnforcedConfigLevel][]config.EnforcedConfigLevel{
+		config.EnforcedConfigLevelGlobal:    {config.EnforcedConfigLevelNamespace, config.EnforcedConfigLevelResource},
+		config.EnforcedConfigLevelNamespace: {config.EnforcedConfigLevelResource},
+	}
+
+	for _, enclosing := range levels {
+		for _, nested := range levels {
+			wantAllowed := true
+			for _, level := range narrower[enclosing] {
+				if level == nested {
+					wantAllowed = false
+				}
+			}
+
+			t.Run(fmt.Sprintf("global %s, namespace %s", enclosing, nested), func(t *testing.T) {
+				configMap := newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: fmt.Sprintf(`enforcedConfigLevel: %s
+namespaces:
+  dev:
+    enforcedConfigLevel: %s`, enclosing, nested)}, nil)
+				response := validateConfigMapAdmission(context.Background(), newAdmissionRequest(t, configMap))
+				assert.Equal(t, wantAllowed, response.Allowed)
+				if !wantAllowed && assert.NotNil(t, response.Result) {
+					assert.Contains(t, response.Result.Message, "namespaces[dev].enforcedConfigLevel: Invalid value")
+				}
+			})
+
+			t.Run(fmt.Sprintf("namespace %s, resource %s", enclosing, nested), func(t *testing.T) {
+				configMap := newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: fmt.Sprintf(`namespaces:
+  dev:
+    enforcedConfigLevel: %s
+    taskRuns:
+      - name: build
+        enforcedConfigLevel: %s`, enclosing, nested)}, nil)
+				response := validateConfigMapAdmission(context.Background(), newAdmissionRequest(t, configMap))
+				assert.Equal(t, wantAllowed, response.Allowed)
+				if !wantAllowed && assert.NotNil(t, response.Result) {
+					assert.Contains(t, response.Result.Message, "namespaces[dev].taskRuns[0].enforcedConfigLevel: Invalid value")
+				}
+			})
+		}
+	}
+
+	// the resource level is validated against the global level when the namespace level is not set
+	configMap := newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: `enforcedConfigLevel: namespace
+namespaces:
+  dev:
+    pipelineRuns:
+      - name: build
+        enforcedConfigLevel: resource`}, nil)
+	response := validateConfigMapAdmission(context.Background(), newAdmissionRequest(t, configMap))
+	assert.False(t, response.Allowed)
+}
+
+func TestValidateConfigMapReportOnly(t *testing.T) {
+	tests := []struct {
+		name        string
+		reportOnly  string
+		wantAllowed bool
+	}{
+		{name: "report-only", reportOnly: "true", wantAllowed: true},
+		{name: "enforced", reportOnly: "false", wantAllowed: false},
+		{name: "unset", reportOnly: "", wantAllowed: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envReportOnly, tc.reportOnly)
+
+			configMap := newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: invalidConfig}, nil)
+			body, err := json.Marshal(admissionv1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+				Request:  newAdmissionRequest(t, configMap),
+			})
+			if err != nil {
+				t.Fatalf("failed to marshal the admission review: %v", err)
+			}
+
+			recorder := httptest.NewRecorder()
+			validateConfigMap(recorder, httptest.NewRequest(http.MethodPost, validateConfigMapPath, bytes.NewReader(body)))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			responseReview := admissionv1.AdmissionReview{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &responseReview); err != nil {
+				t.Fatalf("failed to decode the admission response: %v", err)
+			}
+			response := responseReview.Response
+			if response == nil {
+				t.Fatal("admission response is missing")
+			}
+			assert.Equal(t, types.UID("test-uid"), response.UID)
+			assert.Equal(t, tc.wantAllowed, response.Allowed)
+			if !tc.wantAllowed {
+				assert.Empty(t, response.Warnings)
+				return
+			}
+			assert.Nil(t, response.Result)
+			if assert.Len(t, response.Warnings, 1) {
+				assert.Contains(t, response.Warnings[0], "invalid "+config.PrunerGlobalConfigKey)
+			}
+		})
+	}
+}
+
+func TestReportOnlyKeepsWarnings(t *testing.T) {
+	response := reportOnly(&admissionv1.AdmissionResponse{Allowed: true, Warnings: []string{"deprecated field"}})
+	assert.True(t, response.Allowed)
+	assert.Equal(t, []string{"deprecated field"}, response.Warnings)
+}
+
+func newTektonPrunerAdmissionRequest(t *testing.T, namespace, spec string) *admissionv1.AdmissionRequest {
+	t.Helper()
+	specJSON, err := yaml.YAMLToJSON([]byte(spec))
+	if err != nil {
+		t.Fatalf("failed to convert the spec: %v", err)
+	}
+	raw := fmt.Sprintf(`{"apiVersion":"pruner.tekton.dev/v1alpha1","kind":"TektonPruner","metadata":{"name":"pruner","namespace":%q},"spec":%s}`, namespace, specJSON)
+	return &admissionv1.AdmissionRequest{
+		UID:       types.UID("test-uid"),
+		Namespace: namespace,
+		Object:    runtime.RawExtension{Raw: []byte(raw)},
+	}
+}
+
+func TestValidateTektonPrunerAdmission(t *testing.T) {
+	tests := []struct {
+		name         string
+		spec         string
+		wantAllowed  bool
+		wantMessage  string
+		wantWarnings bool
+	}{
+		{
+			name:        "valid spec",
+			spec:        "successfulHistoryLimit: 5\npipelineRuns:\n  - name: build\n    ttlSecondsAfterFinished: 60",
+			wantAllowed: true,
+		},
+		{
+			name:        "negative history limit",
+			spec:        "failedHistoryLimit: -1",
+			wantAllowed: false,
+			wantMessage: "failedHistoryLimit: Invalid value: -1: must be greater than or equal to 0",
+		},
+		{
+			name:        "invalid ttl of the runs without results",
+			spec:        "ttlSecondsAfterFinishedWithoutResults: -2",
+			wantAllowed: false,
+			wantMessage: "ttlSecondsAfterFinishedWithoutResults: Invalid value: -2: must be greater than or equal to -1",
+		},
+		{
+			name:        "resource spec without name and selector",
+			spec:        "taskRuns:\n  - ttlSecondsAfterFinished: 60",
+			wantAllowed: false,
+			wantMessage: "taskRuns[0]: Required value: either name or selector must be specified",
+		},
+		{
+			name:        "unsupported enforced config level",
+			spec:        "enforcedConfigLevel: bogus",
+			wantAllowed: false,
+			wantMessage: "enforcedConfigLevel: Unsupported value: \"bogus\"",
+		},
+		{
+			name:        "invalid ttl override",
+			spec:        "ttlOverrides:\n  - labelSelector: \"priority in (low\"\n    ttlSecondsAfterFinished: 60",
+			wantAllowed: false,
+			wantMessage: "ttlOverrides[0].labelSelector: Invalid value",
+		},
+		{
+			name:         "historyLimit along with the split limits",
+			spec:         "historyLimit: 5\nsuccessfulHistoryLimit: 3",
+			wantAllowed:  true,
+			wantWarnings: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := validateTektonPrunerAdmission(context.Background(), newTektonPrunerAdmissionRequest(t, "dev", tt.spec))
+			assert.Equal(t, tt.wantAllowed, response.Allowed)
+			assert.Equal(t, tt.wantWarnings, len(response.Warnings) > 0)
+			if tt.wantAllowed {
+				return
+			}
+			if assert.NotNil(t, response.Result) {
+				assert.Contains(t, response.Result.Message, "spec."+tt.wantMessage)
+			}
+
+			// the same spec as a namespace of the config map is rejected with the same message
+			indented := "    " + strings.ReplaceAll(tt.spec, "\n", "\n    ")
+			configMap := newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: "namespaces:\n  dev:\n" + indented}, nil)
+			configMapResponse := validateConfigMapAdmission(context.Background(), newAdmissionRequest(t, configMap))
+			assert.False(t, configMapResponse.Allowed)
+			if assert.NotNil(t, configMapResponse.Result) {
+				assert.Contains(t, configMapResponse.Result.Message, "namespaces[dev]."+tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestValidateConfigLimits(t *testing.T) {
+	const limitedConfig = `namespaces:
+  dev:
+    pipelineRuns:
+      - name: build
+        ttlSecondsAfterFinished: 60
+    taskRuns:
+      - name: lint
+        ttlSecondsAfterFinished: 60
+  prod:
+    pipelineRuns:
+      - name: deploy
+        ttlSecondsAfterFinished: 600`
+
+	tests := []struct {
+		name          string
+		maxNamespaces string
+		maxSelectors  string
+		wantErr       string
+	}{
+		{name: "no limits"},
+		{name: "under the limits", maxNamespaces: "3", maxSelectors: "4"},
+		{name: "at the limits", maxNamespaces: "2", maxSelectors: "3"},
+		{name: "over the namespace limit", maxNamespaces: "1", wantErr: "namespaces: Too many: 2: must have at most 1 items"},
+		{name: "over the selector limit", maxSelectors: "2", wantErr: "holds 3 pipelineRuns and taskRuns entries, must have at most 2"},
+		{name: "invalid limit is ignored", maxNamespaces: "many"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envMaxNamespaces, tc.maxNamespaces)
+			t.Setenv(envMaxSelectors, tc.maxSelectors)
+
+			_, err := config.ValidatePrunerConfig(limitedConfig, configLimits())
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.wantErr)
+			}
+		})
+	}
+
+	t.Run("TektonPruner", func(t *testing.T) {
+		t.Setenv(envMaxSelectors, "1")
+		_, err := config.ValidateTektonPrunerSpec("dev", []byte(`{"pipelineRuns":[{"name":"build","ttlSecondsAfterFinished":60},{"name":"deploy","ttlSecondsAfterFinished":60}]}`), configLimits())
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "spec: Forbidden: holds 2 pipelineRuns and taskRuns entries, must have at most 1")
+		}
+	})
+}
+
+func TestValidatePorts(t *testing.T) {
+	tests := []struct {
+		name        string
+		ports       []serverPort
+		wantMessage string
+	}{
+		{
+			name: "distinct ports",
+			ports: []serverPort{
+				{name: "webhook", flag: "port", port: 8443},
+				{name: "metrics", flag: "metrics-port", port: 9090},
+			},
+		},
+		{
+			name: "metrics on the webhook port",
+			ports: []serverPort{
+				{name: "webhook", flag: "port", port: 8443},
+				{name: "metrics", flag: "metrics-port", port: 8443},
+			},
+			wantMessage: "metrics port 8443 set by -metrics-port collides with the webhook port set by -port",
+		},
+		{
+			name: "port out of range",
+			ports: []serverPort{
+				{name: "webhook", flag: "port", port: 8443},
+				{name: "metrics", flag: "metrics-port", port: 70000},
+			},
+			wantMessage: "metrics port 70000 set by -metrics-port is out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePorts(tt.ports)
+			if tt.wantMessage == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.uber.org/zap"
+	admissionv1 "k8s.io/api/admission/v1"
+	"knative.dev/pkg/logging"
+)
+
+const (
+	// metricAdmissionRequests counts the admission requests received by the webhook
+	metricAdmissionRequests = "tekton_pruner_webhook_admission_requests"
+	// metricAdmissionAllowed counts the admission requests allowed by the webhook
+	metricAdmissionAllowed = "tekton_pruner_webhook_admission_allowed"
+	// metricAdmissionDenied counts the admission requests denied by the webhook
+	metricAdmissionDenied = "tekton_pruner_webhook_admission_denied"
+	// metricAdmissionDuration measures the time spent on the admission requests
+	metricAdmissionDuration = "tekton_pruner_webhook_admission_duration"
+
+	// labelPath is the path of the webhook which served the request
+	labelPath = "path"
+	// labelReason is the category of the denial
+	labelReason = "reason"
+
+	// auditAnnotationReason holds the category of the denial on the AdmissionResponse
+	auditAnnotationReason = "denialReason"
+)
+
+// the categories of the denials
+const (
+	// reasonBadRequest is used when the AdmissionReview can not be read or decoded
+	reasonBadRequest = "bad_request"
+	// reasonMissingRequest is used when the AdmissionReview has no request
+	reasonMissingRequest = "missing_request"
+	// reasonDecode is used when the object under review can not be decoded
+	reasonDecode = "decode"
+	// reasonInvalidConfig is used when the pruner config is invalid
+	reasonInvalidConfig = "invalid_config"
+	// reasonInvalidConfigSource is used when the config source annotation is invalid
+	reasonInvalidConfigSource = "invalid_config_source"
+	// reasonInvalidReferencedConfig is used when the config referenced by the config source annotation is invalid
+	reasonInvalidReferencedConfig = "invalid_referenced_config"
+	// reasonInvalidTektonPruner is used when the spec of a TektonPruner is invalid
+	reasonInvalidTektonPruner = "invalid_tektonpruner"
+	// reasonInvalidLogLevel is used when the log level of the pruner config map is invalid
+	reasonInvalidLogLevel = "invalid_log_level"
+)
+
+// admissionMetrics holds the instruments of the webhook, it is nil until the metrics are set up,
+// nothing is recorded then
+var admissionMetrics *webhookMetrics
+
+// webhookMetrics records the outcome of the admission requests
+type webhookMetrics struct {
+	requests metric.Int64Counter
+	allowed  metric.Int64Counter
+	denied   metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+// newWebhookMetrics creates the instruments of the webhook on the global meter provider
+func newWebhookMetrics() *webhookMetrics {
+	meter := otel.Meter("tekton_pruner_webhook")
+
+	m := &webhookMetrics{}
+	m.requests, _ = meter.Int64Counter(
+		metricAdmissionRequests,
+		metric.WithDescription("Total number of admission requests received by the webhook"),
+		metric.WithUnit("1"),
+	)
+	m.allowed, _ = meter.Int64Counter(
+		metricAdmissionAllowed,
+		metric.WithDescription("Total number of admission requests allowed by the webhook"),
+		metric.WithUnit("1"),
+	)
+	m.denied, _ = meter.Int64Counter(
+		metricAdmissionDenied,
+		metric.WithDescription("Total number of admission requests denied by the webhook"),
+		metric.WithUnit("1"),
+	)
+	m.duration, _ = meter.Float64Histogram(
+		metricAdmissionDuration,
+		metric.WithDescription("Time spent on the admission requests"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0),
+	)
+	return m
+}
+
+// serveMetrics exports the metrics of the webhook in the Prometheus format on the given port at /metrics
+func serveMetrics(ctx context.Context, port int) error {
+	logger := logging.FromContext(ctx)
+
+	exporter, err := prometheus.New()
+	if err != nil {
+		return err
+	}
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(exporter))
+	otel.SetMeterProvider(provider)
+	admissionMetrics = newWebhookMetrics()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			logger.Errorw("error on shutting down the metrics server", zap.Error(err))
+		}
+		if err := provider.Shutdown(context.Background()); err != nil {
+			logger.Errorw("error on shutting down the meter provider", zap.Error(err))
+		}
+	}()
+
+	go func() {
+		logger.Infow("starting the metrics server", "port", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Errorw("metrics server stopped", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// recordAdmission records a request served on the path with its outcome, a nil response
+// is a request which was denied before being admitted, with the given reason
+func (m *webhookMetrics) recordAdmission(ctx context.Context, path string, response *admissionv1.AdmissionResponse, reason string, start time.Time) {
+	if m == nil {
+		return
+	}
+	pathAttrs := metric.WithAttributes(attribute.String(labelPath, path))
+	m.requests.Add(ctx, 1, pathAttrs)
+	m.duration.Record(ctx, time.Since(start).Seconds(), pathAttrs)
+
+	if response != nil && response.Allowed {
+		m.allowed.Add(ctx, 1, pathAttrs)
+		return
+	}
+	if response != nil {
+		reason = response.AuditAnnotations[auditAnnotationReason]
+	}
+	m.denied.Add(ctx, 1, metric.WithAttributes(attribute.String(labelPath, path), attribute.String(labelReason, reason)))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newTestMetrics replaces the webhook metrics with ones recorded on a manual reader
+func newTestMetrics(t *testing.T) *sdkmetric.ManualReader {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	previousProvider := otel.GetMeterProvider()
+	previousMetrics := admissionMetrics
+	otel.SetMeterProvider(provider)
+	admissionMetrics = newWebhookMetrics()
+	t.Cleanup(func() {
+		admissionMetrics = previousMetrics
+		otel.SetMeterProvider(previousProvider)
+		_ = provider.Shutdown(context.Background())
+	})
+	return reader
+}
+
+// collectCounts returns the values of the given counter keyed by the reason label
+func collectCounts(t *testing.T, reader *sdkmetric.ManualReader, name string) map[string]int64 {
+	t.Helper()
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	counts := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				t.Fatalf("metric %s is not an int64 sum", name)
+			}
+			for _, point := range sum.DataPoints {
+				reason, _ := point.Attributes.Value(attribute.Key(labelReason))
+				counts[reason.AsString()] += point.Value
+			}
+		}
+	}
+	return counts
+}
+
+// postConfigMap sends the pruner config map with the given config to the webhook
+func postConfigMap(t *testing.T, globalConfig string) {
+	t.Helper()
+	configMap := newPrunerConfigMap(map[string]string{config.PrunerGlobalConfigKey: globalConfig}, nil)
+	body, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request:  newAdmissionRequest(t, configMap),
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal the admission review: %v", err)
+	}
+	validateConfigMap(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, validateConfigMapPath, bytes.NewReader(body)))
+}
+
+func TestAdmissionMetrics(t *testing.T) {
+	reader := newTestMetrics(t)
+
+	postConfigMap(t, "ttlSecondsAfterFinished: 600")
+	assert.Equal(t, map[string]int64{"": 1}, collectCounts(t, reader, metricAdmissionRequests))
+	assert.Equal(t, map[string]int64{"": 1}, collectCounts(t, reader, metricAdmissionAllowed))
+	assert.Empty(t, collectCounts(t, reader, metricAdmissionDenied))
+
+	postConfigMap(t, invalidConfig)
+	assert.Equal(t, map[string]int64{"": 2}, collectCounts(t, reader, metricAdmissionRequests))
+	assert.Equal(t, map[string]int64{"": 1}, collectCounts(t, reader, metricAdmissionAllowed))
+	assert.Equal(t, map[string]int64{reasonInvalidConfig: 1}, collectCounts(t, reader, metricAdmissionDenied))
+
+	// an AdmissionReview which can not be decoded is denied as a bad request
+	validateConfigMap(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, validateConfigMapPath, strings.NewReader("{")))
+	assert.Equal(t, map[string]int64{"": 3}, collectCounts(t, reader, metricAdmissionRequests))
+	assert.Equal(t, map[string]int64{reasonInvalidConfig: 1, reasonBadRequest: 1}, collectCounts(t, reader, metricAdmissionDenied))
+}
+
+func TestAdmissionReviewWithoutRequest(t *testing.T) {
+	reader := newTestMetrics(t)
+	body, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal the admission review: %v", err)
+	}
+
+	for _, serve := range []http.HandlerFunc{validateConfigMap, validateTektonPruner} {
+		recorder := httptest.NewRecorder()
+		serve(recorder, httptest.NewRequest(http.MethodPost, validateConfigMapPath, bytes.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "the admission review has no request")
+	}
+
+	assert.Equal(t, map[string]int64{reasonMissingRequest: 2}, collectCounts(t, reader, metricAdmissionDenied))
+	assert.Empty(t, collectCounts(t, reader, metricAdmissionAllowed))
+}
+
+func TestAdmissionMetricsDisabled(t *testing.T) {
+	// nothing is recorded until the metrics are set up
+	var m *webhookMetrics
+	m.recordAdmission(context.Background(), validateConfigMapPath, allowed(), "", time.Now())
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// configLimits returns the limits of the config set on the webhook environment
+func configLimits() config.ConfigLimits {
+	return config.ConfigLimits{
+		MaxNamespaces: getLimit(envMaxNamespaces),
+		MaxSelectors:  getLimit(envMaxSelectors),
+	}
+}
+
+// getLimit returns the limit set on the environment variable, 0 when it is not set or invalid
+func getLimit(envKey string) int {
+	limit, err := config.GetEnvValueAsInt(envKey, 0)
+	if err != nil {
+		return 0
+	}
+	return limit
+}
+
+// configSource represents a reference to the config content, parsed from the config source annotation
+type configSource struct {
+	kind string
+	name string
+	key  string
+}
+
+// parseConfigSource parses the config source annotation value. The reference can be a key
+// on the same config map or "<configmap|secret>/<name>/<key>" on the namespace of the config map,
+// where only the config map or the secret named config.PrunerConfigSourceName is supported
+func parseConfigSource(reference string) (*configSource, error) {
+	parts := strings.Split(reference, "/")
+	switch len(parts) {
+	case 1:
+		if parts[0] != "" {
+			return &configSource{key: parts[0]}, nil
+		}
+	case 3:
+		kind := strings.ToLower(parts[0])
+		if (kind == "configmap" || kind == "secret") && parts[1] == config.PrunerConfigSourceName && parts[2] != "" {
+			return &configSource{kind: kind, name: parts[1], key: parts[2]}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported config source reference %q, expected '<key>' or '<configmap|secret>/%s/<key>'",
+		reference, config.PrunerConfigSourceName)
+}
+
+// external returns true when the config content is read from another object than the pruner config map
+func (cs *configSource) external() bool {
+	return cs.kind != ""
+}
+
+// resolveConfigSource returns the config content referenced by the config source
+func resolveConfigSource(ctx context.Context, configMap *corev1.ConfigMap, source *configSource) (string, error) {
+	switch source.kind {
+	case "":
+		data, found := configMap.Data[source.key]
+		if !found {
+			return "", fmt.Errorf("key %q not found on the config map %s", source.key, configMap.Name)
+		}
+		return data, nil
+
+	case "configmap":
+		if kubeClient == nil {
+			return "", fmt.Errorf("kubernetes client is not available to read the config map %s", source.name)
+		}
+		cm, err := kubeClient.CoreV1().ConfigMaps(configMap.Namespace).Get(ctx, source.name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		data, found := cm.Data[source.key]
+		if !found {
+			return "", fmt.Errorf("key %q not found on the config map %s", source.key, source.name)
+		}
+		return data, nil
+
+	default:
+		if kubeClient == nil {
+			return "", fmt.Errorf("kubernetes client is not available to read the secret %s", source.name)
+		}
+		secret, err := kubeClient.CoreV1().Secrets(configMap.Namespace).Get(ctx, source.name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		data, found := secret.Data[source.key]
+		if !found {
+			return "", fmt.Errorf("key %q not found on the secret %s", source.key, source.name)
+		}
+		return string(data), nil
+	}
+}
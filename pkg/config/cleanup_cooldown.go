@@ -0,0 +1,56 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+// cleanupCooldown tracks the last history cleanup of each group, to run it at most once per cooldown
+type cleanupCooldown struct {
+	mutex sync.Mutex
+	// lastCleanup holds the start of the last cleanup, keyed by group
+	lastCleanup map[string]time.Time
+	now         func() time.Time
+}
+
+func newCleanupCooldown() *cleanupCooldown {
+	return &cleanupCooldown{
+		lastCleanup: map[string]time.Time{},
+		now:         time.Now,
+	}
+}
+
+// tryStart returns true and records the cleanup when the last cleanup of the group is older than the cooldown.
+// The groups whose cooldown elapsed are forgotten, to keep the tracked groups bounded
+func (c *cleanupCooldown) tryStart(group string, cooldown time.Duration) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	if last, found := c.lastCleanup[group]; found && now.Sub(last) < cooldown {
+		return false
+	}
+	for key, last := range c.lastCleanup {
+		if now.Sub(last) >= cooldown {
+			delete(c.lastCleanup, key)
+		}
+	}
+	c.lastCleanup[group] = now
+	return true
+}
@@ -18,11 +18,20 @@ package config
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"sync"
+	"time"
+	// the timezone database is embedded, the images do not ship it
+	_ "time/tzdata"
 
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/yaml"
 	"knative.dev/pkg/logging"
+	"knative.dev/pkg/ptr"
 )
 
 // following types are for internal use
@@ -46,12 +55,44 @@ const (
 	// PrunerFieldTypeTTLSecondsAfterFinished represents the field type for the TTL (Time-to-Live) in seconds after the resource is finished.
 	PrunerFieldTypeTTLSecondsAfterFinished PrunerFieldType = "ttlSecondsAfterFinished"
 
+	// PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults represents the field type for the TTL in seconds
+	// after the resource is finished, which applies to the resources that produced no results.
+	PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults PrunerFieldType = "ttlSecondsAfterFinishedWithoutResults"
+
+	// PrunerFieldTypeTTLJitterSeconds represents the field type for the window in seconds the deletion
+	// deadlines of the resources are spread within.
+	PrunerFieldTypeTTLJitterSeconds PrunerFieldType = "ttlJitterSeconds"
+
+	// PrunerFieldTypeMinRetained represents the field type for the minimum number of resources retained
+	// regardless of their age.
+	PrunerFieldTypeMinRetained PrunerFieldType = "minRetained"
+
+	// PrunerFieldTypeMinRetainedPerOutcome represents the field type for the minimum number of the successful
+	// and of the failed resources retained under the combined history limit.
+	PrunerFieldTypeMinRetainedPerOutcome PrunerFieldType = "minRetainedPerOutcome"
+
+	// PrunerFieldTypeMinRetentionSeconds represents the field type for the time in seconds a completed resource
+	// is retained for, before the history limits can delete it
+	PrunerFieldTypeMinRetentionSeconds PrunerFieldType = "minRetentionSeconds"
+
+	// PrunerFieldTypeRetainCalendarDays represents the field type for the number of calendar days,
+	// today included, the completed resources of which are retained regardless of the history limits.
+	PrunerFieldTypeRetainCalendarDays PrunerFieldType = "retainCalendarDays"
+
+	// PrunerFieldTypeMaxRetentionAgeSeconds represents the field type for the maximum age in seconds
+	// of the resources retained by the history limits.
+	PrunerFieldTypeMaxRetentionAgeSeconds PrunerFieldType = "maxRetentionAgeSeconds"
+
 	// PrunerFieldTypeSuccessfulHistoryLimit represents the field type for the successful history limit of a resource.
 	PrunerFieldTypeSuccessfulHistoryLimit PrunerFieldType = "successfulHistoryLimit"
 
 	// PrunerFieldTypeFailedHistoryLimit represents the field type for the failed history limit of a resource.
 	PrunerFieldTypeFailedHistoryLimit PrunerFieldType = "failedHistoryLimit"
 
+	// PrunerFieldTypeHistoryLimit represents the field type for the history limit of the successful and the failed
+	// resources together, it is set only where neither the successful nor the failed history limit is set.
+	PrunerFieldTypeHistoryLimit PrunerFieldType = "historyLimit"
+
 	// EnforcedConfigLevelGlobal represents the cluster-wide config level for pruner.
 	EnforcedConfigLevelGlobal EnforcedConfigLevel = "global"
 
@@ -62,6 +103,36 @@ const (
 	EnforcedConfigLevelResource EnforcedConfigLevel = "resource"
 )
 
+// rank orders the levels from the widest scope, global, to the narrowest one, resource.
+// An unknown level is ranked as resource, as the resource level is the default
+func (l EnforcedConfigLevel) rank() int {
+	switch l {
+	case EnforcedConfigLevelGlobal:
+		return 0
+	case EnforcedConfigLevelNamespace:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Allows returns true when a nested config can declare the given level under this level.
+// The levels are monotonic, a nested config can enforce a wider scope than the enclosing
+// config does but it can not open the config to a narrower scope. For example a namespace
+// can enforce the global config when the global level is resource, but it can not enforce
+// the resource level when the global level is namespace
+func (l EnforcedConfigLevel) Allows(nested EnforcedConfigLevel) bool {
+	return nested.rank() <= l.rank()
+}
+
+// narrow returns the level which applies when a nested config declares the given level under this level
+func (l EnforcedConfigLevel) narrow(nested EnforcedConfigLevel) EnforcedConfigLevel {
+	if l.Allows(nested) {
+		return nested
+	}
+	return l
+}
+
 // ResourceSpec is used to hold the config of a specific resource
 type ResourceSpec struct {
 	Name         string         `yaml:"name"`               // Exact name of the parent Pipeline or Task
@@ -74,6 +145,63 @@ type SelectorSpec struct {
 	// Match by labels or Annotations. If both are specified, Annotations will take priority.
 	MatchLabels      map[string]string `yaml:"matchLabels,omitempty"`
 	MatchAnnotations map[string]string `yaml:"matchAnnotations,omitempty"`
+	// MatchOwnerReferences matches the resources having an owner reference for each of the entries,
+	// it takes precedence over the name, annotations and labels
+	MatchOwnerReferences []OwnerReferenceSelector `yaml:"matchOwnerReferences,omitempty" json:"matchOwnerReferences,omitempty"`
+}
+
+// OwnerReferenceSelector matches an owner reference of a resource by kind and optionally by name
+type OwnerReferenceSelector struct {
+	Kind string `yaml:"kind" json:"kind"`
+	// Name of the owner, any owner of the kind matches when it is empty
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+}
+
+// matchesOwnerReferences returns true if each of the selectors matches one of the owner references
+func matchesOwnerReferences(selectors, ownerReferences []OwnerReferenceSelector) bool {
+	if len(selectors) == 0 {
+		return false
+	}
+	for _, selector := range selectors {
+		found := false
+		for _, ownerReference := range ownerReferences {
+			if ownerReference.Kind == selector.Kind && (selector.Name == "" || selector.Name == ownerReference.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// getResourceSpecByOwnerReferences returns the first resource spec and its selector matching the owner references
+func getResourceSpecByOwnerReferences(resourceSpecs []ResourceSpec, ownerReferences []OwnerReferenceSelector) (*ResourceSpec, *SelectorSpec) {
+	if len(ownerReferences) == 0 {
+		return nil, nil
+	}
+	for specIndex := range resourceSpecs {
+		for selectorIndex := range resourceSpecs[specIndex].Selector {
+			selectorSpec := &resourceSpecs[specIndex].Selector[selectorIndex]
+			if matchesOwnerReferences(selectorSpec.MatchOwnerReferences, ownerReferences) {
+				return &resourceSpecs[specIndex], selectorSpec
+			}
+		}
+	}
+	return nil, nil
+}
+
+// getResourceSpecs returns the resource specs of the namespace for the resource type
+func getResourceSpecs(namespaceSpec NamespaceSpec, resourceType PrunerResourceType) []ResourceSpec {
+	switch resourceType {
+	case PrunerResourceTypePipelineRun:
+		return namespaceSpec.PipelineRuns
+	case PrunerResourceTypeTaskRun:
+		return namespaceSpec.TaskRuns
+	}
+	return nil
 }
 
 // NamespaceSpec is used to hold the pruning config of a specific namespace and its resources
@@ -81,11 +209,117 @@ type NamespaceSpec struct {
 	PrunerConfig `yaml:",inline"`
 	PipelineRuns []ResourceSpec `yaml:"pipelineRuns"`
 	TaskRuns     []ResourceSpec `yaml:"taskRuns"`
+	// TTLOverrides are evaluated in order before the namespace level ttlSecondsAfterFinished,
+	// the first override whose label selector matches the resource labels wins
+	TTLOverrides []TTLOverride `yaml:"ttlOverrides,omitempty" json:"ttlOverrides,omitempty"`
+}
+
+// TTLOverride holds the ttlSecondsAfterFinished applied to the resources matching the label selector
+type TTLOverride struct {
+	// LabelSelector in kubernetes label selector format, example: "priority=low"
+	LabelSelector           string `yaml:"labelSelector" json:"labelSelector"`
+	TTLSecondsAfterFinished *int32 `yaml:"ttlSecondsAfterFinished" json:"ttlSecondsAfterFinished"`
 }
 
 type GlobalConfig struct {
 	PrunerConfig `yaml:",inline"`
 	Namespaces   map[string]NamespaceSpec `yaml:"namespaces"  json:"namespaces"`
+	// ExcludeAnnotations excludes the runs from pruning on all namespaces, a run carrying any of
+	// these annotations is never deleted and it is not counted on the history limits.
+	// An empty value matches any value of the annotation
+	ExcludeAnnotations map[string]string `yaml:"excludeAnnotations,omitempty" json:"excludeAnnotations,omitempty"`
+	// ExcludedRunsMaxAgeSeconds is a backstop overriding ExcludeAnnotations, the completed excluded runs
+	// older than it are deleted regardless of the exclusion. The excluded runs are never deleted when it is not set
+	ExcludedRunsMaxAgeSeconds *int32 `yaml:"excludedRunsMaxAgeSeconds,omitempty" json:"excludedRunsMaxAgeSeconds,omitempty"`
+	// FailureReasonMapping translates the reasons of the failed runs, for example PipelineRunTimeout,
+	// into buckets. The failed runs of a bucket with a limit in FailedHistoryLimitsByBucket are retained
+	// separately from the other failed runs, which are retained by failedHistoryLimit
+	FailureReasonMapping        map[string]string `yaml:"failureReasonMapping,omitempty" json:"failureReasonMapping,omitempty"`
+	FailedHistoryLimitsByBucket map[string]int32  `yaml:"failedHistoryLimitsByBucket,omitempty" json:"failedHistoryLimitsByBucket,omitempty"`
+	// Timezone is the IANA name of the timezone the calendar days are counted in, for example Europe/Berlin.
+	// Defaults to UTC
+	Timezone string `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	// Quarantine retains the failed runs it matches, for example the runs failed on a security scan,
+	// separately from the other failed runs. It takes precedence over all the other settings
+	Quarantine *QuarantineConfig `yaml:"quarantine,omitempty" json:"quarantine,omitempty"`
+	// MaxCompletedRunsPerNamespace is a backstop on top of the history limits, once a namespace holds more
+	// completed PipelineRuns, or TaskRuns, the oldest ones are deleted regardless of the Pipeline or the Task
+	MaxCompletedRunsPerNamespace *int32 `yaml:"maxCompletedRunsPerNamespace,omitempty" json:"maxCompletedRunsPerNamespace,omitempty"`
+	// HistoryCleanupCooldownSeconds limits the history cleanup of each group, a Pipeline or a Task, and outcome to
+	// one pass per cooldown. The runs completed meanwhile are cleaned up by the next pass, in a single batch
+	HistoryCleanupCooldownSeconds *int32 `yaml:"historyCleanupCooldownSeconds,omitempty" json:"historyCleanupCooldownSeconds,omitempty"`
+	// ExcludeChildTaskRunsFromLimits leaves the TaskRuns of a PipelineRun out of the TaskRun history limits,
+	// they are retained along with their PipelineRun. They are counted by default
+	ExcludeChildTaskRunsFromLimits bool `yaml:"excludeChildTaskRunsFromLimits,omitempty" json:"excludeChildTaskRunsFromLimits,omitempty"`
+	// StartupCutoffTime leaves the runs completed before it unmanaged, they are neither counted nor deleted. It is
+	// a time in RFC3339 format, or controllerStart for the start time of the controller. Disabled when unset
+	StartupCutoffTime string `yaml:"startupCutoffTime,omitempty" json:"startupCutoffTime,omitempty"`
+	// HistoryLimitTighteningStep caps the runs a history cleanup pass deletes, the oldest first, so that a history
+	// limit lowered drastically is approached step by step over the next passes. Not capped when unset
+	HistoryLimitTighteningStep *int32 `yaml:"historyLimitTighteningStep,omitempty" json:"historyLimitTighteningStep,omitempty"`
+	// HistorySelfPrune deletes only the reconciled run when it is over the history limits, instead of all the runs
+	// of its group over the limits. The other runs are deleted on their own reconcile, on the resync of the informer
+	HistorySelfPrune bool `yaml:"historySelfPrune,omitempty" json:"historySelfPrune,omitempty"`
+	// Ephemeral prunes the runs marked as ephemeral, for example the scratch runs of a CI, faster than the other runs
+	Ephemeral *EphemeralConfig `yaml:"ephemeral,omitempty" json:"ephemeral,omitempty"`
+	// FeatureFlags enables the experimental behaviors independently, they are all off by default
+	FeatureFlags map[FeatureFlag]bool `yaml:"featureFlags,omitempty" json:"featureFlags,omitempty"`
+	// MaxRunningAgeSeconds flags the runs which are not completed the given seconds after their start as stuck,
+	// for example the runs of a pod which never reports back. The stuck runs are deleted only when DeleteStuckRuns is set
+	MaxRunningAgeSeconds *int32 `yaml:"maxRunningAgeSeconds,omitempty" json:"maxRunningAgeSeconds,omitempty"`
+	DeleteStuckRuns      bool   `yaml:"deleteStuckRuns,omitempty" json:"deleteStuckRuns,omitempty"`
+}
+
+// QuarantineConfig selects the quarantined failed runs by their labels and annotations, a run matching all of
+// them is quarantined, an empty value matches any value. The quarantined runs are not deleted by ttl when
+// ttlSecondsAfterFinished is not set, and they are not limited in number when historyLimit is not set
+type QuarantineConfig struct {
+	MatchLabels             map[string]string `yaml:"matchLabels,omitempty" json:"matchLabels,omitempty"`
+	MatchAnnotations        map[string]string `yaml:"matchAnnotations,omitempty" json:"matchAnnotations,omitempty"`
+	TTLSecondsAfterFinished *int32            `yaml:"ttlSecondsAfterFinished,omitempty" json:"ttlSecondsAfterFinished,omitempty"`
+	HistoryLimit            *int32            `yaml:"historyLimit,omitempty" json:"historyLimit,omitempty"`
+}
+
+// EphemeralConfig applies to the runs whose ephemeral annotation is "true". The ttl applies when it is shorter than
+// the ttl resolved for the run. The ephemeral runs are limited in number separately from the other runs of their
+// group, by the lowest of historyLimit and the history limit of the group
+type EphemeralConfig struct {
+	// AnnotationKey is the annotation marking the ephemeral runs, defaults to pruner.tekton.dev/ephemeral
+	AnnotationKey           string `yaml:"annotationKey,omitempty" json:"annotationKey,omitempty"`
+	TTLSecondsAfterFinished *int32 `yaml:"ttlSecondsAfterFinished,omitempty" json:"ttlSecondsAfterFinished,omitempty"`
+	HistoryLimit            *int32 `yaml:"historyLimit,omitempty" json:"historyLimit,omitempty"`
+}
+
+// matches returns true when the ephemeral annotation of the run is "true"
+func (ec *EphemeralConfig) matches(resourceAnnotations map[string]string) bool {
+	if ec == nil {
+		return false
+	}
+	annotationKey := ec.AnnotationKey
+	if annotationKey == "" {
+		annotationKey = AnnotationEphemeral
+	}
+	return resourceAnnotations[annotationKey] == "true"
+}
+
+// matches returns true when the labels and the annotations match the quarantine, a quarantine
+// without any label and annotation matches nothing
+func (qc *QuarantineConfig) matches(resourceLabels, resourceAnnotations map[string]string) bool {
+	if qc == nil || (len(qc.MatchLabels) == 0 && len(qc.MatchAnnotations) == 0) {
+		return false
+	}
+	return matchesAll(qc.MatchLabels, resourceLabels) && matchesAll(qc.MatchAnnotations, resourceAnnotations)
+}
+
+// matchesAll returns true when all the expected keys are found, an empty expected value matches any value
+func matchesAll(expected, actual map[string]string) bool {
+	for key, value := range expected {
+		actualValue, found := actual[key]
+		if !found || (value != "" && value != actualValue) {
+			return false
+		}
+	}
+	return true
 }
 
 // PrunerConfig used to hold the cluster-wide pruning config as well as namespace specific pruning config
@@ -96,12 +330,74 @@ type PrunerConfig struct {
 	SuccessfulHistoryLimit  *int32               `yaml:"successfulHistoryLimit" json:"successfulHistoryLimit"`
 	FailedHistoryLimit      *int32               `yaml:"failedHistoryLimit" json:"failedHistoryLimit"`
 	HistoryLimit            *int32               `yaml:"historyLimit" json:"historyLimit"`
+	// TTLSecondsAfterFinishedWithoutResults applies to the runs which produced no results, for example
+	// the runs failed on validation. It is used only when it is shorter than ttlSecondsAfterFinished
+	TTLSecondsAfterFinishedWithoutResults *int32 `yaml:"ttlSecondsAfterFinishedWithoutResults,omitempty" json:"ttlSecondsAfterFinishedWithoutResults,omitempty"`
+	// TTLJitterSeconds delays the deletion deadline of each run by up to the given seconds, the delay
+	// is derived from the run UID so that the runs completed at once are not deleted at once
+	TTLJitterSeconds *int32 `yaml:"ttlJitterSeconds,omitempty" json:"ttlJitterSeconds,omitempty"`
+	// MaxRetentionAgeSeconds deletes the runs older than it on the history limit check, even when
+	// the history limit is not reached. MinRetained runs are kept regardless of their age
+	MaxRetentionAgeSeconds *int32 `yaml:"maxRetentionAgeSeconds,omitempty" json:"maxRetentionAgeSeconds,omitempty"`
+	MinRetained            *int32 `yaml:"minRetained,omitempty" json:"minRetained,omitempty"`
+	// MinRetainedPerOutcome retains at least the given number of the newest successful and of the newest failed
+	// runs under the combined historyLimit, so that a burst of one outcome does not delete all the runs of the other
+	MinRetainedPerOutcome *int32 `yaml:"minRetainedPerOutcome,omitempty" json:"minRetainedPerOutcome,omitempty"`
+	// MinRetentionSeconds retains the runs completed within the given seconds, even when they are over the
+	// history limits. They are still counted on the limits, the older runs over the limits are deleted
+	MinRetentionSeconds *int32 `yaml:"minRetentionSeconds,omitempty" json:"minRetentionSeconds,omitempty"`
+	// RetainCalendarDays retains all the runs completed within the given number of calendar days, today
+	// included, in the timezone of the controller. The history limits apply to the runs completed before
+	RetainCalendarDays *int32 `yaml:"retainCalendarDays,omitempty" json:"retainCalendarDays,omitempty"`
+}
+
+// getSuccessfulHistoryLimit returns the successfulHistoryLimit, historyLimit is used when it is not set
+func (pc PrunerConfig) getSuccessfulHistoryLimit() *int32 {
+	if pc.SuccessfulHistoryLimit != nil {
+		return pc.SuccessfulHistoryLimit
+	}
+	return pc.HistoryLimit
+}
+
+// getFailedHistoryLimit returns the failedHistoryLimit, historyLimit is used when it is not set
+func (pc PrunerConfig) getFailedHistoryLimit() *int32 {
+	if pc.FailedHistoryLimit != nil {
+		return pc.FailedHistoryLimit
+	}
+	return pc.HistoryLimit
+}
+
+// getHistoryLimit returns the historyLimit when it is the combined limit of the successful and the failed runs,
+// it is nil when either successfulHistoryLimit or failedHistoryLimit is set, historyLimit falls back to the other then
+func (pc PrunerConfig) getHistoryLimit() *int32 {
+	if pc.SuccessfulHistoryLimit != nil || pc.FailedHistoryLimit != nil {
+		return nil
+	}
+	return pc.HistoryLimit
 }
 
 // prunerConfigStore defines the store structure to hold config from ConfigMap
 type prunerConfigStore struct {
 	mutex        sync.RWMutex
 	globalConfig GlobalConfig
+	// namespacedConfig holds the namespace specs defined by the TektonPruner resources, keyed by namespace
+	namespacedConfig map[string]NamespaceSpec
+	// namespaceAnnotationConfig holds the namespace specs read from the annotations of the namespaces, keyed by namespace.
+	// It has the lowest precedence, below the namespace entries of the global config and the TektonPruner resources
+	namespaceAnnotationConfig map[string]NamespaceSpec
+	// effective is the global config with the namespaced config merged, it is computed on every config load
+	effective GlobalConfig
+	// reprocessGeneration is the value of the reprocess generation annotation of the config map
+	reprocessGeneration string
+	// generation is bumped on every config load, it invalidates the resolved config cache
+	generation uint64
+	// loaded is set once the global config is loaded, the runs are not reconciled with an empty config before
+	loaded bool
+	cache  resolvedConfigCache
+	// location is the timezone of the config, nil until a config is loaded
+	location *time.Location
+	// changeListeners are notified after the config is changed
+	changeListeners []func()
 }
 
 var (
@@ -118,26 +414,192 @@ func (ps *prunerConfigStore) LoadGlobalConfig(ctx context.Context, configMap *co
 	// Log the current state of globalConfig and namespacedConfig before updating
 	logger.Debugw("Loading global config", "oldGlobalConfig", ps.globalConfig)
 
+	// a partial config is not loaded, the previous config is kept active
+	if reason, err := checkConfigIntegrity(configMap); err != nil {
+		logger.Errorw("rejecting the incomplete global config, the previous config is kept", "reason", reason, zap.Error(err))
+		metrics.GetRecorder().RecordConfigRejection(ctx, reason)
+		return err
+	}
+
 	globalConfig := &GlobalConfig{}
 	if configMap.Data != nil && configMap.Data[PrunerGlobalConfigKey] != "" {
 		err := yaml.Unmarshal([]byte(configMap.Data[PrunerGlobalConfigKey]), globalConfig)
 		if err != nil {
+			metrics.GetRecorder().RecordConfigRejection(ctx, metrics.ConfigRejectReasonInvalid)
 			return err
 		}
 	}
 
-	ps.globalConfig = *globalConfig
+	if globalConfig.Namespaces == nil {
+		globalConfig.Namespaces = map[string]NamespaceSpec{}
+	}
+
+	location, err := time.LoadLocation(globalConfig.Timezone)
+	if err != nil {
+		metrics.GetRecorder().RecordConfigRejection(ctx, metrics.ConfigRejectReasonInvalid)
+		return fmt.Errorf("invalid timezone %q: %w", globalConfig.Timezone, err)
+	}
 
-	if ps.globalConfig.Namespaces == nil {
-		ps.globalConfig.Namespaces = map[string]NamespaceSpec{}
+	ps.loaded = true
+	reprocessGeneration := configMap.Annotations[AnnotationReprocessGeneration]
+	if reflect.DeepEqual(ps.globalConfig, *globalConfig) && ps.reprocessGeneration == reprocessGeneration {
+		logger.Debugw("global config is not changed", "generation", ps.generation)
+		return nil
 	}
 
+	ps.globalConfig = *globalConfig
+	ps.location = location
+	ps.reprocessGeneration = reprocessGeneration
+	ps.bumpGeneration(ctx)
+
 	// Log the updated state of globalConfig and namespacedConfig after the update
 	logger.Debugw("Updated global config", "newGlobalConfig", ps.globalConfig)
 
 	return nil
 }
 
+// IsLoaded returns true once the global config is loaded
+func (ps *prunerConfigStore) IsLoaded() bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.loaded
+}
+
+// LoadNamespacedConfig replaces the namespace specs defined by the TektonPruner resources, keyed by namespace
+func (ps *prunerConfigStore) LoadNamespacedConfig(ctx context.Context, namespacedConfig map[string]NamespaceSpec) {
+	logger := logging.FromContext(ctx)
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	logger.Debugw("Loading namespaced config", "oldNamespacedConfig", ps.namespacedConfig, "newNamespacedConfig", namespacedConfig)
+	if reflect.DeepEqual(ps.namespacedConfig, namespacedConfig) {
+		return
+	}
+	ps.namespacedConfig = namespacedConfig
+	ps.bumpGeneration(ctx)
+}
+
+// LoadNamespaceAnnotationConfig replaces the namespace specs read from the annotations of the namespaces, keyed by namespace
+func (ps *prunerConfigStore) LoadNamespaceAnnotationConfig(ctx context.Context, namespaceAnnotationConfig map[string]NamespaceSpec) {
+	logger := logging.FromContext(ctx)
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	logger.Debugw("Loading namespace annotation config", "oldNamespaceAnnotationConfig", ps.namespaceAnnotationConfig,
+		"newNamespaceAnnotationConfig", namespaceAnnotationConfig)
+	if reflect.DeepEqual(ps.namespaceAnnotationConfig, namespaceAnnotationConfig) {
+		return
+	}
+	ps.namespaceAnnotationConfig = namespaceAnnotationConfig
+	ps.bumpGeneration(ctx)
+}
+
+// DeleteNamespacedSpec evicts the specs of a deleted namespace, the TektonPruner and the annotations
+// of a namespace go away with it, so its config should not linger until the next resync
+func (ps *prunerConfigStore) DeleteNamespacedSpec(ctx context.Context, namespace string) {
+	logger := logging.FromContext(ctx)
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	_, foundNamespaced := ps.namespacedConfig[namespace]
+	_, foundAnnotation := ps.namespaceAnnotationConfig[namespace]
+	if !foundNamespaced && !foundAnnotation {
+		return
+	}
+	logger.Debugw("Deleting the config of the namespace", "namespace", namespace)
+	// the maps are replaced rather than updated, they may be shared with the caller of the load functions
+	if foundNamespaced {
+		ps.namespacedConfig = withoutNamespace(ps.namespacedConfig, namespace)
+	}
+	if foundAnnotation {
+		ps.namespaceAnnotationConfig = withoutNamespace(ps.namespaceAnnotationConfig, namespace)
+	}
+	ps.bumpGeneration(ctx)
+}
+
+// withoutNamespace returns a copy of the specs without the namespace
+func withoutNamespace(specs map[string]NamespaceSpec, namespace string) map[string]NamespaceSpec {
+	result := make(map[string]NamespaceSpec, len(specs))
+	for key, spec := range specs {
+		if key != namespace {
+			result[key] = spec
+		}
+	}
+	return result
+}
+
+// bumpGeneration increments the config generation, which invalidates the resolved config cache,
+// and merges the effective config again
+func (ps *prunerConfigStore) bumpGeneration(ctx context.Context) {
+	ps.generation++
+	ps.effective = ps.mergeEffectiveConfig()
+	metrics.GetRecorder().RecordConfigGeneration(ctx, ps.generation)
+	// the listeners are called outside of the lock held by the caller, they may read the config
+	for _, listener := range ps.changeListeners {
+		go listener()
+	}
+}
+
+// OnChange registers a function called whenever the global or the namespaced config is changed
+func (ps *prunerConfigStore) OnChange(listener func()) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.changeListeners = append(ps.changeListeners, listener)
+}
+
+// effectiveConfig returns the global config with the namespaced config merged into its namespaces,
+// as merged on the last config load
+func (ps *prunerConfigStore) effectiveConfig() GlobalConfig {
+	return ps.effective
+}
+
+// mergeEffectiveConfig merges the namespaced config into the namespaces of the global config.
+// The namespaced config is ignored when the global enforcedConfigLevel is global and it can not
+// enforce a level below namespace when the global enforcedConfigLevel is namespace.
+// The namespace entries of the global config take precedence over the namespaced config, which takes
+// precedence over the config read from the annotations of the namespaces
+func (ps *prunerConfigStore) mergeEffectiveConfig() GlobalConfig {
+	globalConfig := ps.globalConfig
+	if len(ps.namespacedConfig) == 0 && len(ps.namespaceAnnotationConfig) == 0 {
+		return globalConfig
+	}
+
+	globalLevel := EnforcedConfigLevelResource
+	if globalConfig.EnforcedConfigLevel != nil {
+		globalLevel = *globalConfig.EnforcedConfigLevel
+	}
+	if globalLevel == EnforcedConfigLevelGlobal {
+		return globalConfig
+	}
+
+	namespaces := make(map[string]NamespaceSpec, len(globalConfig.Namespaces)+len(ps.namespacedConfig)+len(ps.namespaceAnnotationConfig))
+	for namespace, spec := range globalConfig.Namespaces {
+		namespaces[namespace] = spec
+	}
+	mergeNamespaceSpecs(namespaces, ps.namespacedConfig, globalLevel)
+	mergeNamespaceSpecs(namespaces, ps.namespaceAnnotationConfig, globalLevel)
+	globalConfig.Namespaces = namespaces
+	return globalConfig
+}
+
+// mergeNamespaceSpecs adds the specs of the namespaces which are not in namespaces yet, the specs can not
+// enforce a level below namespace when the global enforcedConfigLevel is namespace
+func mergeNamespaceSpecs(namespaces, specs map[string]NamespaceSpec, globalLevel EnforcedConfigLevel) {
+	for namespace, spec := range specs {
+		if _, found := namespaces[namespace]; found {
+			continue
+		}
+		if globalLevel == EnforcedConfigLevelNamespace {
+			namespaceLevel := EnforcedConfigLevelNamespace
+			if spec.EnforcedConfigLevel != nil && *spec.EnforcedConfigLevel == EnforcedConfigLevelGlobal {
+				namespaceLevel = EnforcedConfigLevelGlobal
+			}
+			spec.EnforcedConfigLevel = &namespaceLevel
+		}
+		namespaces[namespace] = spec
+	}
+}
+
 // loads config from configMap (global-config) should be called on startup and if there is a change detected on the ConfigMap
 func (ps *prunerConfigStore) WorkerCount(ctx context.Context, configMap *corev1.ConfigMap) (count int, err error) {
 	logger := logging.FromContext(ctx)
@@ -173,93 +635,111 @@ func getFromPrunerConfigResourceLevelwithSelector(namespacesSpec map[string]Name
 		resourceSpecs = prunerResourceSpec.TaskRuns
 	}
 
-	// First, check if name is provided, and use it to match exactly
-	if name != "" && (len(selector.MatchAnnotations) == 0 || len(selector.MatchLabels) == 0) {
-		for _, resourceSpec := range resourceSpecs {
-			if resourceSpec.Name == name {
-				// Return the field value from the matched resourceSpec
-				switch fieldType {
-				case PrunerFieldTypeTTLSecondsAfterFinished:
-					return resourceSpec.TTLSecondsAfterFinished, "identifiedBy_resource_name"
-				case PrunerFieldTypeSuccessfulHistoryLimit:
-					return resourceSpec.SuccessfulHistoryLimit, "identifiedBy_resource_name"
-				case PrunerFieldTypeFailedHistoryLimit:
-					return resourceSpec.FailedHistoryLimit, "identifiedBy_resource_name"
-				}
-			}
-		}
-	} else if len(selector.MatchAnnotations) > 0 || len(selector.MatchLabels) > 0 {
-		// If name is not provided, we proceed with selector matching
+	// Owner references are the most specific match
+	if resourceSpec, _ := getResourceSpecByOwnerReferences(resourceSpecs, selector.MatchOwnerReferences); resourceSpec != nil {
+		return getResourceSpecField(*resourceSpec, fieldType), "identifiedBy_resource_owner"
+	}
 
+	// Then the exact name, even when the resource carries labels or annotations
+	if name != "" {
 		for _, resourceSpec := range resourceSpecs {
-			// Check if the resourceSpec matches the provided selector by annotations or labels
-			for _, selectorSpec := range resourceSpec.Selector {
-				// Match by annotations if provided in the selector
-				if len(selector.MatchAnnotations) > 0 {
-					match := true
-					for key, value := range selector.MatchAnnotations {
-						if resourceAnnotationValue, exists := selectorSpec.MatchAnnotations[key]; !exists || resourceAnnotationValue != value {
-							match = false
-							break
-						}
-					}
-					if match {
-						// Return the field value if annotations match
-						switch fieldType {
-						case PrunerFieldTypeTTLSecondsAfterFinished:
-							return resourceSpec.TTLSecondsAfterFinished, "identifiedBy_resource_ann"
-						case PrunerFieldTypeSuccessfulHistoryLimit:
-							if resourceSpec.SuccessfulHistoryLimit != nil {
-								return resourceSpec.SuccessfulHistoryLimit, "identifiedBy_resource_ann"
-							} else {
-								return resourceSpec.HistoryLimit, "identifiedBy_resource_ann"
-							}
-						case PrunerFieldTypeFailedHistoryLimit:
-							if resourceSpec.SuccessfulHistoryLimit != nil {
-								return resourceSpec.FailedHistoryLimit, "identifiedBy_resource_ann"
-							} else {
-								return resourceSpec.HistoryLimit, "identifiedBy_resource_ann"
-							}
-						}
-					}
-				}
-				// Match by labels if provided in the selector
-				if len(selector.MatchLabels) > 0 {
-					match := true
-					for key, value := range selector.MatchLabels {
-						if resourceLabelValue, exists := selectorSpec.MatchLabels[key]; !exists || resourceLabelValue != value {
-							match = false
-							break
-						}
-					}
-					if match {
-						// Return the field value if labels match
-						switch fieldType {
-						case PrunerFieldTypeTTLSecondsAfterFinished:
-							return resourceSpec.TTLSecondsAfterFinished, "identifiedBy_resource_label"
-						case PrunerFieldTypeSuccessfulHistoryLimit:
-							if resourceSpec.SuccessfulHistoryLimit != nil {
-								return resourceSpec.SuccessfulHistoryLimit, "identifiedBy_resource_label"
-							} else {
-								return resourceSpec.HistoryLimit, "identifiedBy_resource_label"
-							}
-						case PrunerFieldTypeFailedHistoryLimit:
-							if resourceSpec.SuccessfulHistoryLimit != nil {
-								return resourceSpec.FailedHistoryLimit, "identifiedBy_resource_label"
-							} else {
-								return resourceSpec.HistoryLimit, "identifiedBy_resource_label"
-							}
-						}
-					}
-				}
+			if matchesResourceName(resourceSpec.Name, name) {
+				return getResourceSpecField(resourceSpec, fieldType), "identifiedBy_resource_name"
 			}
 		}
 	}
 
+	// Then the most specific selector matching the annotations or the labels of the resource
+	if resourceSpec, identifiedBy := getResourceSpecBySelector(resourceSpecs, selector); resourceSpec != nil {
+		return getResourceSpecField(*resourceSpec, fieldType), identifiedBy
+	}
+
 	// If no match found, return nil
 	return nil, ""
 }
 
+// getResourceSpecBySelector returns the resource spec with the most specific selector matching the resource, the
+// selector with the most entries. A selector matches when all its annotations, or else all its labels, are carried
+// by the resource, the annotations take priority. Otherwise the first of the equally specific resource specs is returned
+func getResourceSpecBySelector(resourceSpecs []ResourceSpec, selector SelectorSpec) (*ResourceSpec, string) {
+	var matched *ResourceSpec
+	var identifiedBy string
+	matchedEntries := 0
+	for i := range resourceSpecs {
+		for _, selectorSpec := range resourceSpecs[i].Selector {
+			entries, by := 0, ""
+			if len(selectorSpec.MatchAnnotations) > 0 && isSubset(selectorSpec.MatchAnnotations, selector.MatchAnnotations) {
+				entries, by = len(selectorSpec.MatchAnnotations), "identifiedBy_resource_ann"
+			} else if len(selectorSpec.MatchLabels) > 0 && isSubset(selectorSpec.MatchLabels, selector.MatchLabels) {
+				entries, by = len(selectorSpec.MatchLabels), "identifiedBy_resource_label"
+			}
+			// the annotations take priority over the labels on equally specific selectors
+			if entries > matchedEntries || entries > 0 && entries == matchedEntries &&
+				by == "identifiedBy_resource_ann" && identifiedBy != "identifiedBy_resource_ann" {
+				matched, identifiedBy, matchedEntries = &resourceSpecs[i], by, entries
+			}
+		}
+	}
+	return matched, identifiedBy
+}
+
+// isSubset returns true when all the entries of subset are in set
+func isSubset(subset, set map[string]string) bool {
+	for key, value := range subset {
+		if setValue, found := set[key]; !found || setValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// getResourceSpecField returns the value of the field of the resource spec
+func getResourceSpecField(resourceSpec ResourceSpec, fieldType PrunerFieldType) *int32 {
+	switch fieldType {
+	case PrunerFieldTypeTTLSecondsAfterFinished:
+		return resourceSpec.TTLSecondsAfterFinished
+	case PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults:
+		return resourceSpec.TTLSecondsAfterFinishedWithoutResults
+	case PrunerFieldTypeTTLJitterSeconds:
+		return resourceSpec.TTLJitterSeconds
+	case PrunerFieldTypeMinRetained:
+		return resourceSpec.MinRetained
+	case PrunerFieldTypeMinRetentionSeconds:
+		return resourceSpec.MinRetentionSeconds
+	case PrunerFieldTypeMinRetainedPerOutcome:
+		return resourceSpec.MinRetainedPerOutcome
+	case PrunerFieldTypeRetainCalendarDays:
+		return resourceSpec.RetainCalendarDays
+	case PrunerFieldTypeMaxRetentionAgeSeconds:
+		return resourceSpec.MaxRetentionAgeSeconds
+	case PrunerFieldTypeSuccessfulHistoryLimit:
+		return resourceSpec.getSuccessfulHistoryLimit()
+	case PrunerFieldTypeFailedHistoryLimit:
+		return resourceSpec.getFailedHistoryLimit()
+	case PrunerFieldTypeHistoryLimit:
+		return resourceSpec.getHistoryLimit()
+	}
+	return nil
+}
+
+// getTTLFromNamespaceOverrides returns the ttl of the first override matching the given labels
+func getTTLFromNamespaceOverrides(spec NamespaceSpec, resourceLabels map[string]string) *int32 {
+	for _, override := range spec.TTLOverrides {
+		if override.TTLSecondsAfterFinished == nil {
+			continue
+		}
+		selector, err := labels.Parse(override.LabelSelector)
+		// an empty selector matches everything, it is not considered as an override
+		if err != nil || selector.Empty() {
+			continue
+		}
+		if selector.Matches(labels.Set(resourceLabels)) {
+			return override.TTLSecondsAfterFinished
+		}
+	}
+	return nil
+}
+
 func getResourceFieldData(globalSpec GlobalConfig, namespace, name string, selector SelectorSpec, resourceType PrunerResourceType, fieldType PrunerFieldType, enforcedConfigLevel EnforcedConfigLevel) (*int32, string) {
 	var fieldData *int32
 	var identified_by string
@@ -276,21 +756,41 @@ func getResourceFieldData(globalSpec GlobalConfig, namespace, name string, selec
 		if found {
 			switch fieldType {
 			case PrunerFieldTypeTTLSecondsAfterFinished:
+				// label based overrides take precedence over the namespace default
+				if ttl := getTTLFromNamespaceOverrides(spec, selector.MatchLabels); ttl != nil {
+					return ttl, "identified_by_ns_label"
+				}
 				fieldData = spec.TTLSecondsAfterFinished
 
+			case PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults:
+				fieldData = spec.TTLSecondsAfterFinishedWithoutResults
+
+			case PrunerFieldTypeTTLJitterSeconds:
+				fieldData = spec.TTLJitterSeconds
+
+			case PrunerFieldTypeMinRetained:
+				fieldData = spec.MinRetained
+
+			case PrunerFieldTypeMinRetentionSeconds:
+				fieldData = spec.MinRetentionSeconds
+
+			case PrunerFieldTypeMinRetainedPerOutcome:
+				fieldData = spec.MinRetainedPerOutcome
+
+			case PrunerFieldTypeRetainCalendarDays:
+				fieldData = spec.RetainCalendarDays
+
+			case PrunerFieldTypeMaxRetentionAgeSeconds:
+				fieldData = spec.MaxRetentionAgeSeconds
+
 			case PrunerFieldTypeSuccessfulHistoryLimit:
-				if spec.SuccessfulHistoryLimit != nil {
-					fieldData = spec.SuccessfulHistoryLimit
-				} else {
-					fieldData = spec.HistoryLimit
-				}
+				fieldData = spec.getSuccessfulHistoryLimit()
 
 			case PrunerFieldTypeFailedHistoryLimit:
-				if spec.FailedHistoryLimit != nil {
-					fieldData = spec.FailedHistoryLimit
-				} else {
-					fieldData = spec.HistoryLimit
-				}
+				fieldData = spec.getFailedHistoryLimit()
+
+			case PrunerFieldTypeHistoryLimit:
+				fieldData = spec.getHistoryLimit()
 			}
 			identified_by = "identified_by_ns"
 		} else {
@@ -299,19 +799,35 @@ func getResourceFieldData(globalSpec GlobalConfig, namespace, name string, selec
 			case PrunerFieldTypeTTLSecondsAfterFinished:
 				fieldData = globalSpec.TTLSecondsAfterFinished
 
+			case PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults:
+				fieldData = globalSpec.TTLSecondsAfterFinishedWithoutResults
+
+			case PrunerFieldTypeTTLJitterSeconds:
+				fieldData = globalSpec.TTLJitterSeconds
+
+			case PrunerFieldTypeMinRetained:
+				fieldData = globalSpec.MinRetained
+
+			case PrunerFieldTypeMinRetentionSeconds:
+				fieldData = globalSpec.MinRetentionSeconds
+
+			case PrunerFieldTypeMinRetainedPerOutcome:
+				fieldData = globalSpec.MinRetainedPerOutcome
+
+			case PrunerFieldTypeRetainCalendarDays:
+				fieldData = globalSpec.RetainCalendarDays
+
+			case PrunerFieldTypeMaxRetentionAgeSeconds:
+				fieldData = globalSpec.MaxRetentionAgeSeconds
+
 			case PrunerFieldTypeSuccessfulHistoryLimit:
-				if globalSpec.SuccessfulHistoryLimit != nil {
-					fieldData = globalSpec.SuccessfulHistoryLimit
-				} else {
-					fieldData = globalSpec.HistoryLimit
-				}
+				fieldData = globalSpec.getSuccessfulHistoryLimit()
 
 			case PrunerFieldTypeFailedHistoryLimit:
-				if globalSpec.FailedHistoryLimit != nil {
-					fieldData = globalSpec.FailedHistoryLimit
-				} else {
-					fieldData = globalSpec.HistoryLimit
-				}
+				fieldData = globalSpec.getFailedHistoryLimit()
+
+			case PrunerFieldTypeHistoryLimit:
+				fieldData = globalSpec.getHistoryLimit()
 			}
 			identified_by = "identified_by_global"
 		}
@@ -322,21 +838,41 @@ func getResourceFieldData(globalSpec GlobalConfig, namespace, name string, selec
 		if found {
 			switch fieldType {
 			case PrunerFieldTypeTTLSecondsAfterFinished:
+				// label based overrides take precedence over the namespace default
+				if ttl := getTTLFromNamespaceOverrides(spec, selector.MatchLabels); ttl != nil {
+					return ttl, "identified_by_ns_label"
+				}
 				fieldData = spec.TTLSecondsAfterFinished
 
+			case PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults:
+				fieldData = spec.TTLSecondsAfterFinishedWithoutResults
+
+			case PrunerFieldTypeTTLJitterSeconds:
+				fieldData = spec.TTLJitterSeconds
+
+			case PrunerFieldTypeMinRetained:
+				fieldData = spec.MinRetained
+
+			case PrunerFieldTypeMinRetentionSeconds:
+				fieldData = spec.MinRetentionSeconds
+
+			case PrunerFieldTypeMinRetainedPerOutcome:
+				fieldData = spec.MinRetainedPerOutcome
+
+			case PrunerFieldTypeRetainCalendarDays:
+				fieldData = spec.RetainCalendarDays
+
+			case PrunerFieldTypeMaxRetentionAgeSeconds:
+				fieldData = spec.MaxRetentionAgeSeconds
+
 			case PrunerFieldTypeSuccessfulHistoryLimit:
-				if spec.SuccessfulHistoryLimit != nil {
-					fieldData = spec.SuccessfulHistoryLimit
-				} else {
-					fieldData = spec.HistoryLimit
-				}
+				fieldData = spec.getSuccessfulHistoryLimit()
 
 			case PrunerFieldTypeFailedHistoryLimit:
-				if spec.FailedHistoryLimit != nil {
-					fieldData = spec.FailedHistoryLimit
-				} else {
-					fieldData = spec.HistoryLimit
-				}
+				fieldData = spec.getFailedHistoryLimit()
+
+			case PrunerFieldTypeHistoryLimit:
+				fieldData = spec.getHistoryLimit()
 			}
 			identified_by = "identified_by_ns"
 		} else {
@@ -345,19 +881,35 @@ func getResourceFieldData(globalSpec GlobalConfig, namespace, name string, selec
 			case PrunerFieldTypeTTLSecondsAfterFinished:
 				fieldData = globalSpec.TTLSecondsAfterFinished
 
+			case PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults:
+				fieldData = globalSpec.TTLSecondsAfterFinishedWithoutResults
+
+			case PrunerFieldTypeTTLJitterSeconds:
+				fieldData = globalSpec.TTLJitterSeconds
+
+			case PrunerFieldTypeMinRetained:
+				fieldData = globalSpec.MinRetained
+
+			case PrunerFieldTypeMinRetentionSeconds:
+				fieldData = globalSpec.MinRetentionSeconds
+
+			case PrunerFieldTypeMinRetainedPerOutcome:
+				fieldData = globalSpec.MinRetainedPerOutcome
+
+			case PrunerFieldTypeRetainCalendarDays:
+				fieldData = globalSpec.RetainCalendarDays
+
+			case PrunerFieldTypeMaxRetentionAgeSeconds:
+				fieldData = globalSpec.MaxRetentionAgeSeconds
+
 			case PrunerFieldTypeSuccessfulHistoryLimit:
-				if globalSpec.SuccessfulHistoryLimit != nil {
-					fieldData = globalSpec.SuccessfulHistoryLimit
-				} else {
-					fieldData = globalSpec.HistoryLimit
-				}
+				fieldData = globalSpec.getSuccessfulHistoryLimit()
 
 			case PrunerFieldTypeFailedHistoryLimit:
-				if globalSpec.FailedHistoryLimit != nil {
-					fieldData = globalSpec.FailedHistoryLimit
-				} else {
-					fieldData = globalSpec.HistoryLimit
-				}
+				fieldData = globalSpec.getFailedHistoryLimit()
+
+			case PrunerFieldTypeHistoryLimit:
+				fieldData = globalSpec.getHistoryLimit()
 			}
 			identified_by = "identified_by_global"
 		}
@@ -369,19 +921,35 @@ func getResourceFieldData(globalSpec GlobalConfig, namespace, name string, selec
 		case PrunerFieldTypeTTLSecondsAfterFinished:
 			fieldData = globalSpec.TTLSecondsAfterFinished
 
+		case PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults:
+			fieldData = globalSpec.TTLSecondsAfterFinishedWithoutResults
+
+		case PrunerFieldTypeTTLJitterSeconds:
+			fieldData = globalSpec.TTLJitterSeconds
+
+		case PrunerFieldTypeMinRetained:
+			fieldData = globalSpec.MinRetained
+
+		case PrunerFieldTypeMinRetentionSeconds:
+			fieldData = globalSpec.MinRetentionSeconds
+
+		case PrunerFieldTypeMinRetainedPerOutcome:
+			fieldData = globalSpec.MinRetainedPerOutcome
+
+		case PrunerFieldTypeRetainCalendarDays:
+			fieldData = globalSpec.RetainCalendarDays
+
+		case PrunerFieldTypeMaxRetentionAgeSeconds:
+			fieldData = globalSpec.MaxRetentionAgeSeconds
+
 		case PrunerFieldTypeSuccessfulHistoryLimit:
-			if globalSpec.SuccessfulHistoryLimit != nil {
-				fieldData = globalSpec.SuccessfulHistoryLimit
-			} else {
-				fieldData = globalSpec.HistoryLimit
-			}
+			fieldData = globalSpec.getSuccessfulHistoryLimit()
 
 		case PrunerFieldTypeFailedHistoryLimit:
-			if globalSpec.FailedHistoryLimit != nil {
-				fieldData = globalSpec.FailedHistoryLimit
-			} else {
-				fieldData = globalSpec.HistoryLimit
-			}
+			fieldData = globalSpec.getFailedHistoryLimit()
+
+		case PrunerFieldTypeHistoryLimit:
+			fieldData = globalSpec.getHistoryLimit()
 		}
 		identified_by = "identified_by_global"
 	}
@@ -389,28 +957,211 @@ func getResourceFieldData(globalSpec GlobalConfig, namespace, name string, selec
 	return fieldData, identified_by
 }
 
+// GetOwnerReferenceSelectors returns the owner reference selectors of the resource spec
+// matching the owner references, nil if there is no match
+func (ps *prunerConfigStore) GetOwnerReferenceSelectors(namespace string, resourceType PrunerResourceType, ownerReferences []OwnerReferenceSelector) []OwnerReferenceSelector {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	namespaceSpec, found := ps.effectiveConfig().Namespaces[namespace]
+	if !found {
+		return nil
+	}
+	_, selectorSpec := getResourceSpecByOwnerReferences(getResourceSpecs(namespaceSpec, resourceType), ownerReferences)
+	if selectorSpec == nil {
+		return nil
+	}
+	return selectorSpec.MatchOwnerReferences
+}
+
+// GetReprocessGeneration returns the reprocess generation of the config map,
+// the resources processed on another generation are processed again
+func (ps *prunerConfigStore) GetReprocessGeneration() string {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.reprocessGeneration
+}
+
+// IsExcluded returns true if the annotations match any of the globally excluded annotations
+func (ps *prunerConfigStore) IsExcluded(annotations map[string]string) bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	for key, value := range ps.globalConfig.ExcludeAnnotations {
+		annotationValue, found := annotations[key]
+		if found && (value == "" || value == annotationValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetExcludedRunsMaxAge returns the age in seconds the completed excluded runs are deleted at
+// regardless of the exclusion, nil when the excluded runs are never deleted
+func (ps *prunerConfigStore) GetExcludedRunsMaxAge() *int32 {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	if ps.globalConfig.ExcludedRunsMaxAgeSeconds == nil {
+		return nil
+	}
+	return ptr.Int32(*ps.globalConfig.ExcludedRunsMaxAgeSeconds)
+}
+
+// GetLocation returns the timezone of the config, UTC when it is not set
+func (ps *prunerConfigStore) GetLocation() *time.Location {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	if ps.location == nil {
+		return time.UTC
+	}
+	return ps.location
+}
+
+// GetQuarantine returns the ttl and the history limit of the quarantine when the labels and the annotations
+// of a failed run match it, quarantined is false when they do not match
+func (ps *prunerConfigStore) GetQuarantine(resourceLabels, resourceAnnotations map[string]string) (ttl, historyLimit *int32, quarantined bool) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	quarantine := ps.globalConfig.Quarantine
+	if !quarantine.matches(resourceLabels, resourceAnnotations) {
+		return nil, nil, false
+	}
+	if quarantine.TTLSecondsAfterFinished != nil {
+		ttl = ptr.Int32(*quarantine.TTLSecondsAfterFinished)
+	}
+	if quarantine.HistoryLimit != nil {
+		historyLimit = ptr.Int32(*quarantine.HistoryLimit)
+	}
+	return ttl, historyLimit, true
+}
+
+// GetEphemeral returns the ttl and the history limit of the ephemeral config when the annotations mark
+// an ephemeral run, ephemeral is false when they do not
+func (ps *prunerConfigStore) GetEphemeral(resourceAnnotations map[string]string) (ttl, historyLimit *int32, ephemeral bool) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	ephemeralConfig := ps.globalConfig.Ephemeral
+	if !ephemeralConfig.matches(resourceAnnotations) {
+		return nil, nil, false
+	}
+	if ephemeralConfig.TTLSecondsAfterFinished != nil {
+		ttl = ptr.Int32(*ephemeralConfig.TTLSecondsAfterFinished)
+	}
+	if ephemeralConfig.HistoryLimit != nil {
+		historyLimit = ptr.Int32(*ephemeralConfig.HistoryLimit)
+	}
+	return ttl, historyLimit, true
+}
+
+// GetMaxCompletedRunsPerNamespace returns the number of completed runs of a type a namespace holds
+// before the oldest ones are deleted, nil when it is not limited
+func (ps *prunerConfigStore) GetMaxCompletedRunsPerNamespace() *int32 {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	if ps.globalConfig.MaxCompletedRunsPerNamespace == nil {
+		return nil
+	}
+	return ptr.Int32(*ps.globalConfig.MaxCompletedRunsPerNamespace)
+}
+
+// IsChildTaskRunsExcludedFromLimits returns true when the TaskRuns of a PipelineRun are not counted on the TaskRun history limits
+func (ps *prunerConfigStore) IsChildTaskRunsExcludedFromLimits() bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.globalConfig.ExcludeChildTaskRunsFromLimits
+}
+
+// GetStartupCutoff returns the time the runs completed before are not managed, false when it is not set or invalid
+func (ps *prunerConfigStore) GetStartupCutoff() (time.Time, bool) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return parseStartupCutoff(ps.globalConfig.StartupCutoffTime)
+}
+
+// GetHistoryLimitTighteningStep returns the number of runs a history cleanup pass deletes at most, nil when it is not capped
+func (ps *prunerConfigStore) GetHistoryLimitTighteningStep() *int32 {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	if ps.globalConfig.HistoryLimitTighteningStep == nil {
+		return nil
+	}
+	return ptr.Int32(*ps.globalConfig.HistoryLimitTighteningStep)
+}
+
+// IsHistorySelfPruneEnabled returns true when a history cleanup deletes the reconciled run only
+func (ps *prunerConfigStore) IsHistorySelfPruneEnabled() bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.globalConfig.HistorySelfPrune
+}
+
+// GetHistoryCleanupCooldown returns the minimum interval between two history cleanups of a group, zero when disabled
+func (ps *prunerConfigStore) GetHistoryCleanupCooldown() time.Duration {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	if ps.globalConfig.HistoryCleanupCooldownSeconds == nil {
+		return 0
+	}
+	return time.Duration(*ps.globalConfig.HistoryCleanupCooldownSeconds) * time.Second
+}
+
+// GetMaxRunningAge returns the seconds after their start the runs not completed are flagged as stuck,
+// nil when the stuck runs are not detected, and whether the stuck runs are deleted
+func (ps *prunerConfigStore) GetMaxRunningAge() (*int32, bool) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	if ps.globalConfig.MaxRunningAgeSeconds == nil {
+		return nil, false
+	}
+	return ptr.Int32(*ps.globalConfig.MaxRunningAgeSeconds), ps.globalConfig.DeleteStuckRuns
+}
+
+// GetFailureBucket returns the bucket the reason of a failed run is mapped to and the history limit of the bucket,
+// the limit is nil when the reason is not mapped or the bucket has no limit
+func (ps *prunerConfigStore) GetFailureBucket(reason string) (string, *int32) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	bucket, found := ps.globalConfig.FailureReasonMapping[reason]
+	if !found {
+		return "", nil
+	}
+	limit, found := ps.globalConfig.FailedHistoryLimitsByBucket[bucket]
+	if !found {
+		return bucket, nil
+	}
+	return bucket, &limit
+}
+
 func (ps *prunerConfigStore) GetEnforcedConfigLevelFromNamespaceSpec(namespacesSpec map[string]NamespaceSpec, namespace, name string, selector SelectorSpec, resourceType PrunerResourceType) *EnforcedConfigLevel {
 	var enforcedConfigLevel *EnforcedConfigLevel
 
-	namespaceSpec, found := ps.globalConfig.Namespaces[namespace]
+	namespaceSpec, found := namespacesSpec[namespace]
 	if !found {
 		return nil
 	}
 
 	// Get the appropriate resource specs based on type
-	var resourceSpecs []ResourceSpec
-	switch resourceType {
-	case PrunerResourceTypePipelineRun:
-		resourceSpecs = namespaceSpec.PipelineRuns
-	case PrunerResourceTypeTaskRun:
-		resourceSpecs = namespaceSpec.TaskRuns
+	resourceSpecs := getResourceSpecs(namespaceSpec, resourceType)
+
+	// Owner references are the most specific match
+	if resourceSpec, _ := getResourceSpecByOwnerReferences(resourceSpecs, selector.MatchOwnerReferences); resourceSpec != nil && resourceSpec.EnforcedConfigLevel != nil {
+		return resourceSpec.EnforcedConfigLevel
 	}
 
 	// Try to find resource level config first
 	if name != "" && (len(selector.MatchAnnotations) == 0 && len(selector.MatchLabels) == 0) {
 		// Search by exact name
 		for _, resourceSpec := range resourceSpecs {
-			if resourceSpec.Name == name {
+			if matchesResourceName(resourceSpec.Name, name) {
 				enforcedConfigLevel = resourceSpec.EnforcedConfigLevel
 				if enforcedConfigLevel != nil {
 					return enforcedConfigLevel
@@ -465,23 +1216,49 @@ func (ps *prunerConfigStore) GetEnforcedConfigLevelFromNamespaceSpec(namespacesS
 	return namespaceSpec.EnforcedConfigLevel
 }
 
+// getEnforcedConfigLevel returns the level enforced on the resource. The level declared on the
+// global config, resource if not set, can only be narrowed down by the namespace level and then
+// by the resource level, a nested level which opens the config to a narrower scope is ignored
 func (ps *prunerConfigStore) getEnforcedConfigLevel(namespace, name string, selector SelectorSpec, resourceType PrunerResourceType) EnforcedConfigLevel {
-	var enforcedConfigLevel *EnforcedConfigLevel
+	return ps.traceEnforcedConfigLevel(namespace, name, selector, resourceType, nil)
+}
 
-	// get it from global spec (order: resource level, namespace root level)
-	enforcedConfigLevel = ps.GetEnforcedConfigLevelFromNamespaceSpec(ps.globalConfig.Namespaces, namespace, name, selector, resourceType)
-	if enforcedConfigLevel != nil {
-		return *enforcedConfigLevel
+// traceEnforcedConfigLevel resolves the enforced config level, each level checked is appended to the steps when not nil
+func (ps *prunerConfigStore) traceEnforcedConfigLevel(namespace, name string, selector SelectorSpec, resourceType PrunerResourceType, steps *[]string) EnforcedConfigLevel {
+	trace := func(format string, args ...interface{}) {
+		if steps != nil {
+			*steps = append(*steps, fmt.Sprintf(format, args...))
+		}
 	}
 
+	// default level, if no where specified
+	enforcedConfigLevel := EnforcedConfigLevelResource
+
 	// get it from global spec, root level
-	enforcedConfigLevel = ps.globalConfig.EnforcedConfigLevel
-	if enforcedConfigLevel != nil {
-		return *enforcedConfigLevel
+	if ps.globalConfig.EnforcedConfigLevel != nil {
+		enforcedConfigLevel = *ps.globalConfig.EnforcedConfigLevel
+		trace("the global config enforces the %s level", enforcedConfigLevel)
+	} else {
+		trace("the global config does not set enforcedConfigLevel, defaulting to the %s level", enforcedConfigLevel)
 	}
 
-	// default level, if no where specified
-	return EnforcedConfigLevelResource
+	// narrow it by the namespace root level
+	namespaces := ps.effectiveConfig().Namespaces
+	namespaceSpec, found := namespaces[namespace]
+	if found && namespaceSpec.EnforcedConfigLevel != nil {
+		enforcedConfigLevel = enforcedConfigLevel.narrow(*namespaceSpec.EnforcedConfigLevel)
+		trace("the namespace %s sets the %s level, the enforced level is %s", namespace, *namespaceSpec.EnforcedConfigLevel, enforcedConfigLevel)
+	}
+
+	// narrow it by the resource level, the namespace root level is returned when there is none
+	if level := ps.GetEnforcedConfigLevelFromNamespaceSpec(namespaces, namespace, name, selector, resourceType); level != nil {
+		enforcedConfigLevel = enforcedConfigLevel.narrow(*level)
+		if level != namespaceSpec.EnforcedConfigLevel {
+			trace("the matching %s spec of the namespace sets the %s level, the enforced level is %s", resourceType, *level, enforcedConfigLevel)
+		}
+	}
+
+	return enforcedConfigLevel
 }
 
 func (ps *prunerConfigStore) GetPipelineEnforcedConfigLevel(namespace, name string, selector SelectorSpec) EnforcedConfigLevel {
@@ -492,44 +1269,141 @@ func (ps *prunerConfigStore) GetTaskEnforcedConfigLevel(namespace, name string,
 	return ps.getEnforcedConfigLevel(namespace, name, selector, PrunerResourceTypeTaskRun)
 }
 
-func (ps *prunerConfigStore) GetPipelineTTLSecondsAfterFinished(namespace, name string, selector SelectorSpec) (*int32, string) {
+// getResourceField resolves a field of the resource, the resolved fields are cached until the config is reloaded
+func (ps *prunerConfigStore) getResourceField(namespace, name string, selector SelectorSpec, resourceType PrunerResourceType, fieldType PrunerFieldType) (*int32, string) {
 	ps.mutex.Lock()
 	defer ps.mutex.Unlock()
-	enforcedConfigLevel := ps.GetPipelineEnforcedConfigLevel(namespace, name, selector)
-	return getResourceFieldData(ps.globalConfig, namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeTTLSecondsAfterFinished, enforcedConfigLevel)
+
+	key := resolvedConfigCacheKey(namespace, name, selector, resourceType, fieldType)
+	field, found := ps.cache.get(ps.generation, key)
+	if !found {
+		enforcedConfigLevel := ps.getEnforcedConfigLevel(namespace, name, selector, resourceType)
+		field.value, field.identifiedBy = getResourceFieldData(ps.effectiveConfig(), namespace, name, selector, resourceType, fieldType, enforcedConfigLevel)
+		ps.cache.put(ps.generation, key, field)
+	}
+	metrics.GetRecorder().RecordConfigResolution(context.Background(), resourceTypeMetricsLabel(resourceType), string(fieldType), configSource(field.identifiedBy))
+
+	// the callers get their own copy of the value
+	if field.value == nil {
+		return nil, field.identifiedBy
+	}
+	value := *field.value
+	return &value, field.identifiedBy
+}
+
+// configSource returns the metrics label of the source a config field is identified by
+func configSource(identifiedBy string) string {
+	switch identifiedBy {
+	case "identified_by_global", "identifiedBy_global":
+		return metrics.ConfigSourceGlobal
+	case "identified_by_ns":
+		return metrics.ConfigSourceNamespace
+	case "identified_by_ns_label":
+		return metrics.ConfigSourceNamespaceLabel
+	case "identifiedBy_resource_name":
+		return metrics.ConfigSourceResourceName
+	case "identifiedBy_resource_label":
+		return metrics.ConfigSourceResourceLabel
+	case "identifiedBy_resource_ann":
+		return metrics.ConfigSourceResourceAnnotation
+	case "identifiedBy_resource_owner":
+		return metrics.ConfigSourceResourceOwner
+	}
+	return metrics.ConfigSourceUnknown
+}
+
+// resourceTypeMetricsLabel returns the metrics label of the resource type
+func resourceTypeMetricsLabel(resourceType PrunerResourceType) string {
+	if resourceType == PrunerResourceTypeTaskRun {
+		return metrics.ResourceTypeTaskRun
+	}
+	return metrics.ResourceTypePipelineRun
+}
+
+func (ps *prunerConfigStore) GetPipelineTTLSecondsAfterFinished(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeTTLSecondsAfterFinished)
+}
+
+func (ps *prunerConfigStore) GetPipelineTTLSecondsAfterFinishedWithoutResults(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults)
+}
+
+func (ps *prunerConfigStore) GetPipelineTTLJitterSeconds(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeTTLJitterSeconds)
+}
+
+func (ps *prunerConfigStore) GetPipelineRetainCalendarDays(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeRetainCalendarDays)
+}
+
+func (ps *prunerConfigStore) GetPipelineMinRetained(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeMinRetained)
+}
+
+func (ps *prunerConfigStore) GetPipelineMinRetentionSeconds(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeMinRetentionSeconds)
+}
+
+func (ps *prunerConfigStore) GetPipelineMinRetainedPerOutcome(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeMinRetainedPerOutcome)
+}
+
+func (ps *prunerConfigStore) GetPipelineMaxRetentionAgeSeconds(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeMaxRetentionAgeSeconds)
 }
 
 func (ps *prunerConfigStore) GetPipelineSuccessHistoryLimitCount(namespace, name string, selector SelectorSpec) (*int32, string) {
-	ps.mutex.Lock()
-	defer ps.mutex.Unlock()
-	enforcedConfigLevel := ps.GetPipelineEnforcedConfigLevel(namespace, name, selector)
-	return getResourceFieldData(ps.globalConfig, namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeSuccessfulHistoryLimit, enforcedConfigLevel)
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeSuccessfulHistoryLimit)
 }
 
 func (ps *prunerConfigStore) GetPipelineFailedHistoryLimitCount(namespace, name string, selector SelectorSpec) (*int32, string) {
-	ps.mutex.Lock()
-	defer ps.mutex.Unlock()
-	enforcedConfigLevel := ps.GetPipelineEnforcedConfigLevel(namespace, name, selector)
-	return getResourceFieldData(ps.globalConfig, namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeFailedHistoryLimit, enforcedConfigLevel)
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeFailedHistoryLimit)
+}
+
+func (ps *prunerConfigStore) GetPipelineHistoryLimitCount(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypePipelineRun, PrunerFieldTypeHistoryLimit)
 }
 
 func (ps *prunerConfigStore) GetTaskTTLSecondsAfterFinished(namespace, name string, selector SelectorSpec) (*int32, string) {
-	ps.mutex.Lock()
-	defer ps.mutex.Unlock()
-	enforcedConfigLevel := ps.GetTaskEnforcedConfigLevel(namespace, name, selector)
-	return getResourceFieldData(ps.globalConfig, namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeTTLSecondsAfterFinished, enforcedConfigLevel)
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeTTLSecondsAfterFinished)
+}
+
+func (ps *prunerConfigStore) GetTaskTTLSecondsAfterFinishedWithoutResults(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults)
+}
+
+func (ps *prunerConfigStore) GetTaskTTLJitterSeconds(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeTTLJitterSeconds)
+}
+
+func (ps *prunerConfigStore) GetTaskRetainCalendarDays(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeRetainCalendarDays)
+}
+
+func (ps *prunerConfigStore) GetTaskMinRetained(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeMinRetained)
+}
+
+func (ps *prunerConfigStore) GetTaskMinRetentionSeconds(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeMinRetentionSeconds)
+}
+
+func (ps *prunerConfigStore) GetTaskMinRetainedPerOutcome(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeMinRetainedPerOutcome)
+}
+
+func (ps *prunerConfigStore) GetTaskMaxRetentionAgeSeconds(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeMaxRetentionAgeSeconds)
 }
 
 func (ps *prunerConfigStore) GetTaskSuccessHistoryLimitCount(namespace, name string, selector SelectorSpec) (*int32, string) {
-	ps.mutex.Lock()
-	defer ps.mutex.Unlock()
-	enforcedConfigLevel := ps.GetTaskEnforcedConfigLevel(namespace, name, selector)
-	return getResourceFieldData(ps.globalConfig, namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeSuccessfulHistoryLimit, enforcedConfigLevel)
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeSuccessfulHistoryLimit)
 }
 
 func (ps *prunerConfigStore) GetTaskFailedHistoryLimitCount(namespace, name string, selector SelectorSpec) (*int32, string) {
-	ps.mutex.Lock()
-	defer ps.mutex.Unlock()
-	enforcedConfigLevel := ps.GetTaskEnforcedConfigLevel(namespace, name, selector)
-	return getResourceFieldData(ps.globalConfig, namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeFailedHistoryLimit, enforcedConfigLevel)
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeFailedHistoryLimit)
+}
+
+func (ps *prunerConfigStore) GetTaskHistoryLimitCount(namespace, name string, selector SelectorSpec) (*int32, string) {
+	return ps.getResourceField(namespace, name, selector, PrunerResourceTypeTaskRun, PrunerFieldTypeHistoryLimit)
 }
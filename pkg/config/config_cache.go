@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// resolvedConfigCacheSize is the maximum number of the resolved fields held by the cache,
+// the cache is cleared when it is full
+const resolvedConfigCacheSize = 10000
+
+// resolvedConfigCacheKeySeparator separates the parts of the cache key, it can not be part of a name, label or annotation
+const resolvedConfigCacheKeySeparator = '\x00'
+
+// resolvedField is a field value resolved from the config along with the level it is identified by
+type resolvedField struct {
+	value        *int32
+	identifiedBy string
+}
+
+// resolvedConfigCache holds the resolved fields keyed by the resource and its selectors.
+// The cache belongs to a generation of the config, it is cleared when the generation changes.
+// It is not safe for concurrent use, the config store guards it with its own mutex
+type resolvedConfigCache struct {
+	generation uint64
+	entries    map[string]resolvedField
+}
+
+// get returns the cached field of the given generation
+func (c *resolvedConfigCache) get(generation uint64, key string) (resolvedField, bool) {
+	if c.generation != generation {
+		return resolvedField{}, false
+	}
+	field, found := c.entries[key]
+	return field, found
+}
+
+// put caches the field on the given generation, the entries of the other generations are dropped
+func (c *resolvedConfigCache) put(generation uint64, key string, field resolvedField) {
+	if c.generation != generation || c.entries == nil || len(c.entries) >= resolvedConfigCacheSize {
+		c.generation = generation
+		c.entries = make(map[string]resolvedField)
+	}
+	c.entries[key] = field
+}
+
+// resolvedConfigCacheKey builds the cache key of a field of a resource, the selectors are
+// part of the key as the labels, annotations and owners of the resource drive the resolution
+func resolvedConfigCacheKey(namespace, name string, selector SelectorSpec, resourceType PrunerResourceType, fieldType PrunerFieldType) string {
+	var key strings.Builder
+	key.WriteString(string(resourceType))
+	key.WriteByte(resolvedConfigCacheKeySeparator)
+	key.WriteString(string(fieldType))
+	key.WriteByte(resolvedConfigCacheKeySeparator)
+	key.WriteString(namespace)
+	key.WriteByte(resolvedConfigCacheKeySeparator)
+	key.WriteString(name)
+	writeSortedMap(&key, 'l', selector.MatchLabels)
+	writeSortedMap(&key, 'a', selector.MatchAnnotations)
+	for _, ownerReference := range selector.MatchOwnerReferences {
+		key.WriteByte(resolvedConfigCacheKeySeparator)
+		key.WriteByte('o')
+		key.WriteString(ownerReference.Kind)
+		key.WriteByte('/')
+		key.WriteString(ownerReference.Name)
+	}
+	return key.String()
+}
+
+// writeSortedMap writes the map entries to the key in the order of the map keys
+func writeSortedMap(key *strings.Builder, prefix byte, values map[string]string) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key.WriteByte(resolvedConfigCacheKeySeparator)
+		key.WriteByte(prefix)
+		key.WriteString(name)
+		key.WriteByte('=')
+		key.WriteString(values[name])
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/ptr"
+)
+
+func TestResolvedConfigCacheInvalidation(t *testing.T) {
+	selector := SelectorSpec{MatchLabels: map[string]string{"app": "web"}}
+
+	loadTestConfig(t, "ttlSecondsAfterFinished: 600")
+	ttl, _ := PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "build", selector)
+	if ttl == nil || *ttl != 600 {
+		t.Fatalf("ttl = %v, want 600", ttl)
+	}
+
+	// the caller owns the returned value, changing it does not alter the cached value
+	*ttl = 1
+	ttl, _ = PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "build", selector)
+	if ttl == nil || *ttl != 600 {
+		t.Fatalf("cached ttl = %v, want 600", ttl)
+	}
+
+	loadTestConfig(t, "ttlSecondsAfterFinished: 300")
+	ttl, _ = PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "build", selector)
+	if ttl == nil || *ttl != 300 {
+		t.Fatalf("ttl after LoadGlobalConfig = %v, want 300", ttl)
+	}
+
+	PrunerConfigStore.LoadNamespacedConfig(context.Background(), map[string]NamespaceSpec{
+		"dev": {PrunerConfig: PrunerConfig{TTLSecondsAfterFinished: ptr.Int32(60)}},
+	})
+	t.Cleanup(func() { PrunerConfigStore.LoadNamespacedConfig(context.Background(), nil) })
+	ttl, _ = PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "build", selector)
+	if ttl == nil || *ttl != 60 {
+		t.Fatalf("ttl after LoadNamespacedConfig = %v, want 60", ttl)
+	}
+}
+
+func TestResolvedConfigCacheSelectors(t *testing.T) {
+	loadTestConfig(t, `ttlSecondsAfterFinished: 600
+namespaces:
+  dev:
+    ttlSecondsAfterFinished: 300
+    pipelineRuns:
+      - selector:
+          - matchLabels:
+              app: web
+        ttlSecondsAfterFinished: 60`)
+
+	web := SelectorSpec{MatchLabels: map[string]string{"app": "web"}}
+	api := SelectorSpec{MatchLabels: map[string]string{"app": "api"}}
+
+	// the resources differing by labels only do not share the cached value
+	for i := 0; i < 2; i++ {
+		if ttl, _ := PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "", web); ttl == nil || *ttl != 60 {
+			t.Fatalf("ttl of app=web = %v, want 60", ttl)
+		}
+		if ttl, _ := PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "", api); ttl == nil || *ttl != 300 {
+			t.Fatalf("ttl of app=api = %v, want 300", ttl)
+		}
+		// the same field of the other resource type is resolved separately
+		if ttl, _ := PrunerConfigStore.GetTaskTTLSecondsAfterFinished("dev", "", web); ttl == nil || *ttl != 300 {
+			t.Fatalf("ttl of the TaskRun with app=web = %v, want 300", ttl)
+		}
+	}
+}
+
+func TestResolvedConfigCacheBounded(t *testing.T) {
+	cache := resolvedConfigCache{}
+	for i := 0; i <= resolvedConfigCacheSize; i++ {
+		cache.put(1, string(rune(i)), resolvedField{})
+	}
+	if len(cache.entries) > resolvedConfigCacheSize {
+		t.Errorf("cache holds %d entries, want at most %d", len(cache.entries), resolvedConfigCacheSize)
+	}
+}
+
+func BenchmarkResolveConfig(b *testing.B) {
+	configMap := &corev1.ConfigMap{Data: map[string]string{PrunerGlobalConfigKey: `enforcedConfigLevel: resource
+ttlSecondsAfterFinished: 3600
+namespaces:
+  dev:
+    ttlSecondsAfterFinished: 600
+    ttlOverrides:
+      - labelSelector: "tier in (frontend, backend)"
+        ttlSecondsAfterFinished: 120
+    pipelineRuns:
+      - name: build
+        ttlSecondsAfterFinished: 60
+      - selector:
+          - matchLabels:
+              app: web
+        ttlSecondsAfterFinished: 30`}}
+	if err := PrunerConfigStore.LoadGlobalConfig(context.Background(), configMap); err != nil {
+		b.Fatalf("failed to load the config: %v", err)
+	}
+	b.Cleanup(func() { _ = PrunerConfigStore.LoadGlobalConfig(context.Background(), &corev1.ConfigMap{}) })
+	PrunerConfigStore.LoadNamespacedConfig(context.Background(), map[string]NamespaceSpec{
+		"prod": {PrunerConfig: PrunerConfig{TTLSecondsAfterFinished: ptr.Int32(60)}},
+	})
+	b.Cleanup(func() { PrunerConfigStore.LoadNamespacedConfig(context.Background(), nil) })
+
+	selector := SelectorSpec{MatchLabels: map[string]string{"app": "api", "tier": "backend"}}
+
+	b.Run("cache hit", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "deploy", selector)
+		}
+	})
+
+	b.Run("cache miss", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			// a new generation invalidates the cache as a config reload does
+			PrunerConfigStore.mutex.Lock()
+			PrunerConfigStore.generation++
+			PrunerConfigStore.mutex.Unlock()
+			PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "deploy", selector)
+		}
+	})
+}
+
+func TestConfigGeneration(t *testing.T) {
+	generation := func() uint64 {
+		PrunerConfigStore.mutex.Lock()
+		defer PrunerConfigStore.mutex.Unlock()
+		return PrunerConfigStore.generation
+	}
+
+	loadTestConfig(t, "ttlSecondsAfterFinished: 600")
+	initial := generation()
+
+	// reloading the same config keeps the generation
+	loadTestConfig(t, "ttlSecondsAfterFinished: 600")
+	if got := generation(); got != initial {
+		t.Errorf("generation after a no-op reload = %d, want %d", got, initial)
+	}
+
+	loadTestConfig(t, "ttlSecondsAfterFinished: 300")
+	if got := generation(); got != initial+1 {
+		t.Errorf("generation after a reload = %d, want %d", got, initial+1)
+	}
+
+	// a config which fails to load keeps the generation
+	err := PrunerConfigStore.LoadGlobalConfig(context.Background(), &corev1.ConfigMap{
+		Data: map[string]string{PrunerGlobalConfigKey: "ttlSecondsAfterFinished: [invalid"},
+	})
+	if err == nil {
+		t.Fatal("LoadGlobalConfig() error = nil, want error")
+	}
+	if got := generation(); got != initial+1 {
+		t.Errorf("generation after a failed reload = %d, want %d", got, initial+1)
+	}
+
+	namespacedConfig := map[string]NamespaceSpec{"dev": {PrunerConfig: PrunerConfig{TTLSecondsAfterFinished: ptr.Int32(60)}}}
+	PrunerConfigStore.LoadNamespacedConfig(context.Background(), namespacedConfig)
+	t.Cleanup(func() { PrunerConfigStore.LoadNamespacedConfig(context.Background(), nil) })
+	PrunerConfigStore.LoadNamespacedConfig(context.Background(), namespacedConfig)
+	if got := generation(); got != initial+2 {
+		t.Errorf("generation after the namespaced config reloads = %d, want %d", got, initial+2)
+	}
+}
+
+func TestEffectiveConfigMergedOnLoad(t *testing.T) {
+	loadTestConfig(t, "ttlSecondsAfterFinished: 600")
+	PrunerConfigStore.LoadNamespacedConfig(context.Background(), map[string]NamespaceSpec{
+		"dev": {PrunerConfig: PrunerConfig{TTLSecondsAfterFinished: ptr.Int32(60)}},
+	})
+	t.Cleanup(func() { PrunerConfigStore.LoadNamespacedConfig(context.Background(), nil) })
+
+	// the getters share the config merged on the load, rather than merging it on every call
+	first := PrunerConfigStore.effectiveConfig()
+	second := PrunerConfigStore.effectiveConfig()
+	if spec, found := first.Namespaces["dev"]; !found || spec.TTLSecondsAfterFinished == nil || *spec.TTLSecondsAfterFinished != 60 {
+		t.Fatalf("effective config of dev = %+v, want the namespaced config", spec)
+	}
+	if reflect.ValueOf(first.Namespaces).Pointer() != reflect.ValueOf(second.Namespaces).Pointer() {
+		t.Error("effective config is merged again, want the config merged on the load")
+	}
+
+	PrunerConfigStore.DeleteNamespacedSpec(context.Background(), "dev")
+	if _, found := PrunerConfigStore.effectiveConfig().Namespaces["dev"]; found {
+		t.Error("effective config holds dev after its deletion")
+	}
+}
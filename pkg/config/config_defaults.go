@@ -18,9 +18,12 @@ package config
 
 import "knative.dev/pkg/ptr"
 
+// SetDefaults sets the default history limits per outcome when no history limit is set. historyLimit is left
+// unset, it is the combined limit of the successful and the failed runs only when it is set explicitly
 func (pc *PrunerConfig) SetDefaults() {
-	if pc.HistoryLimit == nil {
-		pc.HistoryLimit = ptr.Int32(DefaultHistoryLimit)
+	if pc.HistoryLimit == nil && pc.SuccessfulHistoryLimit == nil && pc.FailedHistoryLimit == nil {
+		pc.SuccessfulHistoryLimit = ptr.Int32(DefaultHistoryLimit)
+		pc.FailedHistoryLimit = ptr.Int32(DefaultHistoryLimit)
 	}
 	if pc.EnforcedConfigLevel == nil {
 		v := EnforcedConfigLevelGlobal
@@ -0,0 +1,57 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+)
+
+// ConfigGate requeues the runs reconciled before the global config is loaded, a race on the controller start,
+// so they are not processed with an empty config
+type ConfigGate struct {
+	isLoaded     func() bool
+	requeueAfter time.Duration
+}
+
+// NewConfigGate creates a ConfigGate requeuing the runs after the given time until isLoaded returns true
+func NewConfigGate(isLoaded func() bool, requeueAfter time.Duration) *ConfigGate {
+	return &ConfigGate{isLoaded: isLoaded, requeueAfter: requeueAfter}
+}
+
+// GetConfigGate returns the ConfigGate of the config store, it is nil when the requeue time is set to 0
+func GetConfigGate() (*ConfigGate, error) {
+	requeueSeconds, err := GetEnvValueAsInt(EnvConfigNotReadyRequeueSeconds, DefaultConfigNotReadyRequeueSeconds)
+	if err != nil || requeueSeconds <= 0 {
+		return nil, err
+	}
+	return NewConfigGate(PrunerConfigStore.IsLoaded, time.Duration(requeueSeconds)*time.Second), nil
+}
+
+// Check returns a requeue error when the global config is not loaded yet. A nil ConfigGate never requeues
+func (cg *ConfigGate) Check(ctx context.Context, resource metav1.Object) error {
+	if cg == nil || cg.isLoaded() {
+		return nil
+	}
+	logging.FromContext(ctx).Debugw("the global config is not loaded yet, requeuing the resource",
+		"namespace", resource.GetNamespace(), "name", resource.GetName(), "requeueAfter", cg.requeueAfter)
+	return controller.NewRequeueAfter(cg.requeueAfter)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/controller"
+)
+
+func TestConfigGate(t *testing.T) {
+	ctx := context.Background()
+	resource := &mockResource{ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "default"}}
+
+	// a nil gate never requeues
+	var gate *ConfigGate
+	assert.NoError(t, gate.Check(ctx, resource))
+
+	store := &prunerConfigStore{}
+	gate = NewConfigGate(store.IsLoaded, 5*time.Second)
+	ok, delay := controller.IsRequeueKey(gate.Check(ctx, resource))
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, delay)
+
+	// a rejected config is not loaded
+	assert.Error(t, store.LoadGlobalConfig(ctx, &corev1.ConfigMap{Data: map[string]string{PrunerGlobalConfigKey: "timezone: Nowhere/Invalid"}}))
+	ok, _ = controller.IsRequeueKey(gate.Check(ctx, resource))
+	assert.True(t, ok)
+
+	// an empty config is loaded, the defaults apply
+	assert.NoError(t, store.LoadGlobalConfig(ctx, &corev1.ConfigMap{}))
+	assert.NoError(t, gate.Check(ctx, resource))
+}
+
+func TestGetConfigGate(t *testing.T) {
+	t.Setenv(EnvConfigNotReadyRequeueSeconds, "0")
+	gate, err := GetConfigGate()
+	assert.NoError(t, err)
+	assert.Nil(t, gate)
+
+	t.Setenv(EnvConfigNotReadyRequeueSeconds, "10")
+	gate, err = GetConfigGate()
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, gate.requeueAfter)
+
+	t.Setenv(EnvConfigNotReadyRequeueSeconds, "soon")
+	_, err = GetConfigGate()
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConfigChecksum returns the checksum of the global config to be set on the checksum annotation of the config map
+func ConfigChecksum(globalConfig string) string {
+	sum := sha256.Sum256([]byte(globalConfig))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkConfigIntegrity checks the config map holds the complete config, the data of a config map over the
+// size limit or not matching the checksum annotation is partial. Returns the reason of the rejection and the error
+func checkConfigIntegrity(configMap *corev1.ConfigMap) (string, error) {
+	size := 0
+	for key, value := range configMap.Data {
+		size += len(key) + len(value)
+	}
+	for key, value := range configMap.BinaryData {
+		size += len(key) + len(value)
+	}
+	if size > MaxConfigMapSizeBytes {
+		return metrics.ConfigRejectReasonOversized, fmt.Errorf("config map data of %d bytes exceeds the limit of %d bytes", size, MaxConfigMapSizeBytes)
+	}
+
+	expected := strings.TrimSpace(configMap.Annotations[AnnotationConfigChecksum])
+	if expected == "" {
+		return "", nil
+	}
+	if actual := ConfigChecksum(configMap.Data[PrunerGlobalConfigKey]); !strings.EqualFold(actual, expected) {
+		return metrics.ConfigRejectReasonChecksumMismatch, fmt.Errorf("checksum %s of the global config does not match the annotation %s=%s", actual, AnnotationConfigChecksum, expected)
+	}
+	return "", nil
+}
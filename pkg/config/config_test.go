@@ -0,0 +1,771 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/ptr"
+)
+
+func loadTestConfig(t *testing.T, globalConfig string) {
+	t.Helper()
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: PrunerConfigMapName, Namespace: "tekton-pipelines"},
+		Data:       map[string]string{PrunerGlobalConfigKey: globalConfig},
+	}
+	if err := PrunerConfigStore.LoadGlobalConfig(context.Background(), configMap); err != nil {
+		t.Fatalf("failed to load the config: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = PrunerConfigStore.LoadGlobalConfig(context.Background(), &corev1.ConfigMap{})
+	})
+}
+
+func TestTTLOverrides(t *testing.T) {
+	loadTestConfig(t, `enforcedConfigLevel: namespace
+ttlSecondsAfterFinished: 3600
+namespaces:
+  dev:
+    ttlSecondsAfterFinished: 600
+    ttlOverrides:
+      - labelSelector: priority=low
+        ttlSecondsAfterFinished: 60
+      - labelSelector: priority in (high, critical)
+        ttlSecondsAfterFinished: 86400`)
+
+	tests := []struct {
+		name         string
+		namespace    string
+		labels       map[string]string
+		wantTTL      int32
+		identifiedBy string
+	}{
+		{
+			name:         "low priority",
+			namespace:    "dev",
+			labels:       map[string]string{"priority": "low"},
+			wantTTL:      60,
+			identifiedBy: "identified_by_ns_label",
+		},
+		{
+			name:         "high priority",
+			namespace:    "dev",
+			labels:       map[string]string{"priority": "high"},
+			wantTTL:      86400,
+			identifiedBy: "identified_by_ns_label",
+		},
+		{
+			name:         "no matching override falls back to the namespace",
+			namespace:    "dev",
+			labels:       map[string]string{"priority": "medium"},
+			wantTTL:      600,
+			identifiedBy: "identified_by_ns",
+		},
+		{
+			name:         "overrides do not apply to other namespaces",
+			namespace:    "prod",
+			labels:       map[string]string{"priority": "low"},
+			wantTTL:      3600,
+			identifiedBy: "identified_by_global",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector := SelectorSpec{MatchLabels: tt.labels}
+			for _, get := range []func(string, string, SelectorSpec) (*int32, string){
+				PrunerConfigStore.GetPipelineTTLSecondsAfterFinished,
+				PrunerConfigStore.GetTaskTTLSecondsAfterFinished,
+			} {
+				ttl, identifiedBy := get(tt.namespace, "", selector)
+				if assert.NotNil(t, ttl) {
+					assert.Equal(t, tt.wantTTL, *ttl)
+				}
+				assert.Equal(t, tt.identifiedBy, identifiedBy)
+			}
+		})
+	}
+}
+
+func TestHistoryLimitPrecedence(t *testing.T) {
+	loadTestConfig(t, `enforcedConfigLevel: resource
+historyLimit: 10
+successfulHistoryLimit: 7
+namespaces:
+  dev:
+    historyLimit: 5
+    failedHistoryLimit: 2
+    pipelineRuns:
+      - name: build
+        historyLimit: 3
+      - name: deploy
+        historyLimit: 4
+        successfulHistoryLimit: 1`)
+
+	tests := []struct {
+		name           string
+		namespace      string
+		pipelineName   string
+		wantSuccessful int32
+		wantFailed     int32
+	}{
+		{
+			name:           "global level",
+			namespace:      "prod",
+			wantSuccessful: 7,
+			wantFailed:     10,
+		},
+		{
+			name:           "namespace level",
+			namespace:      "dev",
+			wantSuccessful: 5,
+			wantFailed:     2,
+		},
+		{
+			name:           "resource level historyLimit alone",
+			namespace:      "dev",
+			pipelineName:   "build",
+			wantSuccessful: 3,
+			wantFailed:     3,
+		},
+		{
+			name:           "resource level historyLimit with successfulHistoryLimit",
+			namespace:      "dev",
+			pipelineName:   "deploy",
+			wantSuccessful: 1,
+			wantFailed:     4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			successful, _ := PrunerConfigStore.GetPipelineSuccessHistoryLimitCount(tt.namespace, tt.pipelineName, SelectorSpec{})
+			if assert.NotNil(t, successful) {
+				assert.Equal(t, tt.wantSuccessful, *successful)
+			}
+			failed, _ := PrunerConfigStore.GetPipelineFailedHistoryLimitCount(tt.namespace, tt.pipelineName, SelectorSpec{})
+			if assert.NotNil(t, failed) {
+				assert.Equal(t, tt.wantFailed, *failed)
+			}
+		})
+	}
+}
+
+func TestNamespacedConfig(t *testing.T) {
+	int32Ptr := func(v int32) *int32 { return &v }
+	resourceLevel := EnforcedConfigLevelResource
+
+	namespacedConfig := map[string]NamespaceSpec{
+		"dev": {
+			PrunerConfig: PrunerConfig{EnforcedConfigLevel: &resourceLevel, SuccessfulHistoryLimit: int32Ptr(2)},
+			PipelineRuns: []ResourceSpec{{Name: "build", PrunerConfig: PrunerConfig{SuccessfulHistoryLimit: int32Ptr(1)}}},
+		},
+		"prod": {PrunerConfig: PrunerConfig{SuccessfulHistoryLimit: int32Ptr(20)}},
+	}
+
+	tests := []struct {
+		name         string
+		globalConfig string
+		namespace    string
+		wantLimit    int32
+		identifiedBy string
+	}{
+		{
+			name:         "resource level applies the resource spec of the TektonPruner",
+			globalConfig: "enforcedConfigLevel: resource\nsuccessfulHistoryLimit: 10",
+			namespace:    "dev",
+			wantLimit:    1,
+			identifiedBy: "identifiedBy_resource_name",
+		},
+		{
+			name:         "namespace level ignores the resource spec of the TektonPruner",
+			globalConfig: "enforcedConfigLevel: namespace\nsuccessfulHistoryLimit: 10",
+			namespace:    "dev",
+			wantLimit:    2,
+			identifiedBy: "identified_by_ns",
+		},
+		{
+			name:         "global level ignores the TektonPruner",
+			globalConfig: "enforcedConfigLevel: global\nsuccessfulHistoryLimit: 10",
+			namespace:    "dev",
+			wantLimit:    10,
+			identifiedBy: "identified_by_global",
+		},
+		{
+			name: "namespace of the config map takes precedence over the TektonPruner",
+			globalConfig: `enforcedConfigLevel: namespace
+successfulHistoryLimit: 10
+namespaces:
+  prod:
+    successfulHistoryLimit: 5`,
+			namespace:    "prod",
+			wantLimit:    5,
+			identifiedBy: "identified_by_ns",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.globalConfig)
+			PrunerConfigStore.LoadNamespacedConfig(context.Background(), namespacedConfig)
+			t.Cleanup(func() { PrunerConfigStore.LoadNamespacedConfig(context.Background(), nil) })
+
+			limit, identifiedBy := PrunerConfigStore.GetPipelineSuccessHistoryLimitCount(tt.namespace, "build", SelectorSpec{})
+			if assert.NotNil(t, limit) {
+				assert.Equal(t, tt.wantLimit, *limit)
+			}
+			assert.Equal(t, tt.identifiedBy, identifiedBy)
+		})
+	}
+}
+
+func TestOwnerReferenceSelector(t *testing.T) {
+	loadTestConfig(t, `enforcedConfigLevel: resource
+namespaces:
+  dev:
+    successfulHistoryLimit: 10
+    pipelineRuns:
+      - name: build
+        successfulHistoryLimit: 5
+      - selector:
+          - matchOwnerReferences:
+              - kind: EventListener
+        successfulHistoryLimit: 1
+      - selector:
+          - matchOwnerReferences:
+              - kind: Repository
+                name: app
+        successfulHistoryLimit: 2`)
+
+	tests := []struct {
+		name            string
+		ownerReferences []OwnerReferenceSelector
+		wantLimit       int32
+		identifiedBy    string
+	}{
+		{
+			name:            "owner kind takes precedence over the name",
+			ownerReferences: []OwnerReferenceSelector{{Kind: "EventListener", Name: "listener"}},
+			wantLimit:       1,
+			identifiedBy:    "identifiedBy_resource_owner",
+		},
+		{
+			name:            "owner kind and name",
+			ownerReferences: []OwnerReferenceSelector{{Kind: "Repository", Name: "app"}},
+			wantLimit:       2,
+			identifiedBy:    "identifiedBy_resource_owner",
+		},
+		{
+			name:            "owner name does not match",
+			ownerReferences: []OwnerReferenceSelector{{Kind: "Repository", Name: "other"}},
+			wantLimit:       5,
+			identifiedBy:    "identifiedBy_resource_name",
+		},
+		{
+			name:         "no owner",
+			wantLimit:    5,
+			identifiedBy: "identifiedBy_resource_name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, identifiedBy := PrunerConfigStore.GetPipelineSuccessHistoryLimitCount("dev", "build", SelectorSpec{MatchOwnerReferences: tt.ownerReferences})
+			if assert.NotNil(t, limit) {
+				assert.Equal(t, tt.wantLimit, *limit)
+			}
+			assert.Equal(t, tt.identifiedBy, identifiedBy)
+		})
+	}
+}
+
+func TestRetentionFields(t *testing.T) {
+	loadTestConfig(t, `enforcedConfigLevel: resource
+minRetained: 5
+maxRetentionAgeSeconds: 604800
+minRetentionSeconds: 300
+namespaces:
+  dev:
+    minRetained: 3
+    maxRetentionAgeSeconds: 86400
+    minRetentionSeconds: 120
+    taskRuns:
+      - name: build
+        minRetained: 2
+        minRetentionSeconds: 30`)
+
+	tests := []struct {
+		name          string
+		namespace     string
+		resourceName  string
+		wantMin       int32
+		wantMaxAge    int32
+		wantMinAge    int32
+		minIdentified string
+	}{
+		{name: "global level", namespace: "prod", resourceName: "build", wantMin: 5, wantMaxAge: 604800, wantMinAge: 300, minIdentified: "identified_by_global"},
+		{name: "namespace level", namespace: "dev", resourceName: "deploy", wantMin: 3, wantMaxAge: 86400, wantMinAge: 120, minIdentified: "identified_by_ns"},
+		{name: "resource level", namespace: "dev", resourceName: "build", wantMin: 2, wantMaxAge: 86400, wantMinAge: 30, minIdentified: "identifiedBy_resource_name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minRetained, identifiedBy := PrunerConfigStore.GetTaskMinRetained(tt.namespace, tt.resourceName, SelectorSpec{})
+			if minRetained == nil || *minRetained != tt.wantMin {
+				t.Fatalf("minRetained = %v, want %d", minRetained, tt.wantMin)
+			}
+			assert.Equal(t, tt.minIdentified, identifiedBy)
+			maxAge, _ := PrunerConfigStore.GetTaskMaxRetentionAgeSeconds(tt.namespace, tt.resourceName, SelectorSpec{})
+			if maxAge == nil || *maxAge != tt.wantMaxAge {
+				t.Fatalf("maxRetentionAgeSeconds = %v, want %d", maxAge, tt.wantMaxAge)
+			}
+			minAge, _ := PrunerConfigStore.GetTaskMinRetentionSeconds(tt.namespace, tt.resourceName, SelectorSpec{})
+			if minAge == nil || *minAge != tt.wantMinAge {
+				t.Fatalf("minRetentionSeconds = %v, want %d", minAge, tt.wantMinAge)
+			}
+		})
+	}
+}
+
+func TestTTLSecondsAfterFinishedWithoutResults(t *testing.T) {
+	loadTestConfig(t, `ttlSecondsAfterFinished: 3600
+ttlSecondsAfterFinishedWithoutResults: 600
+namespaces:
+  dev:
+    ttlSecondsAfterFinishedWithoutResults: 60
+    pipelineRuns:
+      - name: build
+        ttlSecondsAfterFinishedWithoutResults: 30`)
+
+	tests := []struct {
+		name         string
+		namespace    string
+		resourceName string
+		want         int32
+		identifiedBy string
+	}{
+		{name: "global level", namespace: "prod", resourceName: "build", want: 600, identifiedBy: "identified_by_global"},
+		{name: "namespace level", namespace: "dev", resourceName: "deploy", want: 60, identifiedBy: "identified_by_ns"},
+		{name: "resource level", namespace: "dev", resourceName: "build", want: 30, identifiedBy: "identifiedBy_resource_name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttl, identifiedBy := PrunerConfigStore.GetPipelineTTLSecondsAfterFinishedWithoutResults(tt.namespace, tt.resourceName, SelectorSpec{})
+			if ttl == nil || *ttl != tt.want {
+				t.Fatalf("ttl = %v, want %d", ttl, tt.want)
+			}
+			if identifiedBy != tt.identifiedBy {
+				t.Errorf("identifiedBy = %q, want %q", identifiedBy, tt.identifiedBy)
+			}
+		})
+	}
+}
+
+func TestEnforcedConfigLevelMonotonic(t *testing.T) {
+	levels := []EnforcedConfigLevel{EnforcedConfigLevelGlobal, EnforcedConfigLevelNamespace, EnforcedConfigLevelResource}
+	// want holds the level which applies for each pair of the enclosing level and the nested level
+	want := map[EnforcedConfigLevel]map[EnforcedConfigLevel]EnforcedConfigLevel{
+		EnforcedConfigLevelGlobal: {
+			EnforcedConfigLevelGlobal:    EnforcedConfigLevelGlobal,
+			EnforcedConfigLevelNamespace: EnforcedConfigLevelGlobal,
+			EnforcedConfigLevelResource:  EnforcedConfigLevelGlobal,
+		},
+		EnforcedConfigLevelNamespace: {
+			EnforcedConfigLevelGlobal:    EnforcedConfigLevelGlobal,
+			EnforcedConfigLevelNamespace: EnforcedConfigLevelNamespace,
+			EnforcedConfigLevelResource:  EnforcedConfigLevelNamespace,
+		},
+		EnforcedConfigLevelResource: {
+			EnforcedConfigLevelGlobal:    EnforcedConfigLevelGlobal,
+			EnforcedConfigLevelNamespace: EnforcedConfigLevelNamespace,
+			EnforcedConfigLevelResource:  EnforcedConfigLevelResource,
+		},
+	}
+
+	for _, enclosing := range levels {
+		for _, nested := range levels {
+			t.Run(fmt.Sprintf("global %s, namespace %s", enclosing, nested), func(t *testing.T) {
+				loadTestConfig(t, fmt.Sprintf(`enforcedConfigLevel: %s
+namespaces:
+  dev:
+    enforcedConfigLevel: %s`, enclosing, nested))
+				assert.Equal(t, want[enclosing][nested], PrunerConfigStore.GetPipelineEnforcedConfigLevel("dev", "build", SelectorSpec{}))
+				assert.Equal(t, enclosing.Allows(nested), want[enclosing][nested] == nested)
+			})
+
+			t.Run(fmt.Sprintf("namespace %s, resource %s", enclosing, nested), func(t *testing.T) {
+				loadTestConfig(t, fmt.Sprintf(`namespaces:
+  dev:
+    enforcedConfigLevel: %s
+    pipelineRuns:
+      - name: build
+        enforcedConfigLevel: %s`, enclosing, nested))
+				assert.Equal(t, want[enclosing][nested], PrunerConfigStore.GetPipelineEnforcedConfigLevel("dev", "build", SelectorSpec{}))
+				// the other resources of the namespace keep the namespace level
+				assert.Equal(t, enclosing, PrunerConfigStore.GetPipelineEnforcedConfigLevel("dev", "deploy", SelectorSpec{}))
+			})
+		}
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	loadTestConfig(t, "ttlSecondsAfterFinished: 600")
+	if got := PrunerConfigStore.GetLocation(); got != time.UTC {
+		t.Errorf("default location = %v, want UTC", got)
+	}
+
+	loadTestConfig(t, "timezone: Asia/Tokyo")
+	tokyo := PrunerConfigStore.GetLocation()
+	if tokyo.String() != "Asia/Tokyo" {
+		t.Fatalf("location = %v, want Asia/Tokyo", tokyo)
+	}
+
+	// 16:00 UTC is the next day in Tokyo, the runs completed two hours before are on the previous day there
+	now := time.Date(2025, time.June, 1, 16, 0, 0, 0, time.UTC)
+	completedAt := now.Add(-2 * time.Hour)
+	if start := startOfCalendarDays(now, time.UTC, 1); completedAt.Before(start) {
+		t.Errorf("run completed at %v is not on the same day in UTC, day starts at %v", completedAt, start)
+	}
+	if start := startOfCalendarDays(now, tokyo, 1); !completedAt.Before(start) {
+		t.Errorf("run completed at %v is on the same day in Tokyo, day starts at %v", completedAt, start)
+	}
+
+	// an invalid timezone fails the load, the previous config is kept
+	err := PrunerConfigStore.LoadGlobalConfig(context.Background(), &corev1.ConfigMap{
+		Data: map[string]string{PrunerGlobalConfigKey: "timezone: Nowhere/Atlantis"},
+	})
+	if err == nil {
+		t.Fatal("LoadGlobalConfig() error = nil, want error")
+	}
+	if got := PrunerConfigStore.GetLocation(); got != tokyo {
+		t.Errorf("location after a failed load = %v, want %v", got, tokyo)
+	}
+}
+
+func TestConfigIntegrity(t *testing.T) {
+	goodConfig := `ttlSecondsAfterFinished: 600
+namespaces:
+  dev:
+    ttlSecondsAfterFinished: 60`
+	loadTestConfig(t, goodConfig)
+
+	// the config is truncated after the checksum was computed
+	truncated := goodConfig[:len(goodConfig)-len("\n    ttlSecondsAfterFinished: 60")]
+
+	tests := []struct {
+		name        string
+		configMap   *corev1.ConfigMap
+		expectError bool
+	}{
+		{
+			name: "truncated config",
+			configMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationConfigChecksum: ConfigChecksum(goodConfig)}},
+				Data:       map[string]string{PrunerGlobalConfigKey: truncated},
+			},
+			expectError: true,
+		},
+		{
+			name: "oversized config",
+			configMap: &corev1.ConfigMap{
+				Data: map[string]string{PrunerGlobalConfigKey: goodConfig + "\n#" + strings.Repeat("x", MaxConfigMapSizeBytes)},
+			},
+			expectError: true,
+		},
+		{
+			name: "checksum matching",
+			configMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationConfigChecksum: strings.ToUpper(ConfigChecksum(goodConfig))}},
+				Data:       map[string]string{PrunerGlobalConfigKey: goodConfig},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := PrunerConfigStore.LoadGlobalConfig(context.Background(), tc.configMap)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// the previous good config stays active
+			ttl, _ := PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "build", SelectorSpec{})
+			if assert.NotNil(t, ttl) {
+				assert.Equal(t, int32(60), *ttl)
+			}
+		})
+	}
+}
+
+func TestNamespaceAnnotationConfig(t *testing.T) {
+	spec, found, err := NamespaceSpecFromAnnotations(map[string]string{AnnotationTTLSecondsAfterFinished: "3600"})
+	if err != nil || !found {
+		t.Fatalf("NamespaceSpecFromAnnotations() = %v, %v, want the spec", found, err)
+	}
+	PrunerConfigStore.LoadNamespaceAnnotationConfig(context.Background(), map[string]NamespaceSpec{"dev": spec})
+	t.Cleanup(func() { PrunerConfigStore.LoadNamespaceAnnotationConfig(context.Background(), nil) })
+
+	tests := []struct {
+		name         string
+		globalConfig string
+		wantTTL      int32
+		identifiedBy string
+	}{
+		{
+			name:         "namespace annotation supplies the ttl",
+			globalConfig: "enforcedConfigLevel: namespace\nttlSecondsAfterFinished: 60",
+			wantTTL:      3600,
+			identifiedBy: "identified_by_ns",
+		},
+		{
+			name:         "config map namespace entry overrides the namespace annotation",
+			globalConfig: "enforcedConfigLevel: namespace\nttlSecondsAfterFinished: 60\nnamespaces:\n  dev:\n    ttlSecondsAfterFinished: 300",
+			wantTTL:      300,
+			identifiedBy: "identified_by_ns",
+		},
+		{
+			name:         "global level ignores the namespace annotation",
+			globalConfig: "enforcedConfigLevel: global\nttlSecondsAfterFinished: 60",
+			wantTTL:      60,
+			identifiedBy: "identified_by_global",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.globalConfig)
+			ttl, identifiedBy := PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "build", SelectorSpec{})
+			if ttl == nil || *ttl != tt.wantTTL || identifiedBy != tt.identifiedBy {
+				t.Errorf("ttl = %v (%s), want %d (%s)", ttl, identifiedBy, tt.wantTTL, tt.identifiedBy)
+			}
+		})
+	}
+}
+
+func TestNamespaceSpecFromAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantFound   bool
+		wantErr     bool
+	}{
+		{
+			name:        "history limits",
+			annotations: map[string]string{AnnotationSuccessfulHistoryLimit: "5", AnnotationFailedHistoryLimit: "2"},
+			wantFound:   true,
+		},
+		{
+			name:        "disabled ttl",
+			annotations: map[string]string{AnnotationTTLSecondsAfterFinished: "-1"},
+			wantFound:   true,
+		},
+		{
+			name:        "no pruner annotation",
+			annotations: map[string]string{"team": "ci"},
+		},
+		{
+			name:        "invalid ttl",
+			annotations: map[string]string{AnnotationTTLSecondsAfterFinished: "1h"},
+			wantErr:     true,
+		},
+		{
+			name:        "negative history limit",
+			annotations: map[string]string{AnnotationHistoryLimit: "-1"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, found, err := NamespaceSpecFromAnnotations(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NamespaceSpecFromAnnotations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if found != tt.wantFound {
+				t.Errorf("NamespaceSpecFromAnnotations() found = %v, want %v", found, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestConfigSource(t *testing.T) {
+	loadTestConfig(t, `enforcedConfigLevel: resource
+ttlSecondsAfterFinished: 60
+namespaces:
+  dev:
+    ttlSecondsAfterFinished: 600
+    ttlOverrides:
+      - labelSelector: "priority=low"
+        ttlSecondsAfterFinished: 30
+    pipelineRuns:
+      - name: build
+        ttlSecondsAfterFinished: 300
+      - selector:
+          - matchLabels:
+              app: web
+        ttlSecondsAfterFinished: 120
+      - selector:
+          - matchOwnerReferences:
+              - kind: EventListener
+        ttlSecondsAfterFinished: 90`)
+
+	tests := []struct {
+		name       string
+		namespace  string
+		resource   string
+		selector   SelectorSpec
+		wantSource string
+	}{
+		{
+			name:       "global root",
+			namespace:  "prod",
+			resource:   "build",
+			wantSource: metrics.ConfigSourceGlobal,
+		},
+		{
+			name:       "namespace root",
+			namespace:  "dev",
+			resource:   "deploy",
+			wantSource: metrics.ConfigSourceNamespace,
+		},
+		{
+			name:       "namespace label override",
+			namespace:  "dev",
+			resource:   "deploy",
+			selector:   SelectorSpec{MatchLabels: map[string]string{"priority": "low"}},
+			wantSource: metrics.ConfigSourceNamespaceLabel,
+		},
+		{
+			name:       "resource name",
+			namespace:  "dev",
+			resource:   "build",
+			wantSource: metrics.ConfigSourceResourceName,
+		},
+		{
+			name:       "resource label selector",
+			namespace:  "dev",
+			selector:   SelectorSpec{MatchLabels: map[string]string{"app": "web"}},
+			wantSource: metrics.ConfigSourceResourceLabel,
+		},
+		{
+			name:       "resource owner reference",
+			namespace:  "dev",
+			resource:   "deploy",
+			selector:   SelectorSpec{MatchOwnerReferences: []OwnerReferenceSelector{{Kind: "EventListener", Name: "listener"}}},
+			wantSource: metrics.ConfigSourceResourceOwner,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, identifiedBy := PrunerConfigStore.GetPipelineTTLSecondsAfterFinished(tt.namespace, tt.resource, tt.selector)
+			if got := configSource(identifiedBy); got != tt.wantSource {
+				t.Errorf("configSource(%s) = %s, want %s", identifiedBy, got, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	// the default history limit applies to each outcome, it is not a combined limit
+	pc := PrunerConfig{}
+	pc.SetDefaults()
+	assert.Nil(t, pc.HistoryLimit)
+	assert.Equal(t, int32(DefaultHistoryLimit), *pc.SuccessfulHistoryLimit)
+	assert.Equal(t, int32(DefaultHistoryLimit), *pc.FailedHistoryLimit)
+
+	// an explicit historyLimit is kept as the combined limit
+	pc = PrunerConfig{HistoryLimit: ptr.Int32(5)}
+	pc.SetDefaults()
+	assert.Equal(t, int32(5), *pc.getHistoryLimit())
+	assert.Nil(t, pc.SuccessfulHistoryLimit)
+}
+
+func TestResourceLevelSelectorMatching(t *testing.T) {
+	loadTestConfig(t, `enforcedConfigLevel: resource
+namespaces:
+  dev:
+    successfulHistoryLimit: 2
+    pipelineRuns:
+      - name: build
+        successfulHistoryLimit: 3
+      - selector:
+          - matchLabels:
+              app: web
+        successfulHistoryLimit: 5
+      - selector:
+          - matchLabels:
+              app: web
+              tier: frontend
+        successfulHistoryLimit: 7
+      - selector:
+          - matchAnnotations:
+              team: payments
+        successfulHistoryLimit: 8`)
+
+	tests := []struct {
+		name             string
+		resource         string
+		selector         SelectorSpec
+		wantLimit        int32
+		wantIdentifiedBy string
+	}{
+		{
+			name:             "label match without a name spec",
+			resource:         "deploy",
+			selector:         SelectorSpec{MatchLabels: map[string]string{"app": "web", "tekton.dev/pipeline": "deploy"}},
+			wantLimit:        5,
+			wantIdentifiedBy: "identifiedBy_resource_label",
+		},
+		{
+			name:             "most specific label match",
+			resource:         "deploy",
+			selector:         SelectorSpec{MatchLabels: map[string]string{"app": "web", "tier": "frontend", "tekton.dev/pipeline": "deploy"}},
+			wantLimit:        7,
+			wantIdentifiedBy: "identifiedBy_resource_label",
+		},
+		{
+			name:     "name match first",
+			resource: "build",
+			selector: SelectorSpec{
+				MatchLabels:      map[string]string{"app": "web", "tier": "frontend"},
+				MatchAnnotations: map[string]string{"team": "payments"},
+			},
+			wantLimit:        3,
+			wantIdentifiedBy: "identifiedBy_resource_name",
+		},
+		{
+			name:     "annotation match",
+			resource: "deploy",
+			selector: SelectorSpec{
+				MatchLabels:      map[string]string{"app": "web"},
+				MatchAnnotations: map[string]string{"team": "payments", "owner": "alice"},
+			},
+			wantLimit:        8,
+			wantIdentifiedBy: "identifiedBy_resource_ann",
+		},
+		{
+			name:             "partial label match falls back to the namespace",
+			resource:         "deploy",
+			selector:         SelectorSpec{MatchLabels: map[string]string{"tier": "frontend"}},
+			wantLimit:        2,
+			wantIdentifiedBy: "identified_by_ns",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, identifiedBy := PrunerConfigStore.GetPipelineSuccessHistoryLimitCount("dev", tt.resource, tt.selector)
+			if assert.NotNil(t, limit) {
+				assert.Equal(t, tt.wantLimit, *limit)
+			}
+			assert.Equal(t, tt.wantIdentifiedBy, identifiedBy)
+		})
+	}
+}
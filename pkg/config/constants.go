@@ -35,6 +35,83 @@ const (
 	// used to specify the count of concurrent workers in action to prune taskruns
 	EnvTTLConcurrentWorkersTaskRun = "TTL_CONCURRENT_WORKERS_TASK_RUN"
 
+	// EnvShutdownGracePeriodSeconds is the environment variable name used to specify
+	// the time in seconds given to the in-flight cleanups to complete on shutdown
+	EnvShutdownGracePeriodSeconds = "SHUTDOWN_GRACE_PERIOD_SECONDS"
+
+	// EnvStartupGracePeriodSeconds is the environment variable name used to specify
+	// the time in seconds after the controller start, during which the deletions are ramped up gradually
+	EnvStartupGracePeriodSeconds = "STARTUP_GRACE_PERIOD_SECONDS"
+
+	// EnvStartupMaxDeletionsPerSecond is the environment variable name used to specify
+	// the deletion rate reached at the end of the startup grace period
+	EnvStartupMaxDeletionsPerSecond = "STARTUP_MAX_DELETIONS_PER_SECOND"
+
+	// EnvMaxConcurrentDeletions is the environment variable name used to specify the number of
+	// deletions allowed to run at the same time across all the reconcilers
+	EnvMaxConcurrentDeletions = "MAX_CONCURRENT_DELETIONS"
+
+	// EnvPruneRecordsMaxPerNamespace is the environment variable name used to enable the PruneRecord resources
+	// written for each deletion, it caps the records kept on each namespace. They are not written when it is not set
+	EnvPruneRecordsMaxPerNamespace = "PRUNE_RECORDS_MAX_PER_NAMESPACE"
+
+	// EnvStatusConfigMapEnabled is the environment variable name used to enable
+	// the status config map, which summarizes the last periodic cleanup
+	EnvStatusConfigMapEnabled = "STATUS_CONFIGMAP_ENABLED"
+
+	// EnvManagedLabelEnabled is the environment variable name used to enable
+	// the managed label on the runs patched by the pruner
+	EnvManagedLabelEnabled = "MANAGED_LABEL_ENABLED"
+
+	// EnvRetainedByAnnotationEnabled is the environment variable name used to enable the annotation
+	// of the runs retained by a rule other than the history limits, with the rule which retained them
+	EnvRetainedByAnnotationEnabled = "RETAINED_BY_ANNOTATION_ENABLED"
+
+	// EnvTTLKeepLatestEnabled is the environment variable name used to exempt the most recent successful
+	// and the most recent failed run of each group from the ttl deletion
+	EnvTTLKeepLatestEnabled = "TTL_KEEP_LATEST_ENABLED"
+
+	// EnvStuckFinalizers is the environment variable name used to specify the comma separated finalizers
+	// removed from the runs stuck in deletion. The finalizers are never removed when it is not set
+	EnvStuckFinalizers = "STUCK_FINALIZERS"
+
+	// EnvStuckFinalizerTimeoutSeconds is the environment variable name used to specify the time in seconds
+	// a run is in deletion before it is treated as stuck
+	EnvStuckFinalizerTimeoutSeconds = "STUCK_FINALIZER_TIMEOUT_SECONDS"
+
+	// EnvProcessedAnnotationBatchSeconds is the environment variable name used to specify the window in seconds
+	// the writes of the processed annotation are coalesced on, each run is annotated on its own when it is not set
+	EnvProcessedAnnotationBatchSeconds = "PROCESSED_ANNOTATION_BATCH_SECONDS"
+
+	// EnvProcessedByVersion is the environment variable name used to specify the version of the controller,
+	// the processed runs are annotated with it when it is set
+	EnvProcessedByVersion = "PROCESSED_BY_VERSION"
+
+	// EnvConfigNotReadyRequeueSeconds is the environment variable name used to specify the time in seconds a run
+	// reconciled before the global config is loaded is requeued after, the runs are not gated when it is 0
+	EnvConfigNotReadyRequeueSeconds = "CONFIG_NOT_READY_REQUEUE_SECONDS"
+
+	// EnvSweepConcurrentNamespaces is the environment variable name used to specify the number of namespaces
+	// processed at the same time during a sweep of all the runs, on a config change or on the admin endpoint
+	EnvSweepConcurrentNamespaces = "SWEEP_CONCURRENT_NAMESPACES"
+
+	// EnvAdminToken is the environment variable name used to specify the bearer token
+	// the requests to the admin endpoint of the controller are authenticated with
+	EnvAdminToken = "ADMIN_TOKEN"
+
+	// EnvOTLPEndpoint and EnvOTLPLogsEndpoint are the standard OpenTelemetry environment variable names of the
+	// OTLP/HTTP endpoint the log records are exported to, no log record is exported when neither is set
+	EnvOTLPEndpoint     = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	EnvOTLPLogsEndpoint = "OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"
+
+	// AnnotationStuckSince is set on the runs flagged as stuck, not completed after maxRunningAgeSeconds,
+	// its value is the time the run was flagged at
+	AnnotationStuckSince = "pruner.tekton.dev/stuckSince"
+
+	// AnnotationEphemeral marks the runs pruned on the ephemeral config when its value is "true",
+	// unless the ephemeral config names another annotation
+	AnnotationEphemeral = "pruner.tekton.dev/ephemeral"
+
 	// LabelPipelineName represents the label key in a pipeline run's metadata,
 	// where its value corresponds to the name of the pipeline
 	LabelPipelineName = "tekton.dev/pipeline"
@@ -61,6 +138,10 @@ const (
 	// that stores the ttlSecondsAfterFinished value for the resource.
 	AnnotationTTLSecondsAfterFinished = "pruner.tekton.dev/ttlSecondsAfterFinished"
 
+	// AnnotationDeleteAfter represents the annotation key that stores the time (RFC3339)
+	// after which the resource is deleted by the ttl, computed as completionTime + ttlSecondsAfterFinished
+	AnnotationDeleteAfter = "pruner.tekton.dev/deleteAfter"
+
 	// AnnotationResourceNameLabelKey represents the annotation key
 	// that stores the label key value used to uniquely identify the resource.
 	AnnotationResourceNameLabelKey = "pruner.tekton.dev/resourceNameLabelKey"
@@ -73,18 +154,83 @@ const (
 	// that stores the failedHistoryLimit value for the resource.
 	AnnotationFailedHistoryLimit = "pruner.tekton.dev/failedHistoryLimit"
 
+	// AnnotationHistoryLimit represents the annotation key on a namespace
+	// that stores the historyLimit value for the runs of the namespace.
+	AnnotationHistoryLimit = "pruner.tekton.dev/historyLimit"
+
 	// AnnotationHistoryLimitCheckProcessed represents the annotation key
 	// that indicates whether history limit checks have been processed for the resource.
 	AnnotationHistoryLimitCheckProcessed = "pruner.tekton.dev/historyLimitCheckProcessed"
 
+	// AnnotationReprocessGeneration represents the annotation key on the pruner config map, bumping
+	// its value makes the history limits to be checked again on all the resources already processed.
+	// The resources are annotated with the generation they are processed on
+	AnnotationReprocessGeneration = "pruner.tekton.dev/reprocessGeneration"
+
+	// AnnotationProcessedByVersion represents the annotation key that stores the version of the controller
+	// which checked the history limits of a resource. It is set only when PROCESSED_BY_VERSION is set
+	AnnotationProcessedByVersion = "pruner.tekton.dev/processedByVersion"
+
+	// AnnotationLastAccessed represents the annotation key that stores the time (RFC3339) a run was last
+	// accessed, it is updated by the external tooling. The ttl counts from it when it is newer than the completion time
+	AnnotationLastAccessed = "pruner.tekton.dev/lastAccessed"
+
+	// AnnotationRetainedBy represents the annotation key that stores the rule which retained a run the history
+	// limits would have deleted, either RetainedByMinRetained or RetainedByRetainCalendarDays. It is set only when enabled
+	AnnotationRetainedBy = "pruner.tekton.dev/retainedBy"
+
+	// RetainedByMinRetained is set on the runs older than the max retention age, retained by minRetained
+	RetainedByMinRetained = "minRetained"
+
+	// RetainedByRetainCalendarDays is set on the runs above the history limits, retained by retainCalendarDays
+	RetainedByRetainCalendarDays = "retainCalendarDays"
+
+	// LabelManaged represents the label key set to "true" on the runs the pruner has patched,
+	// it is set only when enabled. It is not used to select the config or to group the runs
+	LabelManaged = "pruner.tekton.dev/managed"
+
+	// LabelNamespaceDecommission represents the label key on a namespace, when set to "true" the
+	// namespace is treated as being decommissioned and its completed runs are deleted regardless of the TTL
+	LabelNamespaceDecommission = "pruner.tekton.dev/decommission"
+
 	// PrunerConfigMapName represents the name of the config map
 	// that holds the cluster-wide pruner configuration data
 	PrunerConfigMapName = "tekton-pruner-default-spec"
 
+	// PrunerStatusConfigMapName represents the name of the config map
+	// that summarizes the last periodic cleanup, when it is enabled
+	PrunerStatusConfigMapName = "tekton-pruner-status"
+
 	// PrunerGlobalConfigKey represents the key name
 	// used to fetch the cluster-wide pruner configuration data
 	PrunerGlobalConfigKey = "global-config"
 
+	// PrunerLogLevelKey represents the key name of the pruner config map used to override the log level of the
+	// controllers, for example debug. It is applied without a restart, the logging config applies when it is not set
+	PrunerLogLevelKey = "log-level"
+
+	// AnnotationConfigSource represents the annotation key on the pruner config map
+	// that references the source of the config when it is maintained elsewhere.
+	// The value is either a key of the same config map or "<configmap|secret>/<name>/<key>",
+	// where the name is PrunerConfigSourceName
+	AnnotationConfigSource = "tekton-pruner.io/config-source"
+
+	// PrunerConfigSourceName represents the name of the config map or the secret, on the namespace of
+	// the pruner config map, which the config source annotation can reference
+	PrunerConfigSourceName = "tekton-pruner-config-source"
+
+	// AnnotationConfigChecksum represents the annotation key on the pruner config map that stores
+	// the sha256 checksum, hex encoded, of the global config. A config not matching it is not loaded
+	AnnotationConfigChecksum = "pruner.tekton.dev/configChecksum"
+
+	// StartupCutoffControllerStart represents the startupCutoffTime value which leaves
+	// the runs completed before the start of the controller unmanaged
+	StartupCutoffControllerStart = "controllerStart"
+
+	// MaxConfigMapSizeBytes represents the size limit of a config map, the data of a
+	// larger config map cannot be complete and the config is not loaded
+	MaxConfigMapSizeBytes = 1024 * 1024
+
 	// DefaultTTLConcurrentWorkersPipelineRun represents
 	// number of workers in the PipelineRun controller
 	DefaultTTLConcurrentWorkersPipelineRun = int(5)
@@ -101,6 +247,48 @@ const (
 	// for cleaning up resources in a namespace concurrently
 	DefaultWorkerCountForNamespaceCleanup = 5
 
+	// DefaultShutdownGracePeriodSeconds represents the time in seconds given to the in-flight
+	// cleanups to complete on shutdown, kept below the default pod termination grace period (30s)
+	DefaultShutdownGracePeriodSeconds = 20
+
+	// DefaultNamespacedConfigResyncSeconds represents the interval in seconds
+	// to reload the namespaced config from the TektonPruner resources
+	DefaultNamespacedConfigResyncSeconds = 60
+
+	// DefaultStartupGracePeriodSeconds represents the time in seconds the deletions are ramped up
+	// after the controller start, the ramp is disabled by default
+	DefaultStartupGracePeriodSeconds = 0
+
+	// DefaultStartupMinDeletionsPerSecond represents the deletion rate at the controller start
+	DefaultStartupMinDeletionsPerSecond = 1
+
+	// DefaultStartupMaxDeletionsPerSecond represents the deletion rate reached at the end of the startup grace period
+	DefaultStartupMaxDeletionsPerSecond = 50
+
+	// DefaultMaxConcurrentDeletions represents the number of deletions allowed to run at the same time
+	// across all the reconcilers, the deletions are not limited by default
+	DefaultMaxConcurrentDeletions = 0
+
+	// DefaultStuckFinalizerTimeoutSeconds represents the time in seconds a run is in deletion
+	// before its finalizers are removed, when the removal is enabled
+	DefaultStuckFinalizerTimeoutSeconds = 24 * 60 * 60 // 1 day
+
+	// DefaultConfigNotReadyRequeueSeconds represents the time in seconds a run reconciled
+	// before the global config is loaded is requeued after
+	DefaultConfigNotReadyRequeueSeconds = 5
+
+	// DefaultSweepConcurrentNamespaces represents the number of namespaces processed at the same time
+	// during a sweep, the sweeps are not limited by default
+	DefaultSweepConcurrentNamespaces = 0
+
+	// DefaultProcessedAnnotationBatchSeconds represents the window in seconds the writes of the processed
+	// annotation are coalesced on, the writes are not batched by default
+	DefaultProcessedAnnotationBatchSeconds = 0
+
+	// MinStuckFinalizerTimeoutSeconds represents the lowest time in seconds a run is in deletion before its
+	// finalizers are removed, the owner of a finalizer is given time to complete its cleanup
+	MinStuckFinalizerTimeoutSeconds = 60 * 60 // 1 hour
+
 	// DefaultHistoryLimit represents the default history limit for successful and failed resources
 	DefaultHistoryLimit = 100
 )
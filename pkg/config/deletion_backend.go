@@ -0,0 +1,89 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeletionBackend deletes the resources pruned by the history limiters and the ttl handlers.
+// The resolution of the config and the selection of the resources stay on the pruner, an
+// alternative backend, for example one which archives the resources before deleting them or
+// one which records the deletions on tests, decides only how a selected resource is deleted
+type DeletionBackend interface {
+	Delete(ctx context.Context, resource metav1.Object) error
+}
+
+// DeletionBackendFunc adapts a function to a DeletionBackend
+type DeletionBackendFunc func(ctx context.Context, resource metav1.Object) error
+
+// Delete calls the function
+func (f DeletionBackendFunc) Delete(ctx context.Context, resource metav1.Object) error {
+	return f(ctx, resource)
+}
+
+// DeletionVerifier is implemented by the resource funcs which verify a resource before it is deleted. The verification
+// runs on every deletion of the history limiters and the ttl handlers, whichever DeletionBackend deletes the resource
+type DeletionVerifier interface {
+	VerifyDeletion(ctx context.Context, resource metav1.Object)
+}
+
+// verifyingDeletionBackend verifies the resources before they are deleted with the backend
+type verifyingDeletionBackend struct {
+	backend  DeletionBackend
+	verifier DeletionVerifier
+}
+
+// Delete verifies the resource and deletes it with the backend
+func (b verifyingDeletionBackend) Delete(ctx context.Context, resource metav1.Object) error {
+	b.verifier.VerifyDeletion(ctx, resource)
+	return b.backend.Delete(ctx, resource)
+}
+
+// withDeletionVerifier returns the backend verifying the resources with the resource funcs before they are deleted,
+// the backend is returned as is when the resource funcs do not implement DeletionVerifier
+func withDeletionVerifier(backend DeletionBackend, resourceFn interface{}) DeletionBackend {
+	verifier, ok := resourceFn.(DeletionVerifier)
+	if !ok {
+		return backend
+	}
+	return verifyingDeletionBackend{backend: backend, verifier: verifier}
+}
+
+// deletePreconditionsKey is the context key of the preconditions of the deletions
+type deletePreconditionsKey struct{}
+
+// WithDeletePreconditions returns a context whose deletions are made only when the resource still matches the preconditions
+func WithDeletePreconditions(ctx context.Context, preconditions *metav1.Preconditions) context.Context {
+	return context.WithValue(ctx, deletePreconditionsKey{}, preconditions)
+}
+
+// DeletePreconditionsFromContext returns the preconditions of the deletions, nil when the resources are deleted unconditionally
+func DeletePreconditionsFromContext(ctx context.Context) *metav1.Preconditions {
+	preconditions, _ := ctx.Value(deletePreconditionsKey{}).(*metav1.Preconditions)
+	return preconditions
+}
+
+// newResourceFuncsDeletionBackend returns the default DeletionBackend, it deletes the resource
+// from the cluster with the given delete function of the resource funcs
+func newResourceFuncsDeletionBackend(deleteFn func(ctx context.Context, namespace, name string) error) DeletionBackend {
+	return DeletionBackendFunc(func(ctx context.Context, resource metav1.Object) error {
+		return deleteFn(ctx, resource.GetNamespace(), resource.GetName())
+	})
+}
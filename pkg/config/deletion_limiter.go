@@ -0,0 +1,79 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+)
+
+// DeletionLimiter bounds the number of deletions running at the same time,
+// it is shared by all the reconcilers to bound the aggregate load on the API server
+type DeletionLimiter struct {
+	slots chan struct{}
+}
+
+// NewDeletionLimiter creates a DeletionLimiter which allows up to limit concurrent deletions,
+// nil is returned when the limit is not positive, there is no limit then
+func NewDeletionLimiter(limit int) *DeletionLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &DeletionLimiter{slots: make(chan struct{}, limit)}
+}
+
+var (
+	deletionLimiterOnce sync.Once
+	deletionLimiter     *DeletionLimiter
+	deletionLimiterErr  error
+)
+
+// getDeletionLimiter returns the process wide DeletionLimiter, shared by all the history limiters and ttl handlers.
+// The deletions are not limited when the limit is not set. The error on parsing the environment is returned on every call
+func getDeletionLimiter() (*DeletionLimiter, error) {
+	deletionLimiterOnce.Do(func() {
+		var limit int
+		limit, deletionLimiterErr = GetEnvValueAsInt(EnvMaxConcurrentDeletions, DefaultMaxConcurrentDeletions)
+		if deletionLimiterErr != nil {
+			return
+		}
+		deletionLimiter = NewDeletionLimiter(limit)
+	})
+	return deletionLimiter, deletionLimiterErr
+}
+
+// Acquire blocks until a deletion slot is available or the context is done.
+// A nil DeletionLimiter never blocks
+func (dl *DeletionLimiter) Acquire(ctx context.Context) error {
+	if dl == nil {
+		return nil
+	}
+	select {
+	case dl.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees the slot taken by Acquire
+func (dl *DeletionLimiter) Release() {
+	if dl == nil {
+		return
+	}
+	<-dl.slots
+}
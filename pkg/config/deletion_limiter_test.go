@@ -0,0 +1,134 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktest "k8s.io/utils/clock/testing"
+)
+
+// concurrencyTracker records the highest number of deletions running at the same time
+type concurrencyTracker struct {
+	running int32
+	max     int32
+}
+
+func (ct *concurrencyTracker) delete() {
+	running := atomic.AddInt32(&ct.running, 1)
+	for {
+		max := atomic.LoadInt32(&ct.max)
+		if running <= max || atomic.CompareAndSwapInt32(&ct.max, max, running) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt32(&ct.running, -1)
+}
+
+// trackingTTLFuncs tracks the concurrent deletions, the resources are not removed
+type trackingTTLFuncs struct {
+	*mockTTLFuncs
+	tracker *concurrencyTracker
+}
+
+func (tf *trackingTTLFuncs) Delete(_ context.Context, _, _ string) error {
+	tf.tracker.delete()
+	return nil
+}
+
+func TestNewDeletionLimiter(t *testing.T) {
+	if limiter := NewDeletionLimiter(0); limiter != nil {
+		t.Error("NewDeletionLimiter(0) should not limit the deletions")
+	}
+
+	// a nil limiter never blocks
+	var limiter *DeletionLimiter
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Errorf("Acquire() unexpected error = %v", err)
+	}
+	limiter.Release()
+
+	limiter = NewDeletionLimiter(1)
+	if err := limiter.Acquire(context.Background()); err != nil {
+		t.Fatalf("Acquire() unexpected error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Acquire(ctx); err == nil {
+		t.Error("Acquire() should fail when the context is done before a slot is available")
+	}
+	limiter.Release()
+}
+
+func TestDeletionLimiterAcrossHandlers(t *testing.T) {
+	limiter := NewDeletionLimiter(2)
+	tracker := &concurrencyTracker{}
+	fakeClock := clocktest.NewFakeClock(time.Now())
+
+	// two handlers, as the PipelineRun and the TaskRun reconcilers, sharing the limiter
+	var handlers []*TTLHandler
+	for _, resourceFn := range []*trackingTTLFuncs{
+		{mockTTLFuncs: newMockTTLFuncs(), tracker: tracker},
+		{mockTTLFuncs: newMockTTLFuncs(), tracker: tracker},
+	} {
+		handler, err := NewTTLHandler(fakeClock, resourceFn)
+		if err != nil {
+			t.Fatalf("NewTTLHandler() unexpected error = %v", err)
+		}
+		handler.deletionLimiter = limiter
+
+		for index := 0; index < 5; index++ {
+			name := fmt.Sprintf("run-%d", index)
+			resourceFn.resources["default/"+name] = &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   "default",
+					Annotations: map[string]string{AnnotationTTLSecondsAfterFinished: "60"},
+				},
+				completed:       true,
+				completion_time: &metav1.Time{Time: fakeClock.Now().Add(-2 * time.Hour)},
+			}
+		}
+		handlers = append(handlers, handler)
+	}
+
+	var wg sync.WaitGroup
+	for _, handler := range handlers {
+		for _, resource := range handler.resourceFn.(*trackingTTLFuncs).resources {
+			wg.Add(1)
+			go func(handler *TTLHandler, resource *ttlMockResource) {
+				defer wg.Done()
+				if err := handler.removeResource(context.Background(), resource, false); err != nil {
+					t.Errorf("removeResource() unexpected error = %v", err)
+				}
+			}(handler, resource)
+		}
+	}
+	wg.Wait()
+
+	if tracker.max > 2 {
+		t.Errorf("concurrent deletions = %d, want at most 2", tracker.max)
+	}
+	if tracker.max < 2 {
+		t.Errorf("concurrent deletions = %d, want the deletions to run in parallel up to the limit", tracker.max)
+	}
+}
+
+func TestGetDeletionLimiterError(t *testing.T) {
+	t.Setenv(EnvMaxConcurrentDeletions, "many")
+	deletionLimiterOnce = sync.Once{}
+	t.Cleanup(func() { deletionLimiterOnce = sync.Once{}; deletionLimiter = nil; deletionLimiterErr = nil })
+
+	// the parse error is returned to every caller, not only to the first one
+	for i := 0; i < 2; i++ {
+		limiter, err := getDeletionLimiter()
+		if err == nil || limiter != nil {
+			t.Fatalf("getDeletionLimiter() = %v, %v, want an error", limiter, err)
+		}
+	}
+}
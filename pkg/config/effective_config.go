@@ -0,0 +1,82 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+// EffectiveConfig holds the config in effect on a namespace, the global config merged with the namespace config.
+// The values are the ones applied to the runs matching no resource level spec
+type EffectiveConfig struct {
+	PipelineRuns EffectiveResourceConfig `json:"pipelineRuns"`
+	TaskRuns     EffectiveResourceConfig `json:"taskRuns"`
+}
+
+// EffectiveResourceConfig holds the config in effect for a resource type on a namespace, a nil value is not set
+type EffectiveResourceConfig struct {
+	EnforcedConfigLevel                   EnforcedConfigLevel `json:"enforcedConfigLevel"`
+	TTLSecondsAfterFinished               *int32              `json:"ttlSecondsAfterFinished,omitempty"`
+	TTLSecondsAfterFinishedWithoutResults *int32              `json:"ttlSecondsAfterFinishedWithoutResults,omitempty"`
+	TTLJitterSeconds                      *int32              `json:"ttlJitterSeconds,omitempty"`
+	SuccessfulHistoryLimit                *int32              `json:"successfulHistoryLimit,omitempty"`
+	FailedHistoryLimit                    *int32              `json:"failedHistoryLimit,omitempty"`
+	HistoryLimit                          *int32              `json:"historyLimit,omitempty"`
+	MinRetained                           *int32              `json:"minRetained,omitempty"`
+	MinRetentionSeconds                   *int32              `json:"minRetentionSeconds,omitempty"`
+	MinRetainedPerOutcome                 *int32              `json:"minRetainedPerOutcome,omitempty"`
+	MaxRetentionAgeSeconds                *int32              `json:"maxRetentionAgeSeconds,omitempty"`
+	RetainCalendarDays                    *int32              `json:"retainCalendarDays,omitempty"`
+}
+
+// GetEffectiveConfig returns the config in effect on the namespace
+func (ps *prunerConfigStore) GetEffectiveConfig(namespace string) EffectiveConfig {
+	return EffectiveConfig{
+		PipelineRuns: ps.getEffectiveResourceConfig(namespace, PrunerResourceTypePipelineRun),
+		TaskRuns:     ps.getEffectiveResourceConfig(namespace, PrunerResourceTypeTaskRun),
+	}
+}
+
+// getEffectiveResourceConfig resolves the fields of the resource type on the namespace
+func (ps *prunerConfigStore) getEffectiveResourceConfig(namespace string, resourceType PrunerResourceType) EffectiveResourceConfig {
+	field := func(fieldType PrunerFieldType) *int32 {
+		value, _ := ps.getResourceField(namespace, "", SelectorSpec{}, resourceType, fieldType)
+		return value
+	}
+
+	ps.mutex.RLock()
+	enforcedConfigLevel := ps.getEnforcedConfigLevel(namespace, "", SelectorSpec{}, resourceType)
+	ps.mutex.RUnlock()
+
+	return EffectiveResourceConfig{
+		EnforcedConfigLevel:                   enforcedConfigLevel,
+		TTLSecondsAfterFinished:               field(PrunerFieldTypeTTLSecondsAfterFinished),
+		TTLSecondsAfterFinishedWithoutResults: field(PrunerFieldTypeTTLSecondsAfterFinishedWithoutResults),
+		TTLJitterSeconds:                      field(PrunerFieldTypeTTLJitterSeconds),
+		SuccessfulHistoryLimit:                field(PrunerFieldTypeSuccessfulHistoryLimit),
+		FailedHistoryLimit:                    field(PrunerFieldTypeFailedHistoryLimit),
+		HistoryLimit:                          field(PrunerFieldTypeHistoryLimit),
+		MinRetained:                           field(PrunerFieldTypeMinRetained),
+		MinRetentionSeconds:                   field(PrunerFieldTypeMinRetentionSeconds),
+		MinRetainedPerOutcome:                 field(PrunerFieldTypeMinRetainedPerOutcome),
+		MaxRetentionAgeSeconds:                field(PrunerFieldTypeMaxRetentionAgeSeconds),
+		RetainCalendarDays:                    field(PrunerFieldTypeRetainCalendarDays),
+	}
+}
+
+// GetGeneration returns the config generation, it is bumped on every config load
+func (ps *prunerConfigStore) GetGeneration() uint64 {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.generation
+}
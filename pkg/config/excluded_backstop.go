@@ -0,0 +1,91 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+)
+
+// removeExcludedResource deletes the completed excluded resource once it is older than excludedRunsMaxAgeSeconds,
+// the backstop overrides the exclusion. The younger resource is requeued to be checked again at the age
+func (th *TTLHandler) removeExcludedResource(ctx context.Context, resource metav1.Object) error {
+	maxAge := PrunerConfigStore.GetExcludedRunsMaxAge()
+	if maxAge == nil || !th.resourceFn.IsCompleted(resource) {
+		return nil
+	}
+
+	creationTime := resource.GetCreationTimestamp()
+	if creationTime.IsZero() {
+		return nil
+	}
+	expiresAt := creationTime.Add(time.Duration(*maxAge) * time.Second)
+	if remaining := expiresAt.Sub(th.clock.Now()); remaining > 0 {
+		return controller.NewRequeueAfter(remaining)
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Infow("deleting excluded resource older than the excluded runs max age",
+		"resourceType", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+		"maxAgeSeconds", *maxAge)
+	return th.deleteRegardlessOfTTL(ctx, resource, th.resourceFn.GetCompletionStatus(resource), "excluded_deletion_failed")
+}
+
+// deleteRegardlessOfTTL deletes the resource as the expired resources are, without checking its TTL.
+// The deletion is recorded with the given status, a failure with the given error reason
+func (th *TTLHandler) deleteRegardlessOfTTL(ctx context.Context, resource metav1.Object, status, errorReason string) error {
+	logger := logging.FromContext(ctx)
+	resourceType := th.metricsResourceType()
+
+	metrics.GetRecorder().RecordResourceQueued(ctx, resource.GetUID(), resourceType, resource.GetNamespace(), metrics.OperationTTL)
+	if err := th.startupRamp.Wait(ctx); err != nil {
+		return err
+	}
+	if err := th.deletionLimiter.Acquire(ctx); err != nil {
+		return err
+	}
+	err := th.deletionBackend.Delete(ctx, resource)
+	th.deletionLimiter.Release()
+	if err != nil {
+		if errors.IsNotFound(err) {
+			metrics.GetRecorder().ClearResourceQueued(resource.GetUID())
+			return nil
+		}
+		metrics.GetRecorder().RecordResourceError(ctx, resourceType, resource.GetNamespace(), metrics.ClassifyError(err), errorReason)
+		return fmt.Errorf("failed to delete resource: %w", err)
+	}
+
+	logger.Infow("deleted resource regardless of its TTL",
+		"resourceType", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(), "status", status)
+
+	var resourceAge time.Duration
+	if creationTime := resource.GetCreationTimestamp(); !creationTime.IsZero() {
+		resourceAge = th.clock.Since(creationTime.Time)
+	}
+	metrics.GetRecorder().RecordResourceDeleted(ctx, resourceType, resource.GetNamespace(), metrics.OperationTTL, status, resourceAge)
+	metrics.GetRecorder().ClearResourceQueued(resource.GetUID())
+	pruneSummaryFromContext(ctx).RecordDeletion(resource.GetNamespace())
+	th.observeDeletion(ctx, resource, metrics.OperationTTL, status)
+	return nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConfigExplanation is the step by step resolution of the pruning config of a resource,
+// and whether the resource would be deleted by its ttl now
+type ConfigExplanation struct {
+	Kind                    string              `json:"kind"`
+	Namespace               string              `json:"namespace"`
+	Name                    string              `json:"name"`
+	ResourceName            string              `json:"resourceName,omitempty"`
+	EnforcedConfigLevel     EnforcedConfigLevel `json:"enforcedConfigLevel"`
+	TTLSecondsAfterFinished *int32              `json:"ttlSecondsAfterFinished,omitempty"`
+	SuccessfulHistoryLimit  *int32              `json:"successfulHistoryLimit,omitempty"`
+	FailedHistoryLimit      *int32              `json:"failedHistoryLimit,omitempty"`
+	DeleteAt                *metav1.Time        `json:"deleteAt,omitempty"`
+	DeleteNow               bool                `json:"deleteNow"`
+	Reason                  string              `json:"reason"`
+	Steps                   []string            `json:"steps"`
+}
+
+// Explainer explains the config of a run of a kind by its namespace and name
+type Explainer func(ctx context.Context, namespace, name string) (*ConfigExplanation, error)
+
+var (
+	explainers      = map[string]Explainer{}
+	explainersMutex sync.Mutex
+)
+
+// RegisterExplainer registers the explainer of the runs of a kind, called by the controllers on the start
+func RegisterExplainer(kind string, explainer Explainer) {
+	explainersMutex.Lock()
+	defer explainersMutex.Unlock()
+	explainers[kind] = explainer
+}
+
+// ExplainConfig explains the config of the run of the kind, an error is returned when no controller handles the kind
+func ExplainConfig(ctx context.Context, kind, namespace, name string) (*ConfigExplanation, error) {
+	explainersMutex.Lock()
+	explainer, found := explainers[kind]
+	explainersMutex.Unlock()
+	if !found {
+		return nil, fmt.Errorf("unsupported kind %q, expected %s or %s", kind, KindPipelineRun, KindTaskRun)
+	}
+	return explainer(ctx, namespace, name)
+}
+
+// ExplainEnforcedConfigLevel returns the enforced config level of the resource, with the levels checked to resolve it
+func (ps *prunerConfigStore) ExplainEnforcedConfigLevel(namespace, name string, selector SelectorSpec, resourceType PrunerResourceType) (EnforcedConfigLevel, []string) {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+
+	var steps []string
+	level := ps.traceEnforcedConfigLevel(namespace, name, selector, resourceType, &steps)
+	return level, steps
+}
+
+// ExplainConfig resolves the config of the resource the way it is reconciled, without changing it
+func (th *TTLHandler) ExplainConfig(ctx context.Context, namespace, name string) (*ConfigExplanation, error) {
+	resource, err := th.resourceFn.Get(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	labelKey := getResourceNameLabelKey(resource, th.resourceFn.GetDefaultLabelKey())
+	resourceName := getResourceName(resource, labelKey)
+	selectors := th.getResourceSelectors(resource)
+
+	explanation := &ConfigExplanation{
+		Kind:         th.resourceFn.Type(),
+		Namespace:    namespace,
+		Name:         name,
+		ResourceName: resourceName,
+	}
+
+	resourceType := PrunerResourceTypePipelineRun
+	getSuccessfulHistoryLimit := PrunerConfigStore.GetPipelineSuccessHistoryLimitCount
+	getFailedHistoryLimit := PrunerConfigStore.GetPipelineFailedHistoryLimitCount
+	if explanation.Kind == KindTaskRun {
+		resourceType = PrunerResourceTypeTaskRun
+		getSuccessfulHistoryLimit = PrunerConfigStore.GetTaskSuccessHistoryLimitCount
+		getFailedHistoryLimit = PrunerConfigStore.GetTaskFailedHistoryLimitCount
+	}
+
+	level, steps := PrunerConfigStore.ExplainEnforcedConfigLevel(namespace, resourceName, selectors, resourceType)
+	explanation.EnforcedConfigLevel = level
+	explanation.Steps = steps
+
+	ttl, identifiedBy := th.getTTLSecondsAfterFinished(resource, resourceName, selectors)
+	explanation.TTLSecondsAfterFinished = ttl
+	explanation.Steps = append(explanation.Steps, explainField("ttlSecondsAfterFinished", resourceType, level, ttl, identifiedBy)...)
+
+	successfulLimit, identifiedBy := getSuccessfulHistoryLimit(namespace, resourceName, selectors)
+	explanation.SuccessfulHistoryLimit = successfulLimit
+	explanation.Steps = append(explanation.Steps, explainField("successfulHistoryLimit", resourceType, level, successfulLimit, identifiedBy)...)
+
+	failedLimit, identifiedBy := getFailedHistoryLimit(namespace, resourceName, selectors)
+	explanation.FailedHistoryLimit = failedLimit
+	explanation.Steps = append(explanation.Steps, explainField("failedHistoryLimit", resourceType, level, failedLimit, identifiedBy)...)
+
+	th.explainDeletion(ctx, resource, ttl, explanation)
+	return explanation, nil
+}
+
+// explainDeletion sets whether the resource would be deleted by its ttl now, and why, in the order ProcessEvent checks it
+func (th *TTLHandler) explainDeletion(ctx context.Context, resource metav1.Object, ttl *int32, explanation *ConfigExplanation) {
+	now := th.clock.Now()
+	completed := th.resourceFn.IsCompleted(resource)
+
+	switch {
+	case resource.GetDeletionTimestamp() != nil:
+		explanation.Reason = "the resource is being deleted already"
+		return
+	case PrunerConfigStore.IsExcluded(resource.GetAnnotations()):
+		explanation.Reason = "the resource carries an annotation of excludeAnnotations, it is not pruned"
+		return
+	case !completed:
+		explanation.Reason = "the resource is not completed"
+		return
+	}
+
+	if completionTime, err := th.resourceFn.GetCompletionTime(resource); err == nil && isBeforeStartupCutoff(completionTime.Time) {
+		explanation.Reason = "the resource completed before the startup cutoff, it is not managed"
+		return
+	}
+
+	if deleteAt := th.NextDeletionTime(resource, ttl); deleteAt != nil {
+		explanation.DeleteAt = &metav1.Time{Time: *deleteAt}
+		if !now.Before(*deleteAt) {
+			explanation.DeleteNow = true
+			explanation.Reason = fmt.Sprintf("the ttl of %d seconds expired at %s", *ttl, deleteAt.UTC().Format(time.RFC3339))
+			return
+		}
+	}
+
+	if th.isNamespaceDecommissioned(ctx, resource.GetNamespace()) {
+		explanation.DeleteNow = true
+		explanation.Reason = "the namespace is decommissioned, its completed runs are deleted regardless of the ttl"
+		return
+	}
+
+	if explanation.DeleteAt != nil {
+		explanation.Reason = fmt.Sprintf("the ttl of %d seconds expires at %s", *ttl, explanation.DeleteAt.UTC().Format(time.RFC3339))
+		return
+	}
+	explanation.Reason = "no ttl applies, the resource is pruned by the history limits only"
+}
+
+// explainField describes the level a field is resolved from, and the levels fallen through before it
+func explainField(field string, resourceType PrunerResourceType, level EnforcedConfigLevel, value *int32, identifiedBy string) []string {
+	var steps []string
+	resolved := "unset"
+	if value != nil {
+		resolved = fmt.Sprint(*value)
+	}
+
+	switch identifiedBy {
+	case "identifiedBy_resource_owner":
+		return append(steps, fmt.Sprintf("%s=%s from the %s spec of the namespace matched by owner reference", field, resolved, resourceType))
+	case "identifiedBy_resource_name":
+		return append(steps, fmt.Sprintf("%s=%s from the %s spec of the namespace matched by name", field, resolved, resourceType))
+	case "identifiedBy_resource_label":
+		return append(steps, fmt.Sprintf("%s=%s from the %s spec of the namespace matched by label", field, resolved, resourceType))
+	case "identifiedBy_resource_ann":
+		return append(steps, fmt.Sprintf("%s=%s from the %s spec of the namespace matched by annotation", field, resolved, resourceType))
+	case "identifiedBy_quarantine":
+		return append(steps, fmt.Sprintf("%s=%s from the quarantine of the failed runs", field, resolved))
+	case "identifiedBy_ephemeral":
+		return append(steps, fmt.Sprintf("%s=%s from the ephemeral runs config, shorter than the resolved ttl", field, resolved))
+	}
+
+	// the resource level falls through to the namespace level, the namespace level to the global level
+	if level == EnforcedConfigLevelResource {
+		steps = append(steps, fmt.Sprintf("%s: no %s spec of the namespace sets it, falling through to the namespace level", field, resourceType))
+	}
+	switch identifiedBy {
+	case "identified_by_ns_label":
+		steps = append(steps, fmt.Sprintf("%s=%s from the ttlOverrides of the namespace matched by label", field, resolved))
+	case "identified_by_ns":
+		steps = append(steps, fmt.Sprintf("%s=%s from the namespace config", field, resolved))
+	default:
+		if level != EnforcedConfigLevelGlobal {
+			steps = append(steps, fmt.Sprintf("%s: the namespace has no config, falling through to the global level", field))
+		}
+		steps = append(steps, fmt.Sprintf("%s=%s from the global config", field, resolved))
+	}
+	return steps
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"knative.dev/pkg/ptr"
+)
+
+func TestExplainField(t *testing.T) {
+	tests := []struct {
+		name         string
+		level        EnforcedConfigLevel
+		value        *int32
+		identifiedBy string
+		want         []string
+	}{
+		{
+			name:         "resource spec",
+			level:        EnforcedConfigLevelResource,
+			value:        ptr.Int32(60),
+			identifiedBy: "identifiedBy_resource_label",
+			want:         []string{"ttlSecondsAfterFinished=60 from the pipelineRun spec of the namespace matched by label"},
+		},
+		{
+			name:         "resource level falls through to the global level",
+			level:        EnforcedConfigLevelResource,
+			value:        ptr.Int32(600),
+			identifiedBy: "identified_by_global",
+			want: []string{
+				"ttlSecondsAfterFinished: no pipelineRun spec of the namespace sets it, falling through to the namespace level",
+				"ttlSecondsAfterFinished: the namespace has no config, falling through to the global level",
+				"ttlSecondsAfterFinished=600 from the global config",
+			},
+		},
+		{
+			name:         "namespace label override",
+			level:        EnforcedConfigLevelNamespace,
+			value:        ptr.Int32(30),
+			identifiedBy: "identified_by_ns_label",
+			want:         []string{"ttlSecondsAfterFinished=30 from the ttlOverrides of the namespace matched by label"},
+		},
+		{
+			name:         "global level",
+			level:        EnforcedConfigLevelGlobal,
+			identifiedBy: "identified_by_global",
+			want:         []string{"ttlSecondsAfterFinished=unset from the global config"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := explainField("ttlSecondsAfterFinished", PrunerResourceTypePipelineRun, tt.level, tt.value, tt.identifiedBy)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("explainField() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
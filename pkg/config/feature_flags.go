@@ -0,0 +1,52 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+// FeatureFlag names an experimental behavior, it is enabled with the featureFlags of the global config
+type FeatureFlag string
+
+const (
+	// FeatureRetainedByAnnotation annotates the runs retained by minRetained or retainCalendarDays with the rule
+	// which retained them, as RETAINED_BY_ANNOTATION_ENABLED does
+	FeatureRetainedByAnnotation FeatureFlag = "retainedByAnnotation"
+
+	// FeatureTTLKeepLatest exempts the most recent successful and the most recent failed run of each group
+	// from the ttl deletion, as TTL_KEEP_LATEST_ENABLED does
+	FeatureTTLKeepLatest FeatureFlag = "ttlKeepLatest"
+
+	// FeatureReprocessRetriedRuns applies the history limits again to a run retried in place, which completed
+	// again after it was processed, on its final outcome
+	FeatureReprocessRetriedRuns FeatureFlag = "reprocessRetriedRuns"
+
+	// FeatureVerifyChildOwnership checks that the TaskRuns of a PipelineRun are owned by it before the PipelineRun
+	// is deleted, the TaskRuns lacking the owner reference are orphaned instead of being deleted along with it
+	FeatureVerifyChildOwnership FeatureFlag = "verifyChildOwnership"
+
+	// FeatureTraceLogCorrelation adds the trace and span IDs of the active span to the logs emitted within it, and
+	// bridges them to the OTel log records of the span, to correlate the logs with the traces
+	FeatureTraceLogCorrelation FeatureFlag = "traceLogCorrelation"
+)
+
+// FeatureFlags lists the supported feature flags
+var FeatureFlags = []FeatureFlag{FeatureRetainedByAnnotation, FeatureTTLKeepLatest, FeatureReprocessRetriedRuns, FeatureVerifyChildOwnership, FeatureTraceLogCorrelation}
+
+// IsFeatureEnabled returns true when the flag is enabled on the global config, all the flags are off by default
+func (ps *prunerConfigStore) IsFeatureEnabled(flag FeatureFlag) bool {
+	ps.mutex.RLock()
+	defer ps.mutex.RUnlock()
+	return ps.globalConfig.FeatureFlags[flag]
+}
@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestFeatureFlags(t *testing.T) {
+	// the flags are off by default
+	loadTestConfig(t, "ttlSecondsAfterFinished: 600")
+	for _, flag := range FeatureFlags {
+		if PrunerConfigStore.IsFeatureEnabled(flag) {
+			t.Errorf("feature flag %s is enabled by default", flag)
+		}
+	}
+	if isTTLKeepLatestEnabled() || isRetainedByAnnotationEnabled() {
+		t.Error("the experimental behaviors are enabled by default")
+	}
+
+	// the flags are enabled independently
+	loadTestConfig(t, "featureFlags:\n  ttlKeepLatest: true\n  retainedByAnnotation: false")
+	if !PrunerConfigStore.IsFeatureEnabled(FeatureTTLKeepLatest) || !isTTLKeepLatestEnabled() {
+		t.Errorf("feature flag %s is not enabled", FeatureTTLKeepLatest)
+	}
+	if PrunerConfigStore.IsFeatureEnabled(FeatureRetainedByAnnotation) || isRetainedByAnnotationEnabled() {
+		t.Errorf("feature flag %s is enabled", FeatureRetainedByAnnotation)
+	}
+}
@@ -17,9 +17,15 @@ limitations under the License.
 package config
 
 import (
+	"context"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"knative.dev/pkg/kmeta"
 )
 
 // common functions used across history limiter and ttl handler
@@ -34,6 +40,100 @@ func getResourceNameLabelKey(resource metav1.Object, defaultLabelKey string) str
 	return defaultLabelKey
 }
 
+// withShutdownGracePeriod returns a context which is not cancelled along with the parent context,
+// instead it is cancelled after the grace period once the parent is done. It lets the in-flight
+// work to complete on shutdown, without being hard-cancelled in the middle
+func withShutdownGracePeriod(ctx context.Context, gracePeriod time.Duration) (context.Context, context.CancelFunc) {
+	drainCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-drainCtx.Done():
+			return
+		}
+		timer := time.NewTimer(gracePeriod)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-drainCtx.Done():
+		}
+	}()
+	return drainCtx, cancel
+}
+
+// getOwnerReferenceSelectors returns the owner references of the resource as selectors
+func getOwnerReferenceSelectors(resource metav1.Object) []OwnerReferenceSelector {
+	var selectors []OwnerReferenceSelector
+	for _, ownerReference := range resource.GetOwnerReferences() {
+		selectors = append(selectors, OwnerReferenceSelector{Kind: ownerReference.Kind, Name: ownerReference.Name})
+	}
+	return selectors
+}
+
+// getSelectorLabels returns the labels of the resource to select its config and group it with,
+// the managed label set by the pruner is left out
+func getSelectorLabels(resource metav1.Object) map[string]string {
+	labels := resource.GetLabels()
+	if _, found := labels[LabelManaged]; !found {
+		return labels
+	}
+	selectorLabels := make(map[string]string, len(labels)-1)
+	for key, value := range labels {
+		if key != LabelManaged {
+			selectorLabels[key] = value
+		}
+	}
+	return selectorLabels
+}
+
+// isManagedLabelEnabled returns true when the runs patched by the pruner are labeled as managed
+func isManagedLabelEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv(EnvManagedLabelEnabled))
+	return err == nil && enabled
+}
+
+// isRetainedByAnnotationEnabled returns true when the retained runs are annotated with the rule which retained them,
+// it is enabled by the environment or by the feature flag
+func isRetainedByAnnotationEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv(EnvRetainedByAnnotationEnabled))
+	return (err == nil && enabled) || PrunerConfigStore.IsFeatureEnabled(FeatureRetainedByAnnotation)
+}
+
+// isTTLKeepLatestEnabled returns true when the latest run of each outcome is exempt from the ttl deletion,
+// it is enabled by the environment or by the feature flag
+func isTTLKeepLatestEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv(EnvTTLKeepLatestEnabled))
+	return (err == nil && enabled) || PrunerConfigStore.IsFeatureEnabled(FeatureTTLKeepLatest)
+}
+
+// patchMetadata returns the metadata of a merge patch which updates the given annotations,
+// the managed label is set as well when it is enabled
+func patchMetadata(annotations map[string]interface{}) map[string]interface{} {
+	metadata := map[string]interface{}{
+		"annotations": annotations,
+	}
+	if isManagedLabelEnabled() {
+		metadata["labels"] = map[string]interface{}{LabelManaged: "true"}
+	}
+	return metadata
+}
+
+// resourceNameLabelValue returns the value of the name label Tekton sets for the Pipeline or Task name. The names
+// longer than a label value allows are truncated and suffixed with their hash, as Tekton does with kmeta.ChildName
+func resourceNameLabelValue(name string) string {
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	return kmeta.ChildName(name, "")
+}
+
+// matchesResourceName returns true when the name of a config entry matches the name of a resource, taken
+// from its name label. The long name of an entry matches the truncated name of the label
+func matchesResourceName(specName, name string) bool {
+	return specName == name || resourceNameLabelValue(specName) == name
+}
+
 func getResourceName(resource metav1.Object, labelKey string) string {
 	labels := resource.GetLabels()
 	// if there is no label present, no option to filter
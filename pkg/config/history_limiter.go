@@ -21,15 +21,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"os"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	// tektonprunerv1alpha1 "github.com/openshift-pipelines/tektoncd-pruner/pkg/apis/tektonpruner/v1alpha1"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/ptr"
 )
@@ -45,9 +49,19 @@ type HistoryLimiterResourceFuncs interface {
 	List(ctx context.Context, namespace, label string) ([]metav1.Object, error)
 	GetFailedHistoryLimitCount(namespace, name string, selectors SelectorSpec) (*int32, string)
 	GetSuccessHistoryLimitCount(namespace, name string, selectors SelectorSpec) (*int32, string)
+	GetHistoryLimitCount(namespace, name string, selectors SelectorSpec) (*int32, string)
+	GetMinRetained(namespace, name string, selectors SelectorSpec) (*int32, string)
+	GetMinRetentionSeconds(namespace, name string, selectors SelectorSpec) (*int32, string)
+	GetMinRetainedPerOutcome(namespace, name string, selectors SelectorSpec) (*int32, string)
+	GetMaxRetentionAgeSeconds(namespace, name string, selectors SelectorSpec) (*int32, string)
+	GetRetainCalendarDays(namespace, name string, selectors SelectorSpec) (*int32, string)
 	IsSuccessful(resource metav1.Object) bool
 	IsFailed(resource metav1.Object) bool
 	IsCompleted(resource metav1.Object) bool
+	GetCompletionTime(resource metav1.Object) (metav1.Time, error)
+	GetCompletionStatus(resource metav1.Object) string
+	GetCompletionReason(resource metav1.Object) string
+	IsParentDeleting(ctx context.Context, resource metav1.Object) bool
 	GetDefaultLabelKey() string
 	GetEnforcedConfigLevel(namespace, name string, selectors SelectorSpec) EnforcedConfigLevel
 }
@@ -57,21 +71,82 @@ type HistoryLimiterResourceFuncs interface {
 // with different types of resources
 type HistoryLimiter struct {
 	resourceFn HistoryLimiterResourceFuncs
+	// shutdownGracePeriod is the time given to an in-flight cleanup to complete on shutdown
+	shutdownGracePeriod time.Duration
+	// startupRamp throttles the deletions after the controller start, nil when disabled
+	startupRamp *StartupRamp
+	// deletionLimiter bounds the concurrent deletions of all the reconcilers, nil when disabled
+	deletionLimiter *DeletionLimiter
+	// deletionBackend deletes the resources selected by the history limits
+	deletionBackend DeletionBackend
+	// processedBatcher coalesces the writes of the processed annotation, nil when disabled
+	processedBatcher *processedAnnotationBatcher
+	// cooldown limits the cleanups of each group when historyCleanupCooldownSeconds is set
+	cooldown *cleanupCooldown
+	// processedByVersion is the version of the controller the processed resources are annotated with, empty when disabled
+	processedByVersion string
+	// dryRun logs and counts the resources selected for deletion instead of deleting them
+	dryRun bool
+}
+
+// HistoryLimiterOptions are the options of a HistoryLimiter
+type HistoryLimiterOptions struct {
+	// DryRun reports the resources the history limits would delete, without deleting them
+	DryRun bool
 }
 
 // NewHistoryLimiter creates a new instance of HistoryLimiter, ensuring that the
 // provided HistoryLimiterResourceFuncs interface is not nil
 func NewHistoryLimiter(resourceFn HistoryLimiterResourceFuncs) (*HistoryLimiter, error) {
+	return NewHistoryLimiterWithOptions(resourceFn, HistoryLimiterOptions{})
+}
+
+// NewHistoryLimiterWithOptions creates a new instance of HistoryLimiter with the given options
+func NewHistoryLimiterWithOptions(resourceFn HistoryLimiterResourceFuncs, options HistoryLimiterOptions) (*HistoryLimiter, error) {
 	hl := &HistoryLimiter{
 		resourceFn: resourceFn,
+		cooldown:   newCleanupCooldown(),
+		dryRun:     options.DryRun,
 	}
 	if hl.resourceFn == nil {
 		return nil, fmt.Errorf("resourceFunc interface can not be nil")
 	}
+	hl.deletionBackend = withDeletionVerifier(newResourceFuncsDeletionBackend(resourceFn.Delete), resourceFn)
+
+	gracePeriodSeconds, err := GetEnvValueAsInt(EnvShutdownGracePeriodSeconds, DefaultShutdownGracePeriodSeconds)
+	if err != nil {
+		return nil, err
+	}
+	hl.shutdownGracePeriod = time.Duration(gracePeriodSeconds) * time.Second
+
+	hl.startupRamp, err = getStartupRamp()
+	if err != nil {
+		return nil, err
+	}
 
+	hl.deletionLimiter, err = getDeletionLimiter()
+	if err != nil {
+		return nil, err
+	}
+
+	batchSeconds, err := GetEnvValueAsInt(EnvProcessedAnnotationBatchSeconds, DefaultProcessedAnnotationBatchSeconds)
+	if err != nil {
+		return nil, err
+	}
+	hl.processedBatcher = newProcessedAnnotationBatcher(time.Duration(batchSeconds)*time.Second, hl.writeProcessedAnnotation)
+	hl.processedByVersion = os.Getenv(EnvProcessedByVersion)
 	return hl, nil
 }
 
+// SetDeletionBackend replaces the backend which deletes the resources, the resources
+// are deleted from the cluster with the resource funcs when it is nil
+func (hl *HistoryLimiter) SetDeletionBackend(backend DeletionBackend) {
+	if backend == nil {
+		backend = newResourceFuncsDeletionBackend(hl.resourceFn.Delete)
+	}
+	hl.deletionBackend = withDeletionVerifier(backend, hl.resourceFn)
+}
+
 // ProcessEvent processes an event for a given resource and performs cleanup
 // based on its status. The method checks if the resource is in a deletion state,
 // whether it has already been processed, and if it's in a completed state. Depending
@@ -81,13 +156,28 @@ func (hl *HistoryLimiter) ProcessEvent(ctx context.Context, resource metav1.Obje
 	logger := logging.FromContext(ctx)
 	logger.Debugw("processing an event for limit logic", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
 
+	// the controller is shutting down, do not start a new cleanup
+	if ctx.Err() != nil {
+		logger.Debugw("shutting down, skipping the event", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+		return nil
+	}
+
 	// if the resource is on deletion state, no action needed
 	if resource.GetDeletionTimestamp() != nil {
 		logger.Debugw("resource is in deletion state", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
 		return nil
 	}
 
-	if hl.isProcessed(resource) {
+	// the resource is excluded from pruning
+	if PrunerConfigStore.IsExcluded(resource.GetAnnotations()) {
+		logger.Debugw("resource is excluded from pruning", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+		return nil
+	}
+
+	// in the self-prune mode, a run retained on a previous reconcile can be over the limits now,
+	// the runs are checked on every reconcile and they are not marked as processed
+	selfPrune := PrunerConfigStore.IsHistorySelfPruneEnabled()
+	if !selfPrune && hl.isProcessed(resource) {
 		logger.Debugw("already processed", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
 		return nil
 	}
@@ -98,53 +188,119 @@ func (hl *HistoryLimiter) ProcessEvent(ctx context.Context, resource metav1.Obje
 		return nil
 	}
 
-	defer hl.markAsProcessed(ctx, resource)
+	// the group was cleaned up recently, the resource is left unprocessed, so that a reconcile
+	// after the cooldown, or the periodic cleanup, cleans the group up along with the resource
+	if !hl.startCleanup(resource) {
+		logger.Debugw("group cleaned up recently, deferring the cleanup", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+		return nil
+	}
 
-	if hl.resourceFn.IsSuccessful(resource) {
-		logger.Debugw("success - cleanup", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
-		return hl.DoSuccessfulResourceCleanup(ctx, resource)
+	// once started, the cleanup batch is not cancelled on shutdown,
+	// it gets a grace period to complete the deletions and to mark the resource as processed
+	ctx, cancel := withShutdownGracePeriod(ctx, hl.shutdownGracePeriod)
+	defer cancel()
+
+	if !selfPrune {
+		defer hl.markAsProcessed(ctx, resource)
 	}
 
-	if hl.resourceFn.IsFailed(resource) {
+	var err error
+	if hl.isCombinedLimitResource(resource) && hl.hasCombinedHistoryLimit(resource) {
+		logger.Debugw("combined - cleanup", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+		err = hl.DoCombinedResourceCleanup(ctx, resource)
+	} else if hl.resourceFn.IsSuccessful(resource) {
+		logger.Debugw("success - cleanup", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+		err = hl.DoSuccessfulResourceCleanup(ctx, resource)
+	} else if hl.resourceFn.IsFailed(resource) {
 		logger.Debugw("failed - cleanup", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
-		return hl.DoFailedResourceCleanup(ctx, resource)
+		err = hl.DoFailedResourceCleanup(ctx, resource)
+	} else {
+		logger.Debugw("unknown outcome - cleanup", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+		err = hl.DoUnknownOutcomeResourceCleanup(ctx, resource)
+	}
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return hl.doNamespaceCleanup(ctx, resource.GetNamespace())
+}
+
+// startCleanup returns true when the cleanup of the group and outcome of the resource can run,
+// always when historyCleanupCooldownSeconds is not set. Under the combined history limit the cleanup
+// covers all the outcomes of the group, the cooldown is tracked by the group only
+func (hl *HistoryLimiter) startCleanup(resource metav1.Object) bool {
+	cooldown := PrunerConfigStore.GetHistoryCleanupCooldown()
+	if cooldown <= 0 {
+		return true
+	}
+	labelKey := getResourceNameLabelKey(resource, hl.resourceFn.GetDefaultLabelKey())
+	outcome := strconv.FormatBool(hl.resourceFn.IsSuccessful(resource))
+	if hl.isCombinedLimitResource(resource) && hl.hasCombinedHistoryLimit(resource) {
+		outcome = "combined"
+	}
+	group := strings.Join([]string{resource.GetNamespace(), labelKey, getResourceName(resource, labelKey), outcome}, "/")
+	return hl.cooldown.tryStart(group, cooldown)
 }
 
 // adds an annotation, indicates this resource is already processed
 // no action needed on the further reconcile loop for this Resource
-// markAsProcessed patches the resource with the annotation 'mark as processed'
+// markAsProcessed patches the resource with the annotation 'mark as processed',
+// the patch is deferred to the end of the window when the writes are batched
 func (hl *HistoryLimiter) markAsProcessed(ctx context.Context, resource metav1.Object) {
 	logger := logging.FromContext(ctx)
 
 	logger.Debugw("marking resource as processed", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
 
+	mark := processedMark{
+		namespace:   resource.GetNamespace(),
+		name:        resource.GetName(),
+		uid:         resource.GetUID(),
+		processedAt: time.Now(),
+		generation:  PrunerConfigStore.GetReprocessGeneration(),
+	}
+	if hl.processedBatcher != nil {
+		hl.processedBatcher.add(ctx, mark)
+		return
+	}
+	hl.writeProcessedAnnotation(ctx, mark)
+}
+
+// writeProcessedAnnotation patches the marked resource with the processed annotation,
+// the resource deleted or replaced by another one of the same name meanwhile is not patched
+func (hl *HistoryLimiter) writeProcessedAnnotation(ctx context.Context, mark processedMark) {
+	logger := logging.FromContext(ctx)
+
 	// Fetch the latest version of the resource
-	resourceLatest, err := hl.resourceFn.Get(ctx, resource.GetNamespace(), resource.GetName())
+	resourceLatest, err := hl.resourceFn.Get(ctx, mark.namespace, mark.name)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			return
 		}
 		logger.Errorw("error getting resource", "resource", hl.resourceFn.Type(),
-			"namespace", resource.GetNamespace(), "name", resource.GetName(), zap.Error(err))
+			"namespace", mark.namespace, "name", mark.name, zap.Error(err))
+		return
+	}
+	if mark.uid != "" && resourceLatest.GetUID() != "" && resourceLatest.GetUID() != mark.uid {
 		return
 	}
 
-	// Prepare the annotation update
-	processedTimeAsString := time.Now().Format(time.RFC3339)
-	annotations := resourceLatest.GetAnnotations()
-	if annotations == nil {
-		annotations = map[string]string{}
+	// Prepare the annotation update, the generation is removed when it is not set on the config map
+	processedTimeAsString := mark.processedAt.Format(time.RFC3339)
+	annotations := map[string]interface{}{
+		AnnotationHistoryLimitCheckProcessed: processedTimeAsString,
+		AnnotationReprocessGeneration:        nil,
+	}
+	if mark.generation != "" {
+		annotations[AnnotationReprocessGeneration] = mark.generation
+	}
+	// the version of the controller which made the decision, to debug the upgrades
+	if hl.processedByVersion != "" {
+		annotations[AnnotationProcessedByVersion] = hl.processedByVersion
 	}
-	annotations[AnnotationHistoryLimitCheckProcessed] = processedTimeAsString
 
 	// Create a patch with the new annotations
 	patchData := map[string]interface{}{
-		"metadata": map[string]interface{}{
-			"annotations": annotations,
-		},
+		"metadata": patchMetadata(annotations),
 	}
 
 	// Convert patchData to JSON
@@ -163,25 +319,255 @@ func (hl *HistoryLimiter) markAsProcessed(ctx context.Context, resource metav1.O
 }
 
 func (hl *HistoryLimiter) isProcessed(resource metav1.Object) bool {
+	// the resource whose annotation is not written yet counts as processed
+	if hl.processedBatcher.isPending(resource) {
+		return true
+	}
 	annotations := resource.GetAnnotations()
 	if annotations == nil {
 		return false
 	}
-	_, found := annotations[AnnotationHistoryLimitCheckProcessed]
-	return found
+	processedAt, found := annotations[AnnotationHistoryLimitCheckProcessed]
+	if !found {
+		return false
+	}
+	// the resource processed on another reprocess generation is processed again
+	if annotations[AnnotationReprocessGeneration] != PrunerConfigStore.GetReprocessGeneration() {
+		return false
+	}
+	return !hl.isRetriedSinceProcessed(resource, processedAt)
+}
+
+// isRetriedSinceProcessed returns true when the resource, retried in place, completed again after it was processed.
+// It is processed again on its final outcome when the reprocessRetriedRuns feature flag is enabled
+func (hl *HistoryLimiter) isRetriedSinceProcessed(resource metav1.Object, processedAt string) bool {
+	if !PrunerConfigStore.IsFeatureEnabled(FeatureReprocessRetriedRuns) || !hl.resourceFn.IsCompleted(resource) {
+		return false
+	}
+	processedTime, err := time.Parse(time.RFC3339, processedAt)
+	if err != nil {
+		return false
+	}
+	completionTime, err := hl.resourceFn.GetCompletionTime(resource)
+	if err != nil {
+		return false
+	}
+	// the processed time is truncated to the second
+	return completionTime.Time.After(processedTime.Add(time.Second))
 }
 
 func (hl *HistoryLimiter) DoSuccessfulResourceCleanup(ctx context.Context, resource metav1.Object) error {
 	logging := logging.FromContext(ctx)
 
 	logging.Debugw("processing a successful resource", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
-	return hl.doResourceCleanup(ctx, resource, AnnotationSuccessfulHistoryLimit, hl.resourceFn.GetSuccessHistoryLimitCount, hl.isSuccessfulResource)
+
+	// the ephemeral resources with a limit are retained separately from the other successful resources
+	if hl.isLimitedEphemeral(resource) {
+		return hl.doEphemeralResourceCleanup(ctx, resource, AnnotationSuccessfulHistoryLimit, hl.resourceFn.GetSuccessHistoryLimitCount, hl.isSuccessfulResource)
+	}
+	return hl.doResourceCleanup(ctx, resource, AnnotationSuccessfulHistoryLimit, hl.resourceFn.GetSuccessHistoryLimitCount, func(res metav1.Object) bool {
+		return hl.isSuccessfulResource(res) && !hl.isLimitedEphemeral(res)
+	}, nil)
 }
 
 func (hl *HistoryLimiter) DoFailedResourceCleanup(ctx context.Context, resource metav1.Object) error {
 	logging := logging.FromContext(ctx)
 	logging.Debugw("processing a failed resource", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
-	return hl.doResourceCleanup(ctx, resource, AnnotationFailedHistoryLimit, hl.resourceFn.GetFailedHistoryLimitCount, hl.isFailedResource)
+
+	// the quarantined resources are retained separately from all the other failed resources
+	if _, quarantineLimit, quarantined := hl.getQuarantine(resource); quarantined {
+		if quarantineLimit == nil {
+			logging.Debugw("quarantined resource is not limited", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+			return nil
+		}
+		getQuarantineLimitFn := func(string, string, SelectorSpec) (*int32, string) {
+			return quarantineLimit, "identifiedBy_quarantine"
+		}
+		return hl.doResourceCleanup(ctx, resource, AnnotationFailedHistoryLimit, getQuarantineLimitFn, func(res metav1.Object) bool {
+			return hl.isFailedResource(res) && hl.isQuarantined(res)
+		}, nil)
+	}
+
+	// the ephemeral resources with a limit are retained separately from the other failed resources
+	if hl.isLimitedEphemeral(resource) {
+		return hl.doEphemeralResourceCleanup(ctx, resource, AnnotationFailedHistoryLimit, hl.resourceFn.GetFailedHistoryLimitCount, func(res metav1.Object) bool {
+			return hl.isFailedResource(res) && !hl.isQuarantined(res)
+		})
+	}
+
+	// the failed resources of a bucket with a limit are retained separately from the other failed resources
+	bucket, bucketLimit := PrunerConfigStore.GetFailureBucket(hl.resourceFn.GetCompletionReason(resource))
+	if bucketLimit != nil {
+		logging.Debugw("failed resource is retained by its bucket", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(), "bucket", bucket, "limit", *bucketLimit)
+		getBucketLimitFn := func(string, string, SelectorSpec) (*int32, string) {
+			return bucketLimit, "identifiedBy_failure_bucket"
+		}
+		return hl.doResourceCleanup(ctx, resource, AnnotationFailedHistoryLimit, getBucketLimitFn, func(res metav1.Object) bool {
+			return hl.isFailedResource(res) && !hl.isQuarantined(res) && !hl.isLimitedEphemeral(res) && hl.getFailureBucket(res) == bucket
+		}, nil)
+	}
+
+	return hl.doResourceCleanup(ctx, resource, AnnotationFailedHistoryLimit, hl.resourceFn.GetFailedHistoryLimitCount, func(res metav1.Object) bool {
+		return hl.isFailedResource(res) && !hl.isQuarantined(res) && !hl.isLimitedEphemeral(res) && !hl.hasFailureBucketLimit(res)
+	}, nil)
+}
+
+// doEphemeralResourceCleanup limits the ephemeral resources of the outcome separately from the other resources
+// of their group, by the lowest of the ephemeral history limit and the history limit of the group
+func (hl *HistoryLimiter) doEphemeralResourceCleanup(ctx context.Context, resource metav1.Object, historyLimitAnnotation string, getHistoryLimitFn func(string, string, SelectorSpec) (*int32, string), getResourceFilterFn func(metav1.Object) bool) error {
+	_, ephemeralLimit, _ := PrunerConfigStore.GetEphemeral(resource.GetAnnotations())
+	getEphemeralLimitFn := func(namespace, name string, selectors SelectorSpec) (*int32, string) {
+		limit, identifiedBy := getHistoryLimitFn(namespace, name, selectors)
+		if limit != nil && *limit < *ephemeralLimit {
+			return limit, identifiedBy
+		}
+		return ephemeralLimit, "identifiedBy_ephemeral"
+	}
+	return hl.doResourceCleanup(ctx, resource, historyLimitAnnotation, getEphemeralLimitFn, func(res metav1.Object) bool {
+		return getResourceFilterFn(res) && hl.isLimitedEphemeral(res)
+	}, nil)
+}
+
+// isLimitedEphemeral returns true when the resource is ephemeral and the ephemeral resources are limited in number
+func (hl *HistoryLimiter) isLimitedEphemeral(resource metav1.Object) bool {
+	_, limit, ephemeral := PrunerConfigStore.GetEphemeral(resource.GetAnnotations())
+	return ephemeral && limit != nil
+}
+
+// doNamespaceCleanup deletes the oldest completed resources of the namespace, regardless of the Pipeline or the Task
+// they belong to, until the namespace holds no more than maxCompletedRunsPerNamespace of them. It is a backstop on top
+// of the history limits of each group. The excluded and the quarantined resources are neither counted nor deleted,
+// nor are the TaskRuns of a PipelineRun, they are deleted along with the PipelineRun
+func (hl *HistoryLimiter) doNamespaceCleanup(ctx context.Context, namespace string) error {
+	limit := PrunerConfigStore.GetMaxCompletedRunsPerNamespace()
+	if limit == nil {
+		return nil
+	}
+
+	resources, err := hl.resourceFn.List(ctx, namespace, "")
+	if err != nil {
+		return err
+	}
+	completed := []metav1.Object{}
+	for _, res := range resources {
+		if hl.resourceFn.IsCompleted(res) && res.GetDeletionTimestamp() == nil && !isOwnedByPipelineRun(res) &&
+			!PrunerConfigStore.IsExcluded(res.GetAnnotations()) && !(hl.resourceFn.IsFailed(res) && hl.isQuarantined(res)) &&
+			!isBeforeStartupCutoff(hl.completedAt(res)) {
+			completed = append(completed, res)
+		}
+	}
+	if len(completed) <= int(*limit) {
+		return nil
+	}
+
+	// Sort resources by completion time (oldest first)
+	slices.SortStableFunc(completed, func(a, b metav1.Object) int {
+		return compareTimes(hl.completedAt(a), hl.completedAt(b))
+	})
+
+	logging.FromContext(ctx).Infow("namespace holds more completed resources than the limit, deleting the oldest ones",
+		"resource", hl.resourceFn.Type(), "namespace", namespace, "completed", len(completed), "limit", *limit)
+	return hl.deleteResources(ctx, completed[:len(completed)-int(*limit)])
+}
+
+// isOwnedByPipelineRun returns true when the resource is owned by a PipelineRun
+func isOwnedByPipelineRun(resource metav1.Object) bool {
+	for _, ownerReference := range resource.GetOwnerReferences() {
+		if ownerReference.Kind == KindPipelineRun {
+			return true
+		}
+	}
+	return false
+}
+
+// isPipelineRunChild returns true when the resource is a TaskRun of a PipelineRun,
+// labeled with its PipelineRun or owned by it
+func isPipelineRunChild(resource metav1.Object) bool {
+	return resource.GetLabels()[LabelPipelineRunName] != "" || isOwnedByPipelineRun(resource)
+}
+
+// metricsResourceType returns the resource type label of the metrics
+func (hl *HistoryLimiter) metricsResourceType() string {
+	if hl.resourceFn.Type() == KindTaskRun {
+		return metrics.ResourceTypeTaskRun
+	}
+	return metrics.ResourceTypePipelineRun
+}
+
+// compareTimes compares the times of two resources as time.Compare does. A zero time is unknown, it is
+// compared as the newest one, so the resource is retained rather than deleted first
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.IsZero() && b.IsZero():
+		return 0
+	case a.IsZero():
+		return 1
+	case b.IsZero():
+		return -1
+	}
+	return a.Compare(b)
+}
+
+// recordMissingCreationTimestamps reports the resources without a creation timestamp, they are not expected
+// from the API server. They are ordered as the newest resources
+func (hl *HistoryLimiter) recordMissingCreationTimestamps(ctx context.Context, resources []metav1.Object) {
+	for _, res := range resources {
+		if !res.GetCreationTimestamp().Time.IsZero() {
+			continue
+		}
+		logging.FromContext(ctx).Warnw("resource has no creation timestamp, it is retained as the newest resource",
+			"resource", hl.resourceFn.Type(), "namespace", res.GetNamespace(), "name", res.GetName())
+		metrics.GetRecorder().RecordResourceError(ctx, hl.metricsResourceType(), res.GetNamespace(), metrics.ErrorTypeValidation, "missing_creation_timestamp")
+	}
+}
+
+// completedAt returns the completion time of the resource, its creation time when it has none
+func (hl *HistoryLimiter) completedAt(resource metav1.Object) time.Time {
+	completionTime, err := hl.resourceFn.GetCompletionTime(resource)
+	if err != nil || completionTime.IsZero() {
+		return resource.GetCreationTimestamp().Time
+	}
+	return completionTime.Time
+}
+
+// getQuarantine returns the ttl and the history limit of the quarantine the resource matches
+func (hl *HistoryLimiter) getQuarantine(resource metav1.Object) (*int32, *int32, bool) {
+	return PrunerConfigStore.GetQuarantine(resource.GetLabels(), resource.GetAnnotations())
+}
+
+// isQuarantined returns true when the resource matches the quarantine
+func (hl *HistoryLimiter) isQuarantined(resource metav1.Object) bool {
+	_, _, quarantined := hl.getQuarantine(resource)
+	return quarantined
+}
+
+// getFailureBucket returns the bucket the reason of the failed resource is mapped to
+func (hl *HistoryLimiter) getFailureBucket(resource metav1.Object) string {
+	bucket, _ := PrunerConfigStore.GetFailureBucket(hl.resourceFn.GetCompletionReason(resource))
+	return bucket
+}
+
+// hasFailureBucketLimit returns true when the failed resource is retained by the limit of its bucket
+func (hl *HistoryLimiter) hasFailureBucketLimit(resource metav1.Object) bool {
+	_, limit := PrunerConfigStore.GetFailureBucket(hl.resourceFn.GetCompletionReason(resource))
+	return limit != nil
+}
+
+// filterByOwnerReferences returns the resources matching the same owner reference selectors as the given resource
+func (hl *HistoryLimiter) filterByOwnerReferences(resource metav1.Object, resources []metav1.Object) []metav1.Object {
+	resourceType := PrunerResourceTypePipelineRun
+	if hl.resourceFn.Type() == KindTaskRun {
+		resourceType = PrunerResourceTypeTaskRun
+	}
+	selectors := PrunerConfigStore.GetOwnerReferenceSelectors(resource.GetNamespace(), resourceType, getOwnerReferenceSelectors(resource))
+
+	var filtered []metav1.Object
+	for _, res := range resources {
+		if matchesOwnerReferences(selectors, getOwnerReferenceSelectors(res)) {
+			filtered = append(filtered, res)
+		}
+	}
+	return filtered
 }
 
 func (hl *HistoryLimiter) isFailedResource(resource metav1.Object) bool {
@@ -192,25 +578,107 @@ func (hl *HistoryLimiter) isSuccessfulResource(resource metav1.Object) bool {
 	return hl.resourceFn.IsCompleted(resource) && hl.resourceFn.IsSuccessful(resource)
 }
 
-func (hl *HistoryLimiter) doResourceCleanup(ctx context.Context, resource metav1.Object, historyLimitAnnotation string, getHistoryLimitFn func(string, string, SelectorSpec) (*int32, string), getResourceFilterFn func(metav1.Object) bool) error {
-	logger := logging.FromContext(ctx)
+// DoCombinedResourceCleanup cleans up the successful and the failed resources together, when historyLimit is set
+// without successfulHistoryLimit and failedHistoryLimit. The newest resources up to the limit are retained regardless
+// of their outcome
+func (hl *HistoryLimiter) DoCombinedResourceCleanup(ctx context.Context, resource metav1.Object) error {
+	logging.FromContext(ctx).Debugw("processing a resource on the combined history limit", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
 
-	// get the label key and resource name
-	labelKey := getResourceNameLabelKey(resource, hl.resourceFn.GetDefaultLabelKey())
-	resourceName := getResourceName(resource, labelKey)
+	return hl.doResourceCleanup(ctx, resource, AnnotationHistoryLimit, hl.getCombinedHistoryLimit, hl.isCombinedLimitResource, hl.resourceFn.GetMinRetainedPerOutcome)
+}
 
-	// Get Annotations and Labels
-	resourceAnnotations := resource.GetAnnotations()
-	resourceLabels := resource.GetLabels()
+// hasCombinedHistoryLimit returns true when the combined history limit applies to the group of the resource
+func (hl *HistoryLimiter) hasCombinedHistoryLimit(resource metav1.Object) bool {
+	resourceName, resourceSelectors := hl.getResourceNameAndSelectors(resource)
+	limit, _ := hl.getCombinedHistoryLimit(resource.GetNamespace(), resourceName, resourceSelectors)
+	return limit != nil
+}
+
+// getCombinedHistoryLimit returns the historyLimit when the successful and the failed history limits are identified by
+// the same level, that is when neither of them is set there. It is nil when either is set on a more specific level,
+// the split limits apply then, historyLimit is not combined over them
+func (hl *HistoryLimiter) getCombinedHistoryLimit(namespace, name string, selectors SelectorSpec) (*int32, string) {
+	limit, identifiedBy := hl.resourceFn.GetHistoryLimitCount(namespace, name, selectors)
+	if limit == nil {
+		return nil, identifiedBy
+	}
+	_, successIdentifiedBy := hl.resourceFn.GetSuccessHistoryLimitCount(namespace, name, selectors)
+	_, failedIdentifiedBy := hl.resourceFn.GetFailedHistoryLimitCount(namespace, name, selectors)
+	if successIdentifiedBy != identifiedBy || failedIdentifiedBy != identifiedBy {
+		return nil, identifiedBy
+	}
+	return limit, identifiedBy
+}
+
+// isCombinedLimitResource returns true for a successful or failed resource counted on the combined history limit.
+// The limited ephemeral, the quarantined and the bucketed failed resources are retained separately
+func (hl *HistoryLimiter) isCombinedLimitResource(resource metav1.Object) bool {
+	if hl.isLimitedEphemeral(resource) {
+		return false
+	}
+	if hl.isSuccessfulResource(resource) {
+		return true
+	}
+	return hl.isFailedResource(resource) && !hl.isQuarantined(resource) && !hl.hasFailureBucketLimit(resource)
+}
+
+// isUnknownOutcomeResource returns true for a completed resource which is neither successful nor failed
+func (hl *HistoryLimiter) isUnknownOutcomeResource(resource metav1.Object) bool {
+	return hl.resourceFn.IsCompleted(resource) && !hl.resourceFn.IsSuccessful(resource) && !hl.resourceFn.IsFailed(resource)
+}
+
+// DoUnknownOutcomeResourceCleanup cleans up the completed resources which are neither successful nor failed, for
+// example a run completed without a final condition. They are retained separately from the successful and the failed
+// resources, up to the higher of the successful and the failed history limits, historyLimit when neither is set
+func (hl *HistoryLimiter) DoUnknownOutcomeResourceCleanup(ctx context.Context, resource metav1.Object) error {
+	logging.FromContext(ctx).Debugw("processing a resource of unknown outcome", "resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+
+	return hl.doResourceCleanup(ctx, resource, AnnotationHistoryLimit, hl.getUnknownOutcomeHistoryLimit, hl.isUnknownOutcomeResource, nil)
+}
+
+// getUnknownOutcomeHistoryLimit returns the higher of the successful and the failed history limits, a resource of
+// unknown outcome is not deleted sooner than under either outcome. It is nil when either limit is not set
+func (hl *HistoryLimiter) getUnknownOutcomeHistoryLimit(namespace, name string, selectors SelectorSpec) (*int32, string) {
+	successLimit, successIdentifiedBy := hl.resourceFn.GetSuccessHistoryLimitCount(namespace, name, selectors)
+	failedLimit, failedIdentifiedBy := hl.resourceFn.GetFailedHistoryLimitCount(namespace, name, selectors)
+	if successLimit == nil || *successLimit < 0 {
+		return nil, successIdentifiedBy
+	}
+	if failedLimit == nil || *failedLimit < 0 {
+		return nil, failedIdentifiedBy
+	}
+	if *failedLimit > *successLimit {
+		return failedLimit, failedIdentifiedBy
+	}
+	return successLimit, successIdentifiedBy
+}
+
+// getResourceNameAndSelectors returns the name of the resource group and the selectors, with both matchLabels
+// and matchAnnotations, the config of the resource is resolved with
+func (hl *HistoryLimiter) getResourceNameAndSelectors(resource metav1.Object) (string, SelectorSpec) {
+	labelKey := getResourceNameLabelKey(resource, hl.resourceFn.GetDefaultLabelKey())
 
-	// Construct the selectors with both matchLabels and matchAnnotations
 	resourceSelectors := SelectorSpec{}
-	if len(resourceAnnotations) > 0 {
+	if resourceAnnotations := resource.GetAnnotations(); len(resourceAnnotations) > 0 {
 		resourceSelectors.MatchAnnotations = resourceAnnotations
 	}
-	if len(resourceLabels) > 0 {
+	if resourceLabels := getSelectorLabels(resource); len(resourceLabels) > 0 {
 		resourceSelectors.MatchLabels = resourceLabels
 	}
+	resourceSelectors.MatchOwnerReferences = getOwnerReferenceSelectors(resource)
+	return getResourceName(resource, labelKey), resourceSelectors
+}
+
+// doResourceCleanup deletes the resources of the group of the resource accepted by the filter over the history limit.
+// The newest resources of each outcome up to the limit returned by getMinPerOutcomeFn are retained when it is not nil
+func (hl *HistoryLimiter) doResourceCleanup(ctx context.Context, resource metav1.Object, historyLimitAnnotation string, getHistoryLimitFn func(string, string, SelectorSpec) (*int32, string), getResourceFilterFn func(metav1.Object) bool, getMinPerOutcomeFn func(string, string, SelectorSpec) (*int32, string)) error {
+	logger := logging.FromContext(ctx)
+
+	// get the label key, the resource name and the selectors
+	labelKey := getResourceNameLabelKey(resource, hl.resourceFn.GetDefaultLabelKey())
+	resourceName, resourceSelectors := hl.getResourceNameAndSelectors(resource)
+	resourceAnnotations := resource.GetAnnotations()
+	resourceLabels := getSelectorLabels(resource)
 
 	// Get enforced config level first
 	enforcedConfigLevel := hl.resourceFn.GetEnforcedConfigLevel(resource.GetNamespace(), resourceName, resourceSelectors)
@@ -261,9 +729,23 @@ func (hl *HistoryLimiter) doResourceCleanup(ctx context.Context, resource metav1
 
 	logger.Debugw("historylimit for the resource", "resourcename", resourceName, "limit", historyLimit, "identifiedBy", identifiedBy)
 
-	if historyLimit == nil || *historyLimit < 0 {
+	// the resources older than the max retention age are deleted below the history limit as well
+	maxRetentionAge, maxRetentionAgeIdentifiedBy := hl.resourceFn.GetMaxRetentionAgeSeconds(resource.GetNamespace(), resourceName, resourceSelectors)
+	if maxRetentionAge != nil && *maxRetentionAge < 0 {
+		maxRetentionAge = nil
+	}
+	if historyLimit != nil && *historyLimit < 0 {
+		historyLimit = nil
+	}
+	if historyLimit == nil && maxRetentionAge == nil {
 		return nil
 	}
+	// without a history limit, the resources are grouped by the level the max retention age is identified by
+	if historyLimit == nil {
+		identifiedBy = maxRetentionAgeIdentifiedBy
+	}
+	minRetained, _ := hl.resourceFn.GetMinRetained(resource.GetNamespace(), resourceName, resourceSelectors)
+	logger.Debugw("retention for the resource", "resourcename", resourceName, "maxRetentionAgeSeconds", maxRetentionAge, "minRetained", minRetained)
 
 	// List Resources (using appropriate selector based on enforcement level and identifier)
 	var resources []metav1.Object
@@ -272,26 +754,14 @@ func (hl *HistoryLimiter) doResourceCleanup(ctx context.Context, resource metav1
 	if enforcedConfigLevel == EnforcedConfigLevelResource {
 		switch identifiedBy {
 		case "identifiedBy_resource_name":
-			label := fmt.Sprintf("%s=%s", labelKey, resourceName)
-			resources, err = hl.resourceFn.List(ctx, resource.GetNamespace(), label)
+			resources, err = hl.listMatchingLabels(ctx, resource.GetNamespace(), map[string]string{labelKey: resourceName})
 		case "identifiedBy_resource_ann":
-			labelSelector := ""
-			for k, v := range resourceAnnotations {
-				if labelSelector != "" {
-					labelSelector += ","
-				}
-				labelSelector += fmt.Sprintf("%s=%s", k, v)
-			}
-			resources, err = hl.resourceFn.List(ctx, resource.GetNamespace(), labelSelector)
+			resources, err = hl.listMatchingLabels(ctx, resource.GetNamespace(), resourceAnnotations)
 		case "identifiedBy_resource_label":
-			labelSelector := ""
-			for k, v := range resourceLabels {
-				if labelSelector != "" {
-					labelSelector += ","
-				}
-				labelSelector += fmt.Sprintf("%s=%s", k, v)
-			}
-			resources, err = hl.resourceFn.List(ctx, resource.GetNamespace(), labelSelector)
+			resources, err = hl.listMatchingLabels(ctx, resource.GetNamespace(), resourceLabels)
+		case "identifiedBy_resource_owner":
+			resources, err = hl.resourceFn.List(ctx, resource.GetNamespace(), "")
+			resources = hl.filterByOwnerReferences(resource, resources)
 		default:
 			resources, err = hl.resourceFn.List(ctx, resource.GetNamespace(), "")
 		}
@@ -304,46 +774,122 @@ func (hl *HistoryLimiter) doResourceCleanup(ctx context.Context, resource metav1
 		return err
 	}
 
-	// Filter resources by status (success/failed)
+	// Filter resources by status (success/failed), the excluded resources are not counted.
+	// The resources being deleted are not counted either, the deletion of a resource
+	// still listed after a previous attempt is not repeated and counted twice
+	excludeChildren := hl.resourceFn.Type() == KindTaskRun && PrunerConfigStore.IsChildTaskRunsExcludedFromLimits()
 	resourcesFiltered := []metav1.Object{}
 	for _, res := range resources {
-		if getResourceFilterFn(res) {
+		if excludeChildren && isPipelineRunChild(res) {
+			continue
+		}
+		// the resources completed before the startup cutoff are not managed
+		if isBeforeStartupCutoff(hl.completedAt(res)) {
+			continue
+		}
+		if getResourceFilterFn(res) && !PrunerConfigStore.IsExcluded(res.GetAnnotations()) && res.GetDeletionTimestamp() == nil {
 			resourcesFiltered = append(resourcesFiltered, res)
 		}
 	}
 	resources = resourcesFiltered
+	hl.recordMissingCreationTimestamps(ctx, resources)
 
-	if int(*historyLimit) > len(resources) {
+	// Sort resources by completion time (most recently completed first), a run created early but completed late is
+	// among the most recent runs. The creation timestamp is used when there is no completion time, the resources
+	// without either are the newest
+	slices.SortStableFunc(resources, func(a, b metav1.Object) int {
+		return compareTimes(hl.completedAt(b), hl.completedAt(a))
+	})
+
+	// the resources completed within the retained calendar days are neither deleted nor counted on the limits
+	now := time.Now()
+	listed := resources
+	retainCalendarDays, _ := hl.resourceFn.GetRetainCalendarDays(resource.GetNamespace(), resourceName, resourceSelectors)
+	if retainCalendarDays != nil && *retainCalendarDays > 0 {
+		resources = hl.completedBefore(resources, startOfCalendarDays(now, PrunerConfigStore.GetLocation(), *retainCalendarDays))
+	}
+
+	// Select resources to delete (keep newest up to historyLimit, younger than the max retention age)
+	retained := retainedCount(resources, now, historyLimit, maxRetentionAge, minRetained, hl.completedAt)
+	if isRetainedByAnnotationEnabled() {
+		retainedBy := getRetainedBy(listed, resources, now, historyLimit, maxRetentionAge, minRetained, hl.completedAt)
+		hl.annotateRetainedBy(ctx, listed, resources[retained:], retainedBy)
+	}
+	if retained >= len(resources) {
 		return nil
 	}
+	selectionForDeletion := resources[retained:]
 
-	// Sort resources by creation timestamp (newest first)
-	slices.SortStableFunc(resources, func(a, b metav1.Object) int {
-		objA := a.GetCreationTimestamp()
-		objB := b.GetCreationTimestamp()
-		if objA.Time.Before(objB.Time) {
-			return 1
-		} else if objA.Time.After(objB.Time) {
-			return -1
+	// under the combined history limit, the newest resources of each outcome are retained up to the minimum
+	if getMinPerOutcomeFn != nil {
+		minPerOutcome, _ := getMinPerOutcomeFn(resource.GetNamespace(), resourceName, resourceSelectors)
+		if minPerOutcome != nil && *minPerOutcome > 0 {
+			limit := len(resources)
+			if historyLimit != nil {
+				limit = int(*historyLimit)
+			}
+			selectionForDeletion = retainMinPerOutcome(resources, retained, limit, int(*minPerOutcome), hl.isSuccessfulResource)
+			if len(selectionForDeletion) == 0 {
+				return nil
+			}
 		}
-		return 0
-	})
+	}
 
-	// Select resources to delete (keep newest up to historyLimit)
-	var selectionForDeletion []metav1.Object
-	if *historyLimit == 0 {
-		selectionForDeletion = resources
-	} else {
-		selectionForDeletion = resources[*historyLimit:]
+	// the runs completed within the min retention are not deleted even when they are over the history limits, they
+	// are still counted on the limits. The resources are sorted newest first, the older resources over the limits
+	// are deleted, none when all the resources over the limits completed within the min retention
+	minRetention, _ := hl.resourceFn.GetMinRetentionSeconds(resource.GetNamespace(), resourceName, resourceSelectors)
+	if minRetention != nil && *minRetention > 0 {
+		selectionForDeletion = hl.completedBefore(selectionForDeletion, now.Add(-time.Duration(*minRetention)*time.Second))
+		if len(selectionForDeletion) == 0 {
+			logger.Debugw("the resources over the history limit completed within the min retention, none is deleted",
+				"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resourceName, "minRetentionSeconds", *minRetention)
+			return nil
+		}
 	}
 
-	// Delete selected resources
-	metricsRecorder := metrics.GetRecorder()
-	resourceType := metrics.ResourceTypePipelineRun
-	if hl.resourceFn.Type() == KindTaskRun {
-		resourceType = metrics.ResourceTypeTaskRun
+	// in the self-prune mode, the other runs over the limits are deleted on their own reconcile
+	if PrunerConfigStore.IsHistorySelfPruneEnabled() {
+		selectionForDeletion = selectResource(resource, selectionForDeletion)
+		if len(selectionForDeletion) == 0 {
+			return nil
+		}
 	}
 
+	// a limit lowered drastically is approached gradually, the oldest runs are deleted first
+	if step := PrunerConfigStore.GetHistoryLimitTighteningStep(); step != nil && *step > 0 && len(selectionForDeletion) > int(*step) {
+		logger.Infow("deleting the runs over the history limit gradually",
+			"resource", hl.resourceFn.Type(),
+			"namespace", resource.GetNamespace(),
+			"name", resourceName,
+			"overLimit", len(selectionForDeletion),
+			"step", *step)
+		selectionForDeletion = selectionForDeletion[len(selectionForDeletion)-int(*step):]
+	}
+
+	return hl.deleteResources(ctx, selectionForDeletion)
+}
+
+// selectResource returns the resource when it is one of the resources, matched by UID or else by name
+func selectResource(resource metav1.Object, resources []metav1.Object) []metav1.Object {
+	for _, res := range resources {
+		if resource.GetUID() != "" && res.GetUID() == resource.GetUID() ||
+			resource.GetUID() == "" && res.GetNamespace() == resource.GetNamespace() && res.GetName() == resource.GetName() {
+			return []metav1.Object{res}
+		}
+	}
+	return nil
+}
+
+// deleteResources deletes the resources selected by the limits. The resources whose parent is being deleted
+// are skipped, they are deleted along with their parent
+func (hl *HistoryLimiter) deleteResources(ctx context.Context, selectionForDeletion []metav1.Object) error {
+	logger := logging.FromContext(ctx)
+
+	metricsRecorder := metrics.GetRecorder()
+	resourceType := hl.metricsResourceType()
+
+	deleted := 0
 	for _, res := range selectionForDeletion {
 		logger.Debugw("deleting resource",
 			"resource", hl.resourceFn.Type(),
@@ -359,25 +905,310 @@ func (hl *HistoryLimiter) doResourceCleanup(ctx context.Context, resource metav1
 			resourceAge = time.Since(creationTime.Time)
 		}
 
-		if err := hl.resourceFn.Delete(ctx, res.GetNamespace(), res.GetName()); err != nil {
+		// the resource is deleted along with its parent
+		if hl.resourceFn.IsParentDeleting(ctx, res) {
+			logger.Debugw("skipping resource, its parent is being deleted",
+				"resource", hl.resourceFn.Type(), "namespace", res.GetNamespace(), "name", res.GetName())
+			metricsRecorder.RecordResourceSkipped(ctx, resourceType, res.GetNamespace(), metrics.OperationHistory, metrics.SkipReasonParentDeleting)
+			continue
+		}
+
+		if hl.dryRun {
+			logger.Infow("dry run, the resource would be deleted",
+				"resource", hl.resourceFn.Type(), "namespace", res.GetNamespace(), "name", res.GetName())
+			metricsRecorder.RecordResourceWouldDelete(ctx, resourceType, res.GetNamespace(), metrics.OperationHistory)
+			addSpanEvent(ctx, EventDeleted, attribute.String("status", hl.resourceFn.GetCompletionStatus(res)), attribute.Bool("dry_run", true))
+			continue
+		}
+
+		metricsRecorder.RecordResourceQueued(ctx, res.GetUID(), resourceType, res.GetNamespace(), metrics.OperationHistory)
+		if err := hl.startupRamp.Wait(ctx); err != nil {
+			return err
+		}
+
+		if err := hl.deletionLimiter.Acquire(ctx); err != nil {
+			return err
+		}
+		removed, err := hl.deleteResource(ctx, res)
+		hl.deletionLimiter.Release()
+		if err != nil {
 			if errors.IsNotFound(err) {
+				metricsRecorder.ClearResourceQueued(res.GetUID())
 				continue
 			}
 			// Record deletion error
 			errorType := metrics.ClassifyError(err)
 			metricsRecorder.RecordResourceError(ctx, resourceType, res.GetNamespace(), errorType, "history_deletion_failed")
-			logger.Errorw("error deleting resource",
+			// the resource is still modified concurrently, it is left to the next event and the batch continues
+			if errors.IsConflict(err) {
+				logger.Warnw("skipping resource, it is modified concurrently",
+					"resource", hl.resourceFn.Type(),
+					"namespace", res.GetNamespace(),
+					"name", res.GetName(),
+					zap.Error(err),
+				)
+				continue
+			}
+			// the deletions done so far are recorded, the retry lists the remaining resources only
+			logger.Errorw("error deleting resource, the cleanup is incomplete",
 				"resource", hl.resourceFn.Type(),
 				"namespace", res.GetNamespace(),
 				"name", res.GetName(),
+				"deleted", deleted,
+				"selected", len(selectionForDeletion),
 				zap.Error(err),
 			)
-			return err
+			return fmt.Errorf("deleted %d of %d %s resources, failed at %s/%s: %w",
+				deleted, len(selectionForDeletion), hl.resourceFn.Type(), res.GetNamespace(), res.GetName(), err)
+		}
+		// the resource modified concurrently is not eligible anymore, it is left to its next event
+		if !removed {
+			metricsRecorder.ClearResourceQueued(res.GetUID())
+			metricsRecorder.RecordResourceSkipped(ctx, resourceType, res.GetNamespace(), metrics.OperationHistory, metrics.SkipReasonNotEligible)
+			continue
 		}
 
 		// Record successful deletion
-		metricsRecorder.RecordResourceDeleted(ctx, resourceType, res.GetNamespace(), metrics.OperationHistory, resourceAge)
+		deleted++
+		metricsRecorder.RecordResourceDeleted(ctx, resourceType, res.GetNamespace(), metrics.OperationHistory, hl.resourceFn.GetCompletionStatus(res), resourceAge)
+		// the resource deferred to its TTL expiry is not pending anymore
+		metricsRecorder.ClearDeletionDeferred(ctx, res.GetUID(), resourceType, res.GetNamespace())
+		metricsRecorder.ClearResourceQueued(res.GetUID())
+		pruneSummaryFromContext(ctx).RecordDeletion(res.GetNamespace())
+		addSpanEvent(ctx, EventDeleted, attribute.String("status", hl.resourceFn.GetCompletionStatus(res)), attribute.Bool("dry_run", false))
+		observeDeletion(ctx, DeletionRecord{
+			Kind:      hl.resourceFn.Type(),
+			Namespace: res.GetNamespace(),
+			Name:      res.GetName(),
+			UID:       res.GetUID(),
+			Operation: metrics.OperationHistory,
+			Status:    hl.resourceFn.GetCompletionStatus(res),
+			DeletedAt: time.Now(),
+		})
 	}
 
 	return nil
 }
+
+// startOfCalendarDays returns the start of the first of the given number of calendar days ending today, in the location
+func startOfCalendarDays(now time.Time, location *time.Location, days int32) time.Time {
+	year, month, day := now.In(location).Date()
+	return time.Date(year, month, day-int(days-1), 0, 0, 0, 0, location)
+}
+
+// completedBefore returns the resources completed before the given time, the order is kept.
+// The resource without a completion time is not known to be completed before, it is not returned
+func (hl *HistoryLimiter) completedBefore(resources []metav1.Object, start time.Time) []metav1.Object {
+	var before []metav1.Object
+	for _, res := range resources {
+		completionTime, err := hl.resourceFn.GetCompletionTime(res)
+		if err != nil || completionTime.IsZero() || !completionTime.Time.Before(start) {
+			continue
+		}
+		before = append(before, res)
+	}
+	return before
+}
+
+// listMatchingLabels lists the resources of the namespace carrying all the given labels. A key or a value which
+// is not valid on a label selector, for example a long annotation value or a label key taken from an annotation,
+// would fail the list on every reconcile, the resources are listed without a selector and filtered here instead
+func (hl *HistoryLimiter) listMatchingLabels(ctx context.Context, namespace string, matchLabels map[string]string) ([]metav1.Object, error) {
+	selector, err := labels.ValidatedSelectorFromSet(matchLabels)
+	if err == nil {
+		return hl.resourceFn.List(ctx, namespace, selector.String())
+	}
+
+	logging.FromContext(ctx).Debugw("grouping values are not valid on a label selector, filtering the resources without a selector",
+		"resource", hl.resourceFn.Type(), "namespace", namespace, zap.Error(err))
+	resources, err := hl.resourceFn.List(ctx, namespace, "")
+	if err != nil {
+		return nil, err
+	}
+	selector = labels.SelectorFromValidatedSet(matchLabels)
+	var matching []metav1.Object
+	for _, res := range resources {
+		if selector.Matches(labels.Set(res.GetLabels())) {
+			matching = append(matching, res)
+		}
+	}
+	return matching, nil
+}
+
+// retainedCount returns the number of the newest resources to retain, the resources are sorted newest first
+// by the time completedAt returns. The history limit is the maximum of the retained resources. The resources
+// older than the max retention age are not retained, unless they are needed to retain the min retained resources.
+// The history limit takes precedence over the min retained resources
+func retainedCount(resources []metav1.Object, now time.Time, historyLimit, maxRetentionAgeSeconds, minRetained *int32, completedAt func(metav1.Object) time.Time) int {
+	retained := len(resources)
+	if historyLimit != nil && int(*historyLimit) < retained {
+		retained = int(*historyLimit)
+	}
+	if maxRetentionAgeSeconds == nil {
+		return retained
+	}
+
+	floor := 0
+	if minRetained != nil && *minRetained > 0 {
+		floor = min(int(*minRetained), retained)
+	}
+	maxRetentionAge := time.Duration(*maxRetentionAgeSeconds) * time.Second
+	for index := floor; index < retained; index++ {
+		// the age of a resource without a completion time nor a creation timestamp is unknown
+		completionTime := completedAt(resources[index])
+		if !completionTime.IsZero() && now.Sub(completionTime) > maxRetentionAge {
+			return index
+		}
+	}
+	return retained
+}
+
+// retainMinPerOutcome returns the resources selected for deletion when the newest minPerOutcome resources of each
+// outcome are retained on top of the retained count. The resources are sorted newest first. Over the history limit,
+// a resource retained for its outcome takes the place of the oldest retained resource of the other outcome, as long
+// as the other outcome keeps its minimum too, so the limit is exceeded only when both minimums cannot be met within it
+func retainMinPerOutcome(resources []metav1.Object, retained, limit, minPerOutcome int, isSuccessful func(metav1.Object) bool) []metav1.Object {
+	kept := make([]bool, len(resources))
+	keptCount := map[bool]int{}
+	total := map[bool]int{}
+	for index, res := range resources {
+		outcome := isSuccessful(res)
+		total[outcome]++
+		if index < retained {
+			kept[index] = true
+			keptCount[outcome]++
+		}
+	}
+	want := map[bool]int{true: min(minPerOutcome, total[true]), false: min(minPerOutcome, total[false])}
+
+	for _, outcome := range []bool{true, false} {
+		for index := 0; index < len(resources) && keptCount[outcome] < want[outcome]; index++ {
+			if kept[index] || isSuccessful(resources[index]) != outcome {
+				continue
+			}
+			kept[index] = true
+			keptCount[outcome]++
+			if keptCount[true]+keptCount[false] <= limit {
+				continue
+			}
+
+			// the oldest retained resource of the other outcome above its minimum is deleted instead
+			for other := len(resources) - 1; other >= 0; other-- {
+				if kept[other] && isSuccessful(resources[other]) != outcome && keptCount[!outcome] > want[!outcome] {
+					kept[other] = false
+					keptCount[!outcome]--
+					break
+				}
+			}
+		}
+	}
+
+	selection := []metav1.Object{}
+	for index, res := range resources {
+		if !kept[index] {
+			selection = append(selection, res)
+		}
+	}
+	return selection
+}
+
+// getRetainedBy returns the rules which retained the resources the history limits would have deleted, keyed by
+// the resource name. The listed resources are sorted newest first, the resources are the listed ones without
+// the resources completed within the retained calendar days
+func getRetainedBy(listed, resources []metav1.Object, now time.Time, historyLimit, maxRetentionAgeSeconds, minRetained *int32, completedAt func(metav1.Object) time.Time) map[string]string {
+	retainedBy := map[string]string{}
+
+	// the resources of the calendar days above the limits
+	if len(listed) != len(resources) {
+		counted := make(map[string]bool, len(resources))
+		for _, res := range resources {
+			counted[res.GetName()] = true
+		}
+		for _, res := range listed[retainedCount(listed, now, historyLimit, maxRetentionAgeSeconds, minRetained, completedAt):] {
+			if !counted[res.GetName()] {
+				retainedBy[res.GetName()] = RetainedByRetainCalendarDays
+			}
+		}
+	}
+
+	// the resources older than the max retention age, retained to keep the min retained resources
+	withoutMinRetained := retainedCount(resources, now, historyLimit, maxRetentionAgeSeconds, nil, completedAt)
+	for _, res := range resources[withoutMinRetained:retainedCount(resources, now, historyLimit, maxRetentionAgeSeconds, minRetained, completedAt)] {
+		retainedBy[res.GetName()] = RetainedByMinRetained
+	}
+	return retainedBy
+}
+
+// annotateRetainedBy annotates the retained resources with the rule which retained them, the annotation
+// is removed from the resources retained by the history limits. The resources to delete are not annotated
+func (hl *HistoryLimiter) annotateRetainedBy(ctx context.Context, resources, selectedForDeletion []metav1.Object, retainedBy map[string]string) {
+	logger := logging.FromContext(ctx)
+
+	selected := make(map[string]bool, len(selectedForDeletion))
+	for _, res := range selectedForDeletion {
+		selected[res.GetName()] = true
+	}
+
+	for _, res := range resources {
+		if selected[res.GetName()] {
+			continue
+		}
+		rule, current := retainedBy[res.GetName()], res.GetAnnotations()[AnnotationRetainedBy]
+		if rule == current {
+			continue
+		}
+		var value interface{}
+		if rule != "" {
+			value = rule
+		}
+		patchBytes, err := json.Marshal(map[string]interface{}{
+			"metadata": patchMetadata(map[string]interface{}{AnnotationRetainedBy: value}),
+		})
+		if err != nil {
+			logger.Errorw("error marshaling patch data", zap.Error(err))
+			return
+		}
+		if err := hl.resourceFn.Patch(ctx, res.GetNamespace(), res.GetName(), patchBytes); err != nil && !errors.IsNotFound(err) {
+			logger.Errorw("error patching resource with the retained by annotation",
+				"resource", hl.resourceFn.Type(), "namespace", res.GetNamespace(), "name", res.GetName(), "retainedBy", rule, zap.Error(err))
+		}
+	}
+}
+
+// deleteResource deletes the resource, returns false when it is left in place. A conflict caused by the resource
+// modified between the list and the delete is retried once, on the resource read again: it is deleted only if it is
+// still eligible, and only if it is not modified again before the delete
+func (hl *HistoryLimiter) deleteResource(ctx context.Context, resource metav1.Object) (bool, error) {
+	err := hl.deletionBackend.Delete(ctx, resource)
+	if !errors.IsConflict(err) {
+		return err == nil, err
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Debugw("conflict on deleting resource, retrying",
+		"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+	freshResource, err := hl.resourceFn.Get(ctx, resource.GetNamespace(), resource.GetName())
+	if err != nil {
+		return false, err
+	}
+	if !hl.isStillDeletable(freshResource) {
+		logger.Debugw("skipping resource, it is not eligible for deletion anymore",
+			"resource", hl.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+		return false, nil
+	}
+
+	uid, resourceVersion := freshResource.GetUID(), freshResource.GetResourceVersion()
+	ctx = WithDeletePreconditions(ctx, &metav1.Preconditions{UID: &uid, ResourceVersion: &resourceVersion})
+	if err := hl.deletionBackend.Delete(ctx, freshResource); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isStillDeletable returns true when the resource read again is still completed, not being deleted, not excluded
+// from pruning and not a quarantined failure
+func (hl *HistoryLimiter) isStillDeletable(resource metav1.Object) bool {
+	return hl.resourceFn.IsCompleted(resource) && resource.GetDeletionTimestamp() == nil &&
+		!PrunerConfigStore.IsExcluded(resource.GetAnnotations()) &&
+		!(hl.resourceFn.IsFailed(resource) && hl.isQuarantined(resource))
+}
@@ -2,12 +2,21 @@ package config
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap/zaptest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/ptr"
 )
@@ -15,9 +24,10 @@ import (
 // mockResource implements metav1.Object for testing
 type mockResource struct {
 	metav1.ObjectMeta
-	completed  bool
-	successful bool
-	failed     bool
+	completed      bool
+	successful     bool
+	failed         bool
+	completionTime metav1.Time
 }
 
 // mockResourceFuncs implements HistoryLimiterResourceFuncs for testing
@@ -27,6 +37,14 @@ type mockResourceFuncs struct {
 	failedLimit     *int32
 	enforceLevel    EnforcedConfigLevel
 	defaultLabelKey string
+	parentDeleting  map[string]bool // resource names whose parent is being deleted
+	minRetained     *int32
+	maxRetentionAge *int32
+	reasons         map[string]string // completion reasons keyed by resource name
+	retainDays      *int32
+	minRetention    *int32
+	historyLimit    *int32
+	minPerOutcome   *int32
 }
 
 func (m *mockResourceFuncs) Type() string { return "MockResource" }
@@ -72,6 +90,26 @@ func (m *mockResourceFuncs) GetFailedHistoryLimitCount(_, _ string, _ SelectorSp
 	return m.failedLimit, "identified_by_global"
 }
 
+func (m *mockResourceFuncs) GetHistoryLimitCount(_, _ string, _ SelectorSpec) (*int32, string) {
+	return m.historyLimit, "identified_by_global"
+}
+
+func (m *mockResourceFuncs) GetMinRetained(_, _ string, _ SelectorSpec) (*int32, string) {
+	return m.minRetained, "identified_by_global"
+}
+
+func (m *mockResourceFuncs) GetMinRetainedPerOutcome(_, _ string, _ SelectorSpec) (*int32, string) {
+	return m.minPerOutcome, "identified_by_global"
+}
+
+func (m *mockResourceFuncs) GetMinRetentionSeconds(_, _ string, _ SelectorSpec) (*int32, string) {
+	return m.minRetention, "identified_by_global"
+}
+
+func (m *mockResourceFuncs) GetMaxRetentionAgeSeconds(_, _ string, _ SelectorSpec) (*int32, string) {
+	return m.maxRetentionAge, "identified_by_global"
+}
+
 func (m *mockResourceFuncs) IsSuccessful(resource metav1.Object) bool {
 	if mr, ok := resource.(*mockResource); ok {
 		return mr.successful
@@ -93,6 +131,32 @@ func (m *mockResourceFuncs) IsCompleted(resource metav1.Object) bool {
 	return false
 }
 
+func (m *mockResourceFuncs) GetCompletionStatus(resource metav1.Object) string {
+	if m.IsSuccessful(resource) {
+		return metrics.StatusSucceeded
+	}
+	return metrics.StatusFailed
+}
+
+func (m *mockResourceFuncs) GetCompletionTime(resource metav1.Object) (metav1.Time, error) {
+	if mr, ok := resource.(*mockResource); ok {
+		return mr.completionTime, nil
+	}
+	return metav1.Time{}, fmt.Errorf("completion time not set")
+}
+
+func (m *mockResourceFuncs) GetRetainCalendarDays(_, _ string, _ SelectorSpec) (*int32, string) {
+	return m.retainDays, "identified_by_global"
+}
+
+func (m *mockResourceFuncs) GetCompletionReason(resource metav1.Object) string {
+	return m.reasons[resource.GetName()]
+}
+
+func (m *mockResourceFuncs) IsParentDeleting(_ context.Context, resource metav1.Object) bool {
+	return m.parentDeleting[resource.GetName()]
+}
+
 func (m *mockResourceFuncs) GetDefaultLabelKey() string { return m.defaultLabelKey }
 
 func (m *mockResourceFuncs) GetEnforcedConfigLevel(_, _ string, _ SelectorSpec) EnforcedConfigLevel {
@@ -334,3 +398,2225 @@ func TestDoResourceCleanup(t *testing.T) {
 		})
 	}
 }
+
+func TestRetainedCount(t *testing.T) {
+	now := time.Now()
+	// the resources are sorted newest first, one created per day
+	var resources []metav1.Object
+	for day := 0; day < 10; day++ {
+		resources = append(resources, &mockResource{ObjectMeta: metav1.ObjectMeta{
+			Name:              fmt.Sprintf("run-%d", day),
+			CreationTimestamp: metav1.Time{Time: now.Add(-time.Duration(day)*24*time.Hour - time.Hour)},
+		}})
+	}
+	const day = 24 * 60 * 60
+	creationTime := func(resource metav1.Object) time.Time {
+		return resource.GetCreationTimestamp().Time
+	}
+
+	tests := []struct {
+		name            string
+		historyLimit    *int32
+		maxRetentionAge *int32
+		minRetained     *int32
+		want            int
+	}{
+		{name: "history limit only", historyLimit: ptr.Int32(4), want: 4},
+		{name: "history limit above the resources", historyLimit: ptr.Int32(20), want: 10},
+		{name: "history limit of zero", historyLimit: ptr.Int32(0), want: 0},
+		{name: "no limit", want: 10},
+		{name: "max age below the history limit", historyLimit: ptr.Int32(8), maxRetentionAge: ptr.Int32(3 * day), want: 3},
+		{name: "history limit below the max age", historyLimit: ptr.Int32(2), maxRetentionAge: ptr.Int32(3 * day), want: 2},
+		{name: "max age without history limit", maxRetentionAge: ptr.Int32(5 * day), want: 5},
+		{name: "min retained keeps the resources older than the max age", historyLimit: ptr.Int32(8), maxRetentionAge: ptr.Int32(3 * day), minRetained: ptr.Int32(5), want: 5},
+		{name: "min retained when the max age deletes everything", historyLimit: ptr.Int32(20), maxRetentionAge: ptr.Int32(60), minRetained: ptr.Int32(5), want: 5},
+		{name: "min retained below the resources younger than the max age", historyLimit: ptr.Int32(8), maxRetentionAge: ptr.Int32(3 * day), minRetained: ptr.Int32(1), want: 3},
+		{name: "history limit takes precedence over min retained", historyLimit: ptr.Int32(2), maxRetentionAge: ptr.Int32(60), minRetained: ptr.Int32(5), want: 2},
+		{name: "min retained above the resources", maxRetentionAge: ptr.Int32(60), minRetained: ptr.Int32(20), want: 10},
+		{name: "min retained without max age", historyLimit: ptr.Int32(4), minRetained: ptr.Int32(6), want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retainedCount(resources, now, tt.historyLimit, tt.maxRetentionAge, tt.minRetained, creationTime))
+		})
+	}
+}
+
+func TestDoResourceCleanupRetention(t *testing.T) {
+	newResources := func() []metav1.Object {
+		var resources []metav1.Object
+		for day := 0; day < 8; day++ {
+			resources = append(resources, &mockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              fmt.Sprintf("run-%d", day),
+					Namespace:         "default",
+					CreationTimestamp: metav1.Time{Time: time.Now().Add(-time.Duration(day)*24*time.Hour - time.Hour)},
+				},
+				completed:  true,
+				successful: true,
+			})
+		}
+		return resources
+	}
+
+	tests := []struct {
+		name            string
+		successLimit    *int32
+		maxRetentionAge *int32
+		minRetained     *int32
+		wantRemaining   int
+	}{
+		{name: "max age deletes below the history limit", successLimit: ptr.Int32(20), maxRetentionAge: ptr.Int32(2 * 24 * 60 * 60), wantRemaining: 2},
+		{name: "min retained floor when the max age deletes everything", successLimit: ptr.Int32(20), maxRetentionAge: ptr.Int32(60), minRetained: ptr.Int32(5), wantRemaining: 5},
+		{name: "max age without history limit", maxRetentionAge: ptr.Int32(60), minRetained: ptr.Int32(3), wantRemaining: 3},
+		{name: "disabled max age", successLimit: ptr.Int32(6), maxRetentionAge: ptr.Int32(-1), minRetained: ptr.Int32(3), wantRemaining: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := newResources()
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    tt.successLimit,
+				minRetained:     tt.minRetained,
+				maxRetentionAge: tt.maxRetentionAge,
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}
+			hl, err := NewHistoryLimiter(mockFuncs)
+			assert.NoError(t, err)
+
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[0]))
+			assert.Len(t, mockFuncs.resources["default"], tt.wantRemaining)
+			// the newest resources are retained
+			for index, res := range mockFuncs.resources["default"] {
+				assert.Equal(t, fmt.Sprintf("run-%d", index), res.GetName())
+			}
+		})
+	}
+}
+
+// blockingDeleteFuncs blocks the first deletion until it is released,
+// records the context errors seen by the deletions
+func TestHistoryStartupCutoff(t *testing.T) {
+	loadTestConfig(t, "startupCutoffTime: "+time.Now().Add(-3*time.Hour).UTC().Format(time.RFC3339))
+
+	newResource := func(name string, age time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed:      true,
+			successful:     true,
+			completionTime: metav1.Time{Time: time.Now().Add(-age).Add(time.Minute)},
+		}
+	}
+
+	resources := []metav1.Object{
+		newResource("preexisting-old", 5*time.Hour),
+		newResource("preexisting", 4*time.Hour),
+		newResource("old", 2*time.Hour),
+		newResource("older", time.Hour),
+		newResource("newest", 30*time.Minute),
+	}
+
+	mockFuncs := &mockResourceFuncs{
+		resources:       map[string][]metav1.Object{"default": resources},
+		successLimit:    ptr.Int32(1),
+		enforceLevel:    EnforcedConfigLevelGlobal,
+		defaultLabelKey: "test.label/name",
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[4]))
+
+	// the runs completed before the cutoff are neither counted nor deleted
+	var remaining []string
+	for _, res := range mockFuncs.resources["default"] {
+		remaining = append(remaining, res.GetName())
+	}
+	assert.ElementsMatch(t, []string{"preexisting-old", "preexisting", "newest"}, remaining)
+}
+
+// taskRunMockFuncs reports the mocked resources as TaskRuns
+type taskRunMockFuncs struct {
+	*mockResourceFuncs
+}
+
+func (m *taskRunMockFuncs) Type() string { return KindTaskRun }
+
+func TestExcludeChildTaskRunsFromLimits(t *testing.T) {
+	newResource := func(name string, age time.Duration, labels map[string]string, owners ...metav1.OwnerReference) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+				Labels:            labels,
+				OwnerReferences:   owners,
+			},
+			completed:  true,
+			successful: true,
+		}
+	}
+	newResources := func() []metav1.Object {
+		return []metav1.Object{
+			newResource("child-labeled", 5*time.Hour, map[string]string{LabelPipelineRunName: "pr"}),
+			newResource("child-owned", 4*time.Hour, nil, metav1.OwnerReference{Kind: KindPipelineRun, Name: "pr"}),
+			newResource("standalone-old", 3*time.Hour, nil),
+			newResource("standalone-older", 2*time.Hour, nil),
+			newResource("standalone-newest", time.Hour, nil),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{
+			name:     "child TaskRuns counted by default",
+			config:   `successfulHistoryLimit: 1`,
+			expected: []string{"standalone-newest"},
+		},
+		{
+			name: "child TaskRuns excluded",
+			config: `successfulHistoryLimit: 1
+excludeChildTaskRunsFromLimits: true`,
+			expected: []string{"child-labeled", "child-owned", "standalone-newest"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loadTestConfig(t, tc.config)
+
+			resources := newResources()
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    ptr.Int32(1),
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}
+			hl, err := NewHistoryLimiter(&taskRunMockFuncs{mockResourceFuncs: mockFuncs})
+			assert.NoError(t, err)
+
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[4]))
+
+			var remaining []string
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+			}
+			assert.ElementsMatch(t, tc.expected, remaining)
+		})
+	}
+}
+
+type blockingDeleteFuncs struct {
+	*mockResourceFuncs
+	started   chan struct{}
+	release   chan struct{}
+	deleteErr []error
+}
+
+func (b *blockingDeleteFuncs) Delete(ctx context.Context, namespace, name string) error {
+	if b.started != nil {
+		close(b.started)
+		b.started = nil
+		<-b.release
+	}
+	b.deleteErr = append(b.deleteErr, ctx.Err())
+	return b.mockResourceFuncs.Delete(ctx, namespace, name)
+}
+
+// conflictingDeleteFuncs fails the deletions of a resource with a conflict for the given number of times,
+// the resource is modified by the concurrent writer before the conflict is returned
+type conflictingDeleteFuncs struct {
+	*mockResourceFuncs
+	conflicts     map[string]int
+	modify        func(resource *mockResource)
+	deletes       map[string]int
+	preconditions map[string]*metav1.Preconditions
+}
+
+func (c *conflictingDeleteFuncs) Delete(ctx context.Context, namespace, name string) error {
+	c.deletes[name]++
+	c.preconditions[name] = DeletePreconditionsFromContext(ctx)
+	if c.conflicts[name] > 0 {
+		c.conflicts[name]--
+		if c.modify != nil {
+			resource, _ := c.mockResourceFuncs.Get(ctx, namespace, name)
+			c.modify(resource.(*mockResource))
+		}
+		return apierrors.NewConflict(schema.GroupResource{Resource: "mockresources"}, name, fmt.Errorf("the object has been modified"))
+	}
+	return c.mockResourceFuncs.Delete(ctx, namespace, name)
+}
+
+func TestDoResourceCleanupConflict(t *testing.T) {
+	newResource := func(name string, age time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				UID:               types.UID(name),
+				ResourceVersion:   "1",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed:  true,
+			successful: true,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		conflicts     map[string]int
+		modify        func(resource *mockResource)
+		wantRemaining []string
+		wantDeletes   map[string]int
+		// the resource version of the precondition of the retried delete, empty when it is not retried
+		wantResourceVersion string
+	}{
+		{
+			name:      "conflict is retried once on the resource read again",
+			conflicts: map[string]int{"oldest": 1},
+			modify: func(resource *mockResource) {
+				resource.ResourceVersion = "2"
+			},
+			wantRemaining:       []string{"newest"},
+			wantDeletes:         map[string]int{"oldest": 2, "old": 1},
+			wantResourceVersion: "2",
+		},
+		{
+			name:                "persisting conflict skips the resource and the batch continues",
+			conflicts:           map[string]int{"oldest": 5},
+			wantRemaining:       []string{"oldest", "newest"},
+			wantDeletes:         map[string]int{"oldest": 2, "old": 1},
+			wantResourceVersion: "1",
+		},
+		{
+			name:      "resource not eligible anymore is not deleted",
+			conflicts: map[string]int{"oldest": 1},
+			modify: func(resource *mockResource) {
+				resource.completed = false
+			},
+			wantRemaining: []string{"oldest", "newest"},
+			wantDeletes:   map[string]int{"oldest": 1, "old": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := []metav1.Object{
+				newResource("oldest", 3*time.Hour),
+				newResource("old", 2*time.Hour),
+				newResource("newest", time.Hour),
+			}
+			mockFuncs := &conflictingDeleteFuncs{
+				mockResourceFuncs: &mockResourceFuncs{
+					resources:       map[string][]metav1.Object{"default": resources},
+					successLimit:    ptr.Int32(1),
+					enforceLevel:    EnforcedConfigLevelGlobal,
+					defaultLabelKey: "test.label/name",
+				},
+				conflicts:     tt.conflicts,
+				modify:        tt.modify,
+				deletes:       map[string]int{},
+				preconditions: map[string]*metav1.Preconditions{},
+			}
+			hl, err := NewHistoryLimiter(mockFuncs)
+			assert.NoError(t, err)
+
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[2]))
+
+			var remaining []string
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+			}
+			assert.ElementsMatch(t, tt.wantRemaining, remaining)
+			assert.Equal(t, tt.wantDeletes, mockFuncs.deletes)
+			assert.Nil(t, mockFuncs.preconditions["old"], "the first delete should be unconditional")
+			if tt.wantResourceVersion != "" {
+				// the retry is made on the resource read again, only if it is not modified again
+				preconditions := mockFuncs.preconditions["oldest"]
+				if assert.NotNil(t, preconditions) {
+					assert.Equal(t, types.UID("oldest"), *preconditions.UID)
+					assert.Equal(t, tt.wantResourceVersion, *preconditions.ResourceVersion)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessEventShutdown(t *testing.T) {
+	newResources := func() []metav1.Object {
+		resources := []metav1.Object{}
+		for index, name := range []string{"test-1", "test-2", "test-3", "test-4"} {
+			resources = append(resources, &mockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              name,
+					Namespace:         "default",
+					CreationTimestamp: metav1.Time{Time: time.Now().Add(-time.Duration(4-index) * time.Hour)},
+				},
+				completed:  true,
+				successful: true,
+			})
+		}
+		return resources
+	}
+
+	newFuncs := func(resources []metav1.Object) *blockingDeleteFuncs {
+		return &blockingDeleteFuncs{
+			mockResourceFuncs: &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    ptr.Int32(1),
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			},
+		}
+	}
+
+	t.Run("in-flight batch completes", func(t *testing.T) {
+		resources := newResources()
+		funcs := newFuncs(resources)
+		funcs.started = make(chan struct{})
+		funcs.release = make(chan struct{})
+		started := funcs.started
+
+		hl, err := NewHistoryLimiter(funcs)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar()))
+		defer cancel()
+
+		done := make(chan error)
+		go func() {
+			done <- hl.ProcessEvent(ctx, resources[3])
+		}()
+
+		// shutdown while the first deletion is in progress
+		<-started
+		cancel()
+		close(funcs.release)
+
+		assert.NoError(t, <-done)
+		assert.Len(t, funcs.resources["default"], 1)
+		assert.Len(t, funcs.deleteErr, 3)
+		for _, err := range funcs.deleteErr {
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("no new work after shutdown", func(t *testing.T) {
+		resources := newResources()
+		funcs := newFuncs(resources)
+
+		hl, err := NewHistoryLimiter(funcs)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar()))
+		cancel()
+
+		assert.NoError(t, hl.ProcessEvent(ctx, resources[3]))
+		assert.Len(t, funcs.resources["default"], 4)
+		assert.Empty(t, funcs.deleteErr)
+	})
+}
+
+func TestWithShutdownGracePeriod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	drainCtx, drainCancel := withShutdownGracePeriod(ctx, 50*time.Millisecond)
+	defer drainCancel()
+
+	cancel()
+	assert.NoError(t, drainCtx.Err(), "context should not be cancelled within the grace period")
+
+	select {
+	case <-drainCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context was not cancelled after the grace period")
+	}
+}
+
+func TestExcludeAnnotations(t *testing.T) {
+	loadTestConfig(t, `excludeAnnotations:
+  backup: required
+  keep: ""`)
+
+	newResource := func(name string, age time.Duration, annotations map[string]string) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+				Annotations:       annotations,
+			},
+			completed:  true,
+			successful: true,
+		}
+	}
+
+	resources := []metav1.Object{
+		newResource("backup", 5*time.Hour, map[string]string{"backup": "required"}),
+		newResource("keep", 4*time.Hour, map[string]string{"keep": "any-value"}),
+		newResource("old", 3*time.Hour, map[string]string{"backup": "optional"}),
+		newResource("older", 2*time.Hour, nil),
+		newResource("newest", time.Hour, nil),
+	}
+
+	mockFuncs := &mockResourceFuncs{
+		resources:       map[string][]metav1.Object{"default": resources},
+		successLimit:    ptr.Int32(1),
+		enforceLevel:    EnforcedConfigLevelGlobal,
+		defaultLabelKey: "test.label/name",
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+
+	// an excluded resource does not trigger a cleanup
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[0]))
+	assert.Len(t, mockFuncs.resources["default"], 5)
+
+	// the excluded resources survive and are not counted on the limit
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[4]))
+	var remaining []string
+	for _, res := range mockFuncs.resources["default"] {
+		remaining = append(remaining, res.GetName())
+	}
+	assert.ElementsMatch(t, []string{"backup", "keep", "newest"}, remaining)
+}
+
+func TestHistoryLimiterSkipsParentDeleting(t *testing.T) {
+	newResource := func(name string, age time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed:  true,
+			successful: true,
+		}
+	}
+
+	resources := []metav1.Object{
+		newResource("child", 3*time.Hour),
+		newResource("old", 2*time.Hour),
+		newResource("newest", time.Hour),
+	}
+
+	mockFuncs := &mockResourceFuncs{
+		resources:       map[string][]metav1.Object{"default": resources},
+		successLimit:    ptr.Int32(1),
+		enforceLevel:    EnforcedConfigLevelGlobal,
+		defaultLabelKey: "test.label/name",
+		parentDeleting:  map[string]bool{"child": true},
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[2]))
+
+	// the child is left to the deletion of its parent
+	var remaining []string
+	for _, res := range mockFuncs.resources["default"] {
+		remaining = append(remaining, res.GetName())
+	}
+	assert.ElementsMatch(t, []string{"child", "newest"}, remaining)
+}
+
+func TestReprocessGeneration(t *testing.T) {
+	loadTestConfig(t, "historyLimit: 5")
+
+	processed := map[string]string{AnnotationHistoryLimitCheckProcessed: time.Now().Format(time.RFC3339)}
+	newResource := func(name string, age time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+				Annotations:       processed,
+			},
+			completed:  true,
+			successful: true,
+		}
+	}
+
+	resources := []metav1.Object{
+		newResource("old", 3*time.Hour),
+		newResource("older", 2*time.Hour),
+		newResource("newest", time.Hour),
+	}
+
+	// the limit is lowered after the resources are processed
+	mockFuncs := &mockResourceFuncs{
+		resources:       map[string][]metav1.Object{"default": resources},
+		successLimit:    ptr.Int32(1),
+		enforceLevel:    EnforcedConfigLevelGlobal,
+		defaultLabelKey: "test.label/name",
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+
+	// the processed resources are not checked again
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[2]))
+	assert.Len(t, mockFuncs.resources["default"], 3)
+
+	// bumping the generation on the config map makes them to be checked again
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        PrunerConfigMapName,
+			Namespace:   "tekton-pipelines",
+			Annotations: map[string]string{AnnotationReprocessGeneration: "1"},
+		},
+		Data: map[string]string{PrunerGlobalConfigKey: "historyLimit: 1"},
+	}
+	assert.NoError(t, PrunerConfigStore.LoadGlobalConfig(ctx, configMap))
+	assert.False(t, hl.isProcessed(resources[2]))
+
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[2]))
+	var remaining []string
+	for _, res := range mockFuncs.resources["default"] {
+		remaining = append(remaining, res.GetName())
+	}
+	assert.ElementsMatch(t, []string{"newest"}, remaining)
+
+	// the resources processed on the current generation are not checked again
+	resources[2].SetAnnotations(map[string]string{
+		AnnotationHistoryLimitCheckProcessed: time.Now().Format(time.RFC3339),
+		AnnotationReprocessGeneration:        "1",
+	})
+	assert.True(t, hl.isProcessed(resources[2]))
+}
+
+// recordingDeletionBackend records the deleted resources instead of deleting them
+type recordingDeletionBackend struct {
+	deleted []string
+}
+
+func (r *recordingDeletionBackend) Delete(_ context.Context, resource metav1.Object) error {
+	r.deleted = append(r.deleted, resource.GetNamespace()+"/"+resource.GetName())
+	return nil
+}
+
+func TestHistoryLimiterDeletionBackend(t *testing.T) {
+	newResource := func(name string, age time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed:  true,
+			successful: true,
+		}
+	}
+	resources := []metav1.Object{
+		newResource("oldest", 3*time.Hour),
+		newResource("old", 2*time.Hour),
+		newResource("newest", time.Hour),
+	}
+	mockFuncs := &mockResourceFuncs{
+		resources:       map[string][]metav1.Object{"default": resources},
+		successLimit:    ptr.Int32(1),
+		enforceLevel:    EnforcedConfigLevelGlobal,
+		defaultLabelKey: "test.label/name",
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+	backend := &recordingDeletionBackend{}
+	hl.SetDeletionBackend(backend)
+
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[2]))
+
+	assert.ElementsMatch(t, []string{"default/oldest", "default/old"}, backend.deleted)
+	// the resources are deleted through the backend only
+	assert.Len(t, mockFuncs.resources["default"], 3)
+}
+
+// verifyingResourceFuncs records the resources verified before their deletion
+type verifyingResourceFuncs struct {
+	*mockResourceFuncs
+	verified []string
+}
+
+func (v *verifyingResourceFuncs) VerifyDeletion(_ context.Context, resource metav1.Object) {
+	v.verified = append(v.verified, resource.GetNamespace()+"/"+resource.GetName())
+}
+
+func TestHistoryLimiterDeletionVerifier(t *testing.T) {
+	newResource := func(name string, age time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed:  true,
+			successful: true,
+		}
+	}
+
+	for _, customBackend := range []bool{false, true} {
+		t.Run(fmt.Sprintf("custom backend %v", customBackend), func(t *testing.T) {
+			resources := []metav1.Object{
+				newResource("oldest", 3*time.Hour),
+				newResource("old", 2*time.Hour),
+				newResource("newest", time.Hour),
+			}
+			mockFuncs := &verifyingResourceFuncs{mockResourceFuncs: &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    ptr.Int32(1),
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}}
+			hl, err := NewHistoryLimiter(mockFuncs)
+			assert.NoError(t, err)
+			if customBackend {
+				hl.SetDeletionBackend(&recordingDeletionBackend{})
+			}
+
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[2]))
+
+			// every deleted resource is verified, whichever backend deletes it
+			assert.ElementsMatch(t, []string{"default/oldest", "default/old"}, mockFuncs.verified)
+		})
+	}
+}
+
+// failingDeleteFuncs fails the deletion of the given resource, the resources deleted before stay
+// listed as terminating, as they do while their finalizers run
+type failingDeleteFuncs struct {
+	*mockResourceFuncs
+	failOn string
+}
+
+func (f *failingDeleteFuncs) Delete(_ context.Context, namespace, name string) error {
+	if name == f.failOn {
+		return fmt.Errorf("connection refused")
+	}
+	for _, res := range f.resources[namespace] {
+		if res.GetName() == name {
+			res.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+		}
+	}
+	return nil
+}
+
+func TestDoResourceCleanupPartialFailure(t *testing.T) {
+	newResource := func(name string, age time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed:  true,
+			successful: true,
+		}
+	}
+	resources := []metav1.Object{
+		newResource("run-4", 4*time.Hour),
+		newResource("run-3", 3*time.Hour),
+		newResource("run-2", 2*time.Hour),
+		newResource("run-1", time.Hour),
+	}
+	mockFuncs := &failingDeleteFuncs{
+		mockResourceFuncs: &mockResourceFuncs{
+			resources:       map[string][]metav1.Object{"default": resources},
+			successLimit:    ptr.Int32(1),
+			enforceLevel:    EnforcedConfigLevelGlobal,
+			defaultLabelKey: "test.label/name",
+		},
+		failOn: "run-3",
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+
+	summary := NewPruneSummary()
+	ctx := WithPruneSummary(logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar()), summary)
+
+	// the batch stops at the failure, the deletion done before it is recorded
+	err = hl.ProcessEvent(ctx, resources[3])
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "deleted 1 of 3 MockResource resources, failed at default/run-3")
+	}
+	assert.Equal(t, int64(1), summary.TotalDeletions())
+
+	// the retry deletes the rest, the terminating resource is not deleted and counted again
+	mockFuncs.failOn = ""
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[3]))
+	assert.Equal(t, int64(3), summary.TotalDeletions())
+	for _, res := range resources[:3] {
+		assert.NotNil(t, res.GetDeletionTimestamp(), "resource %s is not deleted", res.GetName())
+	}
+	assert.Nil(t, resources[3].GetDeletionTimestamp())
+}
+
+func TestFailureBuckets(t *testing.T) {
+	loadTestConfig(t, `failureReasonMapping:
+  PipelineRunCancelled: cancelled
+  TaskRunCancelled: cancelled
+  PipelineRunTimeout: timeout
+  PipelineRunCouldntGetPipeline: invalid
+failedHistoryLimitsByBucket:
+  cancelled: 1
+  timeout: 2`)
+
+	newResource := func(name string, age time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed: true,
+			failed:    true,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		trigger       string
+		wantRemaining []string
+	}{
+		{
+			name:          "cancelled bucket",
+			trigger:       "cancelled-1",
+			wantRemaining: []string{"cancelled-1", "timeout-1", "timeout-2", "timeout-3", "failed-1", "failed-2", "invalid-1"},
+		},
+		{
+			name:          "timeout bucket",
+			trigger:       "timeout-1",
+			wantRemaining: []string{"cancelled-1", "cancelled-2", "cancelled-3", "timeout-1", "timeout-2", "failed-1", "failed-2", "invalid-1"},
+		},
+		{
+			// the bucket without a limit is retained along with the unmapped reasons
+			name:          "unmapped reasons",
+			trigger:       "failed-1",
+			wantRemaining: []string{"cancelled-1", "cancelled-2", "cancelled-3", "timeout-1", "timeout-2", "timeout-3", "failed-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := []metav1.Object{
+				newResource("cancelled-1", time.Hour),
+				newResource("cancelled-2", 2*time.Hour),
+				newResource("cancelled-3", 3*time.Hour),
+				newResource("timeout-1", time.Hour),
+				newResource("timeout-2", 2*time.Hour),
+				newResource("timeout-3", 3*time.Hour),
+				newResource("failed-1", time.Hour),
+				newResource("failed-2", 2*time.Hour),
+				newResource("invalid-1", 3*time.Hour),
+			}
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				failedLimit:     ptr.Int32(1),
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+				reasons: map[string]string{
+					"cancelled-1": "PipelineRunCancelled",
+					"cancelled-2": "TaskRunCancelled",
+					"cancelled-3": "PipelineRunCancelled",
+					"timeout-1":   "PipelineRunTimeout",
+					"timeout-2":   "PipelineRunTimeout",
+					"timeout-3":   "PipelineRunTimeout",
+					"failed-1":    "Failed",
+					"failed-2":    "Failed",
+					"invalid-1":   "PipelineRunCouldntGetPipeline",
+				},
+			}
+			hl, err := NewHistoryLimiter(mockFuncs)
+			assert.NoError(t, err)
+
+			var trigger metav1.Object
+			for _, res := range resources {
+				if res.GetName() == tt.trigger {
+					trigger = res
+				}
+			}
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.ProcessEvent(ctx, trigger))
+
+			var remaining []string
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+			}
+			assert.ElementsMatch(t, tt.wantRemaining, remaining)
+		})
+	}
+}
+
+// selectorListFuncs applies the label selector on the list, an invalid selector fails the list as the API server does
+type selectorListFuncs struct {
+	*mockResourceFuncs
+	selectors []string
+}
+
+func (s *selectorListFuncs) List(ctx context.Context, namespace, selector string) ([]metav1.Object, error) {
+	s.selectors = append(s.selectors, selector)
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	resources, _ := s.mockResourceFuncs.List(ctx, namespace, selector)
+	var matching []metav1.Object
+	for _, res := range resources {
+		if parsed.Matches(labels.Set(res.GetLabels())) {
+			matching = append(matching, res)
+		}
+	}
+	return matching, nil
+}
+
+func TestListMatchingLabelsInvalidGroupingValue(t *testing.T) {
+	newResource := func(name string, age time.Duration, source string) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+				Annotations:       map[string]string{"example.com/source": source},
+				Labels:            map[string]string{"example.com/source": "repo"},
+			},
+			completed:  true,
+			successful: true,
+		}
+	}
+	resources := []metav1.Object{
+		newResource("old", 2*time.Hour, "https://git.example.com/org/repo"),
+		newResource("new", time.Hour, "https://git.example.com/org/repo"),
+	}
+	mockFuncs := &selectorListFuncs{
+		mockResourceFuncs: &mockResourceFuncs{
+			resources:       map[string][]metav1.Object{"default": resources},
+			successLimit:    ptr.Int32(1),
+			enforceLevel:    EnforcedConfigLevelResource,
+			defaultLabelKey: "test.label/name",
+		},
+	}
+
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+
+	// the annotation value is not a valid label value, the resources are listed without a selector
+	resources, err = hl.listMatchingLabels(ctx, "default", map[string]string{"example.com/source": "https://git.example.com/org/repo"})
+	assert.NoError(t, err)
+	assert.Empty(t, resources)
+	assert.Equal(t, []string{""}, mockFuncs.selectors)
+
+	// the valid values are still listed with a selector
+	mockFuncs.selectors = nil
+	resources, err = hl.listMatchingLabels(ctx, "default", map[string]string{"example.com/source": "repo"})
+	assert.NoError(t, err)
+	assert.Len(t, resources, 2)
+	assert.Equal(t, []string{"example.com/source=repo"}, mockFuncs.selectors)
+
+	// a label key taken from an annotation is not valid either
+	mockFuncs.selectors = nil
+	_, err = hl.listMatchingLabels(ctx, "default", map[string]string{"not a key": "build"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, mockFuncs.selectors)
+}
+
+func TestStartOfCalendarDays(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("failed to load the timezone: %v", err)
+	}
+
+	// half past midnight in Berlin, the day before in UTC
+	now := time.Date(2025, time.March, 10, 0, 30, 0, 0, berlin)
+	completedToday := time.Date(2025, time.March, 10, 0, 10, 0, 0, berlin)
+	completedYesterday := time.Date(2025, time.March, 9, 23, 50, 0, 0, berlin)
+
+	tests := []struct {
+		name              string
+		location          *time.Location
+		days              int32
+		want              time.Time
+		wantYesterdayKept bool
+	}{
+		{name: "today in Berlin", location: berlin, days: 1, want: time.Date(2025, time.March, 10, 0, 0, 0, 0, berlin), wantYesterdayKept: false},
+		{name: "two days in Berlin", location: berlin, days: 2, want: time.Date(2025, time.March, 9, 0, 0, 0, 0, berlin), wantYesterdayKept: true},
+		{name: "today in UTC", location: time.UTC, days: 1, want: time.Date(2025, time.March, 9, 0, 0, 0, 0, time.UTC), wantYesterdayKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := startOfCalendarDays(now, tt.location, tt.days)
+			assert.True(t, start.Equal(tt.want), "start = %v, want %v", start, tt.want)
+			assert.False(t, completedToday.Before(start), "the run completed today is not retained")
+			assert.Equal(t, tt.wantYesterdayKept, !completedYesterday.Before(start))
+		})
+	}
+}
+
+func TestDoResourceCleanupRetainCalendarDays(t *testing.T) {
+	now := time.Now()
+	newResource := func(name string, completedAt time.Time) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: completedAt.Add(-time.Minute)},
+			},
+			completed:      true,
+			successful:     true,
+			completionTime: metav1.Time{Time: completedAt},
+		}
+	}
+	resources := []metav1.Object{
+		newResource("today-1", now),
+		newResource("today-2", now),
+		newResource("today-3", now),
+		newResource("old-1", now.AddDate(0, 0, -3)),
+		newResource("old-2", now.AddDate(0, 0, -4)),
+		// the run without a completion time is not known to be completed before the retained days
+		&mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "no-completion-time",
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: now.AddDate(0, 0, -5)},
+			},
+			completed:  true,
+			successful: true,
+		},
+	}
+	mockFuncs := &mockResourceFuncs{
+		resources:       map[string][]metav1.Object{"default": resources},
+		successLimit:    ptr.Int32(1),
+		enforceLevel:    EnforcedConfigLevelGlobal,
+		defaultLabelKey: "test.label/name",
+		retainDays:      ptr.Int32(1),
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[0]))
+
+	// all the runs completed today are retained, the limit applies to the runs completed before
+	var remaining []string
+	for _, res := range mockFuncs.resources["default"] {
+		remaining = append(remaining, res.GetName())
+	}
+	assert.ElementsMatch(t, []string{"today-1", "today-2", "today-3", "old-1", "no-completion-time"}, remaining)
+}
+
+func TestQuarantineHistoryLimit(t *testing.T) {
+	newResource := func(name string, age time.Duration, quarantined bool) *mockResource {
+		resource := &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed: true,
+			failed:    true,
+		}
+		if quarantined {
+			resource.Annotations = map[string]string{"security.example.com/quarantine": "true"}
+		}
+		return resource
+	}
+
+	tests := []struct {
+		name          string
+		config        string
+		trigger       string
+		wantRemaining []string
+	}{
+		{
+			name: "quarantined runs",
+			config: `quarantine:
+  matchAnnotations:
+    security.example.com/quarantine: ""
+  historyLimit: 2`,
+			trigger:       "quarantined-1",
+			wantRemaining: []string{"quarantined-1", "quarantined-2", "failed-1", "failed-2", "failed-3"},
+		},
+		{
+			// the quarantined runs are not counted on failedHistoryLimit
+			name: "ordinary failed runs",
+			config: `quarantine:
+  matchAnnotations:
+    security.example.com/quarantine: ""
+  historyLimit: 2`,
+			trigger:       "failed-1",
+			wantRemaining: []string{"quarantined-1", "quarantined-2", "quarantined-3", "failed-1"},
+		},
+		{
+			name: "quarantine without a history limit",
+			config: `quarantine:
+  matchAnnotations:
+    security.example.com/quarantine: ""`,
+			trigger:       "quarantined-1",
+			wantRemaining: []string{"quarantined-1", "quarantined-2", "quarantined-3", "failed-1", "failed-2", "failed-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.config)
+			resources := []metav1.Object{
+				newResource("quarantined-1", time.Hour, true),
+				newResource("quarantined-2", 2*time.Hour, true),
+				newResource("quarantined-3", 3*time.Hour, true),
+				newResource("failed-1", time.Hour, false),
+				newResource("failed-2", 2*time.Hour, false),
+				newResource("failed-3", 3*time.Hour, false),
+			}
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				failedLimit:     ptr.Int32(1),
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}
+			hl, err := NewHistoryLimiter(mockFuncs)
+			assert.NoError(t, err)
+
+			var trigger metav1.Object
+			for _, res := range resources {
+				if res.GetName() == tt.trigger {
+					trigger = res
+				}
+			}
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.ProcessEvent(ctx, trigger))
+
+			var remaining []string
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+			}
+			assert.ElementsMatch(t, tt.wantRemaining, remaining)
+		})
+	}
+}
+
+// annotationPatchFuncs applies the annotations of the merge patches on the listed resources
+type annotationPatchFuncs struct {
+	*mockResourceFuncs
+}
+
+func (a *annotationPatchFuncs) Patch(_ context.Context, namespace, name string, patchBytes []byte) error {
+	var patch struct {
+		Metadata struct {
+			Annotations map[string]*string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(patchBytes, &patch); err != nil {
+		return err
+	}
+	for _, res := range a.resources[namespace] {
+		if res.GetName() != name {
+			continue
+		}
+		annotations := res.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		for key, value := range patch.Metadata.Annotations {
+			if value == nil {
+				delete(annotations, key)
+			} else {
+				annotations[key] = *value
+			}
+		}
+		res.SetAnnotations(annotations)
+	}
+	return nil
+}
+
+func TestRetainedByAnnotation(t *testing.T) {
+	now := time.Now()
+	newResource := func(name string, age time.Duration, completedAt time.Time) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: now.Add(-age)},
+			},
+			completed:      true,
+			successful:     true,
+			completionTime: metav1.Time{Time: completedAt},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		enabled        bool
+		successLimit   *int32
+		retainDays     *int32
+		wantRemaining  []string
+		wantRetainedBy map[string]string
+	}{
+		{
+			name:          "min retained",
+			enabled:       true,
+			successLimit:  ptr.Int32(5),
+			wantRemaining: []string{"recent", "today", "old-1"},
+			// the runs completed today are retained by the limits, old-1 is retained only to keep the min retained runs
+			wantRetainedBy: map[string]string{"old-1": RetainedByMinRetained},
+		},
+		{
+			name:           "calendar days",
+			enabled:        true,
+			successLimit:   ptr.Int32(1),
+			retainDays:     ptr.Int32(1),
+			wantRemaining:  []string{"recent", "today", "old-1"},
+			wantRetainedBy: map[string]string{"today": RetainedByRetainCalendarDays, "old-1": RetainedByMinRetained},
+		},
+		{
+			name:           "disabled",
+			successLimit:   ptr.Int32(5),
+			wantRemaining:  []string{"recent", "today", "old-1"},
+			wantRetainedBy: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvRetainedByAnnotationEnabled, fmt.Sprint(tt.enabled))
+			resources := []metav1.Object{
+				newResource("recent", time.Hour, now),
+				// created long ago, completed today
+				newResource("today", 4*24*time.Hour, now),
+				newResource("old-1", 2*24*time.Hour, now.AddDate(0, 0, -2)),
+				newResource("old-2", 3*24*time.Hour, now.AddDate(0, 0, -3)),
+			}
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    tt.successLimit,
+				maxRetentionAge: ptr.Int32(24 * 60 * 60),
+				minRetained:     ptr.Int32(3),
+				retainDays:      tt.retainDays,
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}
+			hl, err := NewHistoryLimiter(&annotationPatchFuncs{mockFuncs})
+			assert.NoError(t, err)
+
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[0]))
+
+			var remaining []string
+			retainedBy := map[string]string{}
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+				if rule, found := res.GetAnnotations()[AnnotationRetainedBy]; found {
+					retainedBy[res.GetName()] = rule
+				}
+			}
+			assert.ElementsMatch(t, tt.wantRemaining, remaining)
+			assert.Equal(t, tt.wantRetainedBy, retainedBy)
+		})
+	}
+}
+
+// storeLimitFuncs resolves the history limits from the config store, as the PipelineRun funcs do
+type storeLimitFuncs struct {
+	*mockResourceFuncs
+}
+
+func (s *storeLimitFuncs) GetSuccessHistoryLimitCount(namespace, name string, selectors SelectorSpec) (*int32, string) {
+	return PrunerConfigStore.GetPipelineSuccessHistoryLimitCount(namespace, name, selectors)
+}
+
+func (s *storeLimitFuncs) GetFailedHistoryLimitCount(namespace, name string, selectors SelectorSpec) (*int32, string) {
+	return PrunerConfigStore.GetPipelineFailedHistoryLimitCount(namespace, name, selectors)
+}
+
+func (s *storeLimitFuncs) GetHistoryLimitCount(namespace, name string, selectors SelectorSpec) (*int32, string) {
+	return PrunerConfigStore.GetPipelineHistoryLimitCount(namespace, name, selectors)
+}
+
+func (s *storeLimitFuncs) GetMinRetainedPerOutcome(namespace, name string, selectors SelectorSpec) (*int32, string) {
+	return PrunerConfigStore.GetPipelineMinRetainedPerOutcome(namespace, name, selectors)
+}
+
+func TestCombinedHistoryLimit(t *testing.T) {
+	newResource := func(name string, age time.Duration, successful bool) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed:  true,
+			successful: successful,
+			failed:     !successful,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		config        string
+		wantRemaining []string
+	}{
+		{
+			// historyLimit alone caps the successful and the failed runs together
+			name:          "combined limit",
+			config:        "historyLimit: 2",
+			wantRemaining: []string{"succeeded-1", "succeeded-2"},
+		},
+		{
+			name:          "split limits",
+			config:        "historyLimit: 2\nsuccessfulHistoryLimit: 3\nfailedHistoryLimit: 1",
+			wantRemaining: []string{"succeeded-1", "succeeded-2", "succeeded-3", "failed-1"},
+		},
+		{
+			// historyLimit falls back to the outcome whose limit is not set
+			name:          "successful limit only",
+			config:        "historyLimit: 2\nsuccessfulHistoryLimit: 3",
+			wantRemaining: []string{"succeeded-1", "succeeded-2", "succeeded-3", "failed-1", "failed-2"},
+		},
+		{
+			// the split limits of the namespace are not overridden by the combined limit of the global config
+			name: "split limits on the namespace",
+			config: `enforcedConfigLevel: namespace
+historyLimit: 2
+namespaces:
+  default:
+    successfulHistoryLimit: 1
+    failedHistoryLimit: 1`,
+			wantRemaining: []string{"succeeded-1", "failed-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.config)
+
+			// the failed runs are older than all the successful runs
+			resources := []metav1.Object{
+				newResource("succeeded-1", time.Hour, true),
+				newResource("succeeded-2", 2*time.Hour, true),
+				newResource("succeeded-3", 3*time.Hour, true),
+				newResource("succeeded-4", 4*time.Hour, true),
+				newResource("failed-1", 5*time.Hour, false),
+				newResource("failed-2", 6*time.Hour, false),
+				newResource("failed-3", 7*time.Hour, false),
+			}
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": slices.Clone(resources)},
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}
+			hl, err := NewHistoryLimiter(&storeLimitFuncs{mockFuncs})
+			assert.NoError(t, err)
+
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[0]))
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[4]))
+
+			var remaining []string
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+			}
+			assert.ElementsMatch(t, tt.wantRemaining, remaining)
+		})
+	}
+}
+
+func TestHistoryLimitRetainsEachOutcome(t *testing.T) {
+	// under the combined historyLimit, minRetainedPerOutcome keeps the newest runs of each outcome
+	newResource := func(name string, age time.Duration, successful bool) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed:  true,
+			successful: successful,
+			failed:     !successful,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		config        string
+		wantRemaining []string
+	}{
+		{
+			// a burst of successful runs deletes all the failed runs without a minimum
+			name:          "no minimum",
+			config:        "historyLimit: 3",
+			wantRemaining: []string{"succeeded-1", "succeeded-2", "succeeded-3"},
+		},
+		{
+			// the newest failed run takes the place of the oldest retained successful run
+			name:          "minimum of one",
+			config:        "historyLimit: 3\nminRetainedPerOutcome: 1",
+			wantRemaining: []string{"succeeded-1", "succeeded-2", "failed-1"},
+		},
+		{
+			name:          "minimum of two",
+			config:        "historyLimit: 4\nminRetainedPerOutcome: 2",
+			wantRemaining: []string{"succeeded-1", "succeeded-2", "failed-1", "failed-2"},
+		},
+		{
+			// the minimums are kept when they cannot be met within the limit
+			name:          "minimums over the limit",
+			config:        "historyLimit: 1\nminRetainedPerOutcome: 1",
+			wantRemaining: []string{"succeeded-1", "failed-1"},
+		},
+		{
+			// the split limits are not combined, the minimum does not apply
+			name:          "split limits",
+			config:        "successfulHistoryLimit: 2\nfailedHistoryLimit: 0\nminRetainedPerOutcome: 1",
+			wantRemaining: []string{"succeeded-1", "succeeded-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.config)
+
+			// the failed runs are older than all the successful runs
+			resources := []metav1.Object{
+				newResource("succeeded-1", time.Hour, true),
+				newResource("succeeded-2", 2*time.Hour, true),
+				newResource("succeeded-3", 3*time.Hour, true),
+				newResource("succeeded-4", 4*time.Hour, true),
+				newResource("failed-1", 5*time.Hour, false),
+				newResource("failed-2", 6*time.Hour, false),
+				newResource("failed-3", 7*time.Hour, false),
+			}
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": slices.Clone(resources)},
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}
+			hl, err := NewHistoryLimiter(&storeLimitFuncs{mockFuncs})
+			assert.NoError(t, err)
+
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[0]))
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[4]))
+
+			var remaining []string
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+			}
+			assert.ElementsMatch(t, tt.wantRemaining, remaining)
+		})
+	}
+}
+
+// patchCountFuncs counts the patches and reports the deleted resources as not found
+type patchCountFuncs struct {
+	*mockResourceFuncs
+	patches   int
+	lastPatch []byte
+}
+
+func (pf *patchCountFuncs) Get(_ context.Context, namespace, name string) (metav1.Object, error) {
+	for _, res := range pf.resources[namespace] {
+		if res.GetName() == name {
+			return res, nil
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: "test", Resource: "mock"}, name)
+}
+
+func (pf *patchCountFuncs) Patch(_ context.Context, _, _ string, patchBytes []byte) error {
+	pf.patches++
+	pf.lastPatch = patchBytes
+	return nil
+}
+
+func TestProcessedAnnotationBatching(t *testing.T) {
+	// a burst of runs completing one after the other, each run deletes the previous one
+	processBurst := func(t *testing.T) (*HistoryLimiter, *patchCountFuncs) {
+		resourceFuncs := &patchCountFuncs{mockResourceFuncs: &mockResourceFuncs{
+			resources:       map[string][]metav1.Object{},
+			successLimit:    ptr.Int32(1),
+			defaultLabelKey: "test.label/name",
+		}}
+		hl, err := NewHistoryLimiter(resourceFuncs)
+		assert.NoError(t, err)
+		ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+
+		now := time.Now()
+		for i := 0; i < 5; i++ {
+			name := fmt.Sprintf("run-%d", i)
+			resource := &mockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "default",
+					UID:       types.UID(name),
+					Labels:    map[string]string{"test.label/name": "build"},
+					// the runs are ordered by creation time
+					CreationTimestamp: metav1.Time{Time: now.Add(time.Duration(i) * time.Minute)},
+				},
+				completed:      true,
+				successful:     true,
+				completionTime: metav1.Time{Time: now.Add(time.Duration(i) * time.Minute)},
+			}
+			resourceFuncs.resources["default"] = append(resourceFuncs.resources["default"], resource)
+			assert.NoError(t, hl.ProcessEvent(ctx, resource))
+		}
+		assert.Len(t, resourceFuncs.resources["default"], 1)
+		return hl, resourceFuncs
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		_, resourceFuncs := processBurst(t)
+		assert.Equal(t, 5, resourceFuncs.patches)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Setenv(EnvProcessedAnnotationBatchSeconds, "3600")
+		hl, resourceFuncs := processBurst(t)
+		assert.Equal(t, 0, resourceFuncs.patches)
+
+		// the marked resource counts as processed until its annotation is written
+		latest := resourceFuncs.resources["default"][0]
+		assert.True(t, hl.isProcessed(latest))
+
+		// only the resource still present at the end of the window is annotated
+		hl.processedBatcher.flush(context.Background())
+		assert.Equal(t, 1, resourceFuncs.patches)
+		assert.False(t, hl.processedBatcher.isPending(latest))
+	})
+}
+
+func TestNamespaceMaxCompletedRuns(t *testing.T) {
+	loadTestConfig(t, "maxCompletedRunsPerNamespace: 4")
+
+	// the runs of two pipelines complete one after the other, the oldest first
+	now := time.Now()
+	newRun := func(name, pipeline string, completedAgo time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            map[string]string{"test.label/name": pipeline},
+				CreationTimestamp: metav1.Time{Time: now.Add(-completedAgo - time.Minute)},
+			},
+			completed:      true,
+			successful:     true,
+			completionTime: metav1.Time{Time: now.Add(-completedAgo)},
+		}
+	}
+	running := newRun("build-running", "build", time.Hour)
+	running.completed = false
+	// the runs of a PipelineRun are deleted along with it
+	owned := newRun("build-owned", "build", time.Hour)
+	owned.OwnerReferences = []metav1.OwnerReference{{Kind: KindPipelineRun, Name: "parent"}}
+	resources := []metav1.Object{
+		newRun("build-0", "build", 6*time.Minute),
+		newRun("deploy-0", "deploy", 5*time.Minute),
+		newRun("build-1", "build", 4*time.Minute),
+		newRun("deploy-1", "deploy", 3*time.Minute),
+		newRun("build-2", "build", 2*time.Minute),
+		newRun("deploy-2", "deploy", time.Minute),
+		running,
+		owned,
+	}
+	mockFuncs := &mockResourceFuncs{
+		resources: map[string][]metav1.Object{"default": resources},
+		// the history limits of each pipeline are not reached
+		successLimit:    ptr.Int32(10),
+		defaultLabelKey: "test.label/name",
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[5]))
+
+	var remaining []string
+	for _, res := range mockFuncs.resources["default"] {
+		remaining = append(remaining, res.GetName())
+	}
+	// the oldest completed runs are deleted across both pipelines, the running and the owned ones are not counted
+	assert.ElementsMatch(t, []string{"build-1", "deploy-1", "build-2", "deploy-2", "build-running", "build-owned"}, remaining)
+}
+
+func TestDoResourceCleanupWithoutCreationTimestamp(t *testing.T) {
+	now := time.Now()
+	newResources := func() []metav1.Object {
+		resources := []metav1.Object{
+			// the resource without a creation timestamp would be the oldest one
+			&mockResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "no-timestamp", Namespace: "default"},
+				completed:  true,
+				successful: true,
+			},
+		}
+		for hour := 1; hour <= 3; hour++ {
+			resources = append(resources, &mockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              fmt.Sprintf("run-%d", hour),
+					Namespace:         "default",
+					CreationTimestamp: metav1.Time{Time: now.Add(-time.Duration(hour) * time.Hour)},
+				},
+				completed:  true,
+				successful: true,
+			})
+		}
+		return resources
+	}
+
+	tests := []struct {
+		name            string
+		successLimit    *int32
+		maxRetentionAge *int32
+		wantRemaining   []string
+	}{
+		{
+			name:          "history limit",
+			successLimit:  ptr.Int32(2),
+			wantRemaining: []string{"no-timestamp", "run-1"},
+		},
+		{
+			name:            "max retention age",
+			successLimit:    ptr.Int32(10),
+			maxRetentionAge: ptr.Int32(90 * 60),
+			wantRemaining:   []string{"no-timestamp", "run-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := newResources()
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    tt.successLimit,
+				maxRetentionAge: tt.maxRetentionAge,
+			}
+			hl, err := NewHistoryLimiter(mockFuncs)
+			assert.NoError(t, err)
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[1]))
+
+			var remaining []string
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+			}
+			assert.ElementsMatch(t, tt.wantRemaining, remaining)
+		})
+	}
+}
+
+func TestEphemeralHistoryLimit(t *testing.T) {
+	loadTestConfig(t, "ephemeral:\n  historyLimit: 1")
+
+	now := time.Now()
+	var resources []metav1.Object
+	for i := 0; i < 3; i++ {
+		for _, ephemeral := range []bool{false, true} {
+			name := fmt.Sprintf("run-%d", i)
+			var annotations map[string]string
+			if ephemeral {
+				name = fmt.Sprintf("scratch-%d", i)
+				annotations = map[string]string{AnnotationEphemeral: "true"}
+			}
+			resources = append(resources, &mockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              name,
+					Namespace:         "default",
+					Annotations:       annotations,
+					CreationTimestamp: metav1.Time{Time: now.Add(time.Duration(i) * time.Minute)},
+				},
+				completed:  true,
+				successful: true,
+			})
+		}
+	}
+	mockFuncs := &mockResourceFuncs{
+		resources:    map[string][]metav1.Object{"default": resources},
+		successLimit: ptr.Int32(3),
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+
+	// the unmarked runs are within the history limit of their group
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[4]))
+	assert.Len(t, mockFuncs.resources["default"], 6)
+
+	// the ephemeral runs are limited separately, by the lower ephemeral limit
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[5]))
+	var remaining []string
+	for _, res := range mockFuncs.resources["default"] {
+		remaining = append(remaining, res.GetName())
+	}
+	assert.ElementsMatch(t, []string{"run-0", "run-1", "run-2", "scratch-2"}, remaining)
+}
+
+// listCountFuncs counts the lists, one for each cleanup pass
+type listCountFuncs struct {
+	*mockResourceFuncs
+	lists int
+}
+
+func (l *listCountFuncs) List(ctx context.Context, namespace, selector string) ([]metav1.Object, error) {
+	l.lists++
+	return l.mockResourceFuncs.List(ctx, namespace, selector)
+}
+
+func TestHistoryCleanupCooldown(t *testing.T) {
+	loadTestConfig(t, "historyCleanupCooldownSeconds: 600")
+
+	newResource := func(name string, age time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            map[string]string{"test.label/name": "build"},
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed:  true,
+			successful: true,
+		}
+	}
+	mockFuncs := &mockResourceFuncs{
+		resources: map[string][]metav1.Object{"default": {
+			newResource("run-1", 3*time.Minute),
+			newResource("run-2", 2*time.Minute),
+		}},
+		successLimit:    ptr.Int32(1),
+		enforceLevel:    EnforcedConfigLevelGlobal,
+		defaultLabelKey: "test.label/name",
+	}
+	funcs := &listCountFuncs{mockResourceFuncs: mockFuncs}
+	hl, err := NewHistoryLimiter(funcs)
+	assert.NoError(t, err)
+	now := time.Now()
+	hl.cooldown.now = func() time.Time { return now }
+
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	assert.NoError(t, hl.ProcessEvent(ctx, mockFuncs.resources["default"][1]))
+	assert.Equal(t, 1, funcs.lists)
+	assert.Len(t, mockFuncs.resources["default"], 1)
+
+	// the runs completed within the cooldown are not cleaned up
+	for _, name := range []string{"run-3", "run-4", "run-5"} {
+		resource := newResource(name, 0)
+		mockFuncs.resources["default"] = append(mockFuncs.resources["default"], resource)
+		assert.NoError(t, hl.ProcessEvent(ctx, resource))
+	}
+	assert.Equal(t, 1, funcs.lists, "only one cleanup pass runs within the cooldown")
+	assert.Len(t, mockFuncs.resources["default"], 4)
+
+	// a single pass cleans up the runs batched during the cooldown
+	now = now.Add(10 * time.Minute)
+	resources := mockFuncs.resources["default"]
+	assert.NoError(t, hl.ProcessEvent(ctx, resources[len(resources)-1]))
+	assert.Equal(t, 2, funcs.lists)
+	assert.Len(t, mockFuncs.resources["default"], 1)
+}
+
+func TestHistoryCleanupCooldownCombinedLimit(t *testing.T) {
+	loadTestConfig(t, "historyCleanupCooldownSeconds: 600")
+
+	newResource := func(name string, age time.Duration, successful bool) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				Labels:            map[string]string{"test.label/name": "build"},
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed:  true,
+			successful: successful,
+			failed:     !successful,
+		}
+	}
+	mockFuncs := &mockResourceFuncs{
+		resources: map[string][]metav1.Object{"default": {
+			newResource("run-1", 3*time.Minute, true),
+			newResource("run-2", 2*time.Minute, true),
+		}},
+		historyLimit:    ptr.Int32(1),
+		enforceLevel:    EnforcedConfigLevelGlobal,
+		defaultLabelKey: "test.label/name",
+	}
+	funcs := &listCountFuncs{mockResourceFuncs: mockFuncs}
+	hl, err := NewHistoryLimiter(funcs)
+	assert.NoError(t, err)
+	now := time.Now()
+	hl.cooldown.now = func() time.Time { return now }
+
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	assert.NoError(t, hl.ProcessEvent(ctx, mockFuncs.resources["default"][1]))
+	assert.Equal(t, 1, funcs.lists)
+
+	// the cleanup under the combined limit covers the failed runs, a failure within the cooldown does not run another
+	failed := newResource("run-3", 0, false)
+	mockFuncs.resources["default"] = append(mockFuncs.resources["default"], failed)
+	assert.NoError(t, hl.ProcessEvent(ctx, failed))
+	assert.Equal(t, 1, funcs.lists, "only one cleanup pass runs within the cooldown of the group")
+}
+
+func TestReprocessRetriedRuns(t *testing.T) {
+	// the run was processed on its failure, it succeeded on a retry afterwards
+	processedAt := time.Now().Add(-time.Hour)
+	retried := &mockResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "retried",
+			Namespace:   "default",
+			Annotations: map[string]string{AnnotationHistoryLimitCheckProcessed: processedAt.Format(time.RFC3339)},
+		},
+		completed:      true,
+		successful:     true,
+		completionTime: metav1.Time{Time: time.Now()},
+	}
+	mockFuncs := &mockResourceFuncs{
+		resources:       map[string][]metav1.Object{"default": {retried}},
+		enforceLevel:    EnforcedConfigLevelGlobal,
+		defaultLabelKey: "test.label/name",
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+
+	loadTestConfig(t, "historyLimit: 1")
+	assert.True(t, hl.isProcessed(retried), "the retried run is not processed again without the feature flag")
+
+	loadTestConfig(t, "historyLimit: 1\nfeatureFlags:\n  reprocessRetriedRuns: true")
+	assert.False(t, hl.isProcessed(retried), "the run completed again after it was processed")
+
+	// the run processed on its final completion is not processed again
+	retried.Annotations[AnnotationHistoryLimitCheckProcessed] = time.Now().Format(time.RFC3339)
+	assert.True(t, hl.isProcessed(retried))
+}
+
+func TestHistoryLimitTighteningStep(t *testing.T) {
+	loadTestConfig(t, "historyLimitTighteningStep: 10")
+
+	resources := []metav1.Object{}
+	for i := 0; i < 40; i++ {
+		resources = append(resources, &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              fmt.Sprintf("run-%02d", i),
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-time.Duration(40-i) * time.Minute)},
+			},
+			completed:  true,
+			successful: true,
+		})
+	}
+	newest := resources[39]
+
+	mockFuncs := &mockResourceFuncs{
+		resources:       map[string][]metav1.Object{"default": resources},
+		successLimit:    ptr.Int32(10),
+		enforceLevel:    EnforcedConfigLevelGlobal,
+		defaultLabelKey: "test.label/name",
+	}
+	hl, err := NewHistoryLimiter(mockFuncs)
+	assert.NoError(t, err)
+
+	// the count decreases by the step on each pass until the limit is reached
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	for _, expected := range []int{30, 20, 10, 10} {
+		assert.NoError(t, hl.DoSuccessfulResourceCleanup(ctx, newest))
+		assert.Len(t, mockFuncs.resources["default"], expected)
+	}
+
+	// the oldest runs are deleted first
+	var remaining []string
+	for _, res := range mockFuncs.resources["default"] {
+		remaining = append(remaining, res.GetName())
+	}
+	assert.ElementsMatch(t, []string{"run-30", "run-31", "run-32", "run-33", "run-34", "run-35", "run-36", "run-37", "run-38", "run-39"}, remaining)
+}
+
+func TestHistorySelfPrune(t *testing.T) {
+	newResources := func() []metav1.Object {
+		resources := []metav1.Object{}
+		for i := 0; i < 100; i++ {
+			resources = append(resources, &mockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              fmt.Sprintf("run-%03d", i),
+					Namespace:         "default",
+					CreationTimestamp: metav1.Time{Time: time.Now().Add(-time.Duration(100-i) * time.Minute)},
+				},
+				completed:  true,
+				successful: true,
+			})
+		}
+		return resources
+	}
+	names := func(resources []metav1.Object) []string {
+		var result []string
+		for _, res := range resources {
+			result = append(result, res.GetName())
+		}
+		return result
+	}
+	newest := []string{"run-095", "run-096", "run-097", "run-098", "run-099"}
+
+	tests := []struct {
+		name   string
+		config string
+		// remaining after the event of the newest run, and after the event of the oldest run
+		afterNewest, afterOldest int
+	}{
+		{
+			name:        "full sweep",
+			config:      "successfulHistoryLimit: 5",
+			afterNewest: 5,
+			afterOldest: 5,
+		},
+		{
+			name:        "self prune",
+			config:      "successfulHistoryLimit: 5\nhistorySelfPrune: true",
+			afterNewest: 100,
+			afterOldest: 99,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loadTestConfig(t, tc.config)
+
+			resources := newResources()
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    ptr.Int32(5),
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}
+			hl, err := NewHistoryLimiter(mockFuncs)
+			assert.NoError(t, err)
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			// the deletions of the mock shift the listed resources
+			resources = append([]metav1.Object{}, resources...)
+
+			// the event of the newest run sweeps the whole group, or deletes nothing as the run is retained
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[99]))
+			assert.Len(t, mockFuncs.resources["default"], tc.afterNewest)
+
+			// the event of the oldest run deletes it
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[0]))
+			assert.Len(t, mockFuncs.resources["default"], tc.afterOldest)
+			assert.NotContains(t, names(mockFuncs.resources["default"]), "run-000")
+
+			// the resync reconciles every run, each run over the limits deletes itself
+			for _, res := range resources {
+				assert.NoError(t, hl.ProcessEvent(ctx, res))
+			}
+			assert.ElementsMatch(t, newest, names(mockFuncs.resources["default"]))
+		})
+	}
+}
+
+func TestProcessedByVersionAnnotation(t *testing.T) {
+	process := func(t *testing.T) map[string]interface{} {
+		resource := &mockResource{
+			ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "default", Labels: map[string]string{"test.label/name": "build"}},
+			completed:  true,
+			successful: true,
+		}
+		resourceFuncs := &patchCountFuncs{mockResourceFuncs: &mockResourceFuncs{
+			resources:       map[string][]metav1.Object{"default": {resource}},
+			successLimit:    ptr.Int32(1),
+			defaultLabelKey: "test.label/name",
+		}}
+		hl, err := NewHistoryLimiter(resourceFuncs)
+		assert.NoError(t, err)
+		assert.NoError(t, hl.ProcessEvent(logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar()), resource))
+
+		patch := map[string]map[string]map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(resourceFuncs.lastPatch, &patch))
+		return patch["metadata"]["annotations"]
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		annotations := process(t)
+		assert.Contains(t, annotations, AnnotationHistoryLimitCheckProcessed)
+		assert.NotContains(t, annotations, AnnotationProcessedByVersion)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Setenv(EnvProcessedByVersion, "v0.3.1")
+		annotations := process(t)
+		assert.Contains(t, annotations, AnnotationHistoryLimitCheckProcessed)
+		assert.Equal(t, "v0.3.1", annotations[AnnotationProcessedByVersion])
+	})
+}
+
+func TestHistoryLimitCompletionOrder(t *testing.T) {
+	now := time.Now()
+	newResource := func(name string, successful bool, createdAgo, completedAgo time.Duration) *mockResource {
+		res := &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: now.Add(-createdAgo)},
+			},
+			completed:  true,
+			successful: successful,
+			failed:     !successful,
+		}
+		if completedAgo > 0 {
+			res.completionTime = metav1.Time{Time: now.Add(-completedAgo)}
+		}
+		return res
+	}
+
+	for _, successful := range []bool{true, false} {
+		t.Run(fmt.Sprintf("successful=%t", successful), func(t *testing.T) {
+			resources := []metav1.Object{
+				// created first, completed last
+				newResource("long", successful, 3*time.Hour, 10*time.Minute),
+				// created last, completed before the long run
+				newResource("short", successful, time.Hour, 50*time.Minute),
+				newResource("early", successful, 2*time.Hour, 90*time.Minute),
+				// without a completion time, ordered by its creation timestamp
+				newResource("unknown", successful, 4*time.Hour, 0),
+			}
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    ptr.Int32(2),
+				failedLimit:     ptr.Int32(2),
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}
+			hl, err := NewHistoryLimiter(mockFuncs)
+			assert.NoError(t, err)
+
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			if successful {
+				assert.NoError(t, hl.DoSuccessfulResourceCleanup(ctx, resources[0]))
+			} else {
+				assert.NoError(t, hl.DoFailedResourceCleanup(ctx, resources[0]))
+			}
+
+			var remaining []string
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+			}
+			// the most recently completed runs are retained, regardless of their creation order
+			assert.ElementsMatch(t, []string{"long", "short"}, remaining)
+		})
+	}
+}
+
+// countingDeleteFuncs counts the deletions of the resources
+type countingDeleteFuncs struct {
+	*mockResourceFuncs
+	deletes int
+}
+
+func (m *countingDeleteFuncs) Delete(ctx context.Context, namespace, name string) error {
+	m.deletes++
+	return m.mockResourceFuncs.Delete(ctx, namespace, name)
+}
+
+func TestHistoryLimiterDryRun(t *testing.T) {
+	for _, dryRun := range []bool{true, false} {
+		t.Run(fmt.Sprintf("dryRun=%t", dryRun), func(t *testing.T) {
+			resources := []metav1.Object{}
+			for i := 0; i < 5; i++ {
+				resources = append(resources, &mockResource{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              fmt.Sprintf("run-%d", i),
+						Namespace:         "default",
+						CreationTimestamp: metav1.Time{Time: time.Now().Add(-time.Duration(5-i) * time.Minute)},
+					},
+					completed:  true,
+					successful: true,
+				})
+			}
+			funcs := &countingDeleteFuncs{mockResourceFuncs: &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    ptr.Int32(2),
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}}
+			hl, err := NewHistoryLimiterWithOptions(funcs, HistoryLimiterOptions{DryRun: dryRun})
+			assert.NoError(t, err)
+
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.DoSuccessfulResourceCleanup(ctx, resources[4]))
+
+			if dryRun {
+				// the resources over the limit are reported only
+				assert.Equal(t, 0, funcs.deletes)
+				assert.Len(t, funcs.resources["default"], 5)
+			} else {
+				assert.Equal(t, 3, funcs.deletes)
+				assert.Len(t, funcs.resources["default"], 2)
+			}
+		})
+	}
+}
+
+func TestUnknownOutcomeHistoryLimit(t *testing.T) {
+	newResource := func(name string, failed bool, age time.Duration) *mockResource {
+		return &mockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "default",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			completed: true,
+			failed:    failed,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		successLimit  *int32
+		failedLimit   *int32
+		wantRemaining []string
+	}{
+		{
+			name:         "the higher of the limits",
+			successLimit: ptr.Int32(1),
+			failedLimit:  ptr.Int32(2),
+			// the failed runs are not counted with the runs of unknown outcome
+			wantRemaining: []string{"unknown-0", "unknown-1", "failed-0", "failed-1"},
+		},
+		{
+			name:          "same limits",
+			successLimit:  ptr.Int32(3),
+			failedLimit:   ptr.Int32(3),
+			wantRemaining: []string{"unknown-0", "unknown-1", "unknown-2", "failed-0", "failed-1"},
+		},
+		{
+			name:          "an unlimited outcome",
+			failedLimit:   ptr.Int32(0),
+			wantRemaining: []string{"unknown-0", "unknown-1", "unknown-2", "unknown-3", "failed-0", "failed-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := []metav1.Object{
+				newResource("unknown-0", false, time.Minute),
+				newResource("unknown-1", false, 2*time.Minute),
+				newResource("unknown-2", false, 3*time.Minute),
+				newResource("unknown-3", false, 4*time.Minute),
+				newResource("failed-0", true, 5*time.Minute),
+				newResource("failed-1", true, 6*time.Minute),
+			}
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    tt.successLimit,
+				failedLimit:     tt.failedLimit,
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}
+			hl, err := NewHistoryLimiter(mockFuncs)
+			assert.NoError(t, err)
+
+			// a run completed without an outcome is retained by its own bucket
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.ProcessEvent(ctx, resources[0]))
+
+			var remaining []string
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+			}
+			assert.ElementsMatch(t, tt.wantRemaining, remaining)
+		})
+	}
+}
+
+func TestMinRetentionSeconds(t *testing.T) {
+	now := time.Now()
+	newResources := func(completedAgo ...time.Duration) []metav1.Object {
+		var resources []metav1.Object
+		for i, ago := range completedAgo {
+			resources = append(resources, &mockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              fmt.Sprintf("run-%d", i),
+					Namespace:         "default",
+					CreationTimestamp: metav1.Time{Time: now.Add(-ago - time.Minute)},
+				},
+				completed:      true,
+				successful:     true,
+				completionTime: metav1.Time{Time: now.Add(-ago)},
+			})
+		}
+		return resources
+	}
+
+	tests := []struct {
+		name         string
+		completedAgo []time.Duration
+		minRetention *int32
+		// the runs without a completion time
+		withoutCompletionTime []string
+		wantRemaining         []string
+	}{
+		{
+			name:          "disabled",
+			completedAgo:  []time.Duration{time.Second, 2 * time.Second, time.Hour, 2 * time.Hour},
+			wantRemaining: []string{"run-0"},
+		},
+		{
+			// the recent runs are counted on the limit, only the older runs over it are deleted
+			name:          "recent runs over the limit",
+			completedAgo:  []time.Duration{time.Second, 2 * time.Second, time.Hour, 2 * time.Hour},
+			minRetention:  ptr.Int32(60),
+			wantRemaining: []string{"run-0", "run-1"},
+		},
+		{
+			name:          "all the runs over the limit are recent",
+			completedAgo:  []time.Duration{time.Second, 2 * time.Second, 3 * time.Second},
+			minRetention:  ptr.Int32(60),
+			wantRemaining: []string{"run-0", "run-1", "run-2"},
+		},
+		{
+			// the run without a completion time is not known to be out of the min retention
+			name:                  "run without a completion time",
+			completedAgo:          []time.Duration{time.Second, time.Hour, 2 * time.Hour},
+			minRetention:          ptr.Int32(60),
+			withoutCompletionTime: []string{"run-2"},
+			wantRemaining:         []string{"run-0", "run-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := newResources(tt.completedAgo...)
+			for _, res := range resources {
+				if slices.Contains(tt.withoutCompletionTime, res.GetName()) {
+					res.(*mockResource).completionTime = metav1.Time{}
+				}
+			}
+			mockFuncs := &mockResourceFuncs{
+				resources:       map[string][]metav1.Object{"default": resources},
+				successLimit:    ptr.Int32(1),
+				minRetention:    tt.minRetention,
+				enforceLevel:    EnforcedConfigLevelGlobal,
+				defaultLabelKey: "test.label/name",
+			}
+			hl, err := NewHistoryLimiter(mockFuncs)
+			assert.NoError(t, err)
+
+			ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+			assert.NoError(t, hl.DoSuccessfulResourceCleanup(ctx, resources[0]))
+
+			var remaining []string
+			for _, res := range mockFuncs.resources["default"] {
+				remaining = append(remaining, res.GetName())
+			}
+			assert.ElementsMatch(t, tt.wantRemaining, remaining)
+		})
+	}
+}
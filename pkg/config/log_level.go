@@ -0,0 +1,115 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"knative.dev/pkg/logging"
+)
+
+// LogLevel overrides the level of the loggers wrapped by it, it is set from the log-level key of the pruner
+// config map without a restart. The level of the logging config applies while the override is not set
+type LogLevel struct {
+	mutex sync.RWMutex
+	level *zapcore.Level
+}
+
+// PrunerLogLevel is the log level override of the pruner controllers
+var PrunerLogLevel = &LogLevel{}
+
+// ParseLogLevel parses the value of the log-level key, an empty value is nil
+func ParseLogLevel(value string) (*zapcore.Level, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	level, err := zapcore.ParseLevel(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", value, err)
+	}
+	return &level, nil
+}
+
+// Set overrides the level with the given value, an empty value removes the override.
+// The override is kept when the value is invalid
+func (ll *LogLevel) Set(value string) error {
+	level, err := ParseLogLevel(value)
+	if err != nil {
+		return err
+	}
+	ll.mutex.Lock()
+	defer ll.mutex.Unlock()
+	ll.level = level
+	return nil
+}
+
+// enabled returns whether the level is enabled by the override, found is false when there is no override
+func (ll *LogLevel) enabled(level zapcore.Level) (enabled, found bool) {
+	ll.mutex.RLock()
+	defer ll.mutex.RUnlock()
+	if ll.level == nil {
+		return false, false
+	}
+	return ll.level.Enabled(level), true
+}
+
+// WrapLogger returns the logger whose level is overridden by the LogLevel
+func (ll *LogLevel) WrapLogger(logger *zap.SugaredLogger) *zap.SugaredLogger {
+	return logger.Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelOverrideCore{Core: core, logLevel: ll}
+	})).Sugar()
+}
+
+// WithLogLevel returns the context whose logger level is overridden by the PrunerLogLevel
+func WithLogLevel(ctx context.Context) context.Context {
+	return logging.WithLogger(ctx, PrunerLogLevel.WrapLogger(logging.FromContext(ctx)))
+}
+
+// levelOverrideCore enables the entries by the override level when it is set, by the wrapped core otherwise.
+// The entries are written to the wrapped core directly, so the levels disabled on it are written as well
+type levelOverrideCore struct {
+	zapcore.Core
+	logLevel *LogLevel
+}
+
+func (c *levelOverrideCore) Enabled(level zapcore.Level) bool {
+	if enabled, found := c.logLevel.enabled(level); found {
+		return enabled
+	}
+	return c.Core.Enabled(level)
+}
+
+func (c *levelOverrideCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelOverrideCore{Core: c.Core.With(fields), logLevel: c.logLevel}
+}
+
+func (c *levelOverrideCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *levelOverrideCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, fields)
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// logBuffer counts the entries written to it
+type logBuffer struct {
+	bytes.Buffer
+}
+
+func (b *logBuffer) entries() int {
+	return strings.Count(b.String(), "\n")
+}
+
+func TestLogLevel(t *testing.T) {
+	logs := &logBuffer{}
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(logs), zapcore.InfoLevel)
+	logLevel := &LogLevel{}
+	logger := logLevel.WrapLogger(zap.New(core).Sugar()).With("component", "test")
+
+	// the level of the wrapped logger applies while the level is not overridden
+	logger.Debug("hidden")
+	if logs.entries() != 0 {
+		t.Fatalf("logged %d entries at the info level, want none", logs.entries())
+	}
+
+	if err := logLevel.Set("debug"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	logger.Debug("shown")
+	if logs.entries() != 1 {
+		t.Fatalf("logged %d entries at the debug level, want 1", logs.entries())
+	}
+
+	// an invalid level keeps the current level
+	if err := logLevel.Set("verbose"); err == nil {
+		t.Fatal("Set() error = nil, want error")
+	}
+	logger.Debug("shown")
+	if logs.entries() != 2 {
+		t.Fatalf("logged %d entries after an invalid level, want 2", logs.entries())
+	}
+
+	if err := logLevel.Set("error"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	logger.Info("hidden")
+	if logs.entries() != 2 {
+		t.Fatalf("logged %d entries at the error level, want 2", logs.entries())
+	}
+
+	// removing the override restores the level of the wrapped logger
+	if err := logLevel.Set(""); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	logger.Info("shown")
+	logger.Debug("hidden")
+	if logs.entries() != 3 {
+		t.Fatalf("logged %d entries after removing the override, want 3", logs.entries())
+	}
+}
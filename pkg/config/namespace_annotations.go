@@ -0,0 +1,59 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// NamespaceSpecFromAnnotations reads the retention settings of a namespace from its annotations,
+// for example pruner.tekton.dev/ttlSecondsAfterFinished=3600. It returns false when the namespace
+// carries none of the annotations
+func NamespaceSpecFromAnnotations(annotations map[string]string) (NamespaceSpec, bool, error) {
+	spec := NamespaceSpec{}
+	fields := []struct {
+		annotation string
+		minimum    int64
+		value      **int32
+	}{
+		// a ttl of -1 disables the ttl, as on the config map
+		{AnnotationTTLSecondsAfterFinished, -1, &spec.TTLSecondsAfterFinished},
+		{AnnotationSuccessfulHistoryLimit, 0, &spec.SuccessfulHistoryLimit},
+		{AnnotationFailedHistoryLimit, 0, &spec.FailedHistoryLimit},
+		{AnnotationHistoryLimit, 0, &spec.HistoryLimit},
+	}
+
+	found := false
+	for _, field := range fields {
+		raw, exists := annotations[field.annotation]
+		if !exists {
+			continue
+		}
+		value, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return NamespaceSpec{}, false, fmt.Errorf("invalid value %q of the annotation %s: %w", raw, field.annotation, err)
+		}
+		if value < field.minimum {
+			return NamespaceSpec{}, false, fmt.Errorf("invalid value %q of the annotation %s: must be greater than or equal to %d", raw, field.annotation, field.minimum)
+		}
+		parsed := int32(value)
+		*field.value = &parsed
+		found = true
+	}
+	return spec, found, nil
+}
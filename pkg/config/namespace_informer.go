@@ -0,0 +1,42 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	namespaceInformerOnce sync.Once
+	namespaceInformer     cache.SharedIndexInformer
+)
+
+// GetNamespaceInformer returns the process wide namespace informer, shared by the reconcilers to look up
+// the namespaces of the resources from its cache. It is started on the first call and runs until the context is done
+func GetNamespaceInformer(ctx context.Context, client kubernetes.Interface) cache.SharedIndexInformer {
+	namespaceInformerOnce.Do(func() {
+		namespaceInformer = corev1informers.NewNamespaceInformer(client, time.Duration(DefaultNamespacedConfigResyncSeconds)*time.Second, cache.Indexers{})
+		go namespaceInformer.Run(ctx.Done())
+	})
+	return namespaceInformer
+}
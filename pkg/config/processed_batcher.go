@@ -0,0 +1,117 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// processedMark is a resource marked as processed, waiting for the processed annotation to be written
+type processedMark struct {
+	namespace   string
+	name        string
+	uid         types.UID
+	processedAt time.Time
+	// generation is the reprocess generation the resource is processed on
+	generation string
+}
+
+// key returns the namespace and the name of the marked resource
+func (m processedMark) key() string {
+	return m.namespace + "/" + m.name
+}
+
+// processedAnnotationBatcher coalesces the writes of the processed annotation. The resources marked as processed
+// are kept in memory, where they count as processed, and they are annotated together once the window is over.
+// The resources deleted within the window, by the history limits for example, are not annotated at all.
+// The marks not written yet are lost on a restart, the resources are processed again then
+type processedAnnotationBatcher struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	pending map[string]processedMark
+	// writeFn writes the processed annotation of a resource
+	writeFn func(ctx context.Context, mark processedMark)
+	// scheduled is true when a flush is scheduled at the end of the current window
+	scheduled bool
+}
+
+// newProcessedAnnotationBatcher creates a processedAnnotationBatcher which flushes the marks every window,
+// nil is returned when the window is not positive, the writes are not batched then
+func newProcessedAnnotationBatcher(window time.Duration, writeFn func(ctx context.Context, mark processedMark)) *processedAnnotationBatcher {
+	if window <= 0 {
+		return nil
+	}
+	return &processedAnnotationBatcher{
+		window:  window,
+		pending: map[string]processedMark{},
+		writeFn: writeFn,
+	}
+}
+
+// add keeps the mark until the end of the window, the latest mark of a resource is written
+func (pb *processedAnnotationBatcher) add(ctx context.Context, mark processedMark) {
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+
+	pb.pending[mark.key()] = mark
+	if pb.scheduled {
+		return
+	}
+	pb.scheduled = true
+	// the flush is not cancelled with the event which started the window
+	flushCtx := context.WithoutCancel(ctx)
+	time.AfterFunc(pb.window, func() { pb.flush(flushCtx) })
+}
+
+// isPending returns true when the resource is marked as processed and its annotation is not written yet.
+// A nil processedAnnotationBatcher holds no mark
+func (pb *processedAnnotationBatcher) isPending(resource metav1.Object) bool {
+	if pb == nil {
+		return false
+	}
+	pb.mutex.Lock()
+	defer pb.mutex.Unlock()
+	mark, found := pb.pending[resource.GetNamespace()+"/"+resource.GetName()]
+	return found && mark.uid == resource.GetUID() && mark.generation == PrunerConfigStore.GetReprocessGeneration()
+}
+
+// flush writes the pending marks, a mark counts as processed until it is written
+func (pb *processedAnnotationBatcher) flush(ctx context.Context) {
+	pb.mutex.Lock()
+	marks := make([]processedMark, 0, len(pb.pending))
+	for _, mark := range pb.pending {
+		marks = append(marks, mark)
+	}
+	pb.scheduled = false
+	pb.mutex.Unlock()
+
+	for _, mark := range marks {
+		pb.writeFn(ctx, mark)
+
+		pb.mutex.Lock()
+		// the resource marked again meanwhile is written on the next flush
+		if pending, found := pb.pending[mark.key()]; found && pending.processedAt.Equal(mark.processedAt) {
+			delete(pb.pending, mark.key())
+		}
+		pb.mutex.Unlock()
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/logging"
+)
+
+// DeletionRecord describes a resource deleted by the pruner
+type DeletionRecord struct {
+	Kind      string
+	Namespace string
+	Name      string
+	UID       types.UID
+	// Operation is the rule which deleted the resource, ttl or history
+	Operation string
+	// Status is the outcome of the deleted run, succeeded, failed or cancelled
+	Status    string
+	DeletedAt time.Time
+}
+
+// DeletionObserver is notified of each resource deleted by the history limiters and the ttl handlers.
+// It is notified after the deletion, a failure to observe it does not fail the deletion
+type DeletionObserver interface {
+	ObserveDeletion(ctx context.Context, record DeletionRecord)
+}
+
+var (
+	deletionObserverMutex sync.RWMutex
+	deletionObserver      DeletionObserver
+)
+
+// SetDeletionObserver sets the process wide DeletionObserver, shared by all the history limiters
+// and ttl handlers. The deletions are not observed when it is nil
+func SetDeletionObserver(observer DeletionObserver) {
+	deletionObserverMutex.Lock()
+	defer deletionObserverMutex.Unlock()
+	deletionObserver = observer
+}
+
+// observeDeletion notifies the DeletionObserver of a deletion, if any
+func observeDeletion(ctx context.Context, record DeletionRecord) {
+	deletionObserverMutex.RLock()
+	observer := deletionObserver
+	deletionObserverMutex.RUnlock()
+	if observer != nil {
+		observer.ObserveDeletion(ctx, record)
+	}
+}
+
+// PruneRecordClient writes and lists the PruneRecord resources of a namespace
+type PruneRecordClient interface {
+	Create(ctx context.Context, namespace string, record *unstructured.Unstructured) error
+	List(ctx context.Context, namespace string) ([]unstructured.Unstructured, error)
+	Delete(ctx context.Context, namespace, name string) error
+}
+
+// PruneRecordWriter writes a PruneRecord resource for each deletion on the namespace of the deleted resource.
+// The records of a namespace are capped, the oldest ones are deleted once a namespace holds more
+type PruneRecordWriter struct {
+	client          PruneRecordClient
+	maxPerNamespace int
+}
+
+// NewPruneRecordWriter creates a PruneRecordWriter keeping at most maxPerNamespace records on each namespace
+func NewPruneRecordWriter(client PruneRecordClient, maxPerNamespace int) *PruneRecordWriter {
+	return &PruneRecordWriter{client: client, maxPerNamespace: maxPerNamespace}
+}
+
+// ObserveDeletion writes the PruneRecord of the deletion and deletes the records over the cap
+func (w *PruneRecordWriter) ObserveDeletion(ctx context.Context, record DeletionRecord) {
+	logger := logging.FromContext(ctx)
+	if err := w.client.Create(ctx, record.Namespace, newPruneRecord(record)); err != nil {
+		logger.Errorw("error on writing the prune record", "namespace", record.Namespace, "name", record.Name, zap.Error(err))
+		return
+	}
+
+	records, err := w.client.List(ctx, record.Namespace)
+	if err != nil {
+		logger.Errorw("error on listing the prune records", "namespace", record.Namespace, zap.Error(err))
+		return
+	}
+	if len(records) <= w.maxPerNamespace {
+		return
+	}
+	// the records are deleted oldest first
+	sort.SliceStable(records, func(i, j int) bool {
+		return pruneRecordDeletedAt(records[i]).Before(pruneRecordDeletedAt(records[j]))
+	})
+	for _, expired := range records[:len(records)-w.maxPerNamespace] {
+		if err := w.client.Delete(ctx, record.Namespace, expired.GetName()); err != nil {
+			logger.Errorw("error on deleting the prune record over the cap", "namespace", record.Namespace, "name", expired.GetName(), zap.Error(err))
+		}
+	}
+}
+
+// newPruneRecord returns the PruneRecord resource of the deletion
+func newPruneRecord(record DeletionRecord) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "pruner.tekton.dev/v1alpha1",
+		"kind":       "PruneRecord",
+		"metadata": map[string]interface{}{
+			"generateName": record.Name + "-",
+			"namespace":    record.Namespace,
+		},
+		"spec": map[string]interface{}{
+			"resource": map[string]interface{}{
+				"kind": record.Kind,
+				"name": record.Name,
+				"uid":  string(record.UID),
+			},
+			"operation": record.Operation,
+			"status":    record.Status,
+			"deletedAt": record.DeletedAt.UTC().Format(time.RFC3339Nano),
+		},
+	}}
+}
+
+// pruneRecordDeletedAt returns the deletion time of the record, the zero time when it is missing or invalid
+func pruneRecordDeletedAt(record unstructured.Unstructured) time.Time {
+	value, _, _ := unstructured.NestedString(record.Object, "spec", "deletedAt")
+	deletedAt, _ := time.Parse(time.RFC3339Nano, value)
+	return deletedAt
+}
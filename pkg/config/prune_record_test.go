@@ -0,0 +1,98 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clocktest "k8s.io/utils/clock/testing"
+	"knative.dev/pkg/ptr"
+)
+
+// memoryPruneRecordClient keeps the PruneRecords in memory, keyed by namespace
+type memoryPruneRecordClient struct {
+	records map[string][]unstructured.Unstructured
+	created int
+}
+
+func (c *memoryPruneRecordClient) Create(_ context.Context, namespace string, record *unstructured.Unstructured) error {
+	c.created++
+	record.SetName(fmt.Sprintf("%s%d", record.GetGenerateName(), c.created))
+	c.records[namespace] = append(c.records[namespace], *record)
+	return nil
+}
+
+func (c *memoryPruneRecordClient) List(_ context.Context, namespace string) ([]unstructured.Unstructured, error) {
+	return append([]unstructured.Unstructured{}, c.records[namespace]...), nil
+}
+
+func (c *memoryPruneRecordClient) Delete(_ context.Context, namespace, name string) error {
+	for i, record := range c.records[namespace] {
+		if record.GetName() == name {
+			c.records[namespace] = append(c.records[namespace][:i], c.records[namespace][i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("prune record %s/%s not found", namespace, name)
+}
+
+func TestPruneRecordOnDeletion(t *testing.T) {
+	client := &memoryPruneRecordClient{records: map[string][]unstructured.Unstructured{}}
+	SetDeletionObserver(NewPruneRecordWriter(client, 10))
+	t.Cleanup(func() { SetDeletionObserver(nil) })
+
+	mockFuncs := newMockTTLFuncs()
+	mockFuncs.ttl = ptr.Int32(60)
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+	resource := &ttlMockResource{
+		ObjectMeta:      metav1.ObjectMeta{Name: "test1", Namespace: "default", UID: "uid-1"},
+		completed:       true,
+		completion_time: &metav1.Time{Time: fakeClock.Now().Add(-time.Hour)},
+	}
+	mockFuncs.resources["default/test1"] = resource
+
+	assert.NoError(t, handler.ProcessEvent(context.Background(), resource))
+	if !assert.Len(t, client.records["default"], 1) {
+		return
+	}
+	record := client.records["default"][0]
+	assert.Equal(t, "PruneRecord", record.GetKind())
+	spec, _, _ := unstructured.NestedMap(record.Object, "spec")
+	assert.Equal(t, map[string]interface{}{
+		"resource":  map[string]interface{}{"kind": "MockResource", "name": "test1", "uid": "uid-1"},
+		"operation": "ttl",
+		"status":    mockFuncs.GetCompletionStatus(resource),
+		"deletedAt": fakeClock.Now().UTC().Format(time.RFC3339Nano),
+	}, spec)
+}
+
+func TestPruneRecordsCapped(t *testing.T) {
+	client := &memoryPruneRecordClient{records: map[string][]unstructured.Unstructured{}}
+	writer := NewPruneRecordWriter(client, 3)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		writer.ObserveDeletion(context.Background(), DeletionRecord{
+			Kind:      KindPipelineRun,
+			Namespace: "default",
+			Name:      fmt.Sprintf("run-%d", i),
+			Operation: "history",
+			DeletedAt: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	writer.ObserveDeletion(context.Background(), DeletionRecord{Kind: KindPipelineRun, Namespace: "other", Name: "run", DeletedAt: start})
+
+	// the oldest records are deleted, the namespaces are capped on their own
+	var remaining []string
+	for _, record := range client.records["default"] {
+		name, _, _ := unstructured.NestedString(record.Object, "spec", "resource", "name")
+		remaining = append(remaining, name)
+	}
+	assert.Equal(t, []string{"run-2", "run-3", "run-4"}, remaining)
+	assert.Len(t, client.records["other"], 1)
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// PruneSummary collects the outcome of a cleanup, the deletions done by the ttl handlers
+// and the history limiters are counted per namespace when the summary is attached to the context
+type PruneSummary struct {
+	mutex     sync.Mutex
+	deletions map[string]int64
+	errors    []string
+}
+
+// pruneSummaryKey is used as the key for associating the PruneSummary with the context
+type pruneSummaryKey struct{}
+
+// NewPruneSummary creates an empty PruneSummary
+func NewPruneSummary() *PruneSummary {
+	return &PruneSummary{deletions: map[string]int64{}}
+}
+
+// WithPruneSummary attaches the PruneSummary to the context
+func WithPruneSummary(ctx context.Context, summary *PruneSummary) context.Context {
+	return context.WithValue(ctx, pruneSummaryKey{}, summary)
+}
+
+// pruneSummaryFromContext returns the PruneSummary attached to the context, nil if there is none
+func pruneSummaryFromContext(ctx context.Context) *PruneSummary {
+	summary, _ := ctx.Value(pruneSummaryKey{}).(*PruneSummary)
+	return summary
+}
+
+// RecordDeletion counts a deletion on the namespace. A nil PruneSummary ignores it
+func (ps *PruneSummary) RecordDeletion(namespace string) {
+	if ps == nil {
+		return
+	}
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.deletions[namespace]++
+}
+
+// RecordError keeps the error occurred on the namespace. A nil PruneSummary ignores it
+func (ps *PruneSummary) RecordError(namespace string, err error) {
+	if ps == nil || err == nil {
+		return
+	}
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	ps.errors = append(ps.errors, fmt.Sprintf("%s: %v", namespace, err))
+}
+
+// Deletions returns a copy of the deletion counts keyed by namespace
+func (ps *PruneSummary) Deletions() map[string]int64 {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	deletions := make(map[string]int64, len(ps.deletions))
+	for namespace, count := range ps.deletions {
+		deletions[namespace] = count
+	}
+	return deletions
+}
+
+// TotalDeletions returns the number of deletions on all the namespaces
+func (ps *PruneSummary) TotalDeletions() int64 {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	var total int64
+	for _, count := range ps.deletions {
+		total += count
+	}
+	return total
+}
+
+// Errors returns a copy of the errors occurred
+func (ps *PruneSummary) Errors() []string {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	return append([]string(nil), ps.errors...)
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EstimateReclaimable returns the number of the given resources whose TTL expires within the period
+// from now, the resources already expired are included. The TTL is resolved from the config as it is
+// applied on the resources, the resources which are excluded or have no TTL are not counted.
+// The history limits are not considered, the estimate is a lower bound of the resources to be pruned
+func (th *TTLHandler) EstimateReclaimable(resources []metav1.Object, period time.Duration) int {
+	until := th.clock.Now().Add(period)
+
+	reclaimable := 0
+	for _, resource := range resources {
+		if resource.GetDeletionTimestamp() != nil || PrunerConfigStore.IsExcluded(resource.GetAnnotations()) {
+			continue
+		}
+
+		labelKey := getResourceNameLabelKey(resource, th.resourceFn.GetDefaultLabelKey())
+		ttl, _ := th.getTTLSecondsAfterFinished(resource, getResourceName(resource, labelKey), th.getResourceSelectors(resource))
+
+		// the deadline is empty when the resource is not completed or the ttl is disabled
+		deleteAfter, err := time.Parse(time.RFC3339, th.getDeleteAfter(resource, ttl))
+		if err == nil && !deleteAfter.After(until) {
+			reclaimable++
+		}
+	}
+	return reclaimable
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktest "k8s.io/utils/clock/testing"
+	"knative.dev/pkg/ptr"
+)
+
+func TestEstimateReclaimable(t *testing.T) {
+	loadTestConfig(t, "excludeAnnotations:\n  keep: \"true\"")
+
+	mockFuncs := newMockTTLFuncs()
+	mockFuncs.ttl = ptr.Int32(3600)
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+	now := fakeClock.Now()
+	deleting := metav1.NewTime(now)
+	newResource := func(name string, completedAgo time.Duration, completed bool) *ttlMockResource {
+		return &ttlMockResource{
+			ObjectMeta:      metav1.ObjectMeta{Name: name, Namespace: "default"},
+			completed:       completed,
+			completion_time: &metav1.Time{Time: now.Add(-completedAgo)},
+		}
+	}
+
+	expired := newResource("expired", 2*time.Hour, true)
+	expiresWithinPeriod := newResource("expires-within-period", 55*time.Minute, true)
+	expiresAfterPeriod := newResource("expires-after-period", 30*time.Minute, true)
+	running := newResource("running", 2*time.Hour, false)
+	excluded := newResource("excluded", 2*time.Hour, true)
+	excluded.Annotations = map[string]string{"keep": "true"}
+	beingDeleted := newResource("being-deleted", 2*time.Hour, true)
+	beingDeleted.DeletionTimestamp = &deleting
+	accessed := newResource("accessed", 2*time.Hour, true)
+	accessed.Annotations = map[string]string{AnnotationLastAccessed: now.Add(-30 * time.Minute).Format(time.RFC3339)}
+
+	resources := []metav1.Object{expired, expiresWithinPeriod, expiresAfterPeriod, running, excluded, beingDeleted, accessed}
+
+	tests := []struct {
+		name   string
+		ttl    *int32
+		period time.Duration
+		want   int
+	}{
+		{name: "expired only", ttl: ptr.Int32(3600), period: 0, want: 1},
+		{name: "expiring within the period", ttl: ptr.Int32(3600), period: 10 * time.Minute, want: 2},
+		{name: "longer period", ttl: ptr.Int32(3600), period: 45 * time.Minute, want: 4},
+		{name: "ttl disabled", ttl: ptr.Int32(-1), period: 45 * time.Minute, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFuncs.ttl = tt.ttl
+			if got := handler.EstimateReclaimable(resources, tt.period); got != tt.want {
+				t.Errorf("EstimateReclaimable() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Shard identifies the namespaces processed by a controller replica, when the controller
+// runs with multiple replicas without leader election. A namespace is owned by the shard
+// whose index is equal to the hash of the namespace name modulo the shard count
+type Shard struct {
+	Index int
+	Count int
+}
+
+// shardKey is used as the key for associating the Shard with the context
+type shardKey struct{}
+
+// NewShard creates a Shard, the index should be in the range [0, count)
+func NewShard(index, count int) (Shard, error) {
+	if count < 1 {
+		return Shard{}, fmt.Errorf("shard count must be greater than 0, got %d", count)
+	}
+	if index < 0 || index >= count {
+		return Shard{}, fmt.Errorf("shard index must be in the range [0, %d), got %d", count, index)
+	}
+	return Shard{Index: index, Count: count}, nil
+}
+
+// Owns returns true if the namespace is processed by this shard
+func (s Shard) Owns(namespace string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(namespace))
+	return int(hash.Sum32()%uint32(s.Count)) == s.Index
+}
+
+// Filter can be used as informer FilterFunc, accepts the objects of the namespaces owned by this shard
+func (s Shard) Filter(obj interface{}) bool {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	object, ok := obj.(metav1.Object)
+	if !ok {
+		return false
+	}
+	return s.Owns(object.GetNamespace())
+}
+
+// WithShard attaches the Shard to the context
+func WithShard(ctx context.Context, shard Shard) context.Context {
+	return context.WithValue(ctx, shardKey{}, shard)
+}
+
+// ShardFromContext returns the Shard attached to the context,
+// a single shard which owns all the namespaces is returned if there is none
+func ShardFromContext(ctx context.Context) Shard {
+	if shard, ok := ctx.Value(shardKey{}).(Shard); ok {
+		return shard
+	}
+	return Shard{Index: 0, Count: 1}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestNewShard(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   int
+		count   int
+		wantErr bool
+	}{
+		{name: "single shard", index: 0, count: 1},
+		{name: "last shard", index: 2, count: 3},
+		{name: "zero count", index: 0, count: 0, wantErr: true},
+		{name: "negative index", index: -1, count: 3, wantErr: true},
+		{name: "index out of range", index: 3, count: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewShard(tt.index, tt.count)
+			assert.Equal(t, tt.wantErr, err != nil, "error: %v", err)
+		})
+	}
+}
+
+func TestShardOwnsExactlyOneShard(t *testing.T) {
+	for count := 1; count <= 5; count++ {
+		for n := 0; n < 100; n++ {
+			namespace := fmt.Sprintf("namespace-%d", n)
+			owners := 0
+			for index := 0; index < count; index++ {
+				shard, err := NewShard(index, count)
+				assert.NoError(t, err)
+				if shard.Owns(namespace) {
+					owners++
+				}
+			}
+			assert.Equal(t, 1, owners, "namespace %s with %d shards", namespace, count)
+		}
+	}
+}
+
+func TestShardRedistribution(t *testing.T) {
+	assignments := func(count int) map[string]int {
+		assigned := map[string]int{}
+		for n := 0; n < 100; n++ {
+			namespace := fmt.Sprintf("namespace-%d", n)
+			for index := 0; index < count; index++ {
+				if (Shard{Index: index, Count: count}).Owns(namespace) {
+					assigned[namespace] = index
+				}
+			}
+		}
+		return assigned
+	}
+
+	// the same shard count always results in the same assignment
+	assert.Equal(t, assignments(3), assignments(3))
+
+	// changing the shard count redistributes the namespaces, deterministically
+	assert.NotEqual(t, assignments(3), assignments(4))
+	assert.Equal(t, assignments(4), assignments(4))
+
+	// all the shards get namespaces
+	used := map[int]bool{}
+	for _, index := range assignments(4) {
+		used[index] = true
+	}
+	assert.Len(t, used, 4)
+}
+
+func TestShardFilter(t *testing.T) {
+	shards := []Shard{{Index: 0, Count: 2}, {Index: 1, Count: 2}}
+	object := &metav1.ObjectMeta{Name: "run", Namespace: "dev"}
+	tombstone := cache.DeletedFinalStateUnknown{Key: "dev/run", Obj: object}
+
+	assert.NotEqual(t, shards[0].Filter(object), shards[1].Filter(object))
+	assert.Equal(t, shards[0].Filter(object), shards[0].Filter(tombstone))
+	assert.False(t, shards[0].Filter("not an object"))
+}
+
+func TestShardFromContext(t *testing.T) {
+	assert.Equal(t, Shard{Index: 0, Count: 1}, ShardFromContext(context.Background()))
+
+	shard := Shard{Index: 1, Count: 3}
+	assert.Equal(t, shard, ShardFromContext(WithShard(context.Background(), shard)))
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"time"
+)
+
+// controllerStartTime is the start time of the controller, the startup cutoff of controllerStart
+var controllerStartTime = time.Now()
+
+// parseStartupCutoff returns the time of the startup cutoff value, false when it is not set or invalid
+func parseStartupCutoff(value string) (time.Time, bool) {
+	switch value {
+	case "":
+		return time.Time{}, false
+	case StartupCutoffControllerStart:
+		return controllerStartTime, true
+	}
+	cutoff, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return cutoff, true
+}
+
+// isBeforeStartupCutoff returns true when the resource completed before the startup cutoff, it is then not managed.
+// A resource without a completion time is managed
+func isBeforeStartupCutoff(completedAt time.Time) bool {
+	cutoff, found := PrunerConfigStore.GetStartupCutoff()
+	return found && !completedAt.IsZero() && completedAt.Before(cutoff)
+}
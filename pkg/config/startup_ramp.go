@@ -0,0 +1,147 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	clockUtil "k8s.io/utils/clock"
+	"knative.dev/pkg/logging"
+)
+
+// startupRampSteps is the number of steps the ramp progress is logged on
+const startupRampSteps = 10
+
+// StartupRamp throttles the deletions during the grace period after the controller start,
+// so the backlog of runs piled up while the controller was down is not deleted at once.
+// The allowed deletion rate ramps up linearly from minRate to maxRate over the grace period,
+// there is no throttling once the grace period is over
+type StartupRamp struct {
+	mutex       sync.Mutex
+	clock       clockUtil.Clock
+	start       time.Time
+	gracePeriod time.Duration
+	minRate     float64 // deletions per second at the start
+	maxRate     float64 // deletions per second at the end of the grace period
+	next        time.Time
+	loggedStep  int
+}
+
+// NewStartupRamp creates a StartupRamp which starts now
+func NewStartupRamp(clock clockUtil.Clock, gracePeriod time.Duration, minRate, maxRate float64) *StartupRamp {
+	if clock == nil {
+		clock = clockUtil.RealClock{}
+	}
+	if minRate <= 0 {
+		minRate = DefaultStartupMinDeletionsPerSecond
+	}
+	if maxRate < minRate {
+		maxRate = minRate
+	}
+	return &StartupRamp{
+		clock:       clock,
+		start:       clock.Now(),
+		gracePeriod: gracePeriod,
+		minRate:     minRate,
+		maxRate:     maxRate,
+		loggedStep:  -1,
+	}
+}
+
+var (
+	startupRampOnce sync.Once
+	startupRamp     *StartupRamp
+	startupRampErr  error
+)
+
+// getStartupRamp returns the process wide StartupRamp, shared by all the history limiters and ttl handlers.
+// The ramp starts on the first call and it is disabled when the grace period is not set. The error on parsing
+// the environment is returned on every call
+func getStartupRamp() (*StartupRamp, error) {
+	startupRampOnce.Do(func() {
+		var gracePeriodSeconds, maxRate int
+		gracePeriodSeconds, startupRampErr = GetEnvValueAsInt(EnvStartupGracePeriodSeconds, DefaultStartupGracePeriodSeconds)
+		if startupRampErr != nil {
+			return
+		}
+		maxRate, startupRampErr = GetEnvValueAsInt(EnvStartupMaxDeletionsPerSecond, DefaultStartupMaxDeletionsPerSecond)
+		if startupRampErr != nil {
+			return
+		}
+		if gracePeriodSeconds > 0 {
+			startupRamp = NewStartupRamp(nil, time.Duration(gracePeriodSeconds)*time.Second, DefaultStartupMinDeletionsPerSecond, float64(maxRate))
+		}
+	})
+	return startupRamp, startupRampErr
+}
+
+// Wait blocks until a deletion is allowed by the ramp or the context is done.
+// A nil StartupRamp never blocks
+func (sr *StartupRamp) Wait(ctx context.Context) error {
+	if sr == nil {
+		return nil
+	}
+
+	delay := sr.reserve(ctx)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := sr.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve books the next deletion slot and returns the time to wait for it
+func (sr *StartupRamp) reserve(ctx context.Context) time.Duration {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	now := sr.clock.Now()
+	elapsed := now.Sub(sr.start)
+	if elapsed >= sr.gracePeriod {
+		if sr.loggedStep < startupRampSteps {
+			sr.loggedStep = startupRampSteps
+			logging.FromContext(ctx).Infow("startup deletion ramp completed, deletions are not throttled anymore",
+				"gracePeriod", sr.gracePeriod)
+		}
+		return 0
+	}
+
+	progress := float64(elapsed) / float64(sr.gracePeriod)
+	currentRate := sr.minRate + (sr.maxRate-sr.minRate)*progress
+
+	if step := int(progress * startupRampSteps); step > sr.loggedStep {
+		sr.loggedStep = step
+		logging.FromContext(ctx).Infow("startup deletion ramp in progress",
+			"elapsed", elapsed.Round(time.Second), "gracePeriod", sr.gracePeriod, "deletionsPerSecond", currentRate)
+	}
+
+	if sr.next.Before(now) {
+		sr.next = now
+	}
+	delay := sr.next.Sub(now)
+	sr.next = sr.next.Add(time.Duration(float64(time.Second) / currentRate))
+	return delay
+}
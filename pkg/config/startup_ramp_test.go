@@ -0,0 +1,90 @@
+package config
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clocktest "k8s.io/utils/clock/testing"
+)
+
+func TestStartupRampBacklog(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	gracePeriod := 100 * time.Second
+	ramp := NewStartupRamp(fakeClock, gracePeriod, 1, 10)
+	ctx := context.Background()
+
+	// simulate a backlog of deletions, each deletion waits for its slot
+	deletionsPerWindow := make([]int, 10)
+	deletions := 0
+	for fakeClock.Since(ramp.start) < gracePeriod {
+		fakeClock.Step(ramp.reserve(ctx))
+		elapsed := fakeClock.Since(ramp.start)
+		if elapsed >= gracePeriod {
+			break
+		}
+		deletionsPerWindow[int(elapsed*10/gracePeriod)]++
+		deletions++
+	}
+
+	// the deletion rate ramps up from 1/s to 10/s over the grace period
+	assert.InDelta(t, 14, deletionsPerWindow[0], 2)
+	assert.InDelta(t, 95, deletionsPerWindow[9], 2)
+	for index := 1; index < len(deletionsPerWindow); index++ {
+		assert.GreaterOrEqual(t, deletionsPerWindow[index], deletionsPerWindow[index-1])
+	}
+	assert.Less(t, deletions, 600)
+
+	// no throttling after the grace period
+	for index := 0; index < 1000; index++ {
+		assert.Equal(t, time.Duration(0), ramp.reserve(ctx))
+	}
+}
+
+func TestStartupRampBurstAtStart(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	ramp := NewStartupRamp(fakeClock, time.Minute, 2, 20)
+
+	// a burst of deletions at the start is spread at the initial rate
+	for index := 0; index < 5; index++ {
+		assert.Equal(t, time.Duration(index)*500*time.Millisecond, ramp.reserve(context.Background()))
+	}
+}
+
+func TestStartupRampWait(t *testing.T) {
+	var nilRamp *StartupRamp
+	assert.NoError(t, nilRamp.Wait(context.Background()))
+
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	ramp := NewStartupRamp(fakeClock, time.Minute, 1, 1)
+	assert.NoError(t, ramp.Wait(context.Background()))
+
+	// the second deletion waits a second
+	done := make(chan error)
+	go func() { done <- ramp.Wait(context.Background()) }()
+	for !fakeClock.HasWaiters() {
+		time.Sleep(time.Millisecond)
+	}
+	fakeClock.Step(time.Second)
+	assert.NoError(t, <-done)
+
+	// the wait is interrupted when the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, ramp.Wait(ctx), context.Canceled)
+}
+
+func TestGetStartupRampError(t *testing.T) {
+	t.Setenv(EnvStartupGracePeriodSeconds, "soon")
+	startupRampOnce = sync.Once{}
+	t.Cleanup(func() { startupRampOnce = sync.Once{}; startupRamp = nil; startupRampErr = nil })
+
+	// the parse error is returned to every caller, not only to the first one
+	for i := 0; i < 2; i++ {
+		ramp, err := getStartupRamp()
+		assert.Error(t, err)
+		assert.Nil(t, ramp)
+	}
+}
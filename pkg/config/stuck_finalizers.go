@@ -0,0 +1,139 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/logging"
+)
+
+// StuckFinalizerRemover removes the finalizers of the runs stuck in deletion. Removing a finalizer skips the
+// cleanup its owner was expected to do, only the listed finalizers are removed and only after the timeout
+type StuckFinalizerRemover struct {
+	finalizers map[string]bool
+	timeout    time.Duration
+}
+
+// NewStuckFinalizerRemover creates a StuckFinalizerRemover which removes the given finalizers once a run is in
+// deletion for longer than the timeout. nil is returned when there is no finalizer, nothing is removed then
+func NewStuckFinalizerRemover(finalizers []string, timeout time.Duration) *StuckFinalizerRemover {
+	remover := &StuckFinalizerRemover{finalizers: map[string]bool{}, timeout: timeout}
+	for _, finalizer := range finalizers {
+		if finalizer = strings.TrimSpace(finalizer); finalizer != "" {
+			remover.finalizers[finalizer] = true
+		}
+	}
+	if len(remover.finalizers) == 0 {
+		return nil
+	}
+	return remover
+}
+
+// getStuckFinalizerRemover returns the StuckFinalizerRemover configured on the environment,
+// nil when the finalizers are not set. A timeout below the minimum is rejected
+func getStuckFinalizerRemover() (*StuckFinalizerRemover, error) {
+	finalizers := os.Getenv(EnvStuckFinalizers)
+	if strings.TrimSpace(finalizers) == "" {
+		return nil, nil
+	}
+	timeoutSeconds, err := GetEnvValueAsInt(EnvStuckFinalizerTimeoutSeconds, DefaultStuckFinalizerTimeoutSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if timeoutSeconds < MinStuckFinalizerTimeoutSeconds {
+		return nil, fmt.Errorf("%s must be at least %d seconds, got %d", EnvStuckFinalizerTimeoutSeconds, MinStuckFinalizerTimeoutSeconds, timeoutSeconds)
+	}
+	return NewStuckFinalizerRemover(strings.Split(finalizers, ","), time.Duration(timeoutSeconds)*time.Second), nil
+}
+
+// removable splits the finalizers of the resource into the ones to remove and the ones to keep,
+// nothing is removed while the resource is in deletion for less than the timeout
+func (sfr *StuckFinalizerRemover) removable(resource metav1.Object, now time.Time) (remove, keep []string) {
+	deletionTimestamp := resource.GetDeletionTimestamp()
+	if sfr == nil || deletionTimestamp == nil || now.Sub(deletionTimestamp.Time) < sfr.timeout {
+		return nil, resource.GetFinalizers()
+	}
+	keep = []string{}
+	for _, finalizer := range resource.GetFinalizers() {
+		if sfr.finalizers[finalizer] {
+			remove = append(remove, finalizer)
+		} else {
+			keep = append(keep, finalizer)
+		}
+	}
+	return remove, keep
+}
+
+// removeStuckFinalizers removes the listed finalizers of the resource stuck in deletion, so that the deletion completes.
+// The other finalizers are kept, the patch fails when the resource is modified since it was read
+func (th *TTLHandler) removeStuckFinalizers(ctx context.Context, resource metav1.Object) error {
+	logger := logging.FromContext(ctx)
+
+	remove, keep := th.stuckFinalizerRemover.removable(resource, th.clock.Now())
+	if len(remove) == 0 {
+		if th.stuckFinalizerRemover != nil && len(keep) > 0 {
+			logger.Debugw("resource in deletion has no finalizer to remove",
+				"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+				"finalizers", keep, "deletionTimestamp", resource.GetDeletionTimestamp())
+		}
+		return nil
+	}
+
+	logger.Warnw("removing finalizers of a resource stuck in deletion, the cleanup of their owners is skipped",
+		"resource", th.resourceFn.Type(),
+		"namespace", resource.GetNamespace(),
+		"name", resource.GetName(),
+		"uid", resource.GetUID(),
+		"deletionTimestamp", resource.GetDeletionTimestamp(),
+		"timeout", th.stuckFinalizerRemover.timeout,
+		"removedFinalizers", remove,
+		"keptFinalizers", keep,
+	)
+
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      keep,
+			"resourceVersion": resource.GetResourceVersion(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal patch data: %w", err)
+	}
+	if err := th.resourceFn.Patch(ctx, resource.GetNamespace(), resource.GetName(), patchBytes); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		logger.Errorw("error removing finalizers of a resource stuck in deletion",
+			"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+			"removedFinalizers", remove, zap.Error(err))
+		return fmt.Errorf("failed to remove the finalizers %v: %w", remove, err)
+	}
+
+	logger.Warnw("removed finalizers of a resource stuck in deletion",
+		"resource", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+		"removedFinalizers", remove)
+	return nil
+}
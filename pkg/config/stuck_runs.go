@@ -0,0 +1,94 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+)
+
+// handleStuckResource flags the resource not completed maxRunningAgeSeconds after its start as stuck,
+// and deletes it when deleteStuckRuns is set. The resource younger than the max running age is
+// requeued to be checked again once it reaches the age, a stuck run gets no further events
+func (th *TTLHandler) handleStuckResource(ctx context.Context, resource metav1.Object) error {
+	maxRunningAge, deleteStuck := PrunerConfigStore.GetMaxRunningAge()
+	if maxRunningAge == nil || th.resourceFn.IsCompleted(resource) {
+		return nil
+	}
+
+	// the runs which are not started yet, for example the pending runs, are aged from their creation
+	startTime := resource.GetCreationTimestamp()
+	if start := th.resourceFn.GetStartTime(resource); start != nil {
+		startTime = *start
+	}
+	if startTime.IsZero() {
+		return nil
+	}
+
+	stuckAt := startTime.Add(time.Duration(*maxRunningAge) * time.Second)
+	if remaining := stuckAt.Sub(th.clock.Now()); remaining > 0 {
+		return controller.NewRequeueAfter(remaining)
+	}
+
+	if err := th.flagStuckResource(ctx, resource); err != nil {
+		return err
+	}
+	if !deleteStuck {
+		return nil
+	}
+	return th.deleteRegardlessOfTTL(ctx, resource, metrics.StatusStuck, "stuck_deletion_failed")
+}
+
+// flagStuckResource annotates the stuck resource and records it on the metrics, once for each resource
+func (th *TTLHandler) flagStuckResource(ctx context.Context, resource metav1.Object) error {
+	if resource.GetAnnotations()[AnnotationStuckSince] != "" {
+		return nil
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Warnw("resource is running for longer than the max running age, flagging it as stuck",
+		"resourceType", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				AnnotationStuckSince: th.clock.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the stuck annotation patch: %w", err)
+	}
+	if err := th.resourceFn.Patch(ctx, resource.GetNamespace(), resource.GetName(), patchBytes); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to flag the stuck resource: %w", err)
+	}
+
+	metrics.GetRecorder().RecordStuckRun(ctx, th.metricsResourceType(), resource.GetNamespace())
+	return nil
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+)
+
+// sweepRequeueAfter is the time a run of a sweep is requeued after, when its namespace is not admitted yet
+const sweepRequeueAfter = time.Second
+
+// SweepLimiter bounds the number of namespaces processed at the same time during a sweep of all the runs,
+// on a config change or on the admin endpoint. It is shared by all the reconcilers, the runs of the other
+// namespaces are requeued until the runs enqueued by the sweep of an admitted namespace are drained
+type SweepLimiter struct {
+	mutex        sync.Mutex
+	limit        int
+	requeueAfter time.Duration
+	// admitted holds the namespaces being swept
+	admitted map[string]bool
+	// active counts the runs being processed of each admitted namespace
+	active map[string]int
+	// pending holds the runs enqueued by the sweep and not processed yet, keyed by namespace
+	pending map[string]map[string]bool
+}
+
+// NewSweepLimiter creates a SweepLimiter which allows up to limit namespaces to be swept concurrently,
+// nil is returned when the limit is not positive, there is no limit then
+func NewSweepLimiter(limit int, requeueAfter time.Duration) *SweepLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &SweepLimiter{
+		limit:        limit,
+		requeueAfter: requeueAfter,
+		admitted:     map[string]bool{},
+		active:       map[string]int{},
+		pending:      map[string]map[string]bool{},
+	}
+}
+
+var (
+	sweepLimiterOnce sync.Once
+	sweepLimiter     *SweepLimiter
+	sweepLimiterErr  error
+)
+
+// GetSweepLimiter returns the process wide SweepLimiter, shared by the PipelineRun and TaskRun reconcilers.
+// The sweeps are not limited when the limit is not set
+func GetSweepLimiter() (*SweepLimiter, error) {
+	sweepLimiterOnce.Do(func() {
+		var limit int
+		limit, sweepLimiterErr = GetEnvValueAsInt(EnvSweepConcurrentNamespaces, DefaultSweepConcurrentNamespaces)
+		if sweepLimiterErr != nil {
+			return
+		}
+		sweepLimiter = NewSweepLimiter(limit, sweepRequeueAfter)
+	})
+	return sweepLimiter, sweepLimiterErr
+}
+
+// MarkPending records a run enqueued by the sweep, its namespace is kept admitted until the run is processed
+// or forgotten. A nil SweepLimiter ignores the runs
+func (sl *SweepLimiter) MarkPending(obj interface{}) {
+	resource, ok := sweepResource(obj)
+	if sl == nil || !ok {
+		return
+	}
+	namespace := resource.GetNamespace()
+
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+	if sl.pending[namespace] == nil {
+		sl.pending[namespace] = map[string]bool{}
+	}
+	sl.pending[namespace][sweepKey(resource)] = true
+}
+
+// Forget drops a pending run which is not processed, a deleted run is not reconciled.
+// The namespace is released once it has no other runs pending or being processed
+func (sl *SweepLimiter) Forget(obj interface{}) {
+	resource, ok := sweepResource(obj)
+	if sl == nil || !ok {
+		return
+	}
+
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+	sl.drop(resource.GetNamespace(), sweepKey(resource))
+}
+
+// Acquire admits the namespace of the run to the sweep, the returned func releases the run once it is processed.
+// The runs of an admitted namespace are processed concurrently, a requeue error is returned for a run of
+// another namespace when the limit of namespaces is reached. A nil SweepLimiter admits all the runs
+func (sl *SweepLimiter) Acquire(ctx context.Context, resource metav1.Object) (func(), error) {
+	if sl == nil {
+		return func() {}, nil
+	}
+	namespace := resource.GetNamespace()
+
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+	if !sl.admitted[namespace] && len(sl.admitted) >= sl.limit {
+		logging.FromContext(ctx).Debugw("the limit of namespaces swept concurrently is reached, requeuing the resource",
+			"namespace", namespace, "name", resource.GetName(), "limit", sl.limit, "requeueAfter", sl.requeueAfter)
+		return nil, controller.NewRequeueAfter(sl.requeueAfter)
+	}
+	sl.admitted[namespace] = true
+	sl.active[namespace]++
+
+	key := sweepKey(resource)
+	var once sync.Once
+	return func() {
+		once.Do(func() { sl.release(namespace, key) })
+	}, nil
+}
+
+// release completes a run being processed
+func (sl *SweepLimiter) release(namespace, key string) {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+	sl.active[namespace]--
+	if sl.active[namespace] <= 0 {
+		delete(sl.active, namespace)
+	}
+	sl.drop(namespace, key)
+}
+
+// drop removes the run from the pending runs and frees the namespace once it has no runs pending
+// or being processed, the mutex must be held
+func (sl *SweepLimiter) drop(namespace, key string) {
+	delete(sl.pending[namespace], key)
+	if len(sl.pending[namespace]) > 0 {
+		return
+	}
+	delete(sl.pending, namespace)
+	if sl.active[namespace] == 0 {
+		delete(sl.admitted, namespace)
+	}
+}
+
+// sweepResource returns the run, or the run of a tombstone
+func sweepResource(obj interface{}) (metav1.Object, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	resource, ok := obj.(metav1.Object)
+	return resource, ok
+}
+
+// sweepKey identifies a run within its namespace, the PipelineRuns and the TaskRuns share the limiter
+func sweepKey(resource metav1.Object) string {
+	if uid := resource.GetUID(); uid != "" {
+		return string(uid)
+	}
+	return resource.GetName()
+}
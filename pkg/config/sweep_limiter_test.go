@@ -0,0 +1,218 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/controller"
+)
+
+func TestSweepLimiter(t *testing.T) {
+	ctx := context.Background()
+	run := func(namespace, name string) metav1.Object {
+		return &mockResource{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+
+	// a nil limiter admits all the runs
+	var limiter *SweepLimiter
+	release, err := limiter.Acquire(ctx, run("ns-1", "run"))
+	assert.NoError(t, err)
+	release()
+	assert.Nil(t, NewSweepLimiter(0, time.Second))
+
+	limiter = NewSweepLimiter(2, 3*time.Second)
+	release1, err := limiter.Acquire(ctx, run("ns-1", "run-1"))
+	assert.NoError(t, err)
+	release2, err := limiter.Acquire(ctx, run("ns-2", "run-1"))
+	assert.NoError(t, err)
+
+	// the runs of an admitted namespace are processed concurrently
+	release3, err := limiter.Acquire(ctx, run("ns-1", "run-2"))
+	assert.NoError(t, err)
+
+	// the runs of a third namespace are requeued
+	_, err = limiter.Acquire(ctx, run("ns-3", "run-1"))
+	ok, delay := controller.IsRequeueKey(err)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+
+	// the namespace is released once its last run is processed, a release is counted once
+	release1()
+	release1()
+	_, err = limiter.Acquire(ctx, run("ns-3", "run-1"))
+	ok, _ = controller.IsRequeueKey(err)
+	assert.True(t, ok)
+	release3()
+	_, err = limiter.Acquire(ctx, run("ns-3", "run-1"))
+	assert.NoError(t, err)
+	release2()
+}
+
+func TestSweepLimiterConcurrency(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewSweepLimiter(2, time.Millisecond)
+
+	var mutex sync.Mutex
+	active := map[string]int{}
+	maxActive := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func(namespace, name string) {
+				defer wg.Done()
+				resource := &mockResource{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+				// a requeued run is retried, as the workqueue does
+				for {
+					release, err := limiter.Acquire(ctx, resource)
+					if err != nil {
+						time.Sleep(time.Millisecond)
+						continue
+					}
+					mutex.Lock()
+					active[namespace]++
+					maxActive = max(maxActive, len(active))
+					mutex.Unlock()
+
+					time.Sleep(2 * time.Millisecond)
+
+					mutex.Lock()
+					active[namespace]--
+					if active[namespace] == 0 {
+						delete(active, namespace)
+					}
+					mutex.Unlock()
+					release()
+					return
+				}
+			}(fmt.Sprintf("ns-%d", i), fmt.Sprintf("run-%d", j))
+		}
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, maxActive, 2, "namespaces swept concurrently")
+	assert.Empty(t, limiter.active)
+	assert.Empty(t, limiter.admitted)
+}
+
+func TestSweepLimiterPendingRuns(t *testing.T) {
+	ctx := context.Background()
+	run := func(namespace, name string) metav1.Object {
+		return &mockResource{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+	limiter := NewSweepLimiter(1, time.Second)
+	limiter.MarkPending(run("ns-1", "run-1"))
+	limiter.MarkPending(run("ns-1", "run-2"))
+	limiter.MarkPending(run("ns-2", "run-1"))
+
+	// the namespace is kept admitted between its runs while runs of the sweep are pending
+	release, err := limiter.Acquire(ctx, run("ns-1", "run-1"))
+	assert.NoError(t, err)
+	release()
+	_, err = limiter.Acquire(ctx, run("ns-2", "run-1"))
+	ok, _ := controller.IsRequeueKey(err)
+	assert.True(t, ok)
+
+	// a deleted pending run releases the namespace as well, a tombstone is unwrapped
+	limiter.Forget(cache.DeletedFinalStateUnknown{Key: "ns-1/run-2", Obj: run("ns-1", "run-2")})
+	release, err = limiter.Acquire(ctx, run("ns-2", "run-1"))
+	assert.NoError(t, err)
+	release()
+	assert.Empty(t, limiter.admitted)
+	assert.Empty(t, limiter.pending)
+
+	// a nil limiter ignores the runs
+	var nilLimiter *SweepLimiter
+	nilLimiter.MarkPending(run("ns-1", "run-1"))
+	nilLimiter.Forget(run("ns-1", "run-1"))
+}
+
+func TestSweepLimiterBatches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const namespaces, runsPerNamespace, workers = 3, 4, 2
+	limiter := NewSweepLimiter(1, time.Millisecond)
+
+	// the runs of the namespaces are interleaved on the queue, as a sweep of the informer store enqueues them
+	queue := make(chan metav1.Object, namespaces*runsPerNamespace)
+	for j := 0; j < runsPerNamespace; j++ {
+		for i := 0; i < namespaces; i++ {
+			resource := &mockResource{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("run-%d", j), Namespace: fmt.Sprintf("ns-%d", i)}}
+			limiter.MarkPending(resource)
+			queue <- resource
+		}
+	}
+
+	var mutex sync.Mutex
+	processed := []string{}
+	var wg sync.WaitGroup
+	wg.Add(namespaces * runsPerNamespace)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case resource := <-queue:
+					release, err := limiter.Acquire(ctx, resource)
+					if err != nil {
+						// a requeued run goes back to the end of the queue
+						queue <- resource
+						continue
+					}
+					mutex.Lock()
+					processed = append(processed, resource.GetNamespace())
+					mutex.Unlock()
+					time.Sleep(time.Millisecond)
+					release()
+					wg.Done()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// each namespace is processed as one batch, after the previous namespace is drained
+	seen := map[string]bool{}
+	for index, namespace := range processed {
+		if index > 0 && processed[index-1] != namespace {
+			assert.False(t, seen[namespace], "namespace %s is processed again after another namespace: %v", namespace, processed)
+		}
+		seen[namespace] = true
+	}
+	assert.Len(t, seen, namespaces)
+	assert.Empty(t, limiter.admitted)
+}
+
+func TestGetSweepLimiter(t *testing.T) {
+	t.Setenv(EnvSweepConcurrentNamespaces, "2")
+	sweepLimiterOnce = sync.Once{}
+	t.Cleanup(func() { sweepLimiterOnce = sync.Once{}; sweepLimiter = nil; sweepLimiterErr = nil })
+
+	limiter, err := GetSweepLimiter()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, limiter.limit)
+}
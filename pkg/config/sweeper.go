@@ -0,0 +1,63 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Sweeper enqueues the completed runs of a kind for a re-evaluation, it returns the number of the enqueued runs
+type Sweeper func() int
+
+var (
+	sweepers      []Sweeper
+	sweepersMutex sync.Mutex
+)
+
+// RegisterSweeper registers a sweeper of the runs of a kind, called by the controllers on the start
+func RegisterSweeper(sweeper Sweeper) {
+	sweepersMutex.Lock()
+	defer sweepersMutex.Unlock()
+	sweepers = append(sweepers, sweeper)
+}
+
+// SweepAll enqueues the completed runs of all the kinds, it returns the number of the enqueued runs
+func SweepAll() int {
+	sweepersMutex.Lock()
+	defer sweepersMutex.Unlock()
+	count := 0
+	for _, sweeper := range sweepers {
+		count += sweeper()
+	}
+	return count
+}
+
+// EnqueueCompleted enqueues the completed runs of the objects accepted by the filter, it returns the number of the enqueued runs
+func EnqueueCompleted(objects []interface{}, filter func(obj interface{}) bool, isCompleted func(resource metav1.Object) bool, enqueue func(obj interface{})) int {
+	count := 0
+	for _, obj := range objects {
+		resource, ok := obj.(metav1.Object)
+		if !ok || !filter(obj) || !isCompleted(resource) {
+			continue
+		}
+		enqueue(obj)
+		count++
+	}
+	return count
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/contrib/bridges/otelzap"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"knative.dev/pkg/logging"
+)
+
+const (
+	// tracerName is the instrumentation name of the spans of the pruner
+	tracerName = "github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+
+	// the span events of the deletion decisions of the TTL path
+	EventTTLNotExpired = "ttl_not_expired"
+	EventTTLExpired    = "ttl_expired"
+	EventDeleted       = "deleted"
+
+	// the fields of the trace and span IDs on the logs correlated with the traces
+	logFieldTraceID = "trace_id"
+	logFieldSpanID  = "span_id"
+
+	// logFieldContext is the field of the span context on the logs bridged to the OTel log records, the bridge
+	// emits the records with it and does not add it as an attribute
+	logFieldContext = "context"
+)
+
+// SetupLoggerProvider sets the global OTel logger provider the logs correlated with the traces are bridged to, it
+// exports the log records over OTLP/HTTP to the endpoint of the standard OpenTelemetry environment variables. The
+// provider is not set when no endpoint is set, and it is shut down, flushing the pending records, with the context
+func SetupLoggerProvider(ctx context.Context) error {
+	if os.Getenv(EnvOTLPLogsEndpoint) == "" && os.Getenv(EnvOTLPEndpoint) == "" {
+		return nil
+	}
+	exporter, err := otlploghttp.New(ctx)
+	if err != nil {
+		return err
+	}
+	provider := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)))
+	global.SetLoggerProvider(provider)
+	go func() {
+		<-ctx.Done()
+		if err := provider.Shutdown(context.Background()); err != nil {
+			logging.FromContext(ctx).Errorw("failed to shut down the logger provider", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// startSpan starts a span on the global tracer provider, it is a no-op span when no provider is set
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+	return withTraceLogger(ctx, span.SpanContext()), span
+}
+
+// withTraceLogger returns the context whose logger carries the trace and span IDs of the span context, for the
+// logs to be correlated with the traces. Its logs are also bridged to the OTel log records of the global logger
+// provider, emitted with the span context, at the level of the logger. The context is returned as is when the
+// span context is not valid or the traceLogCorrelation feature flag is off
+func withTraceLogger(ctx context.Context, spanContext trace.SpanContext) context.Context {
+	if !spanContext.IsValid() || !PrunerConfigStore.IsFeatureEnabled(FeatureTraceLogCorrelation) {
+		return ctx
+	}
+	spanCtx := trace.ContextWithSpanContext(context.Background(), spanContext)
+	logger := logging.FromContext(ctx).Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		bridge := otelzap.NewCore(tracerName).With([]zapcore.Field{zap.Any(logFieldContext, spanCtx)})
+		if leveled, err := zapcore.NewIncreaseLevelCore(bridge, zapcore.LevelOf(core)); err == nil {
+			bridge = leveled
+		}
+		return zapcore.NewTee(core, bridge)
+	}))
+	logger = logger.With(
+		zap.String(logFieldTraceID, spanContext.TraceID().String()),
+		zap.String(logFieldSpanID, spanContext.SpanID().String()))
+	return logging.WithLogger(ctx, logger.Sugar())
+}
+
+// addSpanEvent adds an event to the span of the context
+func addSpanEvent(ctx context.Context, name string, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).AddEvent(name, trace.WithAttributes(attrs...))
+}
@@ -20,16 +20,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"strconv"
 	"time"
 
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	clockUtil "k8s.io/utils/clock"
 	controller "knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
+	"knative.dev/pkg/ptr"
 )
 
 const (
@@ -46,13 +55,20 @@ const (
 type TTLResourceFuncs interface {
 	Type() string
 	Get(ctx context.Context, namespace, name string) (metav1.Object, error)
+	List(ctx context.Context, namespace, label string) ([]metav1.Object, error)
 	Delete(ctx context.Context, namespace, name string) error
 	Patch(ctx context.Context, namespace, name string, patchBytes []byte) error
 	Update(ctx context.Context, resource metav1.Object) error
 	IsCompleted(resource metav1.Object) bool
+	GetCompletionStatus(resource metav1.Object) string
+	IsParentDeleting(ctx context.Context, resource metav1.Object) bool
 	GetCompletionTime(resource metav1.Object) (metav1.Time, error)
+	GetStartTime(resource metav1.Object) *metav1.Time
 	Ignore(resource metav1.Object) bool
 	GetTTLSecondsAfterFinished(namespace, name string, selectors SelectorSpec) (*int32, string)
+	GetTTLSecondsAfterFinishedWithoutResults(namespace, name string, selectors SelectorSpec) (*int32, string)
+	GetTTLJitterSeconds(namespace, name string, selectors SelectorSpec) (*int32, string)
+	HasResults(resource metav1.Object) bool
 	GetDefaultLabelKey() string
 	GetEnforcedConfigLevel(namespace, name string, selectors SelectorSpec) EnforcedConfigLevel
 }
@@ -61,6 +77,30 @@ type TTLResourceFuncs interface {
 type TTLHandler struct {
 	clock      clockUtil.Clock // the clock for tracking time
 	resourceFn TTLResourceFuncs
+	// startupRamp throttles the deletions after the controller start, nil when disabled
+	startupRamp *StartupRamp
+	// deletionLimiter bounds the concurrent deletions of all the reconcilers, nil when disabled
+	deletionLimiter *DeletionLimiter
+	// namespaceGetter fetches the namespace of the resources, nil disables the decommission detection
+	namespaceGetter NamespaceGetter
+	// deletionBackend deletes the expired resources
+	deletionBackend DeletionBackend
+	// stuckFinalizerRemover removes the finalizers of the resources stuck in deletion, nil when disabled
+	stuckFinalizerRemover *StuckFinalizerRemover
+}
+
+// latestOfOutcomeRequeueAfter is the time an expired resource kept as the latest of its outcome is checked again after
+const latestOfOutcomeRequeueAfter = time.Minute
+
+// NamespaceGetter returns the namespace with the given name
+type NamespaceGetter func(ctx context.Context, name string) (*corev1.Namespace, error)
+
+// NewNamespaceGetter returns a NamespaceGetter which looks up the namespaces on the cache of the given informer
+func NewNamespaceGetter(informer cache.SharedIndexInformer) NamespaceGetter {
+	lister := corev1listers.NewNamespaceLister(informer.GetIndexer())
+	return func(_ context.Context, name string) (*corev1.Namespace, error) {
+		return lister.Get(name)
+	}
 }
 
 // NewTTLHandler creates a new instance of TTLHandler, which is responsible for managing
@@ -74,21 +114,82 @@ func NewTTLHandler(clock clockUtil.Clock, resourceFn TTLResourceFuncs) (*TTLHand
 	if tq.resourceFn == nil {
 		return nil, fmt.Errorf("resourceFunc interface can not be nil")
 	}
+	tq.deletionBackend = withDeletionVerifier(newResourceFuncsDeletionBackend(resourceFn.Delete), resourceFn)
 
 	if tq.clock == nil {
 		tq.clock = clockUtil.RealClock{}
 	}
 
+	startupRamp, err := getStartupRamp()
+	if err != nil {
+		return nil, err
+	}
+	tq.startupRamp = startupRamp
+
+	deletionLimiter, err := getDeletionLimiter()
+	if err != nil {
+		return nil, err
+	}
+	tq.deletionLimiter = deletionLimiter
+
+	stuckFinalizerRemover, err := getStuckFinalizerRemover()
+	if err != nil {
+		return nil, err
+	}
+	tq.stuckFinalizerRemover = stuckFinalizerRemover
+
 	return tq, nil
 }
 
+// SetNamespaceGetter enables the decommission detection, the completed resources of a namespace
+// being decommissioned are deleted without waiting for the TTL
+func (th *TTLHandler) SetNamespaceGetter(namespaceGetter NamespaceGetter) {
+	th.namespaceGetter = namespaceGetter
+}
+
+// SetDeletionBackend replaces the backend which deletes the expired resources, the resources
+// are deleted from the cluster with the resource funcs when it is nil
+func (th *TTLHandler) SetDeletionBackend(backend DeletionBackend) {
+	if backend == nil {
+		backend = newResourceFuncsDeletionBackend(th.resourceFn.Delete)
+	}
+	th.deletionBackend = withDeletionVerifier(backend, th.resourceFn)
+}
+
+// IsNamespaceDecommissioned returns true when the namespace is terminating
+// or it is labeled for decommission
+func IsNamespaceDecommissioned(namespace *corev1.Namespace) bool {
+	if namespace == nil {
+		return false
+	}
+	return namespace.DeletionTimestamp != nil ||
+		namespace.Status.Phase == corev1.NamespaceTerminating ||
+		namespace.Labels[LabelNamespaceDecommission] == "true"
+}
+
+// isNamespaceDecommissioned looks up the namespace of the resource, a namespace which
+// can not be fetched is not considered as decommissioned
+func (th *TTLHandler) isNamespaceDecommissioned(ctx context.Context, name string) bool {
+	if th.namespaceGetter == nil {
+		return false
+	}
+	namespace, err := th.namespaceGetter(ctx, name)
+	if err != nil {
+		logging.FromContext(ctx).Debugw("unable to get the namespace, decommission state is not known",
+			"namespace", name, zap.Error(err))
+		return false
+	}
+	return IsNamespaceDecommissioned(namespace)
+}
+
 // ProcessEvent handles an event for a resource by processing its TTL-based actions.
 // It evaluates the resource's state, checks whether it should be cleaned up,
 // and updates the TTL annotation if needed
 func (th *TTLHandler) ProcessEvent(ctx context.Context, resource metav1.Object) error {
-	// if a resource is in deletion state, no further action needed
+	// if a resource is in deletion state, no further action needed, unless it is stuck on its finalizers
 	if resource.GetDeletionTimestamp() != nil {
-		return nil
+		metrics.GetRecorder().ClearDeletionDeferred(ctx, resource.GetUID(), th.metricsResourceType(), resource.GetNamespace())
+		return th.removeStuckFinalizers(ctx, resource)
 	}
 
 	// if a resource is not completed state, no further action needed
@@ -96,18 +197,32 @@ func (th *TTLHandler) ProcessEvent(ctx context.Context, resource metav1.Object)
 		return nil
 	}
 
+	// the resource is excluded from pruning, unless it is older than the backstop of the excluded runs
+	if PrunerConfigStore.IsExcluded(resource.GetAnnotations()) {
+		return th.removeExcludedResource(ctx, resource)
+	}
+
+	// the resources completed before the startup cutoff are not managed
+	if th.resourceFn.IsCompleted(resource) {
+		if completionTime, err := th.resourceFn.GetCompletionTime(resource); err == nil && isBeforeStartupCutoff(completionTime.Time) {
+			return nil
+		}
+	}
+
 	// update ttl annotation, if not present
 	err := th.updateAnnotationTTLSeconds(ctx, resource)
 	if err != nil {
 		return err
 	}
 
-	// if the resource is not available for cleanup, no further action needed
-	if !th.needsCleanup(resource) {
-		return nil
+	// if the resource is not available for cleanup, no further action needed.
+	// The resources of a namespace being decommissioned are cleaned up regardless of the TTL
+	decommissioned := th.isNamespaceDecommissioned(ctx, resource.GetNamespace())
+	if !th.needsCleanup(resource) && !decommissioned {
+		return th.handleStuckResource(ctx, resource)
 	}
 
-	return th.removeResource(ctx, resource)
+	return th.removeResource(ctx, resource, decommissioned)
 }
 
 // updateAnnotationTTLSeconds updates the TTL annotation of a resource if needed
@@ -133,7 +248,7 @@ func (th *TTLHandler) updateAnnotationTTLSeconds(ctx context.Context, resource m
 	}
 
 	// Get TTL value
-	ttl, identifiedBy := th.resourceFn.GetTTLSecondsAfterFinished(resource.GetNamespace(), resourceName, resourceSelectors)
+	ttl, identifiedBy := th.getTTLSecondsAfterFinished(resource, resourceName, resourceSelectors)
 	logger.Debugw("TTL configuration found",
 		"ttl", ttl,
 		"source", identifiedBy,
@@ -150,16 +265,14 @@ func (th *TTLHandler) updateAnnotationTTLSeconds(ctx context.Context, resource m
 		return fmt.Errorf("failed to get resource: %w", err)
 	}
 
-	// Update annotations
+	// Update annotations, a nil value removes the annotation on the merge patch
 	annotations := resourceLatest.GetAnnotations()
-	if annotations == nil {
-		annotations = make(map[string]string)
-	}
+	annotationsPatch := map[string]interface{}{}
 
 	if ttl == nil {
 		// If TTL is nil, remove the annotation if it exists
 		if _, exists := annotations[AnnotationTTLSecondsAfterFinished]; exists {
-			delete(annotations, AnnotationTTLSecondsAfterFinished)
+			annotationsPatch[AnnotationTTLSecondsAfterFinished] = nil
 			logger.Debugw("removing TTL annotation - no TTL configuration found",
 				"resource", th.resourceFn.Type(),
 				"namespace", resource.GetNamespace(),
@@ -170,7 +283,7 @@ func (th *TTLHandler) updateAnnotationTTLSeconds(ctx context.Context, resource m
 		newTTL := strconv.Itoa(int(*ttl))
 		currentTTL, hasCurrentTTL := annotations[AnnotationTTLSecondsAfterFinished]
 		if !hasCurrentTTL || currentTTL != newTTL {
-			annotations[AnnotationTTLSecondsAfterFinished] = newTTL
+			annotationsPatch[AnnotationTTLSecondsAfterFinished] = newTTL
 			logger.Debugw("updating TTL annotation",
 				"resource", th.resourceFn.Type(),
 				"namespace", resource.GetNamespace(),
@@ -178,15 +291,30 @@ func (th *TTLHandler) updateAnnotationTTLSeconds(ctx context.Context, resource m
 				"oldTTL", currentTTL,
 				"newTTL", newTTL,
 				"hadPreviousTTL", hasCurrentTTL)
-		} else {
-			return nil
 		}
 	}
 
+	// keep the deletion deadline in sync with the ttl
+	currentDeleteAfter, hasCurrentDeleteAfter := annotations[AnnotationDeleteAfter]
+	newDeleteAfter := th.getDeleteAfter(resourceLatest, ttl)
+	if newDeleteAfter == "" && hasCurrentDeleteAfter {
+		annotationsPatch[AnnotationDeleteAfter] = nil
+	} else if newDeleteAfter != "" && newDeleteAfter != currentDeleteAfter {
+		annotationsPatch[AnnotationDeleteAfter] = newDeleteAfter
+		logger.Debugw("updating delete after annotation",
+			"resource", th.resourceFn.Type(),
+			"namespace", resource.GetNamespace(),
+			"name", resource.GetName(),
+			"oldDeleteAfter", currentDeleteAfter,
+			"newDeleteAfter", newDeleteAfter)
+	}
+
+	if len(annotationsPatch) == 0 {
+		return nil
+	}
+
 	patchData := map[string]interface{}{
-		"metadata": map[string]interface{}{
-			"annotations": annotations,
-		},
+		"metadata": patchMetadata(annotationsPatch),
 	}
 
 	patchBytes, err := json.Marshal(patchData)
@@ -201,6 +329,77 @@ func (th *TTLHandler) updateAnnotationTTLSeconds(ctx context.Context, resource m
 	return nil
 }
 
+// getTTLSecondsAfterFinished returns the ttl of the resource extended by its jitter, when a jitter is configured
+func (th *TTLHandler) getTTLSecondsAfterFinished(resource metav1.Object, resourceName string, resourceSelectors SelectorSpec) (*int32, string) {
+	ttl, identifiedBy := th.getConfiguredTTLSecondsAfterFinished(resource, resourceName, resourceSelectors)
+	if ttl == nil || *ttl < 0 {
+		return ttl, identifiedBy
+	}
+
+	jitter, _ := th.resourceFn.GetTTLJitterSeconds(resource.GetNamespace(), resourceName, resourceSelectors)
+	if jitter == nil || *jitter <= 0 {
+		return ttl, identifiedBy
+	}
+
+	jittered := int64(*ttl) + int64(getTTLJitterOffset(resource.GetUID(), *jitter))
+	if jittered > math.MaxInt32 {
+		jittered = math.MaxInt32
+	}
+	ttlWithJitter := int32(jittered)
+	return &ttlWithJitter, identifiedBy
+}
+
+// getTTLJitterOffset returns the delay in the range [0, jitter] of the resource with the given UID,
+// the same UID always gets the same delay, so that the deadline is stable across the reconciles
+func getTTLJitterOffset(uid types.UID, jitter int32) int32 {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(uid))
+	return int32(hash.Sum32() % (uint32(jitter) + 1))
+}
+
+// getConfiguredTTLSecondsAfterFinished returns the ttl of the resource as configured. The quarantined failed resource
+// gets the ttl of the quarantine. The ephemeral resource gets the ephemeral ttl when it is shorter.
+// The completed resource which produced no results gets the ttl configured
+// for such resources, when it is shorter than its ttl
+func (th *TTLHandler) getConfiguredTTLSecondsAfterFinished(resource metav1.Object, resourceName string, resourceSelectors SelectorSpec) (*int32, string) {
+	if th.resourceFn.IsCompleted(resource) && th.resourceFn.GetCompletionStatus(resource) == metrics.StatusFailed {
+		if quarantineTTL, _, quarantined := PrunerConfigStore.GetQuarantine(resource.GetLabels(), resource.GetAnnotations()); quarantined {
+			// the quarantined resource without a ttl is never deleted by ttl
+			if quarantineTTL == nil {
+				quarantineTTL = ptr.Int32(-1)
+			}
+			return quarantineTTL, "identifiedBy_quarantine"
+		}
+	}
+
+	ttl, identifiedBy := th.getResolvedTTLSecondsAfterFinished(resource, resourceName, resourceSelectors)
+
+	// the ephemeral resource is deleted on the ephemeral ttl when it is shorter than the resolved one
+	ephemeralTTL, _, ephemeral := PrunerConfigStore.GetEphemeral(resource.GetAnnotations())
+	if ephemeral && ephemeralTTL != nil && *ephemeralTTL >= 0 && (ttl == nil || *ttl < 0 || *ephemeralTTL < *ttl) {
+		return ephemeralTTL, "identifiedBy_ephemeral"
+	}
+	return ttl, identifiedBy
+}
+
+// getResolvedTTLSecondsAfterFinished returns the ttl resolved from the config, the ttl without results
+// applies when it is shorter
+func (th *TTLHandler) getResolvedTTLSecondsAfterFinished(resource metav1.Object, resourceName string, resourceSelectors SelectorSpec) (*int32, string) {
+	ttl, identifiedBy := th.resourceFn.GetTTLSecondsAfterFinished(resource.GetNamespace(), resourceName, resourceSelectors)
+	if !th.resourceFn.IsCompleted(resource) || th.resourceFn.HasResults(resource) {
+		return ttl, identifiedBy
+	}
+
+	ttlWithoutResults, identifiedByWithoutResults := th.resourceFn.GetTTLSecondsAfterFinishedWithoutResults(resource.GetNamespace(), resourceName, resourceSelectors)
+	if ttlWithoutResults == nil || *ttlWithoutResults < 0 {
+		return ttl, identifiedBy
+	}
+	if ttl == nil || *ttl < 0 || *ttlWithoutResults < *ttl {
+		return ttlWithoutResults, identifiedByWithoutResults
+	}
+	return ttl, identifiedBy
+}
+
 // needsCleanup checks whether a Resource has finished and has a TTL set.
 func (th *TTLHandler) needsCleanup(resource metav1.Object) bool {
 	// Check completion state first as it's likely to be the most expensive operation
@@ -218,8 +417,15 @@ func (th *TTLHandler) needsCleanup(resource metav1.Object) bool {
 	return ttlValue != "" && ttlValue != NoTTL
 }
 
-// removeResource checks the TTL and deletes the Resource if it has expired
-func (th *TTLHandler) removeResource(ctx context.Context, resource metav1.Object) error {
+// removeResource checks the TTL and deletes the Resource if it has expired, the TTL is ignored
+// when the namespace of the resource is being decommissioned
+func (th *TTLHandler) removeResource(ctx context.Context, resource metav1.Object, decommissioned bool) error {
+	ctx, span := startSpan(ctx, "ttl.removeResource",
+		attribute.String("resource_type", th.resourceFn.Type()),
+		attribute.String("namespace", resource.GetNamespace()),
+		attribute.String("name", resource.GetName()))
+	defer span.End()
+
 	logger := logging.FromContext(ctx)
 	logger.Debugw("checking resource cleanup eligibility",
 		"resourceType", th.resourceFn.Type(),
@@ -227,9 +433,21 @@ func (th *TTLHandler) removeResource(ctx context.Context, resource metav1.Object
 		"name", resource.GetName(),
 	)
 
+	if decommissioned {
+		logger.Debugw("namespace is being decommissioned, ignoring the TTL",
+			"resourceType", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+	}
+
+	// Get resource type for metrics
+	resourceType := th.metricsResourceType()
+
 	// check the resource ttl status
-	expiredAt, err := th.processTTL(logger, resource)
+	expiredAt, err := th.processTTL(logger, resource, decommissioned)
 	if err != nil {
+		if ok, delay := controller.IsRequeueKey(err); ok {
+			addSpanEvent(ctx, EventTTLNotExpired, attribute.String("remaining", delay.String()))
+		}
+		th.recordDeferred(ctx, resource, err)
 		return fmt.Errorf("failed to process TTL: %w", err)
 	}
 	if expiredAt == nil {
@@ -240,19 +458,52 @@ func (th *TTLHandler) removeResource(ctx context.Context, resource metav1.Object
 	freshResource, err := th.resourceFn.Get(ctx, resource.GetNamespace(), resource.GetName())
 	if err != nil {
 		if errors.IsNotFound(err) {
+			metrics.GetRecorder().ClearDeletionDeferred(ctx, resource.GetUID(), resourceType, resource.GetNamespace())
 			return nil
 		}
 		return fmt.Errorf("failed to get fresh resource: %w", err)
 	}
 
-	expiredAt, err = th.processTTL(logger, freshResource)
+	expiredAt, err = th.processTTL(logger, freshResource, decommissioned)
 	if err != nil {
+		if ok, delay := controller.IsRequeueKey(err); ok {
+			addSpanEvent(ctx, EventTTLNotExpired, attribute.String("remaining", delay.String()))
+		}
+		th.recordDeferred(ctx, freshResource, err)
 		return fmt.Errorf("failed to process TTL for fresh resource: %w", err)
 	}
 	if expiredAt == nil {
 		return nil
 	}
 
+	// the resource is deleted along with its parent, it is not reported as expired
+	if th.resourceFn.IsParentDeleting(ctx, resource) {
+		logger.Debugw("skipping resource, its parent is being deleted",
+			"resourceType", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName())
+		metrics.GetRecorder().RecordResourceSkipped(ctx, resourceType, resource.GetNamespace(), metrics.OperationTTL, metrics.SkipReasonParentDeleting)
+		return nil
+	}
+
+	addSpanEvent(ctx, EventTTLExpired,
+		attribute.String("expired_at", expiredAt.UTC().Format(time.RFC3339)),
+		attribute.Bool("decommissioned", decommissioned))
+
+	// the latest run of each outcome is kept as a reference, it is checked again periodically
+	// and deleted once a newer run of its outcome completes
+	if isTTLKeepLatestEnabled() && !decommissioned {
+		latest, err := th.isLatestOfOutcome(ctx, freshResource)
+		if err != nil {
+			return fmt.Errorf("failed to check the latest resource of the outcome: %w", err)
+		}
+		if latest {
+			logger.Debugw("skipping expired resource, it is the latest of its outcome",
+				"resourceType", th.resourceFn.Type(), "namespace", resource.GetNamespace(), "name", resource.GetName(),
+				"status", th.resourceFn.GetCompletionStatus(freshResource))
+			metrics.GetRecorder().RecordResourceSkipped(ctx, resourceType, resource.GetNamespace(), metrics.OperationTTL, metrics.SkipReasonLatestOutcome)
+			return controller.NewRequeueAfter(latestOfOutcomeRequeueAfter)
+		}
+	}
+
 	logger.Debugw("cleaning up expired resource",
 		"resourceType", th.resourceFn.Type(),
 		"namespace", resource.GetNamespace(),
@@ -267,14 +518,20 @@ func (th *TTLHandler) removeResource(ctx context.Context, resource metav1.Object
 		resourceAge = time.Since(creationTime.Time)
 	}
 
-	// Get resource type for metrics
-	resourceType := metrics.ResourceTypePipelineRun
-	if th.resourceFn.Type() == KindTaskRun {
-		resourceType = metrics.ResourceTypeTaskRun
+	metrics.GetRecorder().RecordResourceQueued(ctx, resource.GetUID(), resourceType, resource.GetNamespace(), metrics.OperationTTL)
+	if err := th.startupRamp.Wait(ctx); err != nil {
+		return err
 	}
 
-	if err := th.resourceFn.Delete(ctx, resource.GetNamespace(), resource.GetName()); err != nil {
+	if err := th.deletionLimiter.Acquire(ctx); err != nil {
+		return err
+	}
+	err = th.deletionBackend.Delete(ctx, resource)
+	th.deletionLimiter.Release()
+	if err != nil {
 		if errors.IsNotFound(err) {
+			metrics.GetRecorder().ClearDeletionDeferred(ctx, resource.GetUID(), resourceType, resource.GetNamespace())
+			metrics.GetRecorder().ClearResourceQueued(resource.GetUID())
 			return nil
 		}
 		// Record deletion error
@@ -286,20 +543,102 @@ func (th *TTLHandler) removeResource(ctx context.Context, resource metav1.Object
 
 	// Record successful deletion
 	metricsRecorder := metrics.GetRecorder()
-	metricsRecorder.RecordResourceDeleted(ctx, resourceType, resource.GetNamespace(), metrics.OperationTTL, resourceAge)
+	metricsRecorder.RecordResourceDeleted(ctx, resourceType, resource.GetNamespace(), metrics.OperationTTL, th.resourceFn.GetCompletionStatus(resource), resourceAge)
+	metricsRecorder.ClearDeletionDeferred(ctx, resource.GetUID(), resourceType, resource.GetNamespace())
+	metricsRecorder.ClearResourceQueued(resource.GetUID())
+	pruneSummaryFromContext(ctx).RecordDeletion(resource.GetNamespace())
+	th.observeDeletion(ctx, resource, metrics.OperationTTL, th.resourceFn.GetCompletionStatus(resource))
+	addSpanEvent(ctx, EventDeleted, attribute.String("status", th.resourceFn.GetCompletionStatus(resource)))
 
 	return nil
 }
 
+// isLatestOfOutcome returns true when no other completed resource of the same group and outcome, successful or not,
+// completed after the resource. The resources are grouped by the resource name label as on the history limits
+func (th *TTLHandler) isLatestOfOutcome(ctx context.Context, resource metav1.Object) (bool, error) {
+	labelKey := getResourceNameLabelKey(resource, th.resourceFn.GetDefaultLabelKey())
+	resourceName := getResourceName(resource, labelKey)
+
+	selector := ""
+	if resourceName != "" {
+		selector = labels.Set{labelKey: resourceName}.String()
+	}
+	resources, err := th.resourceFn.List(ctx, resource.GetNamespace(), selector)
+	if err != nil {
+		return false, err
+	}
+
+	successful := th.resourceFn.GetCompletionStatus(resource) == metrics.StatusSucceeded
+	completionTime, err := th.resourceFn.GetCompletionTime(resource)
+	if err != nil {
+		return false, err
+	}
+	for _, res := range resources {
+		if res.GetUID() == resource.GetUID() && res.GetName() == resource.GetName() {
+			continue
+		}
+		// the resources without the name label are grouped together
+		if resourceName == "" && getResourceName(res, labelKey) != "" {
+			continue
+		}
+		if res.GetDeletionTimestamp() != nil || !th.resourceFn.IsCompleted(res) ||
+			(th.resourceFn.GetCompletionStatus(res) == metrics.StatusSucceeded) != successful {
+			continue
+		}
+		resCompletionTime, err := th.resourceFn.GetCompletionTime(res)
+		if err == nil && resCompletionTime.After(completionTime.Time) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// observeDeletion notifies the DeletionObserver of the deletion of the resource
+func (th *TTLHandler) observeDeletion(ctx context.Context, resource metav1.Object, operation, status string) {
+	observeDeletion(ctx, DeletionRecord{
+		Kind:      th.resourceFn.Type(),
+		Namespace: resource.GetNamespace(),
+		Name:      resource.GetName(),
+		UID:       resource.GetUID(),
+		Operation: operation,
+		Status:    status,
+		DeletedAt: th.clock.Now(),
+	})
+}
+
+// metricsResourceType returns the resource type label of the metrics
+func (th *TTLHandler) metricsResourceType() string {
+	if th.resourceFn.Type() == KindTaskRun {
+		return metrics.ResourceTypeTaskRun
+	}
+	return metrics.ResourceTypePipelineRun
+}
+
+// recordDeferred counts the resource on the pending deletions when its deletion is requeued to its TTL expiry
+func (th *TTLHandler) recordDeferred(ctx context.Context, resource metav1.Object, err error) {
+	if requeue, _ := controller.IsRequeueKey(err); requeue {
+		metrics.GetRecorder().RecordDeletionDeferred(ctx, resource.GetUID(), th.metricsResourceType(), resource.GetNamespace())
+	}
+}
+
 // processTTL checks whether a given Resource's TTL has expired, and add it to the queue after the TTL is expected to expire
-// if the TTL will expire later.
-func (th *TTLHandler) processTTL(logger *zap.SugaredLogger, resource metav1.Object) (expiredAt *time.Time, err error) {
-	// We don't care about the Resources that are going to be deleted, or the ones that don't need clean up.
-	if resource.GetDeletionTimestamp() != nil || !th.needsCleanup(resource) {
+// if the TTL will expire later. The completed Resources of a decommissioned namespace are expired right away.
+func (th *TTLHandler) processTTL(logger *zap.SugaredLogger, resource metav1.Object, decommissioned bool) (expiredAt *time.Time, err error) {
+	// We don't care about the Resources that are going to be deleted, nor the ones excluded since
+	if resource.GetDeletionTimestamp() != nil || PrunerConfigStore.IsExcluded(resource.GetAnnotations()) {
 		return nil, nil
 	}
 
 	now := th.clock.Now()
+	if decommissioned && th.resourceFn.IsCompleted(resource) {
+		return &now, nil
+	}
+
+	// We don't care about the ones that don't need clean up.
+	if !th.needsCleanup(resource) {
+		return nil, nil
+	}
+
 	t, e, err := th.timeLeft(logger, resource, &now)
 	if err != nil {
 		return nil, err
@@ -345,8 +684,22 @@ func (th *TTLHandler) getFinishAndExpireTime(resource metav1.Object) (*time.Time
 	if err != nil {
 		return nil, nil, err
 	}
-	expireAt := finishAt.Add(*ttlDuration)
-	return &finishAt, &expireAt, nil
+	ttl := int32(*ttlDuration / time.Second)
+	expireAt := th.NextDeletionTime(resource, &ttl)
+	if expireAt == nil {
+		return nil, nil, fmt.Errorf("resource '%s/%s' has no deletion time", resource.GetNamespace(), resource.GetName())
+	}
+	return &finishAt, expireAt, nil
+}
+
+// getTTLStartTime returns the time the ttl counts from, the last access time of the resource
+// when it is newer than the completion time. An invalid last access time is ignored
+func getTTLStartTime(resource metav1.Object, completionTime time.Time) time.Time {
+	lastAccessed, err := time.Parse(time.RFC3339, resource.GetAnnotations()[AnnotationLastAccessed])
+	if err != nil || !lastAccessed.After(completionTime) {
+		return completionTime
+	}
+	return lastAccessed
 }
 
 // returns ttl of the resource
@@ -392,9 +745,10 @@ func (th *TTLHandler) getResourceSelectors(resource metav1.Object) SelectorSpec
 	if annotations := resource.GetAnnotations(); len(annotations) > 0 {
 		selectors.MatchAnnotations = annotations
 	}
-	if labels := resource.GetLabels(); len(labels) > 0 {
+	if labels := getSelectorLabels(resource); len(labels) > 0 {
 		selectors.MatchLabels = labels
 	}
+	selectors.MatchOwnerReferences = getOwnerReferenceSelectors(resource)
 	return selectors
 }
 
@@ -415,7 +769,7 @@ func (th *TTLHandler) needsTTLUpdate(resource metav1.Object, enforcedLevel Enfor
 	resourceName := getResourceName(resource, labelKey)
 	resourceSelectors := th.getResourceSelectors(resource)
 
-	configTTL, _ := th.resourceFn.GetTTLSecondsAfterFinished(resource.GetNamespace(), resourceName, resourceSelectors)
+	configTTL, _ := th.getTTLSecondsAfterFinished(resource, resourceName, resourceSelectors)
 
 	// If there's no config TTL, we should remove the annotation
 	if configTTL == nil {
@@ -424,5 +778,35 @@ func (th *TTLHandler) needsTTLUpdate(resource metav1.Object, enforcedLevel Enfor
 
 	// Compare current TTL with config TTL
 	configTTLStr := strconv.Itoa(int(*configTTL))
-	return currentTTL != configTTLStr
+	if currentTTL != configTTLStr {
+		return true
+	}
+
+	// the deletion deadline is not in sync with the ttl
+	return annotations[AnnotationDeleteAfter] != th.getDeleteAfter(resource, configTTL)
+}
+
+// NextDeletionTime returns the time a completed resource is deleted by the given resolved ttl, counted from
+// its completion or its last access. Returns nil if the resource is not completed, is excluded or there is
+// no ttl to apply, the resource is then only pruned by the history limits
+func (th *TTLHandler) NextDeletionTime(resource metav1.Object, ttl *int32) *time.Time {
+	if ttl == nil || *ttl < 0 || PrunerConfigStore.IsExcluded(resource.GetAnnotations()) || !th.resourceFn.IsCompleted(resource) {
+		return nil
+	}
+	completionTime, err := th.resourceFn.GetCompletionTime(resource)
+	if err != nil || completionTime.IsZero() {
+		return nil
+	}
+	deleteAt := getTTLStartTime(resource, completionTime.Time).Add(time.Duration(*ttl) * time.Second)
+	return &deleteAt
+}
+
+// getDeleteAfter returns the deletion deadline of a completed resource in RFC3339 format,
+// returns empty string if the resource is not completed or there is no ttl to apply
+func (th *TTLHandler) getDeleteAfter(resource metav1.Object, ttl *int32) string {
+	deleteAt := th.NextDeletionTime(resource, ttl)
+	if deleteAt == nil {
+		return ""
+	}
+	return deleteAt.UTC().Format(time.RFC3339)
 }
@@ -1,15 +1,36 @@
 package config
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 	clocktest "k8s.io/utils/clock/testing"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
 	"knative.dev/pkg/ptr"
 )
 
@@ -18,6 +39,9 @@ type ttlMockResource struct {
 	metav1.ObjectMeta
 	completed       bool
 	completion_time *metav1.Time
+	start_time      *metav1.Time
+	hasResults      bool
+	failed          bool
 }
 
 // mockTTLFuncs implements TTLResourceFuncs for testing
@@ -25,6 +49,9 @@ type mockTTLFuncs struct {
 	resources           map[string]*ttlMockResource
 	enforcedConfigLevel EnforcedConfigLevel
 	ttl                 *int32
+	ttlWithoutResults   *int32
+	ttlJitter           *int32
+	parentDeleting      bool
 }
 
 func newMockTTLFuncs() *mockTTLFuncs {
@@ -43,6 +70,20 @@ func (m *mockTTLFuncs) Get(_ context.Context, namespace, name string) (metav1.Ob
 	return nil, errors.NewNotFound(schema.GroupResource{Group: "test", Resource: "mock"}, name)
 }
 
+func (m *mockTTLFuncs) List(_ context.Context, namespace, label string) ([]metav1.Object, error) {
+	selector, err := labels.Parse(label)
+	if err != nil {
+		return nil, err
+	}
+	var resources []metav1.Object
+	for _, res := range m.resources {
+		if res.Namespace == namespace && selector.Matches(labels.Set(res.Labels)) {
+			resources = append(resources, res)
+		}
+	}
+	return resources, nil
+}
+
 func (m *mockTTLFuncs) Delete(_ context.Context, namespace, name string) error {
 	key := namespace + "/" + name
 	if _, ok := m.resources[key]; ok {
@@ -52,13 +93,39 @@ func (m *mockTTLFuncs) Delete(_ context.Context, namespace, name string) error {
 	return errors.NewNotFound(schema.GroupResource{Group: "test", Resource: "mock"}, name)
 }
 
-func (m *mockTTLFuncs) Patch(_ context.Context, namespace, name string, _ []byte) error {
+func (m *mockTTLFuncs) Patch(_ context.Context, namespace, name string, patchBytes []byte) error {
 	key := namespace + "/" + name
 	if res, ok := m.resources[key]; ok {
+		patch := struct {
+			Metadata struct {
+				Annotations map[string]*string `json:"annotations"`
+				Labels      map[string]string  `json:"labels"`
+				Finalizers  *[]string          `json:"finalizers"`
+			} `json:"metadata"`
+		}{}
+		if err := json.Unmarshal(patchBytes, &patch); err != nil {
+			return err
+		}
+		if patch.Metadata.Finalizers != nil {
+			res.Finalizers = *patch.Metadata.Finalizers
+		}
 		if res.Annotations == nil {
 			res.Annotations = make(map[string]string)
 		}
-		res.Annotations[AnnotationTTLSecondsAfterFinished] = "60" // Default test TTL
+		for label, value := range patch.Metadata.Labels {
+			if res.Labels == nil {
+				res.Labels = make(map[string]string)
+			}
+			res.Labels[label] = value
+		}
+		// apply the annotations as a merge patch, null removes the annotation
+		for annotation, value := range patch.Metadata.Annotations {
+			if value == nil {
+				delete(res.Annotations, annotation)
+				continue
+			}
+			res.Annotations[annotation] = *value
+		}
 		return nil
 	}
 	return errors.NewNotFound(schema.GroupResource{Group: "test", Resource: "mock"}, name)
@@ -87,13 +154,49 @@ func (m *mockTTLFuncs) GetCompletionTime(resource metav1.Object) (metav1.Time, e
 	return metav1.Time{}, fmt.Errorf("completion time not set")
 }
 
+func (m *mockTTLFuncs) GetCompletionStatus(resource metav1.Object) string {
+	if r, ok := resource.(*ttlMockResource); ok && r.failed {
+		return metrics.StatusFailed
+	}
+	return metrics.StatusSucceeded
+}
+
+func (m *mockTTLFuncs) IsParentDeleting(_ context.Context, _ metav1.Object) bool {
+	return m.parentDeleting
+}
+
+func (m *mockTTLFuncs) GetStartTime(resource metav1.Object) *metav1.Time {
+	if mr, ok := resource.(*ttlMockResource); ok {
+		return mr.start_time
+	}
+	return nil
+}
+
 func (m *mockTTLFuncs) Ignore(resource metav1.Object) bool { return false }
 
 func (m *mockTTLFuncs) GetTTLSecondsAfterFinished(_, _ string, _ SelectorSpec) (*int32, string) {
+	if m.ttl != nil {
+		return m.ttl, "test"
+	}
 	ttl := int32(60) // Default test TTL
 	return &ttl, "test"
 }
 
+func (m *mockTTLFuncs) GetTTLSecondsAfterFinishedWithoutResults(_, _ string, _ SelectorSpec) (*int32, string) {
+	return m.ttlWithoutResults, "test_without_results"
+}
+
+func (m *mockTTLFuncs) GetTTLJitterSeconds(_, _ string, _ SelectorSpec) (*int32, string) {
+	return m.ttlJitter, "test_jitter"
+}
+
+func (m *mockTTLFuncs) HasResults(resource metav1.Object) bool {
+	if mr, ok := resource.(*ttlMockResource); ok {
+		return mr.hasResults
+	}
+	return false
+}
+
 func (m *mockTTLFuncs) GetDefaultLabelKey() string { return "test.mock/resource" }
 
 func (m *mockTTLFuncs) GetEnforcedConfigLevel(_, _ string, _ SelectorSpec) EnforcedConfigLevel {
@@ -308,3 +411,1368 @@ func TestResourceNeedsCleanup(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteAfterAnnotation(t *testing.T) {
+	mockFuncs := newMockTTLFuncs()
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+	completionTime := fakeClock.Now().Add(-5 * time.Minute)
+	resource := &ttlMockResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+		},
+		completed:       true,
+		completion_time: &metav1.Time{Time: completionTime},
+	}
+	mockFuncs.resources["default/test1"] = resource
+
+	expectedDeleteAfter := func(ttl time.Duration) string {
+		return completionTime.Add(ttl).UTC().Format(time.RFC3339)
+	}
+
+	// the deletion is deferred, the deadline is written on the annotation
+	mockFuncs.ttl = ptr.Int32(3600)
+	err := handler.ProcessEvent(context.Background(), resource)
+	if ok, _ := controller.IsRequeueKey(err); !ok {
+		t.Fatalf("ProcessEvent() error = %v, want requeue", err)
+	}
+	if got := resource.Annotations[AnnotationDeleteAfter]; got != expectedDeleteAfter(time.Hour) {
+		t.Errorf("delete after annotation = %q, want %q", got, expectedDeleteAfter(time.Hour))
+	}
+
+	// the ttl is updated on the config, the deadline follows it
+	mockFuncs.ttl = ptr.Int32(600)
+	err = handler.ProcessEvent(context.Background(), resource)
+	if ok, _ := controller.IsRequeueKey(err); !ok {
+		t.Fatalf("ProcessEvent() error = %v, want requeue", err)
+	}
+	if got := resource.Annotations[AnnotationTTLSecondsAfterFinished]; got != "600" {
+		t.Errorf("ttl annotation = %q, want %q", got, "600")
+	}
+	if got := resource.Annotations[AnnotationDeleteAfter]; got != expectedDeleteAfter(10*time.Minute) {
+		t.Errorf("delete after annotation = %q, want %q", got, expectedDeleteAfter(10*time.Minute))
+	}
+
+	// ttl is disabled, the deadline is removed
+	mockFuncs.ttl = ptr.Int32(-1)
+	if err := handler.ProcessEvent(context.Background(), resource); err != nil {
+		t.Fatalf("ProcessEvent() unexpected error = %v", err)
+	}
+	if got, found := resource.Annotations[AnnotationDeleteAfter]; found {
+		t.Errorf("delete after annotation = %q, want it removed", got)
+	}
+}
+
+func TestNextDeletionTime(t *testing.T) {
+	loadTestConfig(t, `excludeAnnotations:
+  backup: required`)
+
+	now := time.Now()
+	completionTime := now.Add(-5 * time.Minute)
+	lastAccessed := now.Add(-time.Minute).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		completed   bool
+		ttl         *int32
+		expected    *time.Time
+	}{
+		{
+			name:      "ttl governed",
+			completed: true,
+			ttl:       ptr.Int32(3600),
+			expected:  ptr.Time(completionTime.Add(time.Hour)),
+		},
+		{
+			name:        "ttl counted from the last access",
+			annotations: map[string]string{AnnotationLastAccessed: lastAccessed.Format(time.RFC3339)},
+			completed:   true,
+			ttl:         ptr.Int32(3600),
+			expected:    ptr.Time(lastAccessed.Add(time.Hour)),
+		},
+		{
+			name:      "history only",
+			completed: true,
+		},
+		{
+			name:      "ttl disabled",
+			completed: true,
+			ttl:       ptr.Int32(-1),
+		},
+		{
+			name: "not completed",
+			ttl:  ptr.Int32(3600),
+		},
+		{
+			name:        "excluded",
+			annotations: map[string]string{"backup": "required"},
+			completed:   true,
+			ttl:         ptr.Int32(3600),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, _ := NewTTLHandler(clocktest.NewFakeClock(now), newMockTTLFuncs())
+			resource := &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test1",
+					Namespace:   "default",
+					Annotations: tc.annotations,
+				},
+				completed:       tc.completed,
+				completion_time: &metav1.Time{Time: completionTime},
+			}
+
+			got := handler.NextDeletionTime(resource, tc.ttl)
+			if tc.expected == nil {
+				assert.Nil(t, got)
+				return
+			}
+			if assert.NotNil(t, got) {
+				assert.True(t, tc.expected.Equal(*got), "next deletion time = %v, want %v", *got, *tc.expected)
+			}
+		})
+	}
+
+	// the requeue of the resource is computed from the same deletion time
+	mockFuncs := newMockTTLFuncs()
+	mockFuncs.ttl = ptr.Int32(3600)
+	fakeClock := clocktest.NewFakeClock(now)
+	handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+	resource := &ttlMockResource{
+		ObjectMeta:      metav1.ObjectMeta{Name: "test1", Namespace: "default"},
+		completed:       true,
+		completion_time: &metav1.Time{Time: completionTime},
+	}
+	mockFuncs.resources["default/test1"] = resource
+
+	err := handler.ProcessEvent(context.Background(), resource)
+	ok, delay := controller.IsRequeueKey(err)
+	if !ok {
+		t.Fatalf("ProcessEvent() error = %v, want requeue", err)
+	}
+	assert.Equal(t, handler.NextDeletionTime(resource, mockFuncs.ttl).Sub(now), delay)
+}
+
+func TestTTLLastAccessed(t *testing.T) {
+	tests := []struct {
+		name         string
+		lastAccessed func(completionTime time.Time) string
+		wantDeleted  bool
+	}{
+		{
+			name:        "run not accessed expires",
+			wantDeleted: true,
+		},
+		{
+			name: "run accessed after the completion is deferred",
+			lastAccessed: func(completionTime time.Time) string {
+				return completionTime.Add(55 * time.Minute).Format(time.RFC3339)
+			},
+			wantDeleted: false,
+		},
+		{
+			name:         "run accessed before the completion expires",
+			lastAccessed: func(completionTime time.Time) string { return completionTime.Add(-time.Minute).Format(time.RFC3339) },
+			wantDeleted:  true,
+		},
+		{
+			name:         "run accessed long ago expires",
+			lastAccessed: func(completionTime time.Time) string { return completionTime.Add(5 * time.Minute).Format(time.RFC3339) },
+			wantDeleted:  true,
+		},
+		{
+			name:         "invalid access time is ignored",
+			lastAccessed: func(time.Time) string { return "yesterday" },
+			wantDeleted:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFuncs := newMockTTLFuncs()
+			mockFuncs.ttl = ptr.Int32(600)
+			fakeClock := clocktest.NewFakeClock(time.Now())
+			handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+			// the run completed an hour ago, its ttl of 10 minutes has expired
+			completionTime := fakeClock.Now().Add(-time.Hour)
+			resource := &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test1",
+					Namespace: "default",
+				},
+				completed:       true,
+				completion_time: &metav1.Time{Time: completionTime},
+			}
+			if tt.lastAccessed != nil {
+				resource.Annotations = map[string]string{AnnotationLastAccessed: tt.lastAccessed(completionTime)}
+			}
+			mockFuncs.resources["default/test1"] = resource
+
+			err := handler.ProcessEvent(context.Background(), resource)
+			if requeue, _ := controller.IsRequeueKey(err); err != nil && !requeue {
+				t.Fatalf("ProcessEvent() unexpected error = %v", err)
+			}
+			if _, exists := mockFuncs.resources["default/test1"]; exists == tt.wantDeleted {
+				t.Errorf("resource deleted = %v, want %v", !exists, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestTTLLastAccessedUpdate(t *testing.T) {
+	mockFuncs := newMockTTLFuncs()
+	mockFuncs.ttl = ptr.Int32(600)
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+	resource := &ttlMockResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+		},
+		completed:       true,
+		completion_time: &metav1.Time{Time: fakeClock.Now()},
+	}
+	mockFuncs.resources["default/test1"] = resource
+
+	err := handler.ProcessEvent(context.Background(), resource)
+	if ok, _ := controller.IsRequeueKey(err); !ok {
+		t.Fatalf("ProcessEvent() error = %v, want requeue", err)
+	}
+
+	// the run is accessed just before it expires, the deadline moves along
+	fakeClock.Step(9 * time.Minute)
+	resource.Annotations[AnnotationLastAccessed] = fakeClock.Now().Format(time.RFC3339)
+	err = handler.ProcessEvent(context.Background(), resource)
+	if ok, _ := controller.IsRequeueKey(err); !ok {
+		t.Fatalf("ProcessEvent() error = %v, want requeue", err)
+	}
+	wantDeleteAfter := fakeClock.Now().Add(10 * time.Minute).UTC().Format(time.RFC3339)
+	if got := resource.Annotations[AnnotationDeleteAfter]; got != wantDeleteAfter {
+		t.Errorf("delete after annotation = %q, want %q", got, wantDeleteAfter)
+	}
+
+	// the original deadline has passed, the run is kept
+	fakeClock.Step(5 * time.Minute)
+	err = handler.ProcessEvent(context.Background(), resource)
+	if ok, _ := controller.IsRequeueKey(err); !ok {
+		t.Fatalf("ProcessEvent() error = %v, want requeue", err)
+	}
+	if _, exists := mockFuncs.resources["default/test1"]; !exists {
+		t.Fatal("accessed resource was deleted before its deadline")
+	}
+
+	// the deadline after the access has passed
+	fakeClock.Step(6 * time.Minute)
+	if err := handler.ProcessEvent(context.Background(), resource); err != nil {
+		t.Fatalf("ProcessEvent() unexpected error = %v", err)
+	}
+	if _, exists := mockFuncs.resources["default/test1"]; exists {
+		t.Error("resource was not deleted after the deadline following the access")
+	}
+}
+
+func TestManagedLabel(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			t.Setenv(EnvManagedLabelEnabled, strconv.FormatBool(enabled))
+
+			mockFuncs := newMockTTLFuncs()
+			mockFuncs.ttl = ptr.Int32(3600)
+			fakeClock := clocktest.NewFakeClock(time.Now())
+			handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+			resource := &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test1",
+					Namespace: "default",
+					Labels:    map[string]string{"app": "web"},
+				},
+				completed:       true,
+				completion_time: &metav1.Time{Time: fakeClock.Now()},
+			}
+			mockFuncs.resources["default/test1"] = resource
+
+			err := handler.ProcessEvent(context.Background(), resource)
+			if ok, _ := controller.IsRequeueKey(err); !ok {
+				t.Fatalf("ProcessEvent() error = %v, want requeue", err)
+			}
+			if got := resource.Annotations[AnnotationTTLSecondsAfterFinished]; got != "3600" {
+				t.Errorf("ttl annotation = %q, want %q", got, "3600")
+			}
+			if _, found := resource.Labels[LabelManaged]; found != enabled {
+				t.Errorf("managed label found = %v, want %v", found, enabled)
+			}
+			if got := resource.Labels["app"]; got != "web" {
+				t.Errorf("app label = %q, want it kept", got)
+			}
+		})
+	}
+}
+
+func TestManagedLabelNotSelected(t *testing.T) {
+	loadTestConfig(t, `enforcedConfigLevel: resource
+ttlSecondsAfterFinished: 3600
+namespaces:
+  dev:
+    pipelineRuns:
+      - selector:
+          - matchLabels:
+              app: web
+        ttlSecondsAfterFinished: 60`)
+
+	handler, _ := NewTTLHandler(clocktest.NewFakeClock(time.Now()), newMockTTLFuncs())
+	resource := &ttlMockResource{ObjectMeta: metav1.ObjectMeta{
+		Name:      "test1",
+		Namespace: "dev",
+		Labels:    map[string]string{"app": "web", LabelManaged: "true"},
+	}}
+
+	selectors := handler.getResourceSelectors(resource)
+	assert.Equal(t, map[string]string{"app": "web"}, selectors.MatchLabels)
+
+	// the labeled run keeps its config
+	ttl, _ := PrunerConfigStore.GetPipelineTTLSecondsAfterFinished("dev", "", selectors)
+	if ttl == nil || *ttl != 60 {
+		t.Errorf("ttl = %v, want 60", ttl)
+	}
+	// the labels of the resource are not changed
+	assert.Equal(t, "true", resource.Labels[LabelManaged])
+}
+
+func TestTTLExcludeAnnotations(t *testing.T) {
+	loadTestConfig(t, `excludeAnnotations:
+  backup: required`)
+
+	mockFuncs := newMockTTLFuncs()
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+	resource := &ttlMockResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test1",
+			Namespace:   "default",
+			Annotations: map[string]string{"backup": "required"},
+		},
+		completed:       true,
+		completion_time: &metav1.Time{Time: fakeClock.Now().Add(-2 * time.Hour)},
+	}
+	mockFuncs.resources["default/test1"] = resource
+
+	if err := handler.ProcessEvent(context.Background(), resource); err != nil {
+		t.Fatalf("ProcessEvent() unexpected error = %v", err)
+	}
+	if _, exists := mockFuncs.resources["default/test1"]; !exists {
+		t.Error("excluded resource should not be deleted")
+	}
+	if _, found := resource.Annotations[AnnotationTTLSecondsAfterFinished]; found {
+		t.Error("excluded resource should not be annotated with ttl")
+	}
+}
+
+func TestTTLSkipsParentDeleting(t *testing.T) {
+	mockFuncs := newMockTTLFuncs()
+	mockFuncs.parentDeleting = true
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+	resource := &ttlMockResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "default",
+		},
+		completed:       true,
+		completion_time: &metav1.Time{Time: fakeClock.Now().Add(-2 * time.Hour)},
+	}
+	mockFuncs.resources["default/test1"] = resource
+
+	if err := handler.ProcessEvent(context.Background(), resource); err != nil {
+		t.Fatalf("ProcessEvent() unexpected error = %v", err)
+	}
+	if _, exists := mockFuncs.resources["default/test1"]; !exists {
+		t.Error("resource whose parent is being deleted should not be deleted")
+	}
+}
+
+func TestTTLDecommissionedNamespace(t *testing.T) {
+	now := metav1.Now()
+	tests := []struct {
+		name        string
+		namespace   *corev1.Namespace
+		ttl         int32
+		completed   bool
+		wantDeleted bool
+	}{
+		{
+			name:        "active namespace waits for the ttl",
+			namespace:   &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns1"}},
+			ttl:         3600,
+			completed:   true,
+			wantDeleted: false,
+		},
+		{
+			name: "terminating namespace is pruned immediately",
+			namespace: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "ns1", DeletionTimestamp: &now},
+				Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+			},
+			ttl:         3600,
+			completed:   true,
+			wantDeleted: true,
+		},
+		{
+			name: "namespace labeled for decommission is pruned immediately",
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name: "ns1", Labels: map[string]string{LabelNamespaceDecommission: "true"},
+			}},
+			ttl:         3600,
+			completed:   true,
+			wantDeleted: true,
+		},
+		{
+			name: "namespace labeled for decommission ignores the disabled ttl",
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name: "ns1", Labels: map[string]string{LabelNamespaceDecommission: "true"},
+			}},
+			ttl:         -1,
+			completed:   true,
+			wantDeleted: true,
+		},
+		{
+			name: "running resource of a decommissioned namespace is kept",
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name: "ns1", Labels: map[string]string{LabelNamespaceDecommission: "true"},
+			}},
+			ttl:         3600,
+			completed:   false,
+			wantDeleted: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFuncs := newMockTTLFuncs()
+			mockFuncs.ttl = ptr.Int32(tt.ttl)
+			fakeClock := clocktest.NewFakeClock(time.Now())
+			handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+			namespaceInformer := corev1informers.NewNamespaceInformer(fake.NewSimpleClientset(), 0, cache.Indexers{})
+			if err := namespaceInformer.GetIndexer().Add(tt.namespace); err != nil {
+				t.Fatalf("failed to add the namespace: %v", err)
+			}
+			handler.SetNamespaceGetter(NewNamespaceGetter(namespaceInformer))
+
+			resource := &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test1",
+					Namespace: "ns1",
+				},
+				completed:       tt.completed,
+				completion_time: &metav1.Time{Time: fakeClock.Now()},
+			}
+			mockFuncs.resources["ns1/test1"] = resource
+
+			// the resource waiting for the ttl is requeued
+			err := handler.ProcessEvent(context.Background(), resource)
+			if requeue, _ := controller.IsRequeueKey(err); err != nil && !requeue {
+				t.Fatalf("ProcessEvent() unexpected error = %v", err)
+			}
+			if _, exists := mockFuncs.resources["ns1/test1"]; exists == tt.wantDeleted {
+				t.Errorf("resource deleted = %v, want %v", !exists, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestTTLNamespaceLookedUpOnce(t *testing.T) {
+	mockFuncs := newMockTTLFuncs()
+	mockFuncs.ttl = ptr.Int32(3600)
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+	lookups := 0
+	handler.SetNamespaceGetter(func(_ context.Context, name string) (*corev1.Namespace, error) {
+		lookups++
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Labels: map[string]string{LabelNamespaceDecommission: "true"},
+		}}, nil
+	})
+
+	resource := &ttlMockResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test1",
+			Namespace: "ns1",
+		},
+		completed:       true,
+		completion_time: &metav1.Time{Time: fakeClock.Now()},
+	}
+	mockFuncs.resources["ns1/test1"] = resource
+
+	if err := handler.ProcessEvent(context.Background(), resource); err != nil {
+		t.Fatalf("ProcessEvent() unexpected error = %v", err)
+	}
+	if _, exists := mockFuncs.resources["ns1/test1"]; exists {
+		t.Error("resource of a decommissioned namespace should be deleted")
+	}
+	assert.Equal(t, 1, lookups, "the namespace should be looked up once per event")
+}
+
+func TestTTLWithoutResults(t *testing.T) {
+	tests := []struct {
+		name              string
+		ttl               *int32
+		ttlWithoutResults *int32
+		hasResults        bool
+		completed         bool
+		wantTTL           string
+	}{
+		{
+			name:              "run without results gets the shorter ttl",
+			ttl:               ptr.Int32(3600),
+			ttlWithoutResults: ptr.Int32(60),
+			completed:         true,
+			wantTTL:           "60",
+		},
+		{
+			name:              "run with results keeps the ttl",
+			ttl:               ptr.Int32(3600),
+			ttlWithoutResults: ptr.Int32(60),
+			hasResults:        true,
+			completed:         true,
+			wantTTL:           "3600",
+		},
+		{
+			name:              "longer ttl without results is not applied",
+			ttl:               ptr.Int32(60),
+			ttlWithoutResults: ptr.Int32(3600),
+			completed:         true,
+			wantTTL:           "60",
+		},
+		{
+			name:              "ttl without results applies when the ttl is disabled",
+			ttl:               ptr.Int32(-1),
+			ttlWithoutResults: ptr.Int32(60),
+			completed:         true,
+			wantTTL:           "60",
+		},
+		{
+			name:      "run without results keeps the ttl when no ttl without results is set",
+			ttl:       ptr.Int32(3600),
+			completed: true,
+			wantTTL:   "3600",
+		},
+		{
+			name:              "running run keeps the ttl",
+			ttl:               ptr.Int32(3600),
+			ttlWithoutResults: ptr.Int32(60),
+			wantTTL:           "3600",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFuncs := newMockTTLFuncs()
+			mockFuncs.ttl = tt.ttl
+			mockFuncs.ttlWithoutResults = tt.ttlWithoutResults
+			fakeClock := clocktest.NewFakeClock(time.Now())
+			handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+			resource := &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test1",
+					Namespace: "default",
+				},
+				completed:       tt.completed,
+				completion_time: &metav1.Time{Time: fakeClock.Now()},
+				hasResults:      tt.hasResults,
+			}
+			mockFuncs.resources["default/test1"] = resource
+
+			if err := handler.updateAnnotationTTLSeconds(context.Background(), resource); err != nil {
+				t.Fatalf("updateAnnotationTTLSeconds() unexpected error = %v", err)
+			}
+			if got := resource.Annotations[AnnotationTTLSecondsAfterFinished]; got != tt.wantTTL {
+				t.Errorf("ttl annotation = %q, want %q", got, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	mockFuncs := newMockTTLFuncs()
+	mockFuncs.ttl = ptr.Int32(600)
+	mockFuncs.ttlJitter = ptr.Int32(300)
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+	// the runs completed at once
+	completionTime := fakeClock.Now()
+	deadlines := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("run-%d", i)
+		resource := &ttlMockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				UID:       types.UID(fmt.Sprintf("uid-%d", i)),
+			},
+			completed:       true,
+			completion_time: &metav1.Time{Time: completionTime},
+		}
+		mockFuncs.resources["default/"+name] = resource
+
+		err := handler.ProcessEvent(context.Background(), resource)
+		if ok, _ := controller.IsRequeueKey(err); !ok {
+			t.Fatalf("ProcessEvent() error = %v, want requeue", err)
+		}
+		deleteAfter, err := time.Parse(time.RFC3339, resource.Annotations[AnnotationDeleteAfter])
+		if err != nil {
+			t.Fatalf("invalid delete after annotation: %v", err)
+		}
+		earliest := completionTime.Add(600 * time.Second).Truncate(time.Second)
+		latest := completionTime.Add(900 * time.Second)
+		if deleteAfter.Before(earliest) || deleteAfter.After(latest) {
+			t.Errorf("deadline of %s = %v, want within [%v, %v]", name, deleteAfter, earliest, latest)
+		}
+		deadlines[resource.Annotations[AnnotationDeleteAfter]] = true
+
+		// the deadline is stable across the reconciles
+		ttl := resource.Annotations[AnnotationTTLSecondsAfterFinished]
+		err = handler.ProcessEvent(context.Background(), resource)
+		if ok, _ := controller.IsRequeueKey(err); !ok {
+			t.Fatalf("ProcessEvent() error = %v, want requeue", err)
+		}
+		if got := resource.Annotations[AnnotationTTLSecondsAfterFinished]; got != ttl {
+			t.Errorf("ttl of %s changed on the reconcile from %s to %s", name, ttl, got)
+		}
+	}
+	if len(deadlines) < 2 {
+		t.Errorf("the deadlines of the runs completed at once are not spread: %v", deadlines)
+	}
+}
+
+func TestTTLJitterOffset(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		uid := types.UID(fmt.Sprintf("uid-%d", i))
+		offset := getTTLJitterOffset(uid, 10)
+		if offset < 0 || offset > 10 {
+			t.Errorf("offset of %s = %d, want within [0, 10]", uid, offset)
+		}
+		if again := getTTLJitterOffset(uid, 10); again != offset {
+			t.Errorf("offset of %s = %d, then %d", uid, offset, again)
+		}
+	}
+}
+
+func TestTTLHandlerDeletionBackend(t *testing.T) {
+	mockFuncs := newMockTTLFuncs()
+	mockFuncs.ttl = ptr.Int32(60)
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	handler, err := NewTTLHandler(fakeClock, mockFuncs)
+	assert.NoError(t, err)
+	backend := &recordingDeletionBackend{}
+	handler.SetDeletionBackend(backend)
+
+	resource := &ttlMockResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "expired",
+			Namespace: "default",
+		},
+		completed:       true,
+		completion_time: &metav1.Time{Time: fakeClock.Now().Add(-time.Hour)},
+	}
+	mockFuncs.resources["default/expired"] = resource
+
+	assert.NoError(t, handler.ProcessEvent(context.Background(), resource))
+	assert.Equal(t, []string{"default/expired"}, backend.deleted)
+	assert.Contains(t, mockFuncs.resources, "default/expired")
+
+	// a nil backend restores the deletion with the resource funcs
+	handler.SetDeletionBackend(nil)
+	assert.NoError(t, handler.ProcessEvent(context.Background(), resource))
+	assert.NotContains(t, mockFuncs.resources, "default/expired")
+}
+
+func TestQuarantineTTL(t *testing.T) {
+	loadTestConfig(t, `quarantine:
+  matchLabels:
+    security.example.com/scan: failed
+  ttlSecondsAfterFinished: 2592000`)
+
+	mockFuncs := newMockTTLFuncs()
+	mockFuncs.ttl = ptr.Int32(3600)
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		failed  bool
+		wantTTL string
+	}{
+		{name: "quarantined failed run", labels: map[string]string{"security.example.com/scan": "failed"}, failed: true, wantTTL: "2592000"},
+		{name: "ordinary failed run", failed: true, wantTTL: "3600"},
+		// the successful runs are not quarantined
+		{name: "successful run", labels: map[string]string{"security.example.com/scan": "failed"}, wantTTL: "3600"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &ttlMockResource{
+				ObjectMeta:      metav1.ObjectMeta{Name: "run", Namespace: "default", Labels: tt.labels},
+				completed:       true,
+				failed:          tt.failed,
+				completion_time: &metav1.Time{Time: fakeClock.Now()},
+			}
+			mockFuncs.resources["default/run"] = resource
+
+			err := handler.ProcessEvent(context.Background(), resource)
+			if ok, _ := controller.IsRequeueKey(err); !ok {
+				t.Fatalf("ProcessEvent() error = %v, want requeue", err)
+			}
+			if got := resource.Annotations[AnnotationTTLSecondsAfterFinished]; got != tt.wantTTL {
+				t.Errorf("ttl = %s, want %s", got, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestRemoveStuckFinalizers(t *testing.T) {
+	t.Setenv(EnvStuckFinalizers, "example.com/orphaned, example.com/legacy")
+	t.Setenv(EnvStuckFinalizerTimeoutSeconds, "7200")
+
+	tests := []struct {
+		name           string
+		finalizers     []string
+		inDeletion     time.Duration
+		wantFinalizers []string
+	}{
+		{
+			name:           "listed finalizer after the timeout",
+			finalizers:     []string{"example.com/orphaned"},
+			inDeletion:     3 * time.Hour,
+			wantFinalizers: []string{},
+		},
+		{
+			name:           "listed finalizer before the timeout",
+			finalizers:     []string{"example.com/orphaned"},
+			inDeletion:     time.Hour,
+			wantFinalizers: []string{"example.com/orphaned"},
+		},
+		{
+			name:           "unknown finalizer",
+			finalizers:     []string{"example.com/unknown"},
+			inDeletion:     3 * time.Hour,
+			wantFinalizers: []string{"example.com/unknown"},
+		},
+		{
+			// only the listed finalizers are removed
+			name:           "listed and unknown finalizers",
+			finalizers:     []string{"example.com/legacy", "example.com/unknown"},
+			inDeletion:     3 * time.Hour,
+			wantFinalizers: []string{"example.com/unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockFuncs := newMockTTLFuncs()
+			fakeClock := clocktest.NewFakeClock(time.Now())
+			handler, err := NewTTLHandler(fakeClock, mockFuncs)
+			if err != nil {
+				t.Fatalf("NewTTLHandler() error = %v", err)
+			}
+
+			resource := &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "stuck",
+					Namespace:         "default",
+					Finalizers:        tt.finalizers,
+					DeletionTimestamp: &metav1.Time{Time: fakeClock.Now().Add(-tt.inDeletion)},
+				},
+				completed: true,
+			}
+			mockFuncs.resources["default/stuck"] = resource
+
+			if err := handler.ProcessEvent(context.Background(), resource); err != nil {
+				t.Fatalf("ProcessEvent() error = %v", err)
+			}
+			assert.Equal(t, tt.wantFinalizers, resource.Finalizers)
+		})
+	}
+}
+
+func TestStuckFinalizerTimeoutMinimum(t *testing.T) {
+	t.Setenv(EnvStuckFinalizers, "example.com/orphaned")
+	t.Setenv(EnvStuckFinalizerTimeoutSeconds, "60")
+
+	if _, err := NewTTLHandler(nil, newMockTTLFuncs()); err == nil {
+		t.Fatal("NewTTLHandler() error = nil, want an error on a timeout below the minimum")
+	}
+}
+
+func TestTTLKeepLatest(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	newRuns := func() *mockTTLFuncs {
+		mockFuncs := newMockTTLFuncs()
+		mockFuncs.ttl = ptr.Int32(1)
+		for i, age := range []time.Duration{30 * time.Minute, 20 * time.Minute, 10 * time.Minute} {
+			for _, failed := range []bool{false, true} {
+				name := fmt.Sprintf("succeeded-%d", i)
+				if failed {
+					name = fmt.Sprintf("failed-%d", i)
+				}
+				mockFuncs.resources["default/"+name] = &ttlMockResource{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      name,
+						Namespace: "default",
+						UID:       types.UID(name),
+						Labels:    map[string]string{"test.mock/resource": "build"},
+					},
+					completed:       true,
+					failed:          failed,
+					completion_time: &metav1.Time{Time: fakeClock.Now().Add(-age)},
+				}
+			}
+		}
+		// the runs of other groups do not hide the latest runs of the group
+		mockFuncs.resources["default/other"] = &ttlMockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "other",
+				Namespace: "default",
+				UID:       "other",
+				Labels:    map[string]string{"test.mock/resource": "deploy"},
+			},
+			completed:       true,
+			completion_time: &metav1.Time{Time: fakeClock.Now()},
+		}
+		return mockFuncs
+	}
+	processAll := func(t *testing.T, mockFuncs *mockTTLFuncs) {
+		handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+		for _, name := range []string{"succeeded-0", "failed-0", "succeeded-1", "failed-1", "succeeded-2", "failed-2"} {
+			// the latest runs are requeued to be checked again
+			err := handler.ProcessEvent(context.Background(), mockFuncs.resources["default/"+name])
+			if requeue, _ := controller.IsRequeueKey(err); err != nil && !requeue {
+				t.Fatalf("ProcessEvent(%s) error = %v", name, err)
+			}
+		}
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Setenv(EnvTTLKeepLatestEnabled, "true")
+		mockFuncs := newRuns()
+		processAll(t, mockFuncs)
+
+		for _, name := range []string{"succeeded-0", "failed-0", "succeeded-1", "failed-1"} {
+			assert.NotContains(t, mockFuncs.resources, "default/"+name)
+		}
+		assert.Contains(t, mockFuncs.resources, "default/succeeded-2")
+		assert.Contains(t, mockFuncs.resources, "default/failed-2")
+	})
+
+	t.Run("latest run is deleted once a newer run completes", func(t *testing.T) {
+		t.Setenv(EnvTTLKeepLatestEnabled, "true")
+		mockFuncs := newRuns()
+		handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+		latest := mockFuncs.resources["default/succeeded-2"]
+		requeue, after := controller.IsRequeueKey(handler.ProcessEvent(context.Background(), latest))
+		assert.True(t, requeue, "the latest run should be requeued")
+		assert.Equal(t, latestOfOutcomeRequeueAfter, after)
+		assert.Contains(t, mockFuncs.resources, "default/succeeded-2")
+
+		mockFuncs.resources["default/succeeded-3"] = &ttlMockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "succeeded-3",
+				Namespace: "default",
+				UID:       "succeeded-3",
+				Labels:    map[string]string{"test.mock/resource": "build"},
+			},
+			completed:       true,
+			completion_time: &metav1.Time{Time: fakeClock.Now()},
+		}
+		assert.NoError(t, handler.ProcessEvent(context.Background(), latest))
+		assert.NotContains(t, mockFuncs.resources, "default/succeeded-2")
+		assert.Contains(t, mockFuncs.resources, "default/failed-2")
+	})
+
+	t.Run("enabled by the feature flag", func(t *testing.T) {
+		loadTestConfig(t, "featureFlags:\n  ttlKeepLatest: true")
+		mockFuncs := newRuns()
+		processAll(t, mockFuncs)
+
+		assert.Len(t, mockFuncs.resources, 3)
+		assert.Contains(t, mockFuncs.resources, "default/succeeded-2")
+		assert.Contains(t, mockFuncs.resources, "default/failed-2")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv(EnvTTLKeepLatestEnabled, "false")
+		mockFuncs := newRuns()
+		processAll(t, mockFuncs)
+
+		assert.Len(t, mockFuncs.resources, 1)
+		assert.Contains(t, mockFuncs.resources, "default/other")
+	})
+}
+
+func TestEphemeralTTL(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	newRun := func(name string, annotations map[string]string) *ttlMockResource {
+		return &ttlMockResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: annotations,
+			},
+			completed:       true,
+			completion_time: &metav1.Time{Time: fakeClock.Now().Add(-10 * time.Minute)},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		config      string
+		annotations map[string]string
+		wantDeleted bool
+	}{
+		{
+			name:        "ephemeral run",
+			config:      "ephemeral:\n  ttlSecondsAfterFinished: 60",
+			annotations: map[string]string{AnnotationEphemeral: "true"},
+			wantDeleted: true,
+		},
+		{
+			name:        "ephemeral run marked by a custom annotation",
+			config:      "ephemeral:\n  annotationKey: tekton-pruner.io/ephemeral\n  ttlSecondsAfterFinished: 60",
+			annotations: map[string]string{"tekton-pruner.io/ephemeral": "true"},
+			wantDeleted: true,
+		},
+		{
+			name:   "unmarked sibling",
+			config: "ephemeral:\n  ttlSecondsAfterFinished: 60",
+		},
+		{
+			name:        "run not marked as true",
+			config:      "ephemeral:\n  ttlSecondsAfterFinished: 60",
+			annotations: map[string]string{AnnotationEphemeral: "false"},
+		},
+		{
+			// the ephemeral ttl never extends the ttl of the run
+			name:        "ephemeral ttl longer than the resolved ttl",
+			config:      "ephemeral:\n  ttlSecondsAfterFinished: 86400",
+			annotations: map[string]string{AnnotationEphemeral: "true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.config)
+			mockFuncs := newMockTTLFuncs()
+			mockFuncs.ttl = ptr.Int32(3600)
+			handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+			resource := newRun("run", tt.annotations)
+			mockFuncs.resources["default/run"] = resource
+
+			err := handler.ProcessEvent(context.Background(), resource)
+			_, deleted := mockFuncs.resources["default/run"]
+			deleted = !deleted
+			if deleted != tt.wantDeleted {
+				t.Fatalf("deleted = %v, want %v (error %v)", deleted, tt.wantDeleted, err)
+			}
+			if !deleted {
+				if ok, _ := controller.IsRequeueKey(err); !ok {
+					t.Errorf("ProcessEvent() error = %v, want requeue", err)
+				}
+				assert.Equal(t, "3600", resource.Annotations[AnnotationTTLSecondsAfterFinished])
+			}
+		})
+	}
+}
+
+func TestStartupCutoff(t *testing.T) {
+	now := time.Now()
+	cutoff := now.Add(-time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name         string
+		config       string
+		completedAgo time.Duration
+		wantDeleted  bool
+	}{
+		{
+			name:         "completed before the cutoff",
+			config:       "startupCutoffTime: " + cutoff.Format(time.RFC3339),
+			completedAgo: 2 * time.Hour,
+		},
+		{
+			name:         "completed after the cutoff",
+			config:       "startupCutoffTime: " + cutoff.Format(time.RFC3339),
+			completedAgo: 30 * time.Minute,
+			wantDeleted:  true,
+		},
+		{
+			name:         "completed before the controller start",
+			config:       "startupCutoffTime: " + StartupCutoffControllerStart,
+			completedAgo: 2 * time.Hour,
+		},
+		{
+			name:         "no cutoff",
+			config:       "ttlSecondsAfterFinished: 60",
+			completedAgo: 2 * time.Hour,
+			wantDeleted:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loadTestConfig(t, tc.config)
+
+			mockFuncs := newMockTTLFuncs()
+			mockFuncs.ttl = ptr.Int32(60)
+			handler, _ := NewTTLHandler(clocktest.NewFakeClock(now), mockFuncs)
+			resource := &ttlMockResource{
+				ObjectMeta:      metav1.ObjectMeta{Name: "test1", Namespace: "default"},
+				completed:       true,
+				completion_time: &metav1.Time{Time: now.Add(-tc.completedAgo)},
+			}
+			mockFuncs.resources["default/test1"] = resource
+
+			assert.NoError(t, handler.ProcessEvent(context.Background(), resource))
+			_, exists := mockFuncs.resources["default/test1"]
+			assert.Equal(t, tc.wantDeleted, !exists)
+			if !tc.wantDeleted {
+				assert.NotContains(t, resource.Annotations, AnnotationTTLSecondsAfterFinished, "unmanaged resource should not be annotated")
+			}
+		})
+	}
+}
+
+func TestStuckRuns(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Now())
+
+	tests := []struct {
+		name        string
+		config      string
+		startedAgo  time.Duration
+		notStarted  bool
+		wantFlagged bool
+		wantDeleted bool
+		wantRequeue time.Duration
+	}{
+		{
+			name:        "running past the max running age",
+			config:      "maxRunningAgeSeconds: 3600",
+			startedAgo:  2 * time.Hour,
+			wantFlagged: true,
+		},
+		{
+			name:        "running past the max running age with deletion",
+			config:      "maxRunningAgeSeconds: 3600\ndeleteStuckRuns: true",
+			startedAgo:  2 * time.Hour,
+			wantFlagged: true,
+			wantDeleted: true,
+		},
+		{
+			name:        "pending past the max running age",
+			config:      "maxRunningAgeSeconds: 3600",
+			startedAgo:  2 * time.Hour,
+			notStarted:  true,
+			wantFlagged: true,
+		},
+		{
+			name:        "running within the max running age",
+			config:      "maxRunningAgeSeconds: 3600\ndeleteStuckRuns: true",
+			startedAgo:  45 * time.Minute,
+			wantRequeue: 15 * time.Minute,
+		},
+		{
+			name:       "no max running age",
+			startedAgo: 24 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.config)
+			mockFuncs := newMockTTLFuncs()
+			handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+			started := metav1.NewTime(fakeClock.Now().Add(-tt.startedAgo))
+			resource := &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "run",
+					Namespace:         "default",
+					Labels:            map[string]string{"test.mock/resource": "build"},
+					CreationTimestamp: started,
+				},
+			}
+			if !tt.notStarted {
+				resource.start_time = &started
+			}
+			mockFuncs.resources["default/run"] = resource
+
+			err := handler.ProcessEvent(context.Background(), resource)
+			if tt.wantRequeue > 0 {
+				ok, delay := controller.IsRequeueKey(err)
+				assert.True(t, ok, "ProcessEvent() error = %v, want requeue", err)
+				assert.Equal(t, tt.wantRequeue, delay)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			remaining, found := mockFuncs.resources["default/run"]
+			assert.Equal(t, tt.wantDeleted, !found)
+			if found {
+				_, flagged := remaining.Annotations[AnnotationStuckSince]
+				assert.Equal(t, tt.wantFlagged, flagged)
+			}
+		})
+	}
+}
+
+func TestExcludedRunsMaxAge(t *testing.T) {
+	fakeClock := clocktest.NewFakeClock(time.Now())
+
+	tests := []struct {
+		name        string
+		config      string
+		createdAgo  time.Duration
+		running     bool
+		wantDeleted bool
+		wantRequeue time.Duration
+	}{
+		{
+			name:        "excluded run older than the max age",
+			config:      "excludeAnnotations:\n  keep: \"\"\nexcludedRunsMaxAgeSeconds: 3600",
+			createdAgo:  2 * time.Hour,
+			wantDeleted: true,
+		},
+		{
+			name:        "excluded run within the max age",
+			config:      "excludeAnnotations:\n  keep: \"\"\nexcludedRunsMaxAgeSeconds: 3600",
+			createdAgo:  45 * time.Minute,
+			wantRequeue: 15 * time.Minute,
+		},
+		{
+			name:       "running excluded run older than the max age",
+			config:     "excludeAnnotations:\n  keep: \"\"\nexcludedRunsMaxAgeSeconds: 3600",
+			createdAgo: 2 * time.Hour,
+			running:    true,
+		},
+		{
+			name:       "no max age",
+			config:     "excludeAnnotations:\n  keep: \"\"",
+			createdAgo: 24 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.config)
+			mockFuncs := newMockTTLFuncs()
+			handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+			created := metav1.NewTime(fakeClock.Now().Add(-tt.createdAgo))
+			resource := &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "run",
+					Namespace:         "default",
+					Labels:            map[string]string{"test.mock/resource": "build"},
+					Annotations:       map[string]string{"keep": "true"},
+					CreationTimestamp: created,
+				},
+				completed: !tt.running,
+			}
+			if !tt.running {
+				resource.completion_time = &created
+			}
+			mockFuncs.resources["default/run"] = resource
+
+			err := handler.ProcessEvent(context.Background(), resource)
+			if tt.wantRequeue > 0 {
+				ok, delay := controller.IsRequeueKey(err)
+				assert.True(t, ok, "ProcessEvent() error = %v, want requeue", err)
+				assert.Equal(t, tt.wantRequeue, delay)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			_, found := mockFuncs.resources["default/run"]
+			assert.Equal(t, tt.wantDeleted, !found)
+		})
+	}
+}
+
+func TestTTLSpanEvents(t *testing.T) {
+	spanRecorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	fakeClock := clocktest.NewFakeClock(time.Now())
+
+	tests := []struct {
+		name           string
+		completedAgo   time.Duration
+		parentDeleting bool
+		wantEvents     []string
+	}{
+		{
+			name:         "expired",
+			completedAgo: 2 * time.Hour,
+			wantEvents:   []string{EventTTLExpired, EventDeleted},
+		},
+		{
+			// the resource deleted along with its parent is not reported as expired
+			name:           "parent deleting",
+			completedAgo:   2 * time.Hour,
+			parentDeleting: true,
+		},
+		{
+			name:         "not expired",
+			completedAgo: 30 * time.Second,
+			wantEvents:   []string{EventTTLNotExpired},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, "")
+			mockFuncs := newMockTTLFuncs()
+			mockFuncs.parentDeleting = tt.parentDeleting
+			handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+			resource := &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "run",
+					Namespace:   "default",
+					Annotations: map[string]string{AnnotationTTLSecondsAfterFinished: "60"},
+				},
+				completed:       true,
+				completion_time: &metav1.Time{Time: fakeClock.Now().Add(-tt.completedAgo)},
+			}
+			mockFuncs.resources["default/run"] = resource
+
+			_ = handler.ProcessEvent(context.Background(), resource)
+
+			spans := spanRecorder.Ended()
+			if !assert.NotEmpty(t, spans) {
+				return
+			}
+			span := spans[len(spans)-1]
+			assert.Equal(t, "ttl.removeResource", span.Name())
+			var events []string
+			for _, event := range span.Events() {
+				events = append(events, event.Name)
+			}
+			assert.Equal(t, tt.wantEvents, events)
+		})
+	}
+}
+
+// logRecordExporter records the OTel log records exported
+type logRecordExporter struct {
+	mutex   sync.Mutex
+	records []sdklog.Record
+}
+
+func (e *logRecordExporter) Export(_ context.Context, records []sdklog.Record) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, record := range records {
+		e.records = append(e.records, record.Clone())
+	}
+	return nil
+}
+
+func (e *logRecordExporter) Shutdown(context.Context) error   { return nil }
+func (e *logRecordExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *logRecordExporter) reset() []sdklog.Record {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	records := e.records
+	e.records = nil
+	return records
+}
+
+func TestTTLLogTraceCorrelation(t *testing.T) {
+	spanRecorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	logExporter := &logRecordExporter{}
+	previousLoggerProvider := global.GetLoggerProvider()
+	global.SetLoggerProvider(sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(logExporter))))
+	t.Cleanup(func() { global.SetLoggerProvider(previousLoggerProvider) })
+
+	fakeClock := clocktest.NewFakeClock(time.Now())
+
+	tests := []struct {
+		name        string
+		config      string
+		wantTraceID bool
+	}{
+		{name: "disabled", config: "", wantTraceID: false},
+		{name: "enabled", config: "featureFlags:\n  traceLogCorrelation: true", wantTraceID: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, tt.config)
+			mockFuncs := newMockTTLFuncs()
+			handler, _ := NewTTLHandler(fakeClock, mockFuncs)
+
+			resource := &ttlMockResource{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "run",
+					Namespace:   "default",
+					Annotations: map[string]string{AnnotationTTLSecondsAfterFinished: "60"},
+				},
+				completed:       true,
+				completion_time: &metav1.Time{Time: fakeClock.Now().Add(-time.Hour)},
+			}
+			mockFuncs.resources["default/run"] = resource
+
+			var buf bytes.Buffer
+			core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zapcore.DebugLevel)
+			ctx := logging.WithLogger(context.Background(), zap.New(core).Sugar())
+
+			logExporter.reset()
+			_ = handler.ProcessEvent(ctx, resource)
+
+			spans := spanRecorder.Ended()
+			if !assert.NotEmpty(t, spans) {
+				return
+			}
+			spanContext := spans[len(spans)-1].SpanContext()
+
+			// the logs emitted within the span are exported as the OTel log records of the span
+			records := logExporter.reset()
+			assert.Equal(t, tt.wantTraceID, len(records) > 0)
+			for _, record := range records {
+				assert.Equal(t, spanContext.TraceID(), record.TraceID(), "log record %q", record.Body().AsString())
+				assert.Equal(t, spanContext.SpanID(), record.SpanID(), "log record %q", record.Body().AsString())
+			}
+
+			// the logs emitted before the span is started carry no trace ID
+			correlated := 0
+			for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+				var record map[string]interface{}
+				if !assert.NoError(t, json.Unmarshal(line, &record)) {
+					continue
+				}
+				if _, found := record[logFieldTraceID]; !found {
+					continue
+				}
+				correlated++
+				assert.Equal(t, spanContext.TraceID().String(), record[logFieldTraceID], "log %q", record["msg"])
+				assert.Equal(t, spanContext.SpanID().String(), record[logFieldSpanID], "log %q", record["msg"])
+			}
+			assert.Equal(t, tt.wantTraceID, correlated > 0)
+		})
+	}
+}
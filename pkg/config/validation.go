@@ -0,0 +1,470 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ValidatePrunerConfig parses the pruner config data and validates all the fields against the limits,
+// returns the warnings on the fields which are accepted but ambiguous
+func ValidatePrunerConfig(data string, limits ConfigLimits) ([]string, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	globalConfig := &GlobalConfig{}
+	if err := yaml.Unmarshal([]byte(data), globalConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", PrunerGlobalConfigKey, err)
+	}
+
+	if err := ValidatePrunerConfigFields(globalConfig, limits).ToAggregate(); err != nil {
+		return nil, err
+	}
+
+	return PrunerConfigWarnings(globalConfig), nil
+}
+
+// ValidateTektonPrunerSpec parses the spec of a TektonPruner resource and validates it as a namespace spec
+// against the limits, returns the warnings on the fields which are accepted but ambiguous
+func ValidateTektonPrunerSpec(namespace string, data []byte, limits ConfigLimits) ([]string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	namespaceSpec := NamespaceSpec{}
+	if err := json.Unmarshal(data, &namespaceSpec); err != nil {
+		return nil, fmt.Errorf("failed to parse spec: %w", err)
+	}
+
+	fldPath := field.NewPath("spec")
+	// the global level is not known here, the store ignores the level which does not narrow it
+	errs := ValidateNamespaceSpec(namespace, namespaceSpec, nil, fldPath)
+	errs = append(errs, limits.validate(map[string]NamespaceSpec{namespace: namespaceSpec}, fldPath)...)
+	if err := errs.ToAggregate(); err != nil {
+		return nil, err
+	}
+
+	return NamespaceSpecWarnings(namespaceSpec, fldPath), nil
+}
+
+// PrunerConfigWarnings returns the warnings of all the levels of the config
+func PrunerConfigWarnings(globalConfig *GlobalConfig) []string {
+	warnings := prunerConfigSpecWarnings(globalConfig.PrunerConfig, nil)
+	warnings = append(warnings, noRetentionWarnings(globalConfig)...)
+
+	for namespace, namespaceSpec := range globalConfig.Namespaces {
+		warnings = append(warnings, NamespaceSpecWarnings(namespaceSpec, field.NewPath("namespaces").Key(namespace))...)
+	}
+
+	// namespaces are iterated in random order
+	sort.Strings(warnings)
+	return warnings
+}
+
+// NamespaceSpecWarnings returns the warnings of the namespace level config and its resource specs
+func NamespaceSpecWarnings(namespaceSpec NamespaceSpec, fldPath *field.Path) []string {
+	warnings := prunerConfigSpecWarnings(namespaceSpec.PrunerConfig, fldPath)
+	for index, resourceSpec := range namespaceSpec.PipelineRuns {
+		warnings = append(warnings, prunerConfigSpecWarnings(resourceSpec.PrunerConfig, fldPath.Child("pipelineRuns").Index(index))...)
+	}
+	for index, resourceSpec := range namespaceSpec.TaskRuns {
+		warnings = append(warnings, prunerConfigSpecWarnings(resourceSpec.PrunerConfig, fldPath.Child("taskRuns").Index(index))...)
+	}
+	return warnings
+}
+
+// noRetentionWarnings warns when the config is enforced globally without any retention setting on the global level.
+// The namespace and the resource levels are ignored then, so the pruner deletes no run
+func noRetentionWarnings(globalConfig *GlobalConfig) []string {
+	if globalConfig.EnforcedConfigLevel == nil || *globalConfig.EnforcedConfigLevel != EnforcedConfigLevelGlobal {
+		return nil
+	}
+
+	prunerConfig := globalConfig.PrunerConfig
+	retentionSettings := []*int32{
+		prunerConfig.TTLSecondsAfterFinished,
+		prunerConfig.TTLSecondsAfterFinishedWithoutResults,
+		prunerConfig.SuccessfulHistoryLimit,
+		prunerConfig.FailedHistoryLimit,
+		prunerConfig.HistoryLimit,
+		prunerConfig.MaxRetentionAgeSeconds,
+		globalConfig.MaxCompletedRunsPerNamespace,
+	}
+	for _, setting := range retentionSettings {
+		if setting != nil {
+			return nil
+		}
+	}
+
+	return []string{"enforcedConfigLevel: is global but neither ttlSecondsAfterFinished nor a history limit is set globally, no run is pruned"}
+}
+
+// deprecatedField is a field of the pruner config which is still accepted but superseded
+type deprecatedField struct {
+	// name of the field as it is written on the config
+	name string
+	// isSet returns true when the field is set on the given level
+	isSet func(PrunerConfig) bool
+	// hint tells the users how to migrate away from the field
+	hint string
+}
+
+// deprecatedFields lists the deprecated fields of the pruner config, a warning with the migration
+// hint is returned to the client for each of them set on any level, the request is not rejected
+var deprecatedFields []deprecatedField
+
+// prunerConfigSpecWarnings returns the warnings of a single level of the config
+func prunerConfigSpecWarnings(prunerConfig PrunerConfig, fldPath *field.Path) []string {
+	return append(historyLimitWarnings(prunerConfig, fldPath), deprecationWarnings(prunerConfig, fldPath)...)
+}
+
+// deprecationWarnings warns on the deprecated fields set on the given level
+func deprecationWarnings(prunerConfig PrunerConfig, fldPath *field.Path) []string {
+	var warnings []string
+	for _, deprecated := range deprecatedFields {
+		if deprecated.isSet(prunerConfig) {
+			warnings = append(warnings, fmt.Sprintf("%s: is deprecated, %s", fldPath.Child(deprecated.name), deprecated.hint))
+		}
+	}
+	return warnings
+}
+
+// historyLimitWarnings warns when historyLimit is set along with the split limits on the same level.
+// The split limits take precedence, historyLimit applies only to the split limit which is not set
+func historyLimitWarnings(prunerConfig PrunerConfig, fldPath *field.Path) []string {
+	if prunerConfig.HistoryLimit == nil {
+		return nil
+	}
+
+	var overridden []string
+	if prunerConfig.SuccessfulHistoryLimit != nil {
+		overridden = append(overridden, "successfulHistoryLimit")
+	}
+	if prunerConfig.FailedHistoryLimit != nil {
+		overridden = append(overridden, "failedHistoryLimit")
+	}
+	if len(overridden) == 0 {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("%s: is overridden by %s set on the same level",
+		fldPath.Child("historyLimit"), strings.Join(overridden, " and "))}
+}
+
+// ValidatePrunerConfigFields validates the cluster-wide config and all the namespaces specs in it against the limits
+func ValidatePrunerConfigFields(globalConfig *GlobalConfig, limits ConfigLimits) field.ErrorList {
+	errs := validatePrunerConfigSpec(globalConfig.PrunerConfig, nil)
+
+	for key := range globalConfig.ExcludeAnnotations {
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs = append(errs, field.Invalid(field.NewPath("excludeAnnotations").Key(key), key, msg))
+		}
+	}
+
+	// the local timezone of the controller container is not a defined timezone
+	if globalConfig.Timezone == "Local" {
+		errs = append(errs, field.Invalid(field.NewPath("timezone"), globalConfig.Timezone, "must be an IANA timezone name"))
+	} else if _, err := time.LoadLocation(globalConfig.Timezone); err != nil {
+		errs = append(errs, field.Invalid(field.NewPath("timezone"), globalConfig.Timezone, fmt.Sprintf("must be an IANA timezone name: %v", err)))
+	}
+
+	for bucket, limit := range globalConfig.FailedHistoryLimitsByBucket {
+		if limit < 0 {
+			errs = append(errs, field.Invalid(field.NewPath("failedHistoryLimitsByBucket").Key(bucket), limit, "must be greater than or equal to 0"))
+		}
+	}
+	for reason, bucket := range globalConfig.FailureReasonMapping {
+		if bucket == "" {
+			errs = append(errs, field.Required(field.NewPath("failureReasonMapping").Key(reason), "bucket must not be empty"))
+		}
+	}
+
+	if globalConfig.Quarantine != nil {
+		errs = append(errs, validateQuarantine(*globalConfig.Quarantine, field.NewPath("quarantine"))...)
+	}
+
+	if globalConfig.Ephemeral != nil {
+		errs = append(errs, validateEphemeral(*globalConfig.Ephemeral, field.NewPath("ephemeral"))...)
+	}
+
+	for flag := range globalConfig.FeatureFlags {
+		if !slices.Contains(FeatureFlags, flag) {
+			errs = append(errs, field.NotSupported(field.NewPath("featureFlags").Key(string(flag)), flag, FeatureFlags))
+		}
+	}
+
+	if limit := globalConfig.MaxCompletedRunsPerNamespace; limit != nil && *limit < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("maxCompletedRunsPerNamespace"), *limit, "must be greater than or equal to 0"))
+	}
+
+	if age := globalConfig.MaxRunningAgeSeconds; age != nil && *age <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("maxRunningAgeSeconds"), *age, "must be greater than 0"))
+	}
+	if globalConfig.DeleteStuckRuns && globalConfig.MaxRunningAgeSeconds == nil {
+		errs = append(errs, field.Required(field.NewPath("maxRunningAgeSeconds"), "must be set when deleteStuckRuns is set"))
+	}
+	if age := globalConfig.ExcludedRunsMaxAgeSeconds; age != nil && *age <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("excludedRunsMaxAgeSeconds"), *age, "must be greater than 0"))
+	}
+	if cooldown := globalConfig.HistoryCleanupCooldownSeconds; cooldown != nil && *cooldown < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("historyCleanupCooldownSeconds"), *cooldown, "must be greater than or equal to 0"))
+	}
+	if step := globalConfig.HistoryLimitTighteningStep; step != nil && *step <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("historyLimitTighteningStep"), *step, "must be greater than 0"))
+	}
+	if cutoff := globalConfig.StartupCutoffTime; cutoff != "" {
+		if _, valid := parseStartupCutoff(cutoff); !valid {
+			errs = append(errs, field.Invalid(field.NewPath("startupCutoffTime"), cutoff, "must be "+StartupCutoffControllerStart+" or a time in RFC3339 format"))
+		}
+	}
+
+	for namespace, namespaceSpec := range globalConfig.Namespaces {
+		errs = append(errs, ValidateNamespaceSpec(namespace, namespaceSpec, globalConfig.EnforcedConfigLevel, field.NewPath("namespaces").Key(namespace))...)
+	}
+
+	errs = append(errs, limits.validate(globalConfig.Namespaces, field.NewPath("namespaces"))...)
+
+	return errs
+}
+
+// ConfigLimits bounds the size of the config, every namespace and selector entry of the config is matched
+// on each resolution of the controller. A limit which is not positive does not limit the config
+type ConfigLimits struct {
+	// MaxNamespaces limits the number of namespaces of the config
+	MaxNamespaces int
+	// MaxSelectors limits the number of the pipelineRuns and taskRuns entries of all the namespaces
+	MaxSelectors int
+}
+
+// validate rejects the namespaces which hold more namespaces or selectors than the limits
+func (cl ConfigLimits) validate(namespaces map[string]NamespaceSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if cl.MaxNamespaces > 0 && len(namespaces) > cl.MaxNamespaces {
+		errs = append(errs, field.TooMany(fldPath, len(namespaces), cl.MaxNamespaces))
+	}
+
+	if cl.MaxSelectors > 0 {
+		selectors := 0
+		for _, namespaceSpec := range namespaces {
+			selectors += len(namespaceSpec.PipelineRuns) + len(namespaceSpec.TaskRuns)
+		}
+		if selectors > cl.MaxSelectors {
+			errs = append(errs, field.Forbidden(fldPath, fmt.Sprintf("holds %d pipelineRuns and taskRuns entries, must have at most %d", selectors, cl.MaxSelectors)))
+		}
+	}
+
+	return errs
+}
+
+// ValidateNamespaceSpec validates the namespace level config and its resource specs,
+// the enforcedConfigLevel of the global config is nil when it is not known or not set
+func ValidateNamespaceSpec(namespace string, namespaceSpec NamespaceSpec, globalLevel *EnforcedConfigLevel, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	for _, msg := range validation.IsDNS1123Label(namespace) {
+		errs = append(errs, field.Invalid(fldPath, namespace, msg))
+	}
+
+	errs = append(errs, validatePrunerConfigSpec(namespaceSpec.PrunerConfig, fldPath)...)
+
+	errs = append(errs, validateEnforcedConfigLevel(globalLevel, namespaceSpec.EnforcedConfigLevel, fldPath)...)
+	namespaceLevel := namespaceSpec.EnforcedConfigLevel
+	if namespaceLevel == nil {
+		namespaceLevel = globalLevel
+	}
+
+	for index, resourceSpec := range namespaceSpec.PipelineRuns {
+		resourcePath := fldPath.Child("pipelineRuns").Index(index)
+		errs = append(errs, validateResourceSpec(resourceSpec, resourcePath)...)
+		errs = append(errs, validateEnforcedConfigLevel(namespaceLevel, resourceSpec.EnforcedConfigLevel, resourcePath)...)
+	}
+	for index, resourceSpec := range namespaceSpec.TaskRuns {
+		resourcePath := fldPath.Child("taskRuns").Index(index)
+		errs = append(errs, validateResourceSpec(resourceSpec, resourcePath)...)
+		errs = append(errs, validateEnforcedConfigLevel(namespaceLevel, resourceSpec.EnforcedConfigLevel, resourcePath)...)
+	}
+	for index, override := range namespaceSpec.TTLOverrides {
+		errs = append(errs, validateTTLOverride(override, fldPath.Child("ttlOverrides").Index(index))...)
+	}
+
+	return errs
+}
+
+// validateEnforcedConfigLevel rejects the enforcedConfigLevel of a nested config which opens the config to a
+// narrower scope than the enclosing config does, for example resource on a namespace when the global level is namespace
+func validateEnforcedConfigLevel(enclosing, nested *EnforcedConfigLevel, fldPath *field.Path) field.ErrorList {
+	if enclosing == nil || nested == nil || enclosing.Allows(*nested) {
+		return nil
+	}
+	return field.ErrorList{field.Invalid(fldPath.Child("enforcedConfigLevel"), *nested,
+		fmt.Sprintf("must not be narrower than the enforcedConfigLevel %q of the enclosing config", *enclosing))}
+}
+
+// validateResourceSpec validates a resource level config, it should be identified by name or by selector
+func validateResourceSpec(resourceSpec ResourceSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if resourceSpec.Name == "" && len(resourceSpec.Selector) == 0 {
+		errs = append(errs, field.Required(fldPath, "either name or selector must be specified"))
+	}
+
+	for index, selector := range resourceSpec.Selector {
+		selectorPath := fldPath.Child("selector").Index(index)
+		if len(selector.MatchLabels) == 0 && len(selector.MatchAnnotations) == 0 && len(selector.MatchOwnerReferences) == 0 {
+			errs = append(errs, field.Required(selectorPath, "either matchLabels, matchAnnotations or matchOwnerReferences must be specified"))
+		}
+		for ownerIndex, ownerReference := range selector.MatchOwnerReferences {
+			if ownerReference.Kind == "" {
+				errs = append(errs, field.Required(selectorPath.Child("matchOwnerReferences").Index(ownerIndex).Child("kind"), ""))
+			}
+		}
+	}
+
+	errs = append(errs, validatePrunerConfigSpec(resourceSpec.PrunerConfig, fldPath)...)
+
+	return errs
+}
+
+// validateTTLOverride validates a label based ttl override of a namespace
+func validateTTLOverride(override TTLOverride, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if strings.TrimSpace(override.LabelSelector) == "" {
+		errs = append(errs, field.Required(fldPath.Child("labelSelector"), ""))
+	} else if _, err := labels.Parse(override.LabelSelector); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("labelSelector"), override.LabelSelector, err.Error()))
+	}
+
+	if override.TTLSecondsAfterFinished == nil {
+		errs = append(errs, field.Required(fldPath.Child("ttlSecondsAfterFinished"), ""))
+	} else if *override.TTLSecondsAfterFinished < -1 {
+		errs = append(errs, field.Invalid(fldPath.Child("ttlSecondsAfterFinished"), *override.TTLSecondsAfterFinished, "must be greater than or equal to -1"))
+	}
+
+	return errs
+}
+
+// validateQuarantine validates the quarantine of the failed runs, it must match on a label or an annotation
+func validateQuarantine(quarantine QuarantineConfig, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(quarantine.MatchLabels) == 0 && len(quarantine.MatchAnnotations) == 0 {
+		errs = append(errs, field.Required(fldPath, "matchLabels or matchAnnotations must be set"))
+	}
+	for key := range quarantine.MatchLabels {
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs = append(errs, field.Invalid(fldPath.Child("matchLabels").Key(key), key, msg))
+		}
+	}
+	for key := range quarantine.MatchAnnotations {
+		for _, msg := range validation.IsQualifiedName(key) {
+			errs = append(errs, field.Invalid(fldPath.Child("matchAnnotations").Key(key), key, msg))
+		}
+	}
+
+	if ttl := quarantine.TTLSecondsAfterFinished; ttl != nil && *ttl < -1 {
+		errs = append(errs, field.Invalid(fldPath.Child("ttlSecondsAfterFinished"), *ttl, "must be greater than or equal to -1"))
+	}
+	if limit := quarantine.HistoryLimit; limit != nil && *limit < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("historyLimit"), *limit, "must be greater than or equal to 0"))
+	}
+
+	return errs
+}
+
+// validateEphemeral validates the config of the ephemeral runs, it must shorten the ttl or limit the runs
+func validateEphemeral(ephemeral EphemeralConfig, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if ephemeral.TTLSecondsAfterFinished == nil && ephemeral.HistoryLimit == nil {
+		errs = append(errs, field.Required(fldPath, "ttlSecondsAfterFinished or historyLimit must be set"))
+	}
+	if ephemeral.AnnotationKey != "" {
+		for _, msg := range validation.IsQualifiedName(ephemeral.AnnotationKey) {
+			errs = append(errs, field.Invalid(fldPath.Child("annotationKey"), ephemeral.AnnotationKey, msg))
+		}
+	}
+	if ttl := ephemeral.TTLSecondsAfterFinished; ttl != nil && *ttl < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("ttlSecondsAfterFinished"), *ttl, "must be greater than or equal to 0"))
+	}
+	if limit := ephemeral.HistoryLimit; limit != nil && *limit < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("historyLimit"), *limit, "must be greater than or equal to 0"))
+	}
+
+	return errs
+}
+
+// validatePrunerConfigSpec validates the pruner config fields available on every level
+func validatePrunerConfigSpec(prunerConfig PrunerConfig, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if prunerConfig.EnforcedConfigLevel != nil {
+		switch *prunerConfig.EnforcedConfigLevel {
+		case EnforcedConfigLevelGlobal, EnforcedConfigLevelNamespace, EnforcedConfigLevelResource:
+		default:
+			errs = append(errs, field.NotSupported(fldPath.Child("enforcedConfigLevel"), *prunerConfig.EnforcedConfigLevel,
+				[]string{string(EnforcedConfigLevelGlobal), string(EnforcedConfigLevelNamespace), string(EnforcedConfigLevelResource)}))
+		}
+	}
+
+	// -1 is allowed on ttl, to disable the ttl on a specific level
+	if ttl := prunerConfig.TTLSecondsAfterFinished; ttl != nil && *ttl < -1 {
+		errs = append(errs, field.Invalid(fldPath.Child("ttlSecondsAfterFinished"), *ttl, "must be greater than or equal to -1"))
+	}
+	if ttl := prunerConfig.TTLSecondsAfterFinishedWithoutResults; ttl != nil && *ttl < -1 {
+		errs = append(errs, field.Invalid(fldPath.Child("ttlSecondsAfterFinishedWithoutResults"), *ttl, "must be greater than or equal to -1"))
+	}
+	if jitter := prunerConfig.TTLJitterSeconds; jitter != nil && *jitter < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("ttlJitterSeconds"), *jitter, "must be greater than or equal to 0"))
+	}
+	// -1 is allowed on the max retention age, to disable it on a specific level
+	if age := prunerConfig.MaxRetentionAgeSeconds; age != nil && *age < -1 {
+		errs = append(errs, field.Invalid(fldPath.Child("maxRetentionAgeSeconds"), *age, "must be greater than or equal to -1"))
+	}
+
+	limits := []struct {
+		name  string
+		value *int32
+	}{
+		{name: "successfulHistoryLimit", value: prunerConfig.SuccessfulHistoryLimit},
+		{name: "failedHistoryLimit", value: prunerConfig.FailedHistoryLimit},
+		{name: "historyLimit", value: prunerConfig.HistoryLimit},
+		{name: "minRetained", value: prunerConfig.MinRetained},
+		{name: "minRetentionSeconds", value: prunerConfig.MinRetentionSeconds},
+		{name: "minRetainedPerOutcome", value: prunerConfig.MinRetainedPerOutcome},
+		{name: "retainCalendarDays", value: prunerConfig.RetainCalendarDays},
+	}
+	for _, limit := range limits {
+		if limit.value != nil && *limit.value < 0 {
+			errs = append(errs, field.Invalid(fldPath.Child(limit.name), *limit.value, "must be greater than or equal to 0"))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,404 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	validTestConfig = `enforcedConfigLevel: namespace
+ttlSecondsAfterFinished: 300
+namespaces:
+  dev:
+    successfulHistoryLimit: 5
+    pipelineRuns:
+      - name: build
+        ttlSecondsAfterFinished: 60`
+
+	invalidTestConfig = `enforcedConfigLevel: bogus
+ttlSecondsAfterFinished: -5`
+)
+
+func TestValidatePrunerConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		wantErr      string
+		wantWarnings bool
+	}{
+		{
+			name: "empty config",
+			data: "  ",
+		},
+		{
+			name:    "malformed yaml",
+			data:    "ttlSecondsAfterFinished: [",
+			wantErr: "failed to parse",
+		},
+		{
+			name: "valid config",
+			data: validTestConfig,
+		},
+		{
+			name:    "invalid config",
+			data:    invalidTestConfig,
+			wantErr: "ttlSecondsAfterFinished: Invalid value: -5",
+		},
+		{
+			name: "resource spec without name and selector",
+			data: `namespaces:
+  dev:
+    taskRuns:
+      - ttlSecondsAfterFinished: 60`,
+			wantErr: "namespaces[dev].taskRuns[0]: Required value",
+		},
+		{
+			name: "enforced globally without a retention setting",
+			data: `enforcedConfigLevel: global
+namespaces:
+  dev:
+    ttlSecondsAfterFinished: 60`,
+			wantWarnings: true,
+		},
+		{
+			name: "enforced globally with a ttl",
+			data: "enforcedConfigLevel: global\nttlSecondsAfterFinished: 60",
+		},
+		{
+			name: "enforced globally with a history limit",
+			data: "enforcedConfigLevel: global\nfailedHistoryLimit: 3",
+		},
+		{
+			name: "enforced on namespace without a global retention setting",
+			data: "enforcedConfigLevel: namespace\nnamespaces:\n  dev:\n    ttlSecondsAfterFinished: 60",
+		},
+		{
+			name:         "historyLimit along with the split limits",
+			data:         "historyLimit: 5\nsuccessfulHistoryLimit: 3",
+			wantWarnings: true,
+		},
+		{
+			name: "historyLimit along with the split limits on a resource",
+			data: `namespaces:
+  dev:
+    pipelineRuns:
+      - name: build
+        historyLimit: 5
+        failedHistoryLimit: 2`,
+			wantWarnings: true,
+		},
+		{
+			name: "historyLimit alone",
+			data: "historyLimit: 5",
+		},
+		{
+			name: "successfulHistoryLimit alone",
+			data: "successfulHistoryLimit: 5",
+		},
+		{
+			name: "failedHistoryLimit alone",
+			data: "failedHistoryLimit: 5",
+		},
+		{
+			name: "valid exclude annotations",
+			data: "excludeAnnotations:\n  backup: required\n  example.com/keep: \"\"",
+		},
+		{
+			name: "retention",
+			data: "successfulHistoryLimit: 20\nminRetained: 5\nmaxRetentionAgeSeconds: 604800",
+		},
+		{
+			name:    "invalid retention",
+			data:    "minRetained: -1\nmaxRetentionAgeSeconds: -5",
+			wantErr: "maxRetentionAgeSeconds: Invalid value: -5",
+		},
+		{
+			name:    "invalid min retention",
+			data:    "minRetentionSeconds: -1",
+			wantErr: "minRetentionSeconds: Invalid value: -1",
+		},
+		{
+			name:    "invalid min retained per outcome",
+			data:    "historyLimit: 5\nminRetainedPerOutcome: -1",
+			wantErr: "minRetainedPerOutcome: Invalid value: -1",
+		},
+		{
+			name: "failure buckets",
+			data: "failureReasonMapping:\n  PipelineRunTimeout: timeout\nfailedHistoryLimitsByBucket:\n  timeout: 3",
+		},
+		{
+			name:    "invalid failure bucket limit",
+			data:    "failureReasonMapping:\n  PipelineRunTimeout: timeout\nfailedHistoryLimitsByBucket:\n  timeout: -1",
+			wantErr: "failedHistoryLimitsByBucket[timeout]: Invalid value: -1",
+		},
+		{
+			name: "timezone",
+			data: "timezone: Europe/Berlin\nretainCalendarDays: 1",
+		},
+		{
+			name:    "invalid timezone",
+			data:    "timezone: Nowhere/Atlantis",
+			wantErr: "timezone: Invalid value: \"Nowhere/Atlantis\"",
+		},
+		{
+			name:    "local timezone",
+			data:    "timezone: Local",
+			wantErr: "timezone: Invalid value: \"Local\": must be an IANA timezone name",
+		},
+		{
+			name: "quarantine",
+			data: "quarantine:\n  matchLabels:\n    security.example.com/scan: failed\n  ttlSecondsAfterFinished: 2592000\n  historyLimit: 50",
+		},
+		{
+			name: "ephemeral",
+			data: "ephemeral:\n  annotationKey: tekton-pruner.io/ephemeral\n  ttlSecondsAfterFinished: 60\n  historyLimit: 1",
+		},
+		{
+			name:    "ephemeral without a ttl or a limit",
+			data:    "ephemeral:\n  annotationKey: tekton-pruner.io/ephemeral",
+			wantErr: "ephemeral: Required value: ttlSecondsAfterFinished or historyLimit must be set",
+		},
+		{
+			name:    "negative ephemeral ttl",
+			data:    "ephemeral:\n  ttlSecondsAfterFinished: -1",
+			wantErr: "ephemeral.ttlSecondsAfterFinished: Invalid value: -1: must be greater than or equal to 0",
+		},
+		{
+			name: "feature flags",
+			data: "featureFlags:\n  ttlKeepLatest: true\n  retainedByAnnotation: false",
+		},
+		{
+			name:    "unknown feature flag",
+			data:    "featureFlags:\n  softDelete: true",
+			wantErr: "featureFlags[softDelete]: Unsupported value: \"softDelete\": supported values: \"retainedByAnnotation\", \"ttlKeepLatest\"",
+		},
+		{
+			name: "max completed runs per namespace",
+			data: "maxCompletedRunsPerNamespace: 500",
+		},
+		{
+			name:    "negative max completed runs per namespace",
+			data:    "maxCompletedRunsPerNamespace: -1",
+			wantErr: "maxCompletedRunsPerNamespace: Invalid value: -1: must be greater than or equal to 0",
+		},
+		{
+			name: "history limit tightening step",
+			data: "historyLimitTighteningStep: 10",
+		},
+		{
+			name:    "zero history limit tightening step",
+			data:    "historyLimitTighteningStep: 0",
+			wantErr: "historyLimitTighteningStep: Invalid value: 0: must be greater than 0",
+		},
+		{
+			name: "max running age",
+			data: "maxRunningAgeSeconds: 86400\ndeleteStuckRuns: true",
+		},
+		{
+			name:    "zero max running age",
+			data:    "maxRunningAgeSeconds: 0",
+			wantErr: "maxRunningAgeSeconds: Invalid value: 0: must be greater than 0",
+		},
+		{
+			name:    "delete stuck runs without a max running age",
+			data:    "deleteStuckRuns: true",
+			wantErr: "maxRunningAgeSeconds: Required value: must be set when deleteStuckRuns is set",
+		},
+		{
+			name: "excluded runs max age",
+			data: "excludeAnnotations:\n  keep: \"\"\nexcludedRunsMaxAgeSeconds: 2592000",
+		},
+		{
+			name:    "negative history cleanup cooldown",
+			data:    "historyCleanupCooldownSeconds: -60",
+			wantErr: "historyCleanupCooldownSeconds: Invalid value: -60: must be greater than or equal to 0",
+		},
+		{
+			name:    "invalid startup cutoff time",
+			data:    "startupCutoffTime: yesterday",
+			wantErr: "startupCutoffTime: Invalid value: \"yesterday\": must be controllerStart or a time in RFC3339 format",
+		},
+		{
+			name:    "negative excluded runs max age",
+			data:    "excludedRunsMaxAgeSeconds: -1",
+			wantErr: "excludedRunsMaxAgeSeconds: Invalid value: -1: must be greater than 0",
+		},
+		{
+			name:    "quarantine without a match",
+			data:    "quarantine:\n  historyLimit: 50",
+			wantErr: "quarantine: Required value: matchLabels or matchAnnotations must be set",
+		},
+		{
+			name:    "invalid quarantine history limit",
+			data:    "quarantine:\n  matchAnnotations:\n    security.example.com/quarantine: \"\"\n  historyLimit: -1",
+			wantErr: "quarantine.historyLimit: Invalid value: -1",
+		},
+		{
+			name:    "invalid ttl jitter",
+			data:    "ttlSecondsAfterFinished: 600\nttlJitterSeconds: -10",
+			wantErr: "ttlJitterSeconds: Invalid value: -10",
+		},
+		{
+			name:    "invalid exclude annotation key",
+			data:    "excludeAnnotations:\n  \"bad key\": required",
+			wantErr: "excludeAnnotations[bad key]: Invalid value",
+		},
+		{
+			name: "resource spec selecting by owner reference",
+			data: `namespaces:
+  dev:
+    pipelineRuns:
+      - selector:
+          - matchOwnerReferences:
+              - kind: EventListener
+        successfulHistoryLimit: 1`,
+		},
+		{
+			name: "owner reference selector without kind",
+			data: `namespaces:
+  dev:
+    pipelineRuns:
+      - selector:
+          - matchOwnerReferences:
+              - name: listener
+        successfulHistoryLimit: 1`,
+			wantErr: "namespaces[dev].pipelineRuns[0].selector[0].matchOwnerReferences[0].kind: Required value",
+		},
+		{
+			name: "invalid ttl override",
+			data: `namespaces:
+  dev:
+    ttlOverrides:
+      - labelSelector: "priority in (low"
+        ttlSecondsAfterFinished: 60`,
+			wantErr: "namespaces[dev].ttlOverrides[0].labelSelector: Invalid value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := ValidatePrunerConfig(tt.data, ConfigLimits{})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+			assert.Equal(t, tt.wantWarnings, len(warnings) > 0)
+		})
+	}
+}
+
+func TestValidateTektonPrunerSpec(t *testing.T) {
+	tests := []struct {
+		name         string
+		spec         string
+		wantErr      string
+		wantWarnings bool
+	}{
+		{
+			name: "valid spec",
+			spec: `{"successfulHistoryLimit":5,"pipelineRuns":[{"name":"build","ttlSecondsAfterFinished":60}]}`,
+		},
+		{
+			name:    "negative history limit",
+			spec:    `{"failedHistoryLimit":-1}`,
+			wantErr: "spec.failedHistoryLimit: Invalid value: -1: must be greater than or equal to 0",
+		},
+		{
+			name:    "resource spec without name and selector",
+			spec:    `{"taskRuns":[{"ttlSecondsAfterFinished":60}]}`,
+			wantErr: "spec.taskRuns[0]: Required value: either name or selector must be specified",
+		},
+		{
+			name:         "historyLimit along with the split limits",
+			spec:         `{"historyLimit":5,"successfulHistoryLimit":3}`,
+			wantWarnings: true,
+		},
+		{
+			name:    "malformed spec",
+			spec:    `{"historyLimit":`,
+			wantErr: "failed to parse spec",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := ValidateTektonPrunerSpec("dev", []byte(tt.spec), ConfigLimits{})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+			assert.Equal(t, tt.wantWarnings, len(warnings) > 0)
+		})
+	}
+}
+
+func TestValidateConfigLimits(t *testing.T) {
+	const limitedConfig = `namespaces:
+  dev:
+    pipelineRuns:
+      - name: build
+        ttlSecondsAfterFinished: 60
+    taskRuns:
+      - name: lint
+        ttlSecondsAfterFinished: 60
+  prod:
+    pipelineRuns:
+      - name: deploy
+        ttlSecondsAfterFinished: 600`
+
+	tests := []struct {
+		name    string
+		limits  ConfigLimits
+		wantErr string
+	}{
+		{name: "no limits"},
+		{name: "under the limits", limits: ConfigLimits{MaxNamespaces: 3, MaxSelectors: 4}},
+		{name: "at the limits", limits: ConfigLimits{MaxNamespaces: 2, MaxSelectors: 3}},
+		{name: "over the namespace limit", limits: ConfigLimits{MaxNamespaces: 1}, wantErr: "namespaces: Too many: 2: must have at most 1 items"},
+		{name: "over the selector limit", limits: ConfigLimits{MaxSelectors: 2}, wantErr: "holds 3 pipelineRuns and taskRuns entries, must have at most 2"},
+		{name: "negative limit is ignored", limits: ConfigLimits{MaxNamespaces: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidatePrunerConfig(limitedConfig, tt.limits)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeprecatedFieldWarnings(t *testing.T) {
+	original := deprecatedFields
+	deprecatedFields = []deprecatedField{{
+		name:  "historyLimit",
+		isSet: func(prunerConfig PrunerConfig) bool { return prunerConfig.HistoryLimit != nil },
+		hint:  "use successfulHistoryLimit and failedHistoryLimit instead",
+	}}
+	t.Cleanup(func() { deprecatedFields = original })
+
+	warnings, err := ValidatePrunerConfig(`historyLimit: 5
+namespaces:
+  dev:
+    pipelineRuns:
+      - name: build
+        historyLimit: 3`, ConfigLimits{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"historyLimit: is deprecated, use successfulHistoryLimit and failedHistoryLimit instead",
+		"namespaces[dev].pipelineRuns[0].historyLimit: is deprecated, use successfulHistoryLimit and failedHistoryLimit instead",
+	}, warnings)
+
+	// the config without the deprecated fields is accepted without warnings
+	warnings, err = ValidatePrunerConfig("successfulHistoryLimit: 5", ConfigLimits{})
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+}
@@ -33,13 +33,25 @@ const (
 	MetricResourcesProcessed        = "tekton_pruner_controller_resources_processed"
 	MetricReconciliationEvents      = "tekton_pruner_controller_reconciliation_events"
 	MetricResourcesDeleted          = "tekton_pruner_controller_resources_deleted"
+	MetricResourcesQueued           = "tekton_pruner_controller_resources_queued"
 	MetricResourcesErrors           = "tekton_pruner_controller_resources_errors"
+	MetricResourcesSkipped          = "tekton_pruner_controller_resources_skipped"
 	MetricReconciliationDuration    = "tekton_pruner_controller_reconciliation_duration"
 	MetricTTLProcessingDuration     = "tekton_pruner_controller_ttl_processing_duration"
 	MetricHistoryProcessingDuration = "tekton_pruner_controller_history_processing_duration"
 	MetricActiveResourcesCount      = "tekton_pruner_controller_active_resources"
 	MetricPendingDeletionsCount     = "tekton_pruner_controller_pending_deletions"
 	MetricResourceAgeAtDeletion     = "tekton_pruner_controller_resource_age_at_deletion"
+	MetricOldestRetainedAge         = "tekton_pruner_controller_oldest_retained_age"
+	MetricConfigGeneration          = "tekton_pruner_controller_config_generation"
+	MetricReclaimableResources      = "tekton_pruner_controller_reclaimable_resources"
+	MetricStuckRuns                 = "tekton_pruner_controller_stuck_runs"
+	MetricWorkers                   = "tekton_pruner_controller_workers"
+	MetricActiveWorkers             = "tekton_pruner_controller_active_workers"
+	MetricConfigResolutions         = "tekton_pruner_controller_config_resolutions"
+	MetricConfigRejections          = "tekton_pruner_controller_config_rejections"
+	MetricOrphanedChildren          = "tekton_pruner_controller_orphaned_children"
+	MetricResourcesWouldDelete      = "tekton_pruner_controller_resources_would_delete"
 
 	// Label keys
 	LabelNamespace    = "namespace"
@@ -48,6 +60,9 @@ const (
 	LabelReason       = "reason"
 	LabelErrorType    = "error_type"
 	LabelOperation    = "operation"
+	LabelTrigger      = "trigger"
+	LabelConfigField  = "field"
+	LabelConfigSource = "source"
 
 	// Label values for resource types
 	ResourceTypePipelineRun = "pipelinerun"
@@ -62,6 +77,11 @@ const (
 	StatusFailed  = "failed"
 	StatusError   = "error"
 
+	// Label values for status of the deleted runs, StatusFailed is used for failed runs
+	StatusSucceeded = "succeeded"
+	StatusCancelled = "cancelled"
+	StatusStuck     = "stuck"
+
 	// Label values for error types
 	ErrorTypeAPI        = "api_error"
 	ErrorTypeTimeout    = "timeout"
@@ -69,6 +89,33 @@ const (
 	ErrorTypeInternal   = "internal"
 	ErrorTypeNotFound   = "not_found"
 	ErrorTypePermission = "permission"
+
+	// Label values for the triggers of the reconciles
+	TriggerEvent        = "event"
+	TriggerResync       = "resync"
+	TriggerConfigChange = "config_change"
+	TriggerRequeue      = "requeue"
+	TriggerSweep        = "sweep"
+
+	// Label values for the sources a config field is resolved from
+	ConfigSourceGlobal             = "global"
+	ConfigSourceNamespace          = "namespace"
+	ConfigSourceNamespaceLabel     = "namespace_label"
+	ConfigSourceResourceName       = "resource_name"
+	ConfigSourceResourceLabel      = "resource_label"
+	ConfigSourceResourceAnnotation = "resource_annotation"
+	ConfigSourceResourceOwner      = "resource_owner"
+	ConfigSourceUnknown            = "unknown"
+
+	// Label values for the reasons a loaded config is rejected
+	ConfigRejectReasonInvalid          = "invalid"
+	ConfigRejectReasonOversized        = "oversized"
+	ConfigRejectReasonChecksumMismatch = "checksum_mismatch"
+
+	// Label values for skip reasons
+	SkipReasonParentDeleting = "parent_deleting"
+	SkipReasonLatestOutcome  = "latest_outcome"
+	SkipReasonNotEligible    = "not_eligible"
 )
 
 // Recorder holds all the OpenTelemetry instruments for recording metrics
@@ -77,7 +124,14 @@ type Recorder struct {
 	resourcesProcessed   metric.Int64Counter
 	reconciliationEvents metric.Int64Counter
 	resourcesDeleted     metric.Int64Counter
+	resourcesQueued      metric.Int64Counter
 	resourcesErrors      metric.Int64Counter
+	resourcesSkipped     metric.Int64Counter
+	stuckRuns            metric.Int64Counter
+	configResolutions    metric.Int64Counter
+	configRejections     metric.Int64Counter
+	orphanedChildren     metric.Int64Counter
+	resourcesWouldDelete metric.Int64Counter
 
 	// Histograms for duration measurements
 	reconciliationDuration    metric.Float64Histogram
@@ -88,10 +142,21 @@ type Recorder struct {
 	// UpDownCounters for gauge-like metrics
 	activeResourcesCount  metric.Int64UpDownCounter
 	pendingDeletionsCount metric.Int64UpDownCounter
+	activeWorkers         metric.Int64UpDownCounter
+
+	// Gauges
+	oldestRetainedAge metric.Float64Gauge
+	configGeneration  metric.Int64Gauge
+	reclaimable       metric.Int64Gauge
+	workers           metric.Int64Gauge
 
 	// Cache for tracking unique resources
 	seenResources map[types.UID]bool
-	cacheMutex    sync.RWMutex
+	// deferredResources holds the resources counted on the pending deletions gauge
+	deferredResources map[types.UID]bool
+	// queuedResources holds the resources counted on the resources queued counter, until they are deleted
+	queuedResources map[types.UID]bool
+	cacheMutex      sync.RWMutex
 }
 
 var (
@@ -115,6 +180,8 @@ func newRecorder() *Recorder {
 
 	// Initialize cache for unique resource tracking
 	r.seenResources = make(map[types.UID]bool)
+	r.deferredResources = make(map[types.UID]bool)
+	r.queuedResources = make(map[types.UID]bool)
 
 	// Initialize counters
 	r.resourcesProcessed, _ = meter.Int64Counter(
@@ -135,12 +202,54 @@ func newRecorder() *Recorder {
 		metric.WithUnit("1"),
 	)
 
+	r.resourcesQueued, _ = meter.Int64Counter(
+		MetricResourcesQueued,
+		metric.WithDescription("Total number of Tekton resources selected for deletion by the pruner"),
+		metric.WithUnit("1"),
+	)
+
 	r.resourcesErrors, _ = meter.Int64Counter(
 		MetricResourcesErrors,
 		metric.WithDescription("Total number of errors encountered while processing Tekton resources"),
 		metric.WithUnit("1"),
 	)
 
+	r.resourcesSkipped, _ = meter.Int64Counter(
+		MetricResourcesSkipped,
+		metric.WithDescription("Total number of Tekton resources skipped by the pruner instead of being deleted"),
+		metric.WithUnit("1"),
+	)
+
+	r.stuckRuns, _ = meter.Int64Counter(
+		MetricStuckRuns,
+		metric.WithDescription("Total number of Tekton resources flagged as stuck, running for longer than the max running age"),
+		metric.WithUnit("1"),
+	)
+
+	r.configResolutions, _ = meter.Int64Counter(
+		MetricConfigResolutions,
+		metric.WithDescription("Total number of config fields resolved for the resources, by the source they are resolved from"),
+		metric.WithUnit("1"),
+	)
+
+	r.configRejections, _ = meter.Int64Counter(
+		MetricConfigRejections,
+		metric.WithDescription("Total number of loaded configs rejected, the previous config is kept active"),
+		metric.WithUnit("1"),
+	)
+
+	r.orphanedChildren, _ = meter.Int64Counter(
+		MetricOrphanedChildren,
+		metric.WithDescription("Total number of child resources lacking the owner reference of their parent on its deletion"),
+		metric.WithUnit("1"),
+	)
+
+	r.resourcesWouldDelete, _ = meter.Int64Counter(
+		MetricResourcesWouldDelete,
+		metric.WithDescription("Total number of resources a dry run would have deleted"),
+		metric.WithUnit("1"),
+	)
+
 	// Initialize histograms
 	r.reconciliationDuration, _ = meter.Float64Histogram(
 		MetricReconciliationDuration,
@@ -185,6 +294,37 @@ func newRecorder() *Recorder {
 		metric.WithUnit("1"),
 	)
 
+	r.activeWorkers, _ = meter.Int64UpDownCounter(
+		MetricActiveWorkers,
+		metric.WithDescription("Current number of reconcile workers processing a resource"),
+		metric.WithUnit("1"),
+	)
+
+	// Initialize gauges
+	r.oldestRetainedAge, _ = meter.Float64Gauge(
+		MetricOldestRetainedAge,
+		metric.WithDescription("Age of the oldest completed resource retained after a cleanup"),
+		metric.WithUnit("s"),
+	)
+
+	r.configGeneration, _ = meter.Int64Gauge(
+		MetricConfigGeneration,
+		metric.WithDescription("Generation of the pruner config, incremented on every reload which changes the config"),
+		metric.WithUnit("1"),
+	)
+
+	r.reclaimable, _ = meter.Int64Gauge(
+		MetricReclaimableResources,
+		metric.WithDescription("Estimated number of resources whose ttl expires before the next periodic cleanup"),
+		metric.WithUnit("1"),
+	)
+
+	r.workers, _ = meter.Int64Gauge(
+		MetricWorkers,
+		metric.WithDescription("Number of reconcile workers of the controller, the idle workers are the ones not active"),
+		metric.WithUnit("1"),
+	)
+
 	return r
 }
 
@@ -222,12 +362,14 @@ func (t *Timer) RecordHistoryProcessingDuration(ctx context.Context) {
 	t.recorder.historyProcessingDuration.Record(ctx, duration, metric.WithAttributes(t.labels...))
 }
 
-// RecordReconciliationEvent increments the reconciliation events counter
-func (r *Recorder) RecordReconciliationEvent(ctx context.Context, resourceType, namespace, status string) {
+// RecordReconciliationEvent increments the reconciliation events counter,
+// trigger is what enqueued the resource (event, resync, config_change or requeue)
+func (r *Recorder) RecordReconciliationEvent(ctx context.Context, resourceType, namespace, status, trigger string) {
 	labels := []attribute.KeyValue{
 		attribute.String(LabelResourceType, resourceType),
 		attribute.String(LabelNamespace, namespace),
 		attribute.String(LabelStatus, status),
+		attribute.String(LabelTrigger, trigger),
 	}
 	r.reconciliationEvents.Add(ctx, 1, metric.WithAttributes(labels...))
 }
@@ -250,13 +392,41 @@ func (r *Recorder) RecordResourceProcessed(ctx context.Context, resourceUID type
 	}
 }
 
-// RecordResourceDeleted increments the resources deleted counter and records age
-func (r *Recorder) RecordResourceDeleted(ctx context.Context, resourceType, namespace, operation string, resourceAge time.Duration) {
+// RecordResourceQueued increments the resources queued counter for a resource selected for deletion, by its
+// TTL or the history limits. The resource is counted once, however many times its deletion is attempted,
+// queued resources growing faster than the deleted resources is a backlog the pruner does not keep up with
+func (r *Recorder) RecordResourceQueued(ctx context.Context, resourceUID types.UID, resourceType, namespace, operation string) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+
+	if r.queuedResources[resourceUID] {
+		return
+	}
+	r.queuedResources[resourceUID] = true
+	labels := []attribute.KeyValue{
+		attribute.String(LabelResourceType, resourceType),
+		attribute.String(LabelNamespace, namespace),
+		attribute.String(LabelOperation, operation),
+	}
+	r.resourcesQueued.Add(ctx, 1, metric.WithAttributes(labels...))
+}
+
+// ClearResourceQueued forgets the queued resource once it is deleted, the counter is not decremented
+func (r *Recorder) ClearResourceQueued(resourceUID types.UID) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+	delete(r.queuedResources, resourceUID)
+}
+
+// RecordResourceDeleted increments the resources deleted counter and records age,
+// status is the outcome of the deleted run (succeeded, failed or cancelled)
+func (r *Recorder) RecordResourceDeleted(ctx context.Context, resourceType, namespace, operation, status string, resourceAge time.Duration) {
 	// Record deletion count
 	labels := []attribute.KeyValue{
 		attribute.String(LabelResourceType, resourceType),
 		attribute.String(LabelNamespace, namespace),
 		attribute.String(LabelOperation, operation),
+		attribute.String(LabelStatus, status),
 	}
 	r.resourcesDeleted.Add(ctx, 1, metric.WithAttributes(labels...))
 
@@ -275,6 +445,58 @@ func (r *Recorder) RecordResourceError(ctx context.Context, resourceType, namesp
 	r.resourcesErrors.Add(ctx, 1, metric.WithAttributes(labels...))
 }
 
+// RecordResourceSkipped increments the resources skipped counter
+func (r *Recorder) RecordResourceSkipped(ctx context.Context, resourceType, namespace, operation, reason string) {
+	labels := []attribute.KeyValue{
+		attribute.String(LabelResourceType, resourceType),
+		attribute.String(LabelNamespace, namespace),
+		attribute.String(LabelOperation, operation),
+		attribute.String(LabelReason, reason),
+	}
+	r.resourcesSkipped.Add(ctx, 1, metric.WithAttributes(labels...))
+}
+
+// RecordStuckRun increments the stuck runs counter, it is recorded once for each run flagged as stuck
+func (r *Recorder) RecordStuckRun(ctx context.Context, resourceType, namespace string) {
+	labels := []attribute.KeyValue{
+		attribute.String(LabelResourceType, resourceType),
+		attribute.String(LabelNamespace, namespace),
+	}
+	r.stuckRuns.Add(ctx, 1, metric.WithAttributes(labels...))
+}
+
+// RecordConfigResolution records a config field resolved for a resource from the given source
+func (r *Recorder) RecordConfigResolution(ctx context.Context, resourceType, field, source string) {
+	labels := []attribute.KeyValue{
+		attribute.String(LabelResourceType, resourceType),
+		attribute.String(LabelConfigField, field),
+		attribute.String(LabelConfigSource, source),
+	}
+	r.configResolutions.Add(ctx, 1, metric.WithAttributes(labels...))
+}
+
+// RecordOrphanedChildren increments the orphaned children counter with the children of a deleted parent
+// which lack its owner reference, they are not deleted along with it
+func (r *Recorder) RecordOrphanedChildren(ctx context.Context, resourceType, namespace string, count int) {
+	r.orphanedChildren.Add(ctx, int64(count), metric.WithAttributes(ResourceAttributes(resourceType, namespace)...))
+}
+
+// RecordResourceWouldDelete increments the would delete counter with a resource selected for deletion on a dry run,
+// the resource is not deleted
+func (r *Recorder) RecordResourceWouldDelete(ctx context.Context, resourceType, namespace, operation string) {
+	labels := []attribute.KeyValue{
+		attribute.String(LabelResourceType, resourceType),
+		attribute.String(LabelNamespace, namespace),
+		attribute.String(LabelOperation, operation),
+	}
+	r.resourcesWouldDelete.Add(ctx, 1, metric.WithAttributes(labels...))
+}
+
+// RecordConfigRejection increments the config rejections counter with the reason the config is rejected for
+func (r *Recorder) RecordConfigRejection(ctx context.Context, reason string) {
+	r.configRejections.Add(ctx, 1, metric.WithAttributes(attribute.String(LabelReason, reason)))
+}
+
 // UpdateActiveResourcesCount updates the active resources gauge
 func (r *Recorder) UpdateActiveResourcesCount(ctx context.Context, resourceType, namespace string, delta int64) {
 	labels := []attribute.KeyValue{
@@ -284,6 +506,32 @@ func (r *Recorder) UpdateActiveResourcesCount(ctx context.Context, resourceType,
 	r.activeResourcesCount.Add(ctx, delta, metric.WithAttributes(labels...))
 }
 
+// RecordDeletionDeferred counts the resource whose deletion is deferred to its TTL expiry on the pending
+// deletions gauge. The resource is counted once, however many times it is requeued, until it is cleared
+func (r *Recorder) RecordDeletionDeferred(ctx context.Context, resourceUID types.UID, resourceType, namespace string) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+
+	if r.deferredResources[resourceUID] {
+		return
+	}
+	r.deferredResources[resourceUID] = true
+	r.UpdatePendingDeletionsCount(ctx, resourceType, namespace, 1)
+}
+
+// ClearDeletionDeferred removes the resource from the pending deletions gauge once it is deleted,
+// the resource which is not counted is ignored
+func (r *Recorder) ClearDeletionDeferred(ctx context.Context, resourceUID types.UID, resourceType, namespace string) {
+	r.cacheMutex.Lock()
+	defer r.cacheMutex.Unlock()
+
+	if !r.deferredResources[resourceUID] {
+		return
+	}
+	delete(r.deferredResources, resourceUID)
+	r.UpdatePendingDeletionsCount(ctx, resourceType, namespace, -1)
+}
+
 // UpdatePendingDeletionsCount updates the pending deletions gauge
 func (r *Recorder) UpdatePendingDeletionsCount(ctx context.Context, resourceType, namespace string, delta int64) {
 	labels := []attribute.KeyValue{
@@ -293,6 +541,54 @@ func (r *Recorder) UpdatePendingDeletionsCount(ctx context.Context, resourceType
 	r.pendingDeletionsCount.Add(ctx, delta, metric.WithAttributes(labels...))
 }
 
+// RecordOldestRetainedAge records the age of the oldest completed resource retained in a namespace after a cleanup
+func (r *Recorder) RecordOldestRetainedAge(ctx context.Context, resourceType, namespace string, age time.Duration) {
+	labels := []attribute.KeyValue{
+		attribute.String(LabelResourceType, resourceType),
+		attribute.String(LabelNamespace, namespace),
+	}
+	r.oldestRetainedAge.Record(ctx, age.Seconds(), metric.WithAttributes(labels...))
+}
+
+// RecordConfigGeneration records the generation of the pruner config
+func (r *Recorder) RecordConfigGeneration(ctx context.Context, generation uint64) {
+	r.configGeneration.Record(ctx, int64(generation))
+}
+
+// RecordReclaimableResources records the estimated number of resources to be deleted in a namespace before the next periodic cleanup
+func (r *Recorder) RecordReclaimableResources(ctx context.Context, resourceType, namespace string, count int) {
+	labels := []attribute.KeyValue{
+		attribute.String(LabelResourceType, resourceType),
+		attribute.String(LabelNamespace, namespace),
+	}
+	r.reclaimable.Record(ctx, int64(count), metric.WithAttributes(labels...))
+}
+
+// RecordWorkers records the number of reconcile workers of the controller of the resource type
+func (r *Recorder) RecordWorkers(ctx context.Context, resourceType string, workers int) {
+	r.workers.Record(ctx, int64(workers), metric.WithAttributes(attribute.String(LabelResourceType, resourceType)))
+}
+
+// StartWorker counts a reconcile worker of the resource type as active until the returned function is called
+func (r *Recorder) StartWorker(ctx context.Context, resourceType string) func() {
+	labels := metric.WithAttributes(attribute.String(LabelResourceType, resourceType))
+	r.activeWorkers.Add(ctx, 1, labels)
+	return func() {
+		r.activeWorkers.Add(ctx, -1, labels)
+	}
+}
+
+// OldestAge returns the age of the oldest of the given creation times, zero if there is none
+func OldestAge(now time.Time, creationTimes []time.Time) time.Duration {
+	var oldest time.Duration
+	for _, creationTime := range creationTimes {
+		if age := now.Sub(creationTime); age > oldest {
+			oldest = age
+		}
+	}
+	return oldest
+}
+
 // Helper functions for creating common attribute sets
 
 // ResourceAttributes creates common resource-related attributes
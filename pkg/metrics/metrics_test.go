@@ -0,0 +1,427 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newTestRecorder returns a recorder backed by a manual reader to collect the recorded metrics
+func newTestRecorder(t *testing.T) (*Recorder, *sdkmetric.ManualReader) {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(provider)
+	t.Cleanup(func() {
+		otel.SetMeterProvider(previous)
+		_ = provider.Shutdown(context.Background())
+	})
+	return newRecorder(), reader
+}
+
+// collectSum returns the data points of the given counter
+func collectSum(t *testing.T, reader *sdkmetric.ManualReader, name string) []metricdata.DataPoint[int64] {
+	t.Helper()
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				t.Fatalf("metric %s is not an int64 sum", name)
+			}
+			return sum.DataPoints
+		}
+	}
+	return nil
+}
+
+func TestRecordResourceDeletedStatus(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	recorder.RecordResourceDeleted(ctx, ResourceTypePipelineRun, "ns", OperationTTL, StatusSucceeded, time.Minute)
+	recorder.RecordResourceDeleted(ctx, ResourceTypePipelineRun, "ns", OperationTTL, StatusSucceeded, time.Minute)
+	recorder.RecordResourceDeleted(ctx, ResourceTypePipelineRun, "ns", OperationHistory, StatusFailed, time.Minute)
+	recorder.RecordResourceDeleted(ctx, ResourceTypeTaskRun, "ns", OperationHistory, StatusCancelled, time.Minute)
+
+	counts := map[string]int64{}
+	for _, dp := range collectSum(t, reader, MetricResourcesDeleted) {
+		status, found := dp.Attributes.Value(attribute.Key(LabelStatus))
+		assert.True(t, found, "status label is missing")
+		counts[status.AsString()] += dp.Value
+	}
+
+	assert.Equal(t, map[string]int64{
+		StatusSucceeded: 2,
+		StatusFailed:    1,
+		StatusCancelled: 1,
+	}, counts)
+}
+
+func TestRecordResourceSkipped(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	recorder.RecordResourceSkipped(ctx, ResourceTypeTaskRun, "ns", OperationHistory, SkipReasonParentDeleting)
+	recorder.RecordResourceSkipped(ctx, ResourceTypeTaskRun, "ns", OperationTTL, SkipReasonParentDeleting)
+
+	var total int64
+	for _, dp := range collectSum(t, reader, MetricResourcesSkipped) {
+		reason, found := dp.Attributes.Value(attribute.Key(LabelReason))
+		assert.True(t, found, "reason label is missing")
+		assert.Equal(t, SkipReasonParentDeleting, reason.AsString())
+		total += dp.Value
+	}
+	assert.Equal(t, int64(2), total)
+}
+
+func TestOldestAge(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name          string
+		creationTimes []time.Time
+		want          time.Duration
+	}{
+		{
+			name: "no retained resources",
+			want: 0,
+		},
+		{
+			name:          "single resource",
+			creationTimes: []time.Time{now.Add(-time.Hour)},
+			want:          time.Hour,
+		},
+		{
+			name:          "oldest of many",
+			creationTimes: []time.Time{now.Add(-time.Minute), now.Add(-3 * time.Hour), now.Add(-2 * time.Hour)},
+			want:          3 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, OldestAge(now, tt.creationTimes))
+		})
+	}
+}
+
+func TestRecordOldestRetainedAge(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	retained := []time.Time{now.Add(-10 * time.Minute), now.Add(-2 * time.Hour), now.Add(-30 * time.Minute)}
+	recorder.RecordOldestRetainedAge(ctx, ResourceTypePipelineRun, "dev", OldestAge(now, retained))
+	recorder.RecordOldestRetainedAge(ctx, ResourceTypeTaskRun, "dev", OldestAge(now, nil))
+
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+
+	ages := map[string]float64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != MetricOldestRetainedAge {
+				continue
+			}
+			gauge, ok := m.Data.(metricdata.Gauge[float64])
+			if !ok {
+				t.Fatalf("metric %s is not a float64 gauge", m.Name)
+			}
+			for _, dp := range gauge.DataPoints {
+				resourceType, _ := dp.Attributes.Value(attribute.Key(LabelResourceType))
+				ages[resourceType.AsString()] = dp.Value
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		ResourceTypePipelineRun: (2 * time.Hour).Seconds(),
+		ResourceTypeTaskRun:     0,
+	}, ages)
+}
+
+func TestRecordConfigGeneration(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	recorder.RecordConfigGeneration(ctx, 1)
+	recorder.RecordConfigGeneration(ctx, 2)
+
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+
+	var generations []int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != MetricConfigGeneration {
+				continue
+			}
+			gauge, ok := m.Data.(metricdata.Gauge[int64])
+			if !ok {
+				t.Fatalf("metric %s is not an int64 gauge", m.Name)
+			}
+			for _, dp := range gauge.DataPoints {
+				generations = append(generations, dp.Value)
+			}
+		}
+	}
+
+	assert.Equal(t, []int64{2}, generations)
+}
+
+func TestRecordReclaimableResources(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	recorder.RecordReclaimableResources(ctx, ResourceTypePipelineRun, "dev", 3)
+
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != MetricReclaimableResources {
+				continue
+			}
+			gauge, ok := m.Data.(metricdata.Gauge[int64])
+			if !ok {
+				t.Fatalf("metric %s is not an int64 gauge", m.Name)
+			}
+			if len(gauge.DataPoints) != 1 || gauge.DataPoints[0].Value != 3 {
+				t.Fatalf("data points = %+v, want a single value of 3", gauge.DataPoints)
+			}
+			return
+		}
+	}
+	t.Fatalf("metric %s was not recorded", MetricReclaimableResources)
+}
+
+func TestDeletionDeferred(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	pending := func() int64 {
+		dataPoints := collectSum(t, reader, MetricPendingDeletionsCount)
+		if len(dataPoints) != 1 {
+			t.Fatalf("data points = %+v, want a single data point", dataPoints)
+		}
+		return dataPoints[0].Value
+	}
+
+	uids := []types.UID{"uid-1", "uid-2", "uid-3"}
+	for _, uid := range uids {
+		recorder.RecordDeletionDeferred(ctx, uid, ResourceTypePipelineRun, "dev")
+	}
+	if got := pending(); got != 3 {
+		t.Fatalf("pending deletions = %d, want 3", got)
+	}
+
+	// a requeued resource is counted once
+	recorder.RecordDeletionDeferred(ctx, uids[0], ResourceTypePipelineRun, "dev")
+	if got := pending(); got != 3 {
+		t.Fatalf("pending deletions after a requeue = %d, want 3", got)
+	}
+
+	recorder.ClearDeletionDeferred(ctx, uids[0], ResourceTypePipelineRun, "dev")
+	recorder.ClearDeletionDeferred(ctx, uids[1], ResourceTypePipelineRun, "dev")
+	if got := pending(); got != 1 {
+		t.Fatalf("pending deletions after the deletions = %d, want 1", got)
+	}
+
+	// clearing a resource which is not counted does not change the gauge
+	recorder.ClearDeletionDeferred(ctx, uids[0], ResourceTypePipelineRun, "dev")
+	recorder.ClearDeletionDeferred(ctx, "uid-unknown", ResourceTypePipelineRun, "dev")
+	if got := pending(); got != 1 {
+		t.Fatalf("pending deletions after clearing unknown resources = %d, want 1", got)
+	}
+}
+
+func TestWorkerUtilization(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	recorder.RecordWorkers(ctx, ResourceTypePipelineRun, 4)
+
+	activeWorkers := func() int64 {
+		t.Helper()
+		var active int64
+		for _, dp := range collectSum(t, reader, MetricActiveWorkers) {
+			active += dp.Value
+		}
+		return active
+	}
+
+	// three reconciles run concurrently, they are held until released
+	release := make(chan struct{})
+	var started, finished sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		started.Add(1)
+		finished.Add(1)
+		go func() {
+			defer finished.Done()
+			done := recorder.StartWorker(ctx, ResourceTypePipelineRun)
+			started.Done()
+			<-release
+			done()
+		}()
+	}
+	started.Wait()
+	assert.Equal(t, int64(3), activeWorkers())
+
+	close(release)
+	finished.Wait()
+	assert.Equal(t, int64(0), activeWorkers())
+
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("failed to collect metrics: %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != MetricWorkers {
+				continue
+			}
+			gauge, ok := m.Data.(metricdata.Gauge[int64])
+			if !ok {
+				t.Fatalf("metric %s is not an int64 gauge", m.Name)
+			}
+			if len(gauge.DataPoints) != 1 || gauge.DataPoints[0].Value != 4 {
+				t.Fatalf("data points = %+v, want a single value of 4", gauge.DataPoints)
+			}
+			return
+		}
+	}
+	t.Fatalf("metric %s was not recorded", MetricWorkers)
+}
+
+func TestRecordConfigResolution(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	recorder.RecordConfigResolution(ctx, ResourceTypePipelineRun, "ttlSecondsAfterFinished", ConfigSourceGlobal)
+	recorder.RecordConfigResolution(ctx, ResourceTypePipelineRun, "ttlSecondsAfterFinished", ConfigSourceResourceLabel)
+	recorder.RecordConfigResolution(ctx, ResourceTypePipelineRun, "successfulHistoryLimit", ConfigSourceResourceLabel)
+
+	counts := map[string]int64{}
+	for _, dp := range collectSum(t, reader, MetricConfigResolutions) {
+		source, found := dp.Attributes.Value(attribute.Key(LabelConfigSource))
+		assert.True(t, found, "source label is missing")
+		counts[source.AsString()] += dp.Value
+	}
+	assert.Equal(t, map[string]int64{ConfigSourceGlobal: 1, ConfigSourceResourceLabel: 2}, counts)
+}
+
+func TestRecordConfigRejection(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	recorder.RecordConfigRejection(ctx, ConfigRejectReasonChecksumMismatch)
+	recorder.RecordConfigRejection(ctx, ConfigRejectReasonChecksumMismatch)
+	recorder.RecordConfigRejection(ctx, ConfigRejectReasonOversized)
+
+	counts := map[string]int64{}
+	for _, dp := range collectSum(t, reader, MetricConfigRejections) {
+		reason, found := dp.Attributes.Value(attribute.Key(LabelReason))
+		assert.True(t, found, "reason label is missing")
+		counts[reason.AsString()] += dp.Value
+	}
+	assert.Equal(t, map[string]int64{ConfigRejectReasonChecksumMismatch: 2, ConfigRejectReasonOversized: 1}, counts)
+}
+
+func TestRecordOrphanedChildren(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	recorder.RecordOrphanedChildren(ctx, ResourceTypeTaskRun, "dev", 2)
+	recorder.RecordOrphanedChildren(ctx, ResourceTypeTaskRun, "dev", 1)
+
+	points := collectSum(t, reader, MetricOrphanedChildren)
+	assert.Len(t, points, 1)
+	assert.Equal(t, int64(3), points[0].Value)
+	namespace, _ := points[0].Attributes.Value(attribute.Key(LabelNamespace))
+	assert.Equal(t, "dev", namespace.AsString())
+}
+
+func TestRecordResourceWouldDelete(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	recorder.RecordResourceWouldDelete(ctx, ResourceTypePipelineRun, "dev", OperationHistory)
+	recorder.RecordResourceWouldDelete(ctx, ResourceTypePipelineRun, "dev", OperationHistory)
+
+	points := collectSum(t, reader, MetricResourcesWouldDelete)
+	assert.Len(t, points, 1)
+	assert.Equal(t, int64(2), points[0].Value)
+	operation, _ := points[0].Attributes.Value(attribute.Key(LabelOperation))
+	assert.Equal(t, OperationHistory, operation.AsString())
+}
+
+func TestResourcesQueuedOutpacingDeleted(t *testing.T) {
+	recorder, reader := newTestRecorder(t)
+	ctx := context.Background()
+
+	sum := func(name string) int64 {
+		var total int64
+		for _, dp := range collectSum(t, reader, name) {
+			total += dp.Value
+		}
+		return total
+	}
+
+	// three resources are selected for deletion, the failed deletion of one is attempted again
+	recorder.RecordResourceQueued(ctx, types.UID("uid-1"), ResourceTypePipelineRun, "default", OperationHistory)
+	recorder.RecordResourceQueued(ctx, types.UID("uid-2"), ResourceTypePipelineRun, "default", OperationHistory)
+	recorder.RecordResourceQueued(ctx, types.UID("uid-3"), ResourceTypePipelineRun, "default", OperationTTL)
+	recorder.RecordResourceQueued(ctx, types.UID("uid-3"), ResourceTypePipelineRun, "default", OperationTTL)
+
+	// only one of them is deleted, the backlog grows
+	recorder.RecordResourceDeleted(ctx, ResourceTypePipelineRun, "default", OperationHistory, StatusSucceeded, time.Hour)
+	recorder.ClearResourceQueued(types.UID("uid-1"))
+	assert.Equal(t, int64(3), sum(MetricResourcesQueued))
+	assert.Equal(t, int64(1), sum(MetricResourcesDeleted))
+
+	// the remaining ones are deleted, the counters are even
+	recorder.RecordResourceDeleted(ctx, ResourceTypePipelineRun, "default", OperationHistory, StatusSucceeded, time.Hour)
+	recorder.ClearResourceQueued(types.UID("uid-2"))
+	recorder.RecordResourceDeleted(ctx, ResourceTypePipelineRun, "default", OperationTTL, StatusSucceeded, time.Hour)
+	recorder.ClearResourceQueued(types.UID("uid-3"))
+	assert.Equal(t, sum(MetricResourcesQueued), sum(MetricResourcesDeleted))
+	assert.Empty(t, recorder.queuedResources)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// NamespaceQueryParameter is the query parameter of the namespace the series are filtered by
+const NamespaceQueryParameter = "namespace"
+
+// NamespaceHandler serves the series of the gatherer recorded for the namespace of the request,
+// for example /metrics?namespace=team-a. The series without a namespace label are never served
+func NamespaceHandler(gatherer prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.URL.Query().Get(NamespaceQueryParameter)
+		if namespace == "" {
+			http.Error(w, "the namespace query parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		filtered := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			families, err := gatherer.Gather()
+			return filterNamespace(families, namespace), err
+		})
+		promhttp.HandlerFor(filtered, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+// filterNamespace returns the metric families holding only the series of the namespace,
+// the families left without a series are dropped
+func filterNamespace(families []*dto.MetricFamily, namespace string) []*dto.MetricFamily {
+	filtered := []*dto.MetricFamily{}
+	for _, family := range families {
+		var series []*dto.Metric
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == LabelNamespace && label.GetValue() == namespace {
+					series = append(series, metric)
+					break
+				}
+			}
+		}
+		if len(series) == 0 {
+			continue
+		}
+		filtered = append(filtered, &dto.MetricFamily{
+			Name:   family.Name,
+			Help:   family.Help,
+			Type:   family.Type,
+			Unit:   family.Unit,
+			Metric: series,
+		})
+	}
+	return filtered
+}
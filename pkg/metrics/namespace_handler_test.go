@@ -0,0 +1,68 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceHandler(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	deleted := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "runs_deleted", Help: "Runs deleted"}, []string{LabelNamespace, LabelResourceType})
+	generation := prometheus.NewGauge(prometheus.GaugeOpts{Name: "config_generation", Help: "Config generation"})
+	registry.MustRegister(deleted, generation)
+	deleted.WithLabelValues("team-a", ResourceTypePipelineRun).Add(3)
+	deleted.WithLabelValues("team-a", ResourceTypeTaskRun).Add(2)
+	deleted.WithLabelValues("team-b", ResourceTypePipelineRun).Add(5)
+	generation.Set(7)
+
+	handler := NamespaceHandler(registry)
+
+	t.Run("filtered by namespace", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?namespace=team-a", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		body, _ := io.ReadAll(rec.Body)
+		assert.Contains(t, string(body), `runs_deleted{namespace="team-a",resource_type="pipelinerun"} 3`)
+		assert.Contains(t, string(body), `runs_deleted{namespace="team-a",resource_type="taskrun"} 2`)
+		assert.NotContains(t, string(body), "team-b")
+		// the series without a namespace are not served
+		assert.NotContains(t, string(body), "config_generation")
+	})
+
+	t.Run("unknown namespace", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?namespace=team-c", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "runs_deleted")
+	})
+
+	t.Run("no namespace", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// triggerPriority orders the triggers marked on a resource before it is reconciled,
+// the reconcile of a resource enqueued more than once is recorded with the highest one
+var triggerPriority = map[string]int{
+	TriggerResync:       1,
+	TriggerConfigChange: 2,
+	TriggerSweep:        3,
+	TriggerEvent:        4,
+}
+
+// TriggerTracker remembers what enqueued each resource, so the reconcile of
+// the resource is recorded with its trigger
+type TriggerTracker struct {
+	triggers map[types.NamespacedName]string
+	mutex    sync.Mutex
+}
+
+// NewTriggerTracker returns an empty TriggerTracker
+func NewTriggerTracker() *TriggerTracker {
+	return &TriggerTracker{triggers: map[types.NamespacedName]string{}}
+}
+
+// Mark records the trigger of the resource, unless a higher priority trigger is already pending
+func (t *TriggerTracker) Mark(obj interface{}, trigger string) {
+	key, ok := triggerKey(obj)
+	if !ok {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if triggerPriority[t.triggers[key]] <= triggerPriority[trigger] {
+		t.triggers[key] = trigger
+	}
+}
+
+// Take returns and clears the pending trigger of the resource. A resource enqueued
+// by none of the tracked triggers, for example on a requeue after a delay, is reported as a requeue
+func (t *TriggerTracker) Take(key types.NamespacedName) string {
+	if t == nil {
+		return TriggerRequeue
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	trigger, found := t.triggers[key]
+	if !found {
+		return TriggerRequeue
+	}
+	delete(t.triggers, key)
+	return trigger
+}
+
+// forget clears the pending trigger of a deleted resource, a deleted resource is not reconciled
+func (t *TriggerTracker) forget(obj interface{}) {
+	key, ok := triggerKey(obj)
+	if !ok {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.triggers, key)
+}
+
+// Handler returns an informer event handler marking the trigger of the resources before enqueuing them.
+// The periodic resync of the informer delivers updates without a change of the resource version
+func (t *TriggerTracker) Handler(enqueue func(obj interface{})) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			t.Mark(obj, TriggerEvent)
+			enqueue(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			trigger := TriggerEvent
+			oldObject, oldOk := oldObj.(metav1.Object)
+			newObject, newOk := newObj.(metav1.Object)
+			if oldOk && newOk && oldObject.GetResourceVersion() == newObject.GetResourceVersion() {
+				trigger = TriggerResync
+			}
+			t.Mark(newObj, trigger)
+			enqueue(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			t.forget(obj)
+			enqueue(obj)
+		},
+	}
+}
+
+// triggerKey returns the namespaced name of the resource, or of the resource of a tombstone
+func triggerKey(obj interface{}) (types.NamespacedName, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	object, ok := obj.(metav1.Object)
+	if !ok {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: object.GetNamespace(), Name: object.GetName()}, true
+}
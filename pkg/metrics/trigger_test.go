@@ -0,0 +1,124 @@
+/*
+Copyright 2025 The Tekton Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestReconciliationEventTrigger(t *testing.T) {
+	run := func(resourceVersion string) *metav1.ObjectMeta {
+		return &metav1.ObjectMeta{Namespace: "ns", Name: "run", ResourceVersion: resourceVersion}
+	}
+	key := types.NamespacedName{Namespace: "ns", Name: "run"}
+	recorder, reader := newTestRecorder(t)
+
+	tests := []struct {
+		name        string
+		enqueue     func(tracker *TriggerTracker, handler cache.ResourceEventHandler)
+		wantTrigger string
+		wantQueued  int
+	}{
+		{
+			name: "added",
+			enqueue: func(_ *TriggerTracker, handler cache.ResourceEventHandler) {
+				handler.OnAdd(run("1"), false)
+			},
+			wantTrigger: TriggerEvent,
+			wantQueued:  1,
+		},
+		{
+			name: "updated",
+			enqueue: func(_ *TriggerTracker, handler cache.ResourceEventHandler) {
+				handler.OnUpdate(run("1"), run("2"))
+			},
+			wantTrigger: TriggerEvent,
+			wantQueued:  1,
+		},
+		{
+			name: "resync",
+			enqueue: func(_ *TriggerTracker, handler cache.ResourceEventHandler) {
+				handler.OnUpdate(run("1"), run("1"))
+			},
+			wantTrigger: TriggerResync,
+			wantQueued:  1,
+		},
+		{
+			name: "config change",
+			enqueue: func(tracker *TriggerTracker, _ cache.ResourceEventHandler) {
+				tracker.Mark(run("1"), TriggerConfigChange)
+			},
+			wantTrigger: TriggerConfigChange,
+		},
+		{
+			name:        "requeue",
+			enqueue:     func(_ *TriggerTracker, _ cache.ResourceEventHandler) {},
+			wantTrigger: TriggerRequeue,
+		},
+		{
+			name: "resync after a change",
+			enqueue: func(tracker *TriggerTracker, handler cache.ResourceEventHandler) {
+				handler.OnUpdate(run("1"), run("2"))
+				handler.OnUpdate(run("2"), run("2"))
+				tracker.Mark(run("2"), TriggerConfigChange)
+			},
+			wantTrigger: TriggerEvent,
+			wantQueued:  2,
+		},
+		{
+			name: "deleted",
+			enqueue: func(_ *TriggerTracker, handler cache.ResourceEventHandler) {
+				handler.OnAdd(run("1"), false)
+				handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "ns/run", Obj: run("1")})
+			},
+			wantTrigger: TriggerRequeue,
+			wantQueued:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTriggerTracker()
+			queued := 0
+			handler := tracker.Handler(func(interface{}) { queued++ })
+
+			tt.enqueue(tracker, handler)
+			// the counter is shared by the test cases, each case is recorded on its own namespace
+			recorder.RecordReconciliationEvent(context.Background(), ResourceTypePipelineRun, tt.name, StatusSuccess, tracker.Take(key))
+
+			assert.Equal(t, tt.wantQueued, queued)
+			var triggers []string
+			for _, dp := range collectSum(t, reader, MetricReconciliationEvents) {
+				if namespace, _ := dp.Attributes.Value(attribute.Key(LabelNamespace)); namespace.AsString() != tt.name {
+					continue
+				}
+				trigger, found := dp.Attributes.Value(attribute.Key(LabelTrigger))
+				assert.True(t, found, "trigger label is missing")
+				triggers = append(triggers, trigger.AsString())
+			}
+			assert.Equal(t, []string{tt.wantTrigger}, triggers)
+			// the trigger is cleared once the resource is reconciled
+			assert.Equal(t, TriggerRequeue, tracker.Take(key))
+		})
+	}
+}
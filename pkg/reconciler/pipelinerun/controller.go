@@ -5,10 +5,13 @@ import (
 	"os"
 
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	pipelineclient "github.com/tektoncd/pipeline/pkg/client/injection/client"
 	pipelineruninformer "github.com/tektoncd/pipeline/pkg/client/injection/informers/pipeline/v1/pipelinerun"
+	taskruninformer "github.com/tektoncd/pipeline/pkg/client/injection/informers/pipeline/v1/taskrun"
 	pipelinerunreconciler "github.com/tektoncd/pipeline/pkg/client/injection/reconciler/pipeline/v1/pipelinerun"
 	"go.uber.org/zap"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/utils/clock"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
 	"knative.dev/pkg/configmap"
@@ -23,26 +26,49 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	// cluster's state of the respective resource at all times.
 	pipelineRunInformer := pipelineruninformer.Get(ctx)
 
+	// the log level is overridden by the pruner config map
+	ctx = config.WithLogLevel(ctx)
 	logger := logging.FromContext(ctx)
 
 	pipelineRunFuncs := &PrFuncs{
-		client: pipelineclient.Get(ctx),
+		client:        pipelineclient.Get(ctx),
+		taskRunLister: taskruninformer.Get(ctx).Lister(),
 	}
 	ttlHandler, err := config.NewTTLHandler(clock.RealClock{}, pipelineRunFuncs)
 	if err != nil {
 		logger.Fatal("error on getting ttl handler", zap.Error(err))
 	}
+	ttlHandler.SetNamespaceGetter(config.NewNamespaceGetter(config.GetNamespaceInformer(ctx, kubeclient.Get(ctx))))
 
 	historyLimiter, err := config.NewHistoryLimiter(pipelineRunFuncs)
 	if err != nil {
 		logger.Fatal("error on getting history limiter", zap.Error(err))
 	}
 
+	configGate, err := config.GetConfigGate()
+	if err != nil {
+		logger.Fatalw("error on getting the config gate",
+			"environmentKey", config.EnvConfigNotReadyRequeueSeconds, "environmentValue", os.Getenv(config.EnvConfigNotReadyRequeueSeconds),
+			zap.Error(err),
+		)
+	}
+
+	sweepLimiter, err := config.GetSweepLimiter()
+	if err != nil {
+		logger.Fatalw("error on getting the sweep limiter",
+			"environmentKey", config.EnvSweepConcurrentNamespaces, "environmentValue", os.Getenv(config.EnvSweepConcurrentNamespaces),
+			zap.Error(err),
+		)
+	}
+
 	r := &Reconciler{
 		// The client will be needed to create/delete Pods via the API.
 		kubeclient:     kubeclient.Get(ctx),
 		ttlHandler:     ttlHandler,
 		historyLimiter: historyLimiter,
+		triggers:       metrics.NewTriggerTracker(),
+		configGate:     configGate,
+		sweepLimiter:   sweepLimiter,
 	}
 
 	// number of works to process the events
@@ -57,13 +83,51 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	ctrlOptions := controller.Options{
 		Concurrency: concurrentWorkers,
 	}
+	metrics.GetRecorder().RecordWorkers(ctx, metrics.ResourceTypePipelineRun, concurrentWorkers)
 
 	impl := pipelinerunreconciler.NewImpl(ctx, r, func(impl *controller.Impl) controller.Options { return ctrlOptions })
 
 	// listen for events on the main resource and enqueue themselves.
-	_, err = pipelineRunInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
+	// only the namespaces owned by this replica's shard are processed
+	filter := config.ShardFromContext(ctx).Filter
+	_, err = pipelineRunInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: filter,
+		Handler:    r.triggers.Handler(impl.Enqueue),
+	})
+	if err != nil {
+		logger.Fatal("Failed to add event handler", zap.Error(err))
+	}
+
+	// a deleted run is not reconciled, it no longer holds its namespace in the sweep
+	_, err = pipelineRunInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: sweepLimiter.Forget,
+	})
 	if err != nil {
 		logger.Fatal("Failed to add event handler", zap.Error(err))
 	}
+
+	// sweep all the PipelineRuns again once the config is changed
+	config.PrunerConfigStore.OnChange(func() {
+		impl.FilteredGlobalResync(func(obj interface{}) bool {
+			if !filter(obj) {
+				return false
+			}
+			r.triggers.Mark(obj, metrics.TriggerConfigChange)
+			r.sweepLimiter.MarkPending(obj)
+			return true
+		}, pipelineRunInformer.Informer())
+	})
+
+	// enqueue the completed PipelineRuns on a sweep requested on the admin endpoint
+	config.RegisterSweeper(func() int {
+		return config.EnqueueCompleted(pipelineRunInformer.Informer().GetStore().List(), filter, pipelineRunFuncs.IsCompleted, func(obj interface{}) {
+			r.triggers.Mark(obj, metrics.TriggerSweep)
+			r.sweepLimiter.MarkPending(obj)
+			impl.EnqueueSlow(obj)
+		})
+	})
+
+	// explain the config of a PipelineRun on the debug endpoint
+	config.RegisterExplainer(config.KindPipelineRun, ttlHandler.ExplainConfig)
 	return impl
 }
@@ -8,12 +8,15 @@ import (
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 
 	pipelineversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
 	pipelinerunreconciler "github.com/tektoncd/pipeline/pkg/client/injection/reconciler/pipeline/v1/pipelinerun"
+	pipelinev1listers "github.com/tektoncd/pipeline/pkg/client/listers/pipeline/v1"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"knative.dev/pkg/apis"
@@ -27,6 +30,12 @@ type Reconciler struct {
 	kubeclient     kubernetes.Interface
 	ttlHandler     *config.TTLHandler
 	historyLimiter *config.HistoryLimiter
+	// triggers tracks what enqueued each run, it is recorded on the reconciliation events
+	triggers *metrics.TriggerTracker
+	// configGate requeues the runs reconciled before the global config is loaded, nil when disabled
+	configGate *config.ConfigGate
+	// sweepLimiter bounds the namespaces processed at the same time during a sweep, nil when not limited
+	sweepLimiter *config.SweepLimiter
 }
 
 // Check that our Reconciler implements Interface
@@ -37,6 +46,26 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, pr *pipelinev1.PipelineR
 	logger := logging.FromContext(ctx)
 	logger.Debugw("received a PipelineRun event", "namespace", pr.Namespace, "name", pr.Name, "status", pr.Status)
 
+	// the worker is counted as active for the whole reconcile, to size the concurrent workers
+	defer metrics.GetRecorder().StartWorker(ctx, metrics.ResourceTypePipelineRun)()
+
+	// the run is not processed with an empty config on the controller start
+	if err := r.configGate.Check(ctx, pr); err != nil {
+		return err
+	}
+
+	trigger := r.triggers.Take(types.NamespacedName{Namespace: pr.Namespace, Name: pr.Name})
+
+	// the runs enqueued by a sweep are processed in a bounded number of namespaces at once, the others are requeued
+	if trigger == metrics.TriggerConfigChange || trigger == metrics.TriggerSweep {
+		release, err := r.sweepLimiter.Acquire(ctx, pr)
+		if err != nil {
+			r.triggers.Mark(pr, trigger)
+			return err
+		}
+		defer release()
+	}
+
 	// Start timing the reconciliation
 	metricsRecorder := metrics.GetRecorder()
 	reconcileTimer := metricsRecorder.NewTimer(metrics.ResourceAttributes(metrics.ResourceTypePipelineRun, pr.Namespace)...)
@@ -46,7 +75,7 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, pr *pipelinev1.PipelineR
 	status := metrics.StatusSuccess
 	defer func() {
 		// Record reconciliation event (every reconciliation)
-		metricsRecorder.RecordReconciliationEvent(ctx, metrics.ResourceTypePipelineRun, pr.Namespace, status)
+		metricsRecorder.RecordReconciliationEvent(ctx, metrics.ResourceTypePipelineRun, pr.Namespace, status, trigger)
 		// Record unique resource (only first time we see this UID)
 		metricsRecorder.RecordResourceProcessed(ctx, pr.UID, metrics.ResourceTypePipelineRun, pr.Namespace, status)
 	}()
@@ -91,6 +120,8 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, pr *pipelinev1.PipelineR
 // it contains a client to interact with the pipeline API and manage PipelineRuns
 type PrFuncs struct {
 	client pipelineversioned.Interface
+	// taskRunLister looks up the TaskRuns of a PipelineRun on the verification of their owner references
+	taskRunLister pipelinev1listers.TaskRunLister
 }
 
 // Type returns the kind of resource represented by the PRFuncs struct, which is "PipelineRun".
@@ -293,9 +324,64 @@ func (prf *PrFuncs) Get(ctx context.Context, namespace, name string) (metav1.Obj
 	return prf.client.TektonV1().PipelineRuns(namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
-// Delete removes a specific PipelineRun by name in the given namespace.
+// Delete removes a specific PipelineRun by name in the given namespace, with the preconditions of the context.
 func (prf *PrFuncs) Delete(ctx context.Context, namespace, name string) error {
-	return prf.client.TektonV1().PipelineRuns(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	return prf.client.TektonV1().PipelineRuns(namespace).Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: config.DeletePreconditionsFromContext(ctx),
+	})
+}
+
+// SetTaskRunLister sets the lister the TaskRuns of a PipelineRun are looked up with, on the verification
+// of their owner references. The owner references are not verified without a lister
+func (prf *PrFuncs) SetTaskRunLister(lister pipelinev1listers.TaskRunLister) {
+	prf.taskRunLister = lister
+}
+
+// VerifyDeletion verifies the owner references of the TaskRuns of the PipelineRun before it is deleted,
+// when the verification is enabled. It is called on every deletion path of the pruner
+func (prf *PrFuncs) VerifyDeletion(ctx context.Context, resource metav1.Object) {
+	if config.PrunerConfigStore.IsFeatureEnabled(config.FeatureVerifyChildOwnership) {
+		prf.verifyChildOwnership(ctx, resource.GetNamespace(), resource.GetName())
+	}
+}
+
+// verifyChildOwnership returns the TaskRuns of the PipelineRun which lack its owner reference, they are orphaned
+// by the deletion of the PipelineRun instead of being deleted along with it by the garbage collector
+func (prf *PrFuncs) verifyChildOwnership(ctx context.Context, namespace, name string) []string {
+	logger := logging.FromContext(ctx)
+	if prf.taskRunLister == nil {
+		logger.Debugw("no TaskRun lister, the owner references of the TaskRuns of the PipelineRun are not verified",
+			"namespace", namespace, "name", name)
+		return nil
+	}
+
+	taskRuns, err := prf.taskRunLister.TaskRuns(namespace).List(labels.SelectorFromSet(labels.Set{config.LabelPipelineRunName: name}))
+	if err != nil {
+		logger.Warnw("unable to verify the owner references of the TaskRuns of the PipelineRun",
+			"namespace", namespace, "name", name, zap.Error(err))
+		return nil
+	}
+
+	var orphaned []string
+	for _, taskRun := range taskRuns {
+		owned := false
+		for _, ownerReference := range taskRun.OwnerReferences {
+			if ownerReference.Kind == config.KindPipelineRun && ownerReference.Name == name {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			orphaned = append(orphaned, taskRun.Name)
+		}
+	}
+
+	if len(orphaned) > 0 {
+		logger.Warnw("TaskRuns of the PipelineRun lack its owner reference, they are orphaned by its deletion",
+			"namespace", namespace, "name", name, "taskRuns", orphaned)
+		metrics.GetRecorder().RecordOrphanedChildren(ctx, metrics.ResourceTypeTaskRun, namespace, len(orphaned))
+	}
+	return orphaned
 }
 
 // Update modifies an existing PipelineRun resource.
@@ -328,12 +414,18 @@ func (prf *PrFuncs) Patch(ctx context.Context, namespace, name string, patchByte
 
 // GetCompletionTime retrieves the completion time of a PipelineRun resource.
 func (prf *PrFuncs) GetCompletionTime(resource metav1.Object) (metav1.Time, error) {
-	pr, ok := resource.(*pipelinev1.PipelineRun)
+	pr, ok := toPipelineRun(resource)
 	if !ok {
 		return metav1.Time{}, fmt.Errorf("resource type error, this is not a PipelineRun resource. namespace:%s, name:%s, type:%T",
 			resource.GetNamespace(), resource.GetName(), resource)
 	}
 	if pr.Status.CompletionTime != nil {
+		// a run retried in place may keep the completion time of a previous attempt,
+		// the final condition is used when it transitioned later
+		condition := pr.Status.GetCondition(apis.ConditionSucceeded)
+		if condition != nil && condition.Status != corev1.ConditionUnknown && condition.LastTransitionTime.Inner.After(pr.Status.CompletionTime.Time) {
+			return condition.LastTransitionTime.Inner, nil
+		}
 		return *pr.Status.CompletionTime, nil
 	}
 	for _, c := range pr.Status.Conditions {
@@ -363,7 +455,7 @@ func (prf *PrFuncs) Ignore(resource metav1.Object) bool {
 
 // IsCompleted checks if the PipelineRun resource has completed.
 func (prf *PrFuncs) IsCompleted(resource metav1.Object) bool {
-	pr, ok := resource.(*pipelinev1.PipelineRun)
+	pr, ok := toPipelineRun(resource)
 	if !ok {
 		return false
 	}
@@ -372,6 +464,13 @@ func (prf *PrFuncs) IsCompleted(resource metav1.Object) bool {
 		return false
 	}
 
+	// the final condition takes precedence over the completion time, a run retried
+	// in place is running again while it keeps the completion time of the failed attempt
+	condition := pr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition != nil && condition.Status == corev1.ConditionUnknown {
+		return false
+	}
+
 	if pr.Status.CompletionTime != nil {
 		return true
 	}
@@ -381,17 +480,12 @@ func (prf *PrFuncs) IsCompleted(resource metav1.Object) bool {
 	}
 
 	// check the status from conditions
-	condition := pr.Status.GetCondition(apis.ConditionSucceeded)
-	if condition == nil || condition.Status == corev1.ConditionUnknown {
-		return false
-	}
-
-	return true
+	return condition != nil
 }
 
 // IsSuccessful checks if the PipelineRun resource has successfully completed.
 func (prf *PrFuncs) IsSuccessful(resource metav1.Object) bool {
-	pr, ok := resource.(*pipelinev1.PipelineRun)
+	pr, ok := toPipelineRun(resource)
 	if !ok {
 		return false
 	}
@@ -416,7 +510,7 @@ func (prf *PrFuncs) IsSuccessful(resource metav1.Object) bool {
 
 // IsFailed checks if the PipelineRun resource has failed.
 func (prf *PrFuncs) IsFailed(resource metav1.Object) bool {
-	pr, ok := resource.(*pipelinev1.PipelineRun)
+	pr, ok := toPipelineRun(resource)
 	if !ok {
 		return false
 	}
@@ -425,9 +519,61 @@ func (prf *PrFuncs) IsFailed(resource metav1.Object) bool {
 		return false
 	}
 
+	// a run without a final condition, for example a run just created, has not failed
+	condition := pr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status == corev1.ConditionUnknown {
+		return false
+	}
+
 	return !prf.IsSuccessful(resource)
 }
 
+// IsParentDeleting returns false, a PipelineRun is not owned by another run.
+func (prf *PrFuncs) IsParentDeleting(_ context.Context, _ metav1.Object) bool {
+	return false
+}
+
+// GetCompletionStatus returns the outcome of a completed PipelineRun: succeeded, failed or cancelled.
+func (prf *PrFuncs) GetCompletionStatus(resource metav1.Object) string {
+	pr, ok := toPipelineRun(resource)
+	if !ok {
+		return metrics.StatusFailed
+	}
+
+	if prf.IsSuccessful(resource) {
+		return metrics.StatusSucceeded
+	}
+
+	if pr.IsCancelled() {
+		return metrics.StatusCancelled
+	}
+	// a run cancelled or stopped gracefully keeps the reason it got while running its finally tasks
+	if condition := pr.Status.GetCondition(apis.ConditionSucceeded); condition != nil {
+		switch pipelinev1.PipelineRunReason(condition.Reason) {
+		case pipelinev1.PipelineRunReasonCancelled,
+			pipelinev1.PipelineRunReasonCancelledRunningFinally,
+			pipelinev1.PipelineRunReasonStoppedRunningFinally:
+			return metrics.StatusCancelled
+		}
+	}
+
+	return metrics.StatusFailed
+}
+
+// GetCompletionReason returns the reason of the Succeeded condition of the PipelineRun, for example PipelineRunTimeout.
+func (prf *PrFuncs) GetCompletionReason(resource metav1.Object) string {
+	pr, ok := toPipelineRun(resource)
+	if !ok {
+		return ""
+	}
+
+	condition := pr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil {
+		return ""
+	}
+	return condition.Reason
+}
+
 // GetDefaultLabelKey returns the default label key for PipelineRun resources.
 func (prf *PrFuncs) GetDefaultLabelKey() string {
 	return config.LabelPipelineName
@@ -438,6 +584,34 @@ func (prf *PrFuncs) GetTTLSecondsAfterFinished(namespace, pipelineName string, s
 	return config.PrunerConfigStore.GetPipelineTTLSecondsAfterFinished(namespace, pipelineName, selectors)
 }
 
+// GetTTLSecondsAfterFinishedWithoutResults retrieves the TTL in seconds after a PipelineRun which produced no results finishes.
+func (prf *PrFuncs) GetTTLSecondsAfterFinishedWithoutResults(namespace, pipelineName string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetPipelineTTLSecondsAfterFinishedWithoutResults(namespace, pipelineName, selectors)
+}
+
+// GetTTLJitterSeconds retrieves the window in seconds the deletion deadlines of the PipelineRuns are spread within.
+func (prf *PrFuncs) GetTTLJitterSeconds(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetPipelineTTLJitterSeconds(namespace, name, selectors)
+}
+
+// GetStartTime retrieves the start time of a PipelineRun resource, nil when it is not started.
+func (prf *PrFuncs) GetStartTime(resource metav1.Object) *metav1.Time {
+	pr, ok := toPipelineRun(resource)
+	if !ok {
+		return nil
+	}
+	return pr.Status.StartTime
+}
+
+// HasResults checks if the PipelineRun resource produced any results.
+func (prf *PrFuncs) HasResults(resource metav1.Object) bool {
+	pr, ok := toPipelineRun(resource)
+	if !ok {
+		return false
+	}
+	return len(pr.Status.Results) > 0
+}
+
 // GetSuccessHistoryLimitCount retrieves the success history limit count for a PipelineRun.
 func (prf *PrFuncs) GetSuccessHistoryLimitCount(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
 	return config.PrunerConfigStore.GetPipelineSuccessHistoryLimitCount(namespace, name, selectors)
@@ -448,7 +622,55 @@ func (prf *PrFuncs) GetFailedHistoryLimitCount(namespace, name string, selectors
 	return config.PrunerConfigStore.GetPipelineFailedHistoryLimitCount(namespace, name, selectors)
 }
 
+// GetRetainCalendarDays retrieves the number of calendar days the completed PipelineRuns are retained for regardless of the history limits.
+func (prf *PrFuncs) GetRetainCalendarDays(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetPipelineRetainCalendarDays(namespace, name, selectors)
+}
+
+// GetHistoryLimitCount retrieves the history limit of the successful and the failed PipelineRuns together.
+func (prf *PrFuncs) GetHistoryLimitCount(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetPipelineHistoryLimitCount(namespace, name, selectors)
+}
+
+// GetMinRetained retrieves the number of PipelineRuns retained regardless of their age.
+func (prf *PrFuncs) GetMinRetained(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetPipelineMinRetained(namespace, name, selectors)
+}
+
+// GetMinRetainedPerOutcome retrieves the number of the successful and of the failed PipelineRuns retained under the combined history limit.
+func (prf *PrFuncs) GetMinRetainedPerOutcome(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetPipelineMinRetainedPerOutcome(namespace, name, selectors)
+}
+
+// GetMinRetentionSeconds retrieves the time in seconds the completed PipelineRuns are retained for, regardless of the history limits.
+func (prf *PrFuncs) GetMinRetentionSeconds(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetPipelineMinRetentionSeconds(namespace, name, selectors)
+}
+
+// GetMaxRetentionAgeSeconds retrieves the maximum age in seconds of the retained PipelineRuns.
+func (prf *PrFuncs) GetMaxRetentionAgeSeconds(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetPipelineMaxRetentionAgeSeconds(namespace, name, selectors)
+}
+
 // GetEnforcedConfigLevel retrieves the enforced config level for a PipelineRun.
 func (prf *PrFuncs) GetEnforcedConfigLevel(namespace, name string, selectors config.SelectorSpec) config.EnforcedConfigLevel {
 	return config.PrunerConfigStore.GetPipelineEnforcedConfigLevel(namespace, name, selectors)
 }
+
+// toPipelineRun returns the resource as a v1 PipelineRun. The v1beta1 PipelineRuns are converted to v1,
+// so the status of the runs created with the older API version is read the same way
+func toPipelineRun(resource metav1.Object) (*pipelinev1.PipelineRun, bool) {
+	switch pr := resource.(type) {
+	case *pipelinev1.PipelineRun:
+		return pr, true
+	case *pipelinev1beta1.PipelineRun:
+		converted := &pipelinev1.PipelineRun{}
+		// the conversion may annotate the object meta, convert a copy to keep the original intact
+		if err := pr.DeepCopy().ConvertTo(context.Background(), converted); err != nil {
+			return nil, false
+		}
+		return converted, true
+	default:
+		return nil, false
+	}
+}
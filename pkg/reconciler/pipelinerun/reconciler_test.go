@@ -3,20 +3,28 @@ package pipelinerun
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 	fakepipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	pipelinev1listers "github.com/tektoncd/pipeline/pkg/client/listers/pipeline/v1"
 	"go.uber.org/zap/zaptest"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 	clocktest "k8s.io/utils/clock/testing"
 	"knative.dev/pkg/apis"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/logging"
 )
 
@@ -148,6 +156,71 @@ func TestPrFuncs_Ignore(t *testing.T) {
 	}
 }
 
+func TestPrFuncs_GetCompletionStatus(t *testing.T) {
+	newRun := func(status corev1.ConditionStatus, reason string) *pipelinev1.PipelineRun {
+		return &pipelinev1.PipelineRun{
+			Status: pipelinev1.PipelineRunStatus{
+				Status: duckv1.Status{
+					Conditions: []apis.Condition{{
+						Type:   apis.ConditionSucceeded,
+						Status: status,
+						Reason: reason,
+					}},
+				},
+			},
+		}
+	}
+
+	cancelledBySpec := newRun(corev1.ConditionFalse, "Failed")
+	cancelledBySpec.Spec.Status = pipelinev1.PipelineRunSpecStatusCancelled
+
+	tests := []struct {
+		name string
+		pr   *pipelinev1.PipelineRun
+		want string
+	}{
+		{
+			name: "succeeded",
+			pr:   newRun(corev1.ConditionTrue, string(pipelinev1.PipelineRunReasonSuccessful)),
+			want: metrics.StatusSucceeded,
+		},
+		{
+			name: "failed",
+			pr:   newRun(corev1.ConditionFalse, "Failed"),
+			want: metrics.StatusFailed,
+		},
+		{
+			name: "cancelled",
+			pr:   newRun(corev1.ConditionFalse, string(pipelinev1.PipelineRunReasonCancelled)),
+			want: metrics.StatusCancelled,
+		},
+		{
+			name: "cancelled running finally",
+			pr:   newRun(corev1.ConditionFalse, string(pipelinev1.PipelineRunReasonCancelledRunningFinally)),
+			want: metrics.StatusCancelled,
+		},
+		{
+			name: "stopped running finally",
+			pr:   newRun(corev1.ConditionFalse, string(pipelinev1.PipelineRunReasonStoppedRunningFinally)),
+			want: metrics.StatusCancelled,
+		},
+		{
+			name: "cancelled by spec",
+			pr:   cancelledBySpec,
+			want: metrics.StatusCancelled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prFuncs := &PrFuncs{client: fakepipelineclientset.NewSimpleClientset()}
+			if got := prFuncs.GetCompletionStatus(tt.pr); got != tt.want {
+				t.Errorf("PrFuncs.GetCompletionStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestReconciler_ProcessPipelineRun(t *testing.T) {
 	fakeClock := clocktest.NewFakeClock(time.Now())
 
@@ -264,3 +337,565 @@ failedHistoryLimit: %d`, tt.ttl, tt.successLimit, tt.failureLimit),
 		})
 	}
 }
+
+func TestReconcileBeforeConfigLoaded(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{Data: map[string]string{
+		config.PrunerGlobalConfigKey: "enforcedConfigLevel: global\nttlSecondsAfterFinished: 60",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{}) })
+
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "expired",
+			Namespace:   "default",
+			Annotations: map[string]string{config.AnnotationTTLSecondsAfterFinished: "60"},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				StartTime:      &metav1.Time{Time: fakeClock.Now().Add(-2 * time.Hour)},
+				CompletionTime: &metav1.Time{Time: fakeClock.Now().Add(-time.Hour)},
+			},
+			Status: duckv1.Status{
+				Conditions: []apis.Condition{{Type: apis.ConditionSucceeded, Status: corev1.ConditionTrue}},
+			},
+		},
+	}
+	client := fakepipelineclientset.NewSimpleClientset(pr)
+	prFuncs := &PrFuncs{client: client}
+	ttlHandler, err := config.NewTTLHandler(fakeClock, prFuncs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	historyLimiter, err := config.NewHistoryLimiter(prFuncs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := false
+	r := &Reconciler{
+		kubeclient:     fake.NewSimpleClientset(),
+		ttlHandler:     ttlHandler,
+		historyLimiter: historyLimiter,
+		configGate:     config.NewConfigGate(func() bool { return loaded }, 5*time.Second),
+	}
+
+	// the run is requeued, it is not deleted with a config which is not loaded yet
+	err = r.ReconcileKind(ctx, pr)
+	if ok, delay := controller.IsRequeueKey(err); !ok || delay != 5*time.Second {
+		t.Fatalf("ReconcileKind() error = %v, want a requeue after 5s", err)
+	}
+	if _, err := client.TektonV1().PipelineRuns("default").Get(ctx, pr.Name, metav1.GetOptions{}); err != nil {
+		t.Fatalf("the PipelineRun was deleted before the config is loaded: %v", err)
+	}
+
+	// the expired run is deleted once the config is loaded
+	loaded = true
+	if err := r.ReconcileKind(ctx, pr); err != nil {
+		t.Fatalf("ReconcileKind() error = %v", err)
+	}
+	if _, err := client.TektonV1().PipelineRuns("default").Get(ctx, pr.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("the expired PipelineRun is not deleted once the config is loaded, error = %v", err)
+	}
+}
+
+func TestReconcileSweepLimit(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{Data: map[string]string{
+		config.PrunerGlobalConfigKey: "enforcedConfigLevel: global\nttlSecondsAfterFinished: 60",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{}) })
+
+	fakeClock := clocktest.NewFakeClock(time.Now())
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "expired",
+			Namespace:   "default",
+			Annotations: map[string]string{config.AnnotationTTLSecondsAfterFinished: "60"},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				StartTime:      &metav1.Time{Time: fakeClock.Now().Add(-2 * time.Hour)},
+				CompletionTime: &metav1.Time{Time: fakeClock.Now().Add(-time.Hour)},
+			},
+			Status: duckv1.Status{
+				Conditions: []apis.Condition{{Type: apis.ConditionSucceeded, Status: corev1.ConditionTrue}},
+			},
+		},
+	}
+	client := fakepipelineclientset.NewSimpleClientset(pr)
+	prFuncs := &PrFuncs{client: client}
+	ttlHandler, err := config.NewTTLHandler(fakeClock, prFuncs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	historyLimiter, err := config.NewHistoryLimiter(prFuncs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sweepLimiter := config.NewSweepLimiter(1, time.Second)
+	r := &Reconciler{
+		kubeclient:     fake.NewSimpleClientset(),
+		ttlHandler:     ttlHandler,
+		historyLimiter: historyLimiter,
+		triggers:       metrics.NewTriggerTracker(),
+		sweepLimiter:   sweepLimiter,
+	}
+
+	// another namespace is being swept, the run of the sweep is requeued with its trigger
+	release, err := sweepLimiter.Acquire(ctx, &pipelinev1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "other"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.triggers.Mark(pr, metrics.TriggerSweep)
+	if ok, _ := controller.IsRequeueKey(r.ReconcileKind(ctx, pr)); !ok {
+		t.Fatal("the run of a sweep is not requeued while the limit of namespaces is reached")
+	}
+	if _, err := client.TektonV1().PipelineRuns("default").Get(ctx, pr.Name, metav1.GetOptions{}); err != nil {
+		t.Fatalf("the requeued PipelineRun was deleted: %v", err)
+	}
+
+	// the run is processed once the other namespace is swept
+	release()
+	if err := r.ReconcileKind(ctx, pr); err != nil {
+		t.Fatalf("ReconcileKind() error = %v", err)
+	}
+	if _, err := client.TektonV1().PipelineRuns("default").Get(ctx, pr.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("the expired PipelineRun is not deleted once the namespace is admitted, error = %v", err)
+	}
+}
+
+func TestHistoryLimitByOwnerReference(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: config.PrunerConfigMapName, Namespace: "tekton-pipelines"},
+		Data: map[string]string{config.PrunerGlobalConfigKey: `enforcedConfigLevel: resource
+namespaces:
+  dev:
+    pipelineRuns:
+      - selector:
+          - matchOwnerReferences:
+              - kind: EventListener
+        successfulHistoryLimit: 1`},
+	}
+	if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, cm); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	t.Cleanup(func() { _ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{}) })
+
+	newRun := func(name string, age time.Duration, ownerKind string) *pipelinev1.PipelineRun {
+		pr := &pipelinev1.PipelineRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "dev",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+			},
+			Status: pipelinev1.PipelineRunStatus{
+				PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+					StartTime:      &metav1.Time{Time: time.Now().Add(-age)},
+					CompletionTime: &metav1.Time{Time: time.Now().Add(-age).Add(time.Minute)},
+				},
+				Status: duckv1.Status{
+					Conditions: []apis.Condition{{
+						Type:   apis.ConditionSucceeded,
+						Status: corev1.ConditionTrue,
+						Reason: pipelinev1.PipelineRunReasonSuccessful.String(),
+					}},
+				},
+			},
+		}
+		if ownerKind != "" {
+			pr.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: "owner", UID: "owner-uid"}}
+		}
+		return pr
+	}
+
+	runs := []*pipelinev1.PipelineRun{
+		newRun("triggered-1", 3*time.Hour, "EventListener"),
+		newRun("triggered-2", 2*time.Hour, "EventListener"),
+		newRun("triggered-3", time.Hour, "EventListener"),
+		newRun("manual-1", 3*time.Hour, ""),
+		newRun("manual-2", 2*time.Hour, ""),
+	}
+	pipelineClient := fakepipelineclientset.NewSimpleClientset(runs[0], runs[1], runs[2], runs[3], runs[4])
+	historyLimiter, err := config.NewHistoryLimiter(NewPrFuncs(pipelineClient))
+	if err != nil {
+		t.Fatalf("Failed to create HistoryLimiter: %v", err)
+	}
+
+	for _, pr := range []*pipelinev1.PipelineRun{runs[2], runs[4]} {
+		if err := historyLimiter.ProcessEvent(ctx, pr); err != nil {
+			t.Fatalf("ProcessEvent() error = %v", err)
+		}
+	}
+
+	prs, err := pipelineClient.TektonV1().PipelineRuns("dev").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list PipelineRuns: %v", err)
+	}
+	var remaining []string
+	for _, pr := range prs.Items {
+		remaining = append(remaining, pr.Name)
+	}
+	sort.Strings(remaining)
+	if want := []string{"manual-1", "manual-2", "triggered-3"}; fmt.Sprint(remaining) != fmt.Sprint(want) {
+		t.Errorf("remaining PipelineRuns = %v, want %v", remaining, want)
+	}
+}
+
+func TestHistoryLimitLongPipelineName(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+
+	// the label value of a name longer than 63 characters is truncated and suffixed with its hash
+	longName := "build-and-deploy-the-frontend-application-to-the-staging-environment"
+	otherName := longName + "-nightly"
+	labelValue := kmeta.ChildName(longName, "")
+	otherLabelValue := kmeta.ChildName(otherName, "")
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: config.PrunerConfigMapName, Namespace: "tekton-pipelines"},
+		Data: map[string]string{config.PrunerGlobalConfigKey: fmt.Sprintf(`enforcedConfigLevel: resource
+namespaces:
+  dev:
+    pipelineRuns:
+      - name: %s
+        successfulHistoryLimit: 1
+      - name: %s
+        successfulHistoryLimit: 2`, longName, otherName)},
+	}
+	if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, cm); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	t.Cleanup(func() { _ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{}) })
+
+	newRun := func(name string, age time.Duration, pipelineLabel string) *pipelinev1.PipelineRun {
+		return &pipelinev1.PipelineRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "dev",
+				CreationTimestamp: metav1.Time{Time: time.Now().Add(-age)},
+				Labels:            map[string]string{config.LabelPipelineName: pipelineLabel},
+			},
+			Status: pipelinev1.PipelineRunStatus{
+				PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+					StartTime:      &metav1.Time{Time: time.Now().Add(-age)},
+					CompletionTime: &metav1.Time{Time: time.Now().Add(-age).Add(time.Minute)},
+				},
+				Status: duckv1.Status{
+					Conditions: []apis.Condition{{
+						Type:   apis.ConditionSucceeded,
+						Status: corev1.ConditionTrue,
+						Reason: pipelinev1.PipelineRunReasonSuccessful.String(),
+					}},
+				},
+			},
+		}
+	}
+
+	runs := []*pipelinev1.PipelineRun{
+		newRun("build-1", 3*time.Hour, labelValue),
+		newRun("build-2", 2*time.Hour, labelValue),
+		newRun("build-3", time.Hour, labelValue),
+		newRun("nightly-1", 3*time.Hour, otherLabelValue),
+		newRun("nightly-2", 2*time.Hour, otherLabelValue),
+		newRun("nightly-3", time.Hour, otherLabelValue),
+	}
+	pipelineClient := fakepipelineclientset.NewSimpleClientset(runs[0], runs[1], runs[2], runs[3], runs[4], runs[5])
+	historyLimiter, err := config.NewHistoryLimiter(NewPrFuncs(pipelineClient))
+	if err != nil {
+		t.Fatalf("Failed to create HistoryLimiter: %v", err)
+	}
+
+	for _, pr := range []*pipelinev1.PipelineRun{runs[2], runs[5]} {
+		if err := historyLimiter.ProcessEvent(ctx, pr); err != nil {
+			t.Fatalf("ProcessEvent() error = %v", err)
+		}
+	}
+
+	prs, err := pipelineClient.TektonV1().PipelineRuns("dev").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list PipelineRuns: %v", err)
+	}
+	var remaining []string
+	for _, pr := range prs.Items {
+		remaining = append(remaining, pr.Name)
+	}
+	sort.Strings(remaining)
+	if want := []string{"build-3", "nightly-2", "nightly-3"}; fmt.Sprint(remaining) != fmt.Sprint(want) {
+		t.Errorf("remaining PipelineRuns = %v, want %v", remaining, want)
+	}
+}
+
+func TestPrFuncs_V1beta1(t *testing.T) {
+	startTime := metav1.NewTime(time.Now().Add(-1 * time.Hour).Truncate(time.Second))
+	finishTime := metav1.NewTime(time.Now().Truncate(time.Second))
+	newRun := func(completionTime *metav1.Time, status corev1.ConditionStatus, reason string) *pipelinev1beta1.PipelineRun {
+		return &pipelinev1beta1.PipelineRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "run1", Namespace: "ns1"},
+			Status: pipelinev1beta1.PipelineRunStatus{
+				PipelineRunStatusFields: pipelinev1beta1.PipelineRunStatusFields{
+					StartTime:      &startTime,
+					CompletionTime: completionTime,
+				},
+				Status: duckv1.Status{
+					Conditions: []apis.Condition{{
+						Type:               apis.ConditionSucceeded,
+						Status:             status,
+						Reason:             reason,
+						LastTransitionTime: apis.VolatileTime{Inner: finishTime},
+					}},
+				},
+			},
+		}
+	}
+
+	prFuncs := NewPrFuncs(nil)
+
+	tests := []struct {
+		name          string
+		run           *pipelinev1beta1.PipelineRun
+		wantCompleted bool
+		wantStatus    string
+	}{
+		{
+			name:          "completed with CompletionTime",
+			run:           newRun(&finishTime, corev1.ConditionTrue, pipelinev1beta1.PipelineRunReasonSuccessful.String()),
+			wantCompleted: true,
+			wantStatus:    metrics.StatusSucceeded,
+		},
+		{
+			name:          "completed with failed condition",
+			run:           newRun(nil, corev1.ConditionFalse, "Failed"),
+			wantCompleted: true,
+			wantStatus:    metrics.StatusFailed,
+		},
+		{
+			name:          "running",
+			run:           newRun(nil, corev1.ConditionUnknown, "Running"),
+			wantCompleted: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prFuncs.IsCompleted(tt.run); got != tt.wantCompleted {
+				t.Fatalf("IsCompleted() = %v, want %v", got, tt.wantCompleted)
+			}
+			if !tt.wantCompleted {
+				return
+			}
+			if got := prFuncs.GetCompletionStatus(tt.run); got != tt.wantStatus {
+				t.Errorf("GetCompletionStatus() = %v, want %v", got, tt.wantStatus)
+			}
+			completionTime, err := prFuncs.GetCompletionTime(tt.run)
+			if err != nil {
+				t.Fatalf("GetCompletionTime() unexpected error = %v", err)
+			}
+			if !completionTime.Equal(&finishTime) {
+				t.Errorf("GetCompletionTime() = %v, want %v", completionTime, finishTime)
+			}
+			if len(tt.run.Annotations) != 0 {
+				t.Errorf("the v1beta1 run should not be modified, got annotations %v", tt.run.Annotations)
+			}
+		})
+	}
+}
+
+func TestPrFuncs_HasResults(t *testing.T) {
+	prFuncs := NewPrFuncs(nil)
+
+	withResults := &pipelinev1.PipelineRun{Status: pipelinev1.PipelineRunStatus{
+		PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+			Results: []pipelinev1.PipelineRunResult{{Name: "digest", Value: *pipelinev1.NewStructuredValues("sha256:abc")}},
+		},
+	}}
+	if !prFuncs.HasResults(withResults) {
+		t.Error("HasResults() = false for a PipelineRun with results, want true")
+	}
+	if prFuncs.HasResults(&pipelinev1.PipelineRun{}) {
+		t.Error("HasResults() = true for a PipelineRun without results, want false")
+	}
+}
+
+func TestPrFuncs_RetriedInPlace(t *testing.T) {
+	prFuncs := &PrFuncs{client: fakepipelineclientset.NewSimpleClientset()}
+	failedAt := time.Now().Add(-time.Hour)
+	succeededAt := time.Now()
+
+	// the run failed, then it is retried in place, keeping the completion time of the failed attempt
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "retried", Namespace: "default"},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				StartTime:      &metav1.Time{Time: failedAt.Add(-time.Hour)},
+				CompletionTime: &metav1.Time{Time: failedAt},
+			},
+			Status: duckv1.Status{
+				Conditions: []apis.Condition{{
+					Type:   apis.ConditionSucceeded,
+					Status: corev1.ConditionUnknown,
+					Reason: string(pipelinev1.PipelineRunReasonRunning),
+				}},
+			},
+		},
+	}
+	if prFuncs.IsCompleted(pr) {
+		t.Error("IsCompleted() = true while the run is retried, want false")
+	}
+
+	// the retry succeeds
+	pr.Status.Conditions = []apis.Condition{{
+		Type:               apis.ConditionSucceeded,
+		Status:             corev1.ConditionTrue,
+		Reason:             string(pipelinev1.PipelineRunReasonSuccessful),
+		LastTransitionTime: apis.VolatileTime{Inner: metav1.Time{Time: succeededAt}},
+	}}
+	if !prFuncs.IsCompleted(pr) {
+		t.Error("IsCompleted() = false, want true")
+	}
+	if !prFuncs.IsSuccessful(pr) || prFuncs.IsFailed(pr) {
+		t.Errorf("IsSuccessful() = %v, IsFailed() = %v, want the run to be counted as successful only",
+			prFuncs.IsSuccessful(pr), prFuncs.IsFailed(pr))
+	}
+	if status := prFuncs.GetCompletionStatus(pr); status != metrics.StatusSucceeded {
+		t.Errorf("GetCompletionStatus() = %s, want %s", status, metrics.StatusSucceeded)
+	}
+	completionTime, err := prFuncs.GetCompletionTime(pr)
+	if err != nil {
+		t.Fatalf("GetCompletionTime() error = %v", err)
+	}
+	if !completionTime.Time.Equal(succeededAt) {
+		t.Errorf("GetCompletionTime() = %v, want the time of the final completion %v", completionTime.Time, succeededAt)
+	}
+}
+
+func TestPrFuncs_NoConditions(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		status pipelinev1.PipelineRunStatus
+	}{
+		{
+			name: "empty status",
+		},
+		{
+			name: "started without conditions",
+			status: pipelinev1.PipelineRunStatus{
+				PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+					StartTime: &metav1.Time{Time: now},
+				},
+			},
+		},
+		{
+			name: "empty conditions",
+			status: pipelinev1.PipelineRunStatus{
+				PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+					StartTime: &metav1.Time{Time: now},
+				},
+				Status: duckv1.Status{Conditions: []apis.Condition{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &pipelinev1.PipelineRun{Status: tt.status}
+			prFuncs := &PrFuncs{client: fakepipelineclientset.NewSimpleClientset()}
+			if prFuncs.IsCompleted(pr) || prFuncs.IsSuccessful(pr) || prFuncs.IsFailed(pr) {
+				t.Errorf("IsCompleted() = %v, IsSuccessful() = %v, IsFailed() = %v, want all false",
+					prFuncs.IsCompleted(pr), prFuncs.IsSuccessful(pr), prFuncs.IsFailed(pr))
+			}
+		})
+	}
+
+	// a run completed without a condition is neither counted as successful nor as failed,
+	// it is not deleted by a failed history limit of 0
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{Data: map[string]string{
+		config.PrunerGlobalConfigKey: "enforcedConfigLevel: global\nfailedHistoryLimit: 0",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{}) })
+
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "no-conditions", Namespace: "default"},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				StartTime:      &metav1.Time{Time: now.Add(-time.Hour)},
+				CompletionTime: &metav1.Time{Time: now},
+			},
+		},
+	}
+	client := fakepipelineclientset.NewSimpleClientset(pr)
+	historyLimiter, err := config.NewHistoryLimiter(&PrFuncs{client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := historyLimiter.ProcessEvent(ctx, pr); err != nil {
+		t.Fatalf("ProcessEvent() error = %v", err)
+	}
+	if _, err := client.TektonV1().PipelineRuns("default").Get(ctx, pr.Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("the PipelineRun without conditions was deleted: %v", err)
+	}
+}
+
+func TestPrFuncs_VerifyChildOwnership(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{Data: map[string]string{
+		config.PrunerGlobalConfigKey: "featureFlags:\n  verifyChildOwnership: true",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{}) })
+
+	pr := &pipelinev1.PipelineRun{ObjectMeta: metav1.ObjectMeta{Name: "build-1", Namespace: "default"}}
+	owned := &pipelinev1.TaskRun{ObjectMeta: metav1.ObjectMeta{
+		Name:            "build-1-compile",
+		Namespace:       "default",
+		Labels:          map[string]string{config.LabelPipelineRunName: "build-1"},
+		OwnerReferences: []metav1.OwnerReference{{Kind: config.KindPipelineRun, Name: "build-1"}},
+	}}
+	orphaned := &pipelinev1.TaskRun{ObjectMeta: metav1.ObjectMeta{
+		Name:      "build-1-test",
+		Namespace: "default",
+		Labels:    map[string]string{config.LabelPipelineRunName: "build-1"},
+	}}
+	client := fakepipelineclientset.NewSimpleClientset(pr, owned, orphaned)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, taskRun := range []*pipelinev1.TaskRun{owned, orphaned} {
+		if err := indexer.Add(taskRun); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prFuncs := &PrFuncs{client: client, taskRunLister: pipelinev1listers.NewTaskRunLister(indexer)}
+
+	// the owned TaskRun is pruned along with the PipelineRun, the orphaned one is warned about
+	if got := prFuncs.verifyChildOwnership(ctx, "default", "build-1"); !reflect.DeepEqual(got, []string{"build-1-test"}) {
+		t.Errorf("verifyChildOwnership() = %v, want [build-1-test]", got)
+	}
+
+	// the deletion is verified by the pruner before any deletion backend deletes the PipelineRun
+	var _ config.DeletionVerifier = prFuncs
+	prFuncs.VerifyDeletion(ctx, pr)
+	if err := prFuncs.Delete(ctx, "default", "build-1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := client.TektonV1().PipelineRuns("default").Get(ctx, "build-1", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("the PipelineRun is not deleted, error = %v", err)
+	}
+
+	// the TaskRuns are looked up on the lister, not listed from the API server
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource == "taskruns" {
+			t.Error("the TaskRuns of the PipelineRun are listed from the API server")
+		}
+	}
+}
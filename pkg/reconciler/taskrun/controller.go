@@ -5,12 +5,13 @@ import (
 	"os"
 
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	pipelineclient "github.com/tektoncd/pipeline/pkg/client/injection/client"
 	taskruninformer "github.com/tektoncd/pipeline/pkg/client/injection/informers/pipeline/v1/taskrun"
 	taskrunreconciler "github.com/tektoncd/pipeline/pkg/client/injection/reconciler/pipeline/v1/taskrun"
 	"go.uber.org/zap"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/utils/clock"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
 	"knative.dev/pkg/configmap"
@@ -26,6 +27,8 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	// cluster's state of the respective resource at all times.
 	taskRunInformer := taskruninformer.Get(ctx)
 
+	// the log level is overridden by the pruner config map
+	ctx = config.WithLogLevel(ctx)
 	logger := logging.FromContext(ctx)
 
 	taskRunFuncs := &TrFuncs{
@@ -35,17 +38,37 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	if err != nil {
 		logger.Fatal("error on getting ttl handler", zap.Error(err))
 	}
+	ttlHandler.SetNamespaceGetter(config.NewNamespaceGetter(config.GetNamespaceInformer(ctx, kubeclient.Get(ctx))))
 
 	historyLimiter, err := config.NewHistoryLimiter(taskRunFuncs)
 	if err != nil {
 		logger.Fatal("error on getting history limiter", zap.Error(err))
 	}
 
+	configGate, err := config.GetConfigGate()
+	if err != nil {
+		logger.Fatalw("error on getting the config gate",
+			"environmentKey", config.EnvConfigNotReadyRequeueSeconds, "environmentValue", os.Getenv(config.EnvConfigNotReadyRequeueSeconds),
+			zap.Error(err),
+		)
+	}
+
+	sweepLimiter, err := config.GetSweepLimiter()
+	if err != nil {
+		logger.Fatalw("error on getting the sweep limiter",
+			"environmentKey", config.EnvSweepConcurrentNamespaces, "environmentValue", os.Getenv(config.EnvSweepConcurrentNamespaces),
+			zap.Error(err),
+		)
+	}
+
 	r := &Reconciler{
 		// The client will be needed to create/delete Pods via the API.
 		kubeclient:     kubeclient.Get(ctx),
 		ttlHandler:     ttlHandler,
 		historyLimiter: historyLimiter,
+		triggers:       metrics.NewTriggerTracker(),
+		configGate:     configGate,
+		sweepLimiter:   sweepLimiter,
 	}
 
 	// number of works to process the events
@@ -60,31 +83,69 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 	ctrlOptions := controller.Options{
 		Concurrency: concurrentWorkers,
 	}
+	metrics.GetRecorder().RecordWorkers(ctx, metrics.ResourceTypeTaskRun, concurrentWorkers)
 
 	impl := taskrunreconciler.NewImpl(ctx, r, func(impl *controller.Impl) controller.Options { return ctrlOptions })
 
-	_, err = taskRunInformer.Informer().AddEventHandler(controller.HandleAll(filterTaskRun(logger, impl)))
+	// only the standalone TaskRuns of the namespaces owned by this replica's shard are processed
+	shardFilter := config.ShardFromContext(ctx).Filter
+	standaloneFilter := filterTaskRun(logger)
+	filter := func(obj interface{}) bool {
+		return shardFilter(obj) && standaloneFilter(obj)
+	}
+	_, err = taskRunInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: filter,
+		Handler:    r.triggers.Handler(impl.Enqueue),
+	})
+	if err != nil {
+		logger.Fatal("Failed to add event handler", zap.Error(err))
+	}
+
+	// a deleted run is not reconciled, it no longer holds its namespace in the sweep
+	_, err = taskRunInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: sweepLimiter.Forget,
+	})
 	if err != nil {
 		logger.Fatal("Failed to add event handler", zap.Error(err))
 	}
 
+	// sweep all the TaskRuns again once the config is changed
+	config.PrunerConfigStore.OnChange(func() {
+		impl.FilteredGlobalResync(func(obj interface{}) bool {
+			if !filter(obj) {
+				return false
+			}
+			r.triggers.Mark(obj, metrics.TriggerConfigChange)
+			r.sweepLimiter.MarkPending(obj)
+			return true
+		}, taskRunInformer.Informer())
+	})
+
+	// enqueue the completed TaskRuns on a sweep requested on the admin endpoint
+	config.RegisterSweeper(func() int {
+		return config.EnqueueCompleted(taskRunInformer.Informer().GetStore().List(), filter, taskRunFuncs.IsCompleted, func(obj interface{}) {
+			r.triggers.Mark(obj, metrics.TriggerSweep)
+			r.sweepLimiter.MarkPending(obj)
+			impl.EnqueueSlow(obj)
+		})
+	})
+
+	// explain the config of a TaskRun on the debug endpoint
+	config.RegisterExplainer(config.KindTaskRun, ttlHandler.ExplainConfig)
+
 	return impl
 }
 
 // filters the taskrun which has a parent
-func filterTaskRun(logger *zap.SugaredLogger, impl *controller.Impl) func(obj interface{}) {
-	return func(obj interface{}) {
+func filterTaskRun(logger *zap.SugaredLogger) func(obj interface{}) bool {
+	return func(obj interface{}) bool {
 		taskRun, err := kmeta.DeletionHandlingAccessor(obj)
 		if err != nil {
 			logger.Errorw("error on getting object as Accessor", zap.Error(err))
-			return
-		}
-
-		if !isStandaloneTaskRun(taskRun) {
-			return
+			return false
 		}
 
-		impl.EnqueueKey(types.NamespacedName{Namespace: taskRun.GetNamespace(), Name: taskRun.GetName()})
+		return isStandaloneTaskRun(taskRun)
 	}
 }
 
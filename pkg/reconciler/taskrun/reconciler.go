@@ -12,9 +12,11 @@ import (
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 	pipelineversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
 	taskrunreconciler "github.com/tektoncd/pipeline/pkg/client/injection/reconciler/pipeline/v1/taskrun"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"knative.dev/pkg/apis"
 	"knative.dev/pkg/controller"
@@ -28,6 +30,12 @@ type Reconciler struct {
 	kubeclient     kubernetes.Interface
 	ttlHandler     *config.TTLHandler
 	historyLimiter *config.HistoryLimiter
+	// triggers tracks what enqueued each run, it is recorded on the reconciliation events
+	triggers *metrics.TriggerTracker
+	// configGate requeues the runs reconciled before the global config is loaded, nil when disabled
+	configGate *config.ConfigGate
+	// sweepLimiter bounds the namespaces processed at the same time during a sweep, nil when not limited
+	sweepLimiter *config.SweepLimiter
 }
 
 // Check that our Reconciler implements Interface
@@ -40,12 +48,32 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, tr *pipelinev1.TaskRun)
 		"namespace", tr.Namespace, "name", tr.Name,
 	)
 
+	// the worker is counted as active for the whole reconcile, to size the concurrent workers
+	defer metrics.GetRecorder().StartWorker(ctx, metrics.ResourceTypeTaskRun)()
+
+	// the run is not processed with an empty config on the controller start
+	if err := r.configGate.Check(ctx, tr); err != nil {
+		return err
+	}
+
 	// if the TaskRun is not a standalone, no action needed
 	// if so, will be handled by it is parent resource(PipelineRun)
 	if !isStandaloneTaskRun(tr) {
 		return nil
 	}
 
+	trigger := r.triggers.Take(types.NamespacedName{Namespace: tr.Namespace, Name: tr.Name})
+
+	// the runs enqueued by a sweep are processed in a bounded number of namespaces at once, the others are requeued
+	if trigger == metrics.TriggerConfigChange || trigger == metrics.TriggerSweep {
+		release, err := r.sweepLimiter.Acquire(ctx, tr)
+		if err != nil {
+			r.triggers.Mark(tr, trigger)
+			return err
+		}
+		defer release()
+	}
+
 	// Start timing the reconciliation
 	metricsRecorder := metrics.GetRecorder()
 	reconcileTimer := metricsRecorder.NewTimer(metrics.ResourceAttributes(metrics.ResourceTypeTaskRun, tr.Namespace)...)
@@ -55,7 +83,7 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, tr *pipelinev1.TaskRun)
 	status := metrics.StatusSuccess
 	defer func() {
 		// Record reconciliation event (every reconciliation)
-		metricsRecorder.RecordReconciliationEvent(ctx, metrics.ResourceTypeTaskRun, tr.Namespace, status)
+		metricsRecorder.RecordReconciliationEvent(ctx, metrics.ResourceTypeTaskRun, tr.Namespace, status, trigger)
 		// Record unique resource (only first time we see this UID)
 		metricsRecorder.RecordResourceProcessed(ctx, tr.UID, metrics.ResourceTypeTaskRun, tr.Namespace, status)
 	}()
@@ -301,9 +329,11 @@ func (trf *TrFuncs) Get(ctx context.Context, namespace, name string) (metav1.Obj
 	return trf.client.TektonV1().TaskRuns(namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
-// Delete removes a specific TaskRun by name in the given namespace.
+// Delete removes a specific TaskRun by name in the given namespace, with the preconditions of the context.
 func (trf *TrFuncs) Delete(ctx context.Context, namespace, name string) error {
-	return trf.client.TektonV1().TaskRuns(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	return trf.client.TektonV1().TaskRuns(namespace).Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: config.DeletePreconditionsFromContext(ctx),
+	})
 }
 
 // Update modifies an existing TaskRun resource.
@@ -336,7 +366,7 @@ func (trf *TrFuncs) Patch(ctx context.Context, namespace, name string, patchByte
 
 // GetCompletionTime retrieves the completion time of a TaskRun resource.
 func (trf *TrFuncs) GetCompletionTime(resource metav1.Object) (metav1.Time, error) {
-	tr, ok := resource.(*pipelinev1.TaskRun)
+	tr, ok := toTaskRun(resource)
 	if !ok {
 		return metav1.Time{}, fmt.Errorf("resource type error, this is not a TaskRun resource. namespace:%s, name:%s, type:%T",
 			resource.GetNamespace(), resource.GetName(), resource)
@@ -372,7 +402,7 @@ func (trf *TrFuncs) Ignore(resource metav1.Object) bool {
 
 // IsCompleted checks if the TaskRun resource has completed.
 func (trf *TrFuncs) IsCompleted(resource metav1.Object) bool {
-	tr, ok := resource.(*pipelinev1.TaskRun)
+	tr, ok := toTaskRun(resource)
 	if !ok {
 		return false
 	}
@@ -396,7 +426,7 @@ func (trf *TrFuncs) IsCompleted(resource metav1.Object) bool {
 
 // IsSuccessful checks if the TaskRun resource has successfully completed.
 func (trf *TrFuncs) IsSuccessful(resource metav1.Object) bool {
-	tr, ok := resource.(*pipelinev1.TaskRun)
+	tr, ok := toTaskRun(resource)
 	if !ok {
 		return false
 	}
@@ -412,14 +442,76 @@ func (trf *TrFuncs) IsSuccessful(resource metav1.Object) bool {
 
 // IsFailed checks if the TaskRun resource has failed.
 func (trf *TrFuncs) IsFailed(resource metav1.Object) bool {
-	_, ok := resource.(*pipelinev1.TaskRun)
+	tr, ok := toTaskRun(resource)
 	if !ok {
 		return false
 	}
 
+	// a run without a final condition, for example a run just created, has not failed
+	condition := tr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil || condition.Status == corev1.ConditionUnknown {
+		return false
+	}
+
 	return !trf.IsSuccessful(resource)
 }
 
+// GetCompletionStatus returns the outcome of a completed TaskRun: succeeded, failed or cancelled.
+func (trf *TrFuncs) GetCompletionStatus(resource metav1.Object) string {
+	tr, ok := toTaskRun(resource)
+	if !ok {
+		return metrics.StatusFailed
+	}
+
+	if trf.IsSuccessful(resource) {
+		return metrics.StatusSucceeded
+	}
+
+	condition := tr.Status.GetCondition(apis.ConditionSucceeded)
+	if tr.IsCancelled() || (condition != nil && pipelinev1.TaskRunReason(condition.Reason) == pipelinev1.TaskRunReasonCancelled) {
+		return metrics.StatusCancelled
+	}
+
+	return metrics.StatusFailed
+}
+
+// IsParentDeleting returns true if the TaskRun is owned by a PipelineRun which is being deleted or
+// is already gone, such TaskRun is removed by the garbage collector along with its parent.
+func (trf *TrFuncs) IsParentDeleting(ctx context.Context, resource metav1.Object) bool {
+	for _, ownerReference := range resource.GetOwnerReferences() {
+		if ownerReference.Kind != config.KindPipelineRun {
+			continue
+		}
+		pr, err := trf.client.TektonV1().PipelineRuns(resource.GetNamespace()).Get(ctx, ownerReference.Name, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return true
+			}
+			logging.FromContext(ctx).Debugw("error on getting the parent PipelineRun",
+				"namespace", resource.GetNamespace(), "name", resource.GetName(), "parent", ownerReference.Name, zap.Error(err))
+			continue
+		}
+		if pr.UID != ownerReference.UID || pr.DeletionTimestamp != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCompletionReason returns the reason of the Succeeded condition of the TaskRun, for example TaskRunTimeout.
+func (trf *TrFuncs) GetCompletionReason(resource metav1.Object) string {
+	tr, ok := toTaskRun(resource)
+	if !ok {
+		return ""
+	}
+
+	condition := tr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil {
+		return ""
+	}
+	return condition.Reason
+}
+
 // GetDefaultLabelKey returns the default label key for TaskRun resources.
 func (trf *TrFuncs) GetDefaultLabelKey() string {
 	return config.LabelTaskName
@@ -430,6 +522,38 @@ func (trf *TrFuncs) GetTTLSecondsAfterFinished(namespace, taskName string, selec
 	return config.PrunerConfigStore.GetTaskTTLSecondsAfterFinished(namespace, taskName, selectors)
 }
 
+// GetTTLSecondsAfterFinishedWithoutResults retrieves the TTL in seconds after a TaskRun which produced no results finishes.
+func (trf *TrFuncs) GetTTLSecondsAfterFinishedWithoutResults(namespace, taskName string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetTaskTTLSecondsAfterFinishedWithoutResults(namespace, taskName, selectors)
+}
+
+// GetTTLJitterSeconds retrieves the window in seconds the deletion deadlines of the TaskRuns are spread within.
+func (trf *TrFuncs) GetTTLJitterSeconds(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetTaskTTLJitterSeconds(namespace, name, selectors)
+}
+
+// GetStartTime retrieves the start time of a TaskRun resource, nil when it is not started.
+func (trf *TrFuncs) GetStartTime(resource metav1.Object) *metav1.Time {
+	tr, ok := toTaskRun(resource)
+	if !ok {
+		return nil
+	}
+	return tr.Status.StartTime
+}
+
+// HasResults checks if the TaskRun resource produced any results or artifacts.
+func (trf *TrFuncs) HasResults(resource metav1.Object) bool {
+	tr, ok := toTaskRun(resource)
+	if !ok {
+		return false
+	}
+	if len(tr.Status.Results) > 0 {
+		return true
+	}
+	artifacts := tr.Status.Artifacts
+	return artifacts != nil && (len(artifacts.Inputs) > 0 || len(artifacts.Outputs) > 0)
+}
+
 // GetSuccessHistoryLimitCount retrieves the success history limit count for a TaskRun.
 func (trf *TrFuncs) GetSuccessHistoryLimitCount(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
 	return config.PrunerConfigStore.GetTaskSuccessHistoryLimitCount(namespace, name, selectors)
@@ -440,7 +564,55 @@ func (trf *TrFuncs) GetFailedHistoryLimitCount(namespace, name string, selectors
 	return config.PrunerConfigStore.GetTaskFailedHistoryLimitCount(namespace, name, selectors)
 }
 
+// GetRetainCalendarDays retrieves the number of calendar days the completed TaskRuns are retained for regardless of the history limits.
+func (trf *TrFuncs) GetRetainCalendarDays(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetTaskRetainCalendarDays(namespace, name, selectors)
+}
+
+// GetHistoryLimitCount retrieves the history limit of the successful and the failed TaskRuns together.
+func (trf *TrFuncs) GetHistoryLimitCount(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetTaskHistoryLimitCount(namespace, name, selectors)
+}
+
+// GetMinRetained retrieves the number of TaskRuns retained regardless of their age.
+func (trf *TrFuncs) GetMinRetained(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetTaskMinRetained(namespace, name, selectors)
+}
+
+// GetMinRetainedPerOutcome retrieves the number of the successful and of the failed TaskRuns retained under the combined history limit.
+func (trf *TrFuncs) GetMinRetainedPerOutcome(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetTaskMinRetainedPerOutcome(namespace, name, selectors)
+}
+
+// GetMinRetentionSeconds retrieves the time in seconds the completed TaskRuns are retained for, regardless of the history limits.
+func (trf *TrFuncs) GetMinRetentionSeconds(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetTaskMinRetentionSeconds(namespace, name, selectors)
+}
+
+// GetMaxRetentionAgeSeconds retrieves the maximum age in seconds of the retained TaskRuns.
+func (trf *TrFuncs) GetMaxRetentionAgeSeconds(namespace, name string, selectors config.SelectorSpec) (*int32, string) {
+	return config.PrunerConfigStore.GetTaskMaxRetentionAgeSeconds(namespace, name, selectors)
+}
+
 // GetEnforcedConfigLevel retrieves the enforced config level for a TaskRun.
 func (trf *TrFuncs) GetEnforcedConfigLevel(namespace, name string, selectors config.SelectorSpec) config.EnforcedConfigLevel {
 	return config.PrunerConfigStore.GetTaskEnforcedConfigLevel(namespace, name, selectors)
 }
+
+// toTaskRun returns the resource as a v1 TaskRun. The v1beta1 TaskRuns are converted to v1,
+// so the status of the runs created with the older API version is read the same way
+func toTaskRun(resource metav1.Object) (*pipelinev1.TaskRun, bool) {
+	switch tr := resource.(type) {
+	case *pipelinev1.TaskRun:
+		return tr, true
+	case *pipelinev1beta1.TaskRun:
+		converted := &pipelinev1.TaskRun{}
+		// the conversion may annotate the object meta, convert a copy to keep the original intact
+		if err := tr.DeepCopy().ConvertTo(context.Background(), converted); err != nil {
+			return nil, false
+		}
+		return converted, true
+	default:
+		return nil, false
+	}
+}
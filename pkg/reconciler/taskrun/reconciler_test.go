@@ -8,12 +8,15 @@ import (
 	"time"
 
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 	fakepipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
 	"go.uber.org/zap/zaptest"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
 	clocktest "k8s.io/utils/clock/testing"
 	"knative.dev/pkg/apis"
@@ -148,6 +151,123 @@ func TestTrFuncs_Ignore(t *testing.T) {
 	}
 }
 
+func TestTrFuncs_GetCompletionStatus(t *testing.T) {
+	newRun := func(status corev1.ConditionStatus, reason string) *pipelinev1.TaskRun {
+		return &pipelinev1.TaskRun{
+			Status: pipelinev1.TaskRunStatus{
+				Status: duckv1.Status{
+					Conditions: []apis.Condition{{
+						Type:   apis.ConditionSucceeded,
+						Status: status,
+						Reason: reason,
+					}},
+				},
+			},
+		}
+	}
+
+	cancelledBySpec := newRun(corev1.ConditionFalse, "Failed")
+	cancelledBySpec.Spec.Status = pipelinev1.TaskRunSpecStatusCancelled
+
+	tests := []struct {
+		name string
+		tr   *pipelinev1.TaskRun
+		want string
+	}{
+		{
+			name: "succeeded",
+			tr:   newRun(corev1.ConditionTrue, string(pipelinev1.TaskRunReasonSuccessful)),
+			want: metrics.StatusSucceeded,
+		},
+		{
+			name: "failed",
+			tr:   newRun(corev1.ConditionFalse, "Failed"),
+			want: metrics.StatusFailed,
+		},
+		{
+			name: "cancelled",
+			tr:   newRun(corev1.ConditionFalse, string(pipelinev1.TaskRunReasonCancelled)),
+			want: metrics.StatusCancelled,
+		},
+		{
+			name: "cancelled by spec",
+			tr:   cancelledBySpec,
+			want: metrics.StatusCancelled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trFuncs := &TrFuncs{client: fakepipelineclientset.NewSimpleClientset()}
+			if got := trFuncs.GetCompletionStatus(tt.tr); got != tt.want {
+				t.Errorf("TrFuncs.GetCompletionStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrFuncs_IsParentDeleting(t *testing.T) {
+	newParent := func(name string, deleting bool) *pipelinev1.PipelineRun {
+		pr := &pipelinev1.PipelineRun{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name + "-uid")},
+		}
+		if deleting {
+			pr.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			pr.Finalizers = []string{"foregroundDeletion"}
+		}
+		return pr
+	}
+	newChild := func(parent string, uid types.UID) *pipelinev1.TaskRun {
+		tr := &pipelinev1.TaskRun{ObjectMeta: metav1.ObjectMeta{Name: "child", Namespace: "default"}}
+		if parent != "" {
+			tr.OwnerReferences = []metav1.OwnerReference{{Kind: config.KindPipelineRun, Name: parent, UID: uid}}
+		}
+		return tr
+	}
+
+	tests := []struct {
+		name string
+		tr   *pipelinev1.TaskRun
+		want bool
+	}{
+		{
+			name: "standalone TaskRun",
+			tr:   newChild("", ""),
+			want: false,
+		},
+		{
+			name: "parent is running",
+			tr:   newChild("running", "running-uid"),
+			want: false,
+		},
+		{
+			name: "parent is being deleted",
+			tr:   newChild("deleting", "deleting-uid"),
+			want: true,
+		},
+		{
+			name: "parent is already deleted",
+			tr:   newChild("missing", "missing-uid"),
+			want: true,
+		},
+		{
+			name: "parent is recreated with the same name",
+			tr:   newChild("running", "previous-uid"),
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fakepipelineclientset.NewSimpleClientset(newParent("running", false), newParent("deleting", true))
+			trFuncs := &TrFuncs{client: client}
+			if got := trFuncs.IsParentDeleting(context.Background(), tt.tr); got != tt.want {
+				t.Errorf("TrFuncs.IsParentDeleting() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestReconciler_ProcessTaskRun(t *testing.T) {
 	fakeClock := clocktest.NewFakeClock(time.Now())
 
@@ -226,7 +346,7 @@ func TestReconciler_ProcessTaskRun(t *testing.T) {
 			ttl:          3600,
 			successLimit: 1,
 			failureLimit: 2,
-			wantDelete:   true,
+			wantDelete:   false,
 			setupAdditional: func(client *fakepipelineclientset.Clientset) {
 				// Add older successful TaskRuns with proper completion times
 				for i := 0; i < 2; i++ {
@@ -253,7 +373,7 @@ func TestReconciler_ProcessTaskRun(t *testing.T) {
 					}, metav1.CreateOptions{})
 				}
 			},
-			description: "TaskRun exceeding success history limit should be deleted",
+			description: "the most recently completed TaskRun should be kept over the older ones exceeding the success history limit",
 		},
 		{
 			name: "Failure history limit exceeded",
@@ -281,7 +401,7 @@ func TestReconciler_ProcessTaskRun(t *testing.T) {
 			ttl:          3600,
 			successLimit: 5,
 			failureLimit: 1,
-			wantDelete:   true,
+			wantDelete:   false,
 			setupAdditional: func(client *fakepipelineclientset.Clientset) {
 				// Add older failed TaskRuns with proper completion times
 				for i := 0; i < 2; i++ {
@@ -308,7 +428,7 @@ func TestReconciler_ProcessTaskRun(t *testing.T) {
 					}, metav1.CreateOptions{})
 				}
 			},
-			description: "TaskRun exceeding failure history limit should be deleted",
+			description: "the most recently completed TaskRun should be kept over the older ones exceeding the failure history limit",
 			validateResults: func(t *testing.T, client *fakepipelineclientset.Clientset) {
 				// List all TaskRuns in the namespace to verify the state
 				trs, err := client.TektonV1().TaskRuns("default").List(context.Background(), metav1.ListOptions{})
@@ -444,3 +564,188 @@ failedHistoryLimit: %d`, tt.ttl, tt.successLimit, tt.failureLimit),
 		})
 	}
 }
+
+func TestTrFuncs_V1beta1(t *testing.T) {
+	startTime := metav1.NewTime(time.Now().Add(-1 * time.Hour).Truncate(time.Second))
+	finishTime := metav1.NewTime(time.Now().Truncate(time.Second))
+	newRun := func(completionTime *metav1.Time, status corev1.ConditionStatus, reason string) *pipelinev1beta1.TaskRun {
+		return &pipelinev1beta1.TaskRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "run1", Namespace: "ns1"},
+			Status: pipelinev1beta1.TaskRunStatus{
+				TaskRunStatusFields: pipelinev1beta1.TaskRunStatusFields{
+					StartTime:      &startTime,
+					CompletionTime: completionTime,
+				},
+				Status: duckv1.Status{
+					Conditions: []apis.Condition{{
+						Type:               apis.ConditionSucceeded,
+						Status:             status,
+						Reason:             reason,
+						LastTransitionTime: apis.VolatileTime{Inner: finishTime},
+					}},
+				},
+			},
+		}
+	}
+
+	trFuncs := NewTrFuncs(nil)
+
+	tests := []struct {
+		name          string
+		run           *pipelinev1beta1.TaskRun
+		wantCompleted bool
+		wantStatus    string
+	}{
+		{
+			name:          "completed with CompletionTime",
+			run:           newRun(&finishTime, corev1.ConditionTrue, pipelinev1beta1.TaskRunReasonSuccessful.String()),
+			wantCompleted: true,
+			wantStatus:    metrics.StatusSucceeded,
+		},
+		{
+			name:          "completed with failed condition",
+			run:           newRun(nil, corev1.ConditionFalse, "Failed"),
+			wantCompleted: true,
+			wantStatus:    metrics.StatusFailed,
+		},
+		{
+			name:          "running",
+			run:           newRun(nil, corev1.ConditionUnknown, "Running"),
+			wantCompleted: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trFuncs.IsCompleted(tt.run); got != tt.wantCompleted {
+				t.Fatalf("IsCompleted() = %v, want %v", got, tt.wantCompleted)
+			}
+			if !tt.wantCompleted {
+				return
+			}
+			if got := trFuncs.GetCompletionStatus(tt.run); got != tt.wantStatus {
+				t.Errorf("GetCompletionStatus() = %v, want %v", got, tt.wantStatus)
+			}
+			completionTime, err := trFuncs.GetCompletionTime(tt.run)
+			if err != nil {
+				t.Fatalf("GetCompletionTime() unexpected error = %v", err)
+			}
+			if !completionTime.Equal(&finishTime) {
+				t.Errorf("GetCompletionTime() = %v, want %v", completionTime, finishTime)
+			}
+			if len(tt.run.Annotations) != 0 {
+				t.Errorf("the v1beta1 run should not be modified, got annotations %v", tt.run.Annotations)
+			}
+		})
+	}
+}
+
+func TestTrFuncs_HasResults(t *testing.T) {
+	trFuncs := NewTrFuncs(nil)
+
+	tests := []struct {
+		name   string
+		status pipelinev1.TaskRunStatusFields
+		want   bool
+	}{
+		{
+			name:   "results",
+			status: pipelinev1.TaskRunStatusFields{Results: []pipelinev1.TaskRunResult{{Name: "digest", Value: *pipelinev1.NewStructuredValues("sha256:abc")}}},
+			want:   true,
+		},
+		{
+			name:   "artifacts",
+			status: pipelinev1.TaskRunStatusFields{Artifacts: &pipelinev1.Artifacts{Outputs: []pipelinev1.Artifact{{Name: "image"}}}},
+			want:   true,
+		},
+		{
+			name:   "empty artifacts",
+			status: pipelinev1.TaskRunStatusFields{Artifacts: &pipelinev1.Artifacts{}},
+			want:   false,
+		},
+		{
+			name: "no results",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &pipelinev1.TaskRun{Status: pipelinev1.TaskRunStatus{TaskRunStatusFields: tt.status}}
+			if got := trFuncs.HasResults(tr); got != tt.want {
+				t.Errorf("HasResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrFuncs_NoConditions(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		status pipelinev1.TaskRunStatus
+	}{
+		{
+			name: "empty status",
+		},
+		{
+			name: "started without conditions",
+			status: pipelinev1.TaskRunStatus{
+				TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+					StartTime: &metav1.Time{Time: now},
+				},
+			},
+		},
+		{
+			name: "empty conditions",
+			status: pipelinev1.TaskRunStatus{
+				TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+					StartTime: &metav1.Time{Time: now},
+				},
+				Status: duckv1.Status{Conditions: []apis.Condition{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &pipelinev1.TaskRun{Status: tt.status}
+			trFuncs := &TrFuncs{client: fakepipelineclientset.NewSimpleClientset()}
+			if trFuncs.IsCompleted(tr) || trFuncs.IsSuccessful(tr) || trFuncs.IsFailed(tr) {
+				t.Errorf("IsCompleted() = %v, IsSuccessful() = %v, IsFailed() = %v, want all false",
+					trFuncs.IsCompleted(tr), trFuncs.IsSuccessful(tr), trFuncs.IsFailed(tr))
+			}
+		})
+	}
+
+	// a run completed without a condition is neither counted as successful nor as failed,
+	// it is not deleted by a failed history limit of 0
+	ctx := logging.WithLogger(context.Background(), zaptest.NewLogger(t).Sugar())
+	if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{Data: map[string]string{
+		config.PrunerGlobalConfigKey: "enforcedConfigLevel: global\nfailedHistoryLimit: 0",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{}) })
+
+	tr := &pipelinev1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "no-conditions", Namespace: "default"},
+		Status: pipelinev1.TaskRunStatus{
+			TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+				StartTime:      &metav1.Time{Time: now.Add(-time.Hour)},
+				CompletionTime: &metav1.Time{Time: now},
+			},
+		},
+	}
+	client := fakepipelineclientset.NewSimpleClientset(tr)
+	historyLimiter, err := config.NewHistoryLimiter(&TrFuncs{client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := historyLimiter.ProcessEvent(ctx, tr); err != nil {
+		t.Fatalf("ProcessEvent() error = %v", err)
+	}
+	if _, err := client.TektonV1().TaskRuns("default").Get(ctx, tr.Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("the TaskRun without conditions was deleted: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -11,14 +12,18 @@ import (
 	"go.uber.org/zap"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
+	"knative.dev/pkg/injection"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/system"
 
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/metrics"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/pipelinerun"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/taskrun"
 	"github.com/openshift-pipelines/tektoncd-pruner/pkg/version"
 	pipelineclient "github.com/tektoncd/pipeline/pkg/client/injection/client"
+	taskruninformer "github.com/tektoncd/pipeline/pkg/client/injection/informers/pipeline/v1/taskrun"
+	pipelinev1listers "github.com/tektoncd/pipeline/pkg/client/listers/pipeline/v1"
 
 	clockUtil "k8s.io/utils/clock"
 
@@ -26,7 +31,10 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
 )
 
@@ -35,8 +43,13 @@ import (
 // The GC process is responsible for cleaning up resources based on the TTL configuration.
 // Additionally, it watches for changes to the ConfigMap and triggers GC immediately when a change is detected.
 func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
+	// the log level is overridden by the pruner config map
+	ctx = config.WithLogLevel(ctx)
 	logger := logging.FromContext(ctx)
 
+	// the PipelineRuns deleted by the garbage collector are verified with the TaskRun lister
+	ctx = context.WithValue(ctx, taskRunListerKey{}, taskruninformer.Get(ctx).Lister())
+
 	logger.Info("Started Pruner controller")
 
 	ver := version.Get()
@@ -54,14 +67,132 @@ func NewController(ctx context.Context, cmw configmap.Watcher) *controller.Impl
 		WorkQueueName: "pruner",
 	})
 
-	// ConfigMap watcher triggers GC
+	// ConfigMap watcher applies the log level and triggers GC, the namespaced config sync publishes
+	// the reloaded config into the status of the TektonPruner resources
 	cmw.Watch(config.PrunerConfigMapName, func(cm *corev1.ConfigMap) {
+		applyLogLevel(cm, logger)
 		go safeRunGarbageCollector(ctx, logger)
+		impl.EnqueueKey(namespacedConfigKey)
 	})
 
+	// TektonPruner resources are watched, their events enqueue a sync of the namespaced config
+	// and a change on the namespaced config triggers GC
+	if cfg := injection.GetConfig(ctx); cfg != nil {
+		dynamicClient, err := dynamic.NewForConfig(cfg)
+		if err != nil {
+			logger.Fatalw("error on creating dynamic client", zap.Error(err))
+		}
+		tektonPrunerInformer := newTektonPrunerInformer(dynamicClient, time.Duration(config.DefaultNamespacedConfigResyncSeconds)*time.Second)
+		listFn := func(ctx context.Context) (map[string]config.NamespaceSpec, error) {
+			return listNamespacedConfig(ctx, tektonPrunerInformer.GetStore()), nil
+		}
+		statusFn := func(ctx context.Context) error {
+			return updateTektonPrunerStatus(ctx, dynamicClient, tektonPrunerInformer.GetStore())
+		}
+		r.syncNamespacedConfig = namespacedConfigSyncer(listFn, statusFn, logger)
+		if _, err := tektonPrunerInformer.AddEventHandler(tektonPrunerEventHandler(func() {
+			impl.EnqueueKey(namespacedConfigKey)
+		})); err != nil {
+			logger.Fatalw("error on adding the TektonPruner event handler", zap.Error(err))
+		}
+		go tektonPrunerInformer.Run(ctx.Done())
+
+		// a deleted namespace is evicted from the config store right away, rather than on the next annotation poll
+		if _, err := config.GetNamespaceInformer(ctx, r.kubeclient).AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: namespaceDeleteHandler(ctx, logger),
+		}); err != nil {
+			logger.Fatalw("error on adding the namespace event handler", zap.Error(err))
+		}
+
+		// the deletions of all the controllers are recorded as PruneRecord resources, when enabled
+		maxPruneRecords, err := config.GetEnvValueAsInt(config.EnvPruneRecordsMaxPerNamespace, 0)
+		if err != nil {
+			logger.Fatalw("error on getting the max prune records per namespace", "environmentKey", config.EnvPruneRecordsMaxPerNamespace, zap.Error(err))
+		}
+		if maxPruneRecords > 0 {
+			config.SetDeletionObserver(config.NewPruneRecordWriter(dynamicPruneRecordClient{client: dynamicClient}, maxPruneRecords))
+		}
+	}
+
+	// the annotations of the namespaces are polled as well, they are the lowest precedence config source
+	listAnnotationsFn := func(ctx context.Context) (map[string]config.NamespaceSpec, error) {
+		return listNamespaceAnnotationConfig(ctx, r.kubeclient)
+	}
+	go wait.UntilWithContext(ctx, namespaceAnnotationConfigSyncer(listAnnotationsFn, logger), time.Duration(config.DefaultNamespacedConfigResyncSeconds)*time.Second)
+
 	return impl
 }
 
+// applyLogLevel overrides the log level of the controllers with the log level of the pruner config map,
+// the current level is kept when the value is invalid
+func applyLogLevel(cm *corev1.ConfigMap, logger *zap.SugaredLogger) {
+	value := cm.Data[config.PrunerLogLevelKey]
+	if err := config.PrunerLogLevel.Set(value); err != nil {
+		logger.Errorw("error on applying the log level of the pruner config map", "key", config.PrunerLogLevelKey, zap.Error(err))
+		return
+	}
+	logger.Infow("applied the log level of the pruner config map", "level", value)
+}
+
+// namespacedConfigSyncer returns a function which loads the TektonPruner resources into the config store
+// and runs the garbage collector when the namespaced config is changed since the previous call.
+// The config store is replaced on every change, so the namespace whose TektonPruner is deleted
+// falls back to the global config. The statusFn is called once the config generation is changed,
+// by a reload of the global config or of the namespaced config, to publish the config in effect
+func namespacedConfigSyncer(listFn func(context.Context) (map[string]config.NamespaceSpec, error), statusFn func(context.Context) error, logger *zap.SugaredLogger) func(context.Context) {
+	lastNamespacedConfig := map[string]config.NamespaceSpec{}
+	// the status is published on the first call, whatever the generation
+	var lastStatusGeneration uint64
+	statusPublished := false
+	return func(ctx context.Context) {
+		namespacedConfig, err := listFn(ctx)
+		if err != nil {
+			logger.Errorw("error on listing TektonPruner resources", zap.Error(err))
+			return
+		}
+		if !reflect.DeepEqual(lastNamespacedConfig, namespacedConfig) {
+			for namespace := range lastNamespacedConfig {
+				if _, found := namespacedConfig[namespace]; !found {
+					logger.Infow("TektonPruner removed, namespace falls back to the global config", "namespace", namespace)
+				}
+			}
+			lastNamespacedConfig = namespacedConfig
+			config.PrunerConfigStore.LoadNamespacedConfig(ctx, namespacedConfig)
+			safeRunGarbageCollector(ctx, logger)
+		}
+
+		generation := config.PrunerConfigStore.GetGeneration()
+		if statusFn == nil || (statusPublished && generation == lastStatusGeneration) {
+			return
+		}
+		if err := statusFn(ctx); err != nil {
+			logger.Errorw("error on updating the status of the TektonPruner resources", zap.Error(err))
+			return
+		}
+		lastStatusGeneration = generation
+		statusPublished = true
+	}
+}
+
+// namespaceAnnotationConfigSyncer returns a function which loads the config read from the annotations of the
+// namespaces into the config store and runs the garbage collector when it is changed since the previous call
+func namespaceAnnotationConfigSyncer(listFn func(context.Context) (map[string]config.NamespaceSpec, error), logger *zap.SugaredLogger) func(context.Context) {
+	lastConfig := map[string]config.NamespaceSpec{}
+	return func(ctx context.Context) {
+		annotationConfig, err := listFn(ctx)
+		if err != nil {
+			logger.Errorw("error on listing the namespaces", zap.Error(err))
+			return
+		}
+		if reflect.DeepEqual(lastConfig, annotationConfig) {
+			return
+		}
+		lastConfig = annotationConfig
+		config.PrunerConfigStore.LoadNamespaceAnnotationConfig(ctx, annotationConfig)
+		safeRunGarbageCollector(ctx, logger)
+	}
+}
+
 // safeRunGarbageCollector is a thread-safe wrapper around the garbage collection process.
 func safeRunGarbageCollector(ctx context.Context, logger *zap.SugaredLogger) {
 	var gcMutex sync.Mutex
@@ -104,6 +235,13 @@ func runGarbageCollector(ctx context.Context) {
 
 	logger.Infow("Namespaces selected for garbage collection", "namespaces", namespaces)
 
+	// the deletions are summarized on the status config map, when it is enabled
+	statusEnabled := isStatusConfigMapEnabled()
+	summary := config.NewPruneSummary()
+	if statusEnabled {
+		ctx = config.WithPruneSummary(ctx, summary)
+	}
+
 	// Get worker count from config or default to 5
 	workerCount, err := config.PrunerConfigStore.WorkerCount(ctx, configMap)
 	if err != nil {
@@ -125,10 +263,12 @@ func runGarbageCollector(ctx context.Context) {
 
 				if err := cleanupPRs(ctx, ns, configMapUpdateTime); err != nil {
 					logger.Errorw("Error collecting PipelineRuns", zap.String("namespace", ns), zap.Error(err))
+					summary.RecordError(ns, err)
 					continue
 				}
 				if err := cleanupTRs(ctx, ns, configMapUpdateTime); err != nil {
 					logger.Errorw("Error collecting TaskRuns", zap.String("namespace", ns), zap.Error(err))
+					summary.RecordError(ns, err)
 					continue
 				}
 			}
@@ -143,18 +283,29 @@ func runGarbageCollector(ctx context.Context) {
 
 	wg.Wait()
 	logger.Info("Garbage collection completed")
+
+	if statusEnabled {
+		if err := writeStatusConfigMap(ctx, kubeClient, namespace, summary, time.Now()); err != nil {
+			logger.Errorw("Failed to write the status ConfigMap", "name", config.PrunerStatusConfigMapName, zap.Error(err))
+		}
+	}
 }
 
 // getFilteredNamespaces returns namespaces not starting with "kube" or "openshift"
+// and owned by the shard of this replica
 func getFilteredNamespaces(ctx context.Context, client kubernetes.Interface) ([]string, error) {
 	nsList, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
+	shard := config.ShardFromContext(ctx)
 	var filtered []string
 	for _, ns := range nsList.Items {
 		name := ns.Name
+		if !shard.Owns(name) {
+			continue
+		}
 		if !strings.HasPrefix(name, "kube") && !strings.HasPrefix(name, "openshift") && !strings.HasPrefix(name, "tekton") {
 			filtered = append(filtered, name)
 		}
@@ -162,6 +313,9 @@ func getFilteredNamespaces(ctx context.Context, client kubernetes.Interface) ([]
 	return filtered, nil
 }
 
+// taskRunListerKey is the context key of the TaskRun lister of the garbage collector
+type taskRunListerKey struct{}
+
 // CleanupPRs is responsible for cleaning up completed PipelineRuns based on their TTL and history limit.
 func cleanupPRs(ctx context.Context, namespace string, configMapUpdateTime string) error {
 
@@ -170,11 +324,15 @@ func cleanupPRs(ctx context.Context, namespace string, configMapUpdateTime strin
 
 	pipelineClient := pipelineclient.Get(ctx)
 	prFuncs := pipelinerun.NewPrFuncs(pipelineClient)
+	if taskRunLister, ok := ctx.Value(taskRunListerKey{}).(pipelinev1listers.TaskRunLister); ok {
+		prFuncs.SetTaskRunLister(taskRunLister)
+	}
 
 	prTTLHandler, err := config.NewTTLHandler(clockUtil.RealClock{}, prFuncs)
 	if err != nil {
 		logger.Fatal("error on getting ttl handler", zap.Error(err))
 	}
+	prTTLHandler.SetNamespaceGetter(config.NewNamespaceGetter(config.GetNamespaceInformer(ctx, kubeclient.Get(ctx))))
 
 	prHistoryLimiter, err := config.NewHistoryLimiter(prFuncs)
 	if err != nil {
@@ -263,6 +421,26 @@ func cleanupPRs(ctx context.Context, namespace string, configMapUpdateTime strin
 
 		}
 	}
+
+	// record the age of the oldest completed PipelineRun retained after the cleanup
+	// and the estimate of the PipelineRuns to be deleted before the next cleanup
+	retainedList, err := pipelineClient.TektonV1().PipelineRuns(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logger.Errorw("error listing retained PipelineRuns", "namespace", namespace, zap.Error(err))
+		return nil
+	}
+	var creationTimes []time.Time
+	var retained []metav1.Object
+	for index, pr := range retainedList.Items {
+		if pr.Status.CompletionTime != nil {
+			creationTimes = append(creationTimes, pr.CreationTimestamp.Time)
+			retained = append(retained, &retainedList.Items[index])
+		}
+	}
+	metrics.GetRecorder().RecordOldestRetainedAge(ctx, metrics.ResourceTypePipelineRun, namespace, metrics.OldestAge(time.Now(), creationTimes))
+	metrics.GetRecorder().RecordReclaimableResources(ctx, metrics.ResourceTypePipelineRun, namespace,
+		prTTLHandler.EstimateReclaimable(retained, config.DefaultPeriodicCleanupIntervalSeconds*time.Second))
+
 	return nil
 }
 
@@ -280,6 +458,7 @@ func cleanupTRs(ctx context.Context, namespace string, configMapUpdateTime strin
 	if err != nil {
 		logger.Fatal("error on getting ttl handler", zap.Error(err))
 	}
+	trTTLHandler.SetNamespaceGetter(config.NewNamespaceGetter(config.GetNamespaceInformer(ctx, kubeclient.Get(ctx))))
 
 	trHistoryLimiter, err := config.NewHistoryLimiter(trFuncs)
 	if err != nil {
@@ -366,5 +545,25 @@ func cleanupTRs(ctx context.Context, namespace string, configMapUpdateTime strin
 
 		}
 	}
+
+	// record the age of the oldest completed standalone TaskRun retained after the cleanup
+	// and the estimate of the standalone TaskRuns to be deleted before the next cleanup
+	retainedList, err := pipelineClient.TektonV1().TaskRuns(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logger.Errorw("error listing retained TaskRuns", "namespace", namespace, zap.Error(err))
+		return nil
+	}
+	var creationTimes []time.Time
+	var retained []metav1.Object
+	for index, tr := range retainedList.Items {
+		if tr.Status.CompletionTime != nil && !tr.HasPipelineRunOwnerReference() {
+			creationTimes = append(creationTimes, tr.CreationTimestamp.Time)
+			retained = append(retained, &retainedList.Items[index])
+		}
+	}
+	metrics.GetRecorder().RecordOldestRetainedAge(ctx, metrics.ResourceTypeTaskRun, namespace, metrics.OldestAge(time.Now(), creationTimes))
+	metrics.GetRecorder().RecordReclaimableResources(ctx, metrics.ResourceTypeTaskRun, namespace,
+		trTTLHandler.EstimateReclaimable(retained, config.DefaultPeriodicCleanupIntervalSeconds*time.Second))
+
 	return nil
 }
@@ -266,3 +266,39 @@ func TestGetFilteredNamespaces(t *testing.T) {
 		})
 	}
 }
+
+func TestGetFilteredNamespacesSharded(t *testing.T) {
+	var namespaceObjects []runtime.Object
+	for i := 0; i < 20; i++ {
+		namespaceObjects = append(namespaceObjects, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("ns-%d", i)},
+		})
+	}
+	client := fake.NewSimpleClientset(namespaceObjects...)
+
+	const shardCount = 3
+	owners := map[string]int{}
+	for index := 0; index < shardCount; index++ {
+		shard, err := config.NewShard(index, shardCount)
+		if err != nil {
+			t.Fatalf("NewShard() error = %v", err)
+		}
+		filtered, err := getFilteredNamespaces(config.WithShard(context.Background(), shard), client)
+		if err != nil {
+			t.Fatalf("getFilteredNamespaces() error = %v", err)
+		}
+		for _, ns := range filtered {
+			owners[ns]++
+		}
+	}
+
+	// every namespace is processed by exactly one shard
+	if len(owners) != len(namespaceObjects) {
+		t.Errorf("got %d namespaces across the shards, want %d", len(owners), len(namespaceObjects))
+	}
+	for ns, count := range owners {
+		if count != 1 {
+			t.Errorf("namespace %s is processed by %d shards, want 1", ns, count)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package tektonpruner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/logging"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+)
+
+// tektonPrunerResource is the namespaced TektonPruner resource, its spec holds the pruning config of the namespace
+var tektonPrunerResource = schema.GroupVersionResource{Group: "pruner.tekton.dev", Version: "v1alpha1", Resource: "tektonpruners"}
+
+// newTektonPrunerInformer returns an informer on the TektonPruner resources of all the namespaces.
+// The informer keeps retrying the list while the TektonPruner CRD is not installed
+func newTektonPrunerInformer(client dynamic.Interface, resync time.Duration) cache.SharedIndexInformer {
+	resource := client.Resource(tektonPrunerResource)
+	return cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			return resource.List(ctx, options)
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			return resource.Watch(ctx, options)
+		},
+	}, &unstructured.Unstructured{}, resync, cache.Indexers{})
+}
+
+// tektonPrunerEventHandler returns the event handler of the TektonPruner informer, every add, update
+// and delete calls the enqueue function. The resync of the informer calls it as well
+func tektonPrunerEventHandler(enqueue func()) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { enqueue() },
+		UpdateFunc: func(interface{}, interface{}) { enqueue() },
+		DeleteFunc: func(interface{}) { enqueue() },
+	}
+}
+
+// listTektonPruners returns the TektonPruner resources held by the store, sorted by namespace and name.
+// The returned resources are shared with the store and must not be changed
+func listTektonPruners(store cache.Store) []*unstructured.Unstructured {
+	items := []*unstructured.Unstructured{}
+	for _, obj := range store.List() {
+		if item, ok := obj.(*unstructured.Unstructured); ok {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].GetNamespace() != items[j].GetNamespace() {
+			return items[i].GetNamespace() < items[j].GetNamespace()
+		}
+		return items[i].GetName() < items[j].GetName()
+	})
+	return items
+}
+
+// listNamespacedConfig returns the specs of the TektonPruner resources held by the store, keyed by namespace.
+// When a namespace holds more than one TektonPruner, the first one by name is used
+func listNamespacedConfig(ctx context.Context, store cache.Store) map[string]config.NamespaceSpec {
+	logger := logging.FromContext(ctx)
+
+	namespacedConfig := map[string]config.NamespaceSpec{}
+	for _, item := range listTektonPruners(store) {
+		if _, found := namespacedConfig[item.GetNamespace()]; found {
+			logger.Warnw("ignoring TektonPruner, the namespace already holds a TektonPruner",
+				"namespace", item.GetNamespace(), "name", item.GetName())
+			continue
+		}
+		spec, err := namespaceSpecFromTektonPruner(item)
+		if err != nil {
+			logger.Errorw("ignoring TektonPruner with invalid spec", "namespace", item.GetNamespace(), "name", item.GetName(), zap.Error(err))
+			continue
+		}
+		namespacedConfig[item.GetNamespace()] = spec
+	}
+
+	return namespacedConfig
+}
+
+// listNamespaceAnnotationConfig lists the namespaces and returns the retention settings read from their annotations,
+// keyed by namespace. The namespaces without any of the annotations are left out, as are the ones with invalid values
+func listNamespaceAnnotationConfig(ctx context.Context, client kubernetes.Interface) (map[string]config.NamespaceSpec, error) {
+	logger := logging.FromContext(ctx)
+
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	annotationConfig := map[string]config.NamespaceSpec{}
+	for _, namespace := range namespaces.Items {
+		spec, found, err := config.NamespaceSpecFromAnnotations(namespace.Annotations)
+		if err != nil {
+			logger.Errorw("ignoring the pruner annotations of the namespace", "namespace", namespace.Name, zap.Error(err))
+			continue
+		}
+		if found {
+			annotationConfig[namespace.Name] = spec
+		}
+	}
+	return annotationConfig, nil
+}
+
+// updateTektonPrunerStatus sets the config in effect on the namespace into the status of the TektonPruner
+// resources held by the store, the first one by name of each namespace. Only the changed statuses are updated
+func updateTektonPrunerStatus(ctx context.Context, client dynamic.Interface, store cache.Store) error {
+	namespaces := map[string]bool{}
+	for _, item := range listTektonPruners(store) {
+		if namespaces[item.GetNamespace()] {
+			continue
+		}
+		namespaces[item.GetNamespace()] = true
+
+		item = item.DeepCopy()
+		changed, err := setEffectiveConfigStatus(item)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		_, err = client.Resource(tektonPrunerResource).Namespace(item.GetNamespace()).UpdateStatus(ctx, item, metav1.UpdateOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to update the status of the TektonPruner %s/%s: %w", item.GetNamespace(), item.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// setEffectiveConfigStatus sets the config in effect on the namespace of the TektonPruner into its status,
+// it returns true when the status is changed
+func setEffectiveConfigStatus(item *unstructured.Unstructured) (bool, error) {
+	data, err := json.Marshal(config.PrunerConfigStore.GetEffectiveConfig(item.GetNamespace()))
+	if err != nil {
+		return false, err
+	}
+	effectiveConfig := map[string]interface{}{}
+	if err := json.Unmarshal(data, &effectiveConfig); err != nil {
+		return false, err
+	}
+
+	current, _, _ := unstructured.NestedMap(item.Object, "status", "effectiveConfig")
+	if reflect.DeepEqual(current, effectiveConfig) {
+		return false, nil
+	}
+	if err := unstructured.SetNestedMap(item.Object, effectiveConfig, "status", "effectiveConfig"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// namespaceSpecFromTektonPruner decodes the spec of a TektonPruner resource
+func namespaceSpecFromTektonPruner(item *unstructured.Unstructured) (config.NamespaceSpec, error) {
+	spec := config.NamespaceSpec{}
+
+	rawSpec, found, err := unstructured.NestedMap(item.Object, "spec")
+	if err != nil {
+		return spec, err
+	}
+	if !found {
+		return spec, nil
+	}
+
+	data, err := json.Marshal(rawSpec)
+	if err != nil {
+		return spec, err
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return spec, fmt.Errorf("failed to decode the spec: %w", err)
+	}
+	return spec, nil
+}
+
+// namespaceDeleteHandler returns the delete handler of the namespace informer, it evicts the config of the
+// deleted namespace from the config store. The final state of a namespace whose deletion was missed is unwrapped
+func namespaceDeleteHandler(ctx context.Context, logger *zap.SugaredLogger) func(obj interface{}) {
+	return func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		namespace, ok := obj.(*corev1.Namespace)
+		if !ok {
+			logger.Warnw("unexpected object on the namespace deletion", "type", fmt.Sprintf("%T", obj))
+			return
+		}
+		logger.Debugw("namespace deleted, evicting its config", "namespace", namespace.Name)
+		config.PrunerConfigStore.DeleteNamespacedSpec(ctx, namespace.Name)
+	}
+}
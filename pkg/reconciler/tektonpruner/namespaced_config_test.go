@@ -0,0 +1,401 @@
+package tektonpruner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	fakepipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	"knative.dev/pkg/logging"
+	logtesting "knative.dev/pkg/logging/testing"
+	"knative.dev/pkg/system"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/reconciler/pipelinerun"
+)
+
+func newTektonPruner(namespace string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "pruner.tekton.dev/v1alpha1",
+		"kind":       "TektonPruner",
+		"metadata":   map[string]interface{}{"name": "pruner", "namespace": namespace},
+		"spec":       spec,
+	}}
+}
+
+func newSucceededPipelineRun(namespace, name string, completedAgo time.Duration) *pipelinev1.PipelineRun {
+	completionTime := time.Now().Add(-completedAgo)
+	return &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			Labels:            map[string]string{config.LabelPipelineName: "build"},
+			CreationTimestamp: metav1.Time{Time: completionTime.Add(-time.Minute)},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				StartTime:      &metav1.Time{Time: completionTime.Add(-time.Minute)},
+				CompletionTime: &metav1.Time{Time: completionTime},
+			},
+			Status: duckv1.Status{
+				Conditions: []apis.Condition{{
+					Type:   apis.ConditionSucceeded,
+					Status: corev1.ConditionTrue,
+					Reason: pipelinev1.PipelineRunReasonSuccessful.String(),
+				}},
+			},
+		},
+	}
+}
+
+func TestNamespaceSpecFromTektonPruner(t *testing.T) {
+	item := newTektonPruner("dev", map[string]interface{}{
+		"ttlSecondsAfterFinished": int64(120),
+		"successfulHistoryLimit":  int64(1),
+		"pipelineRuns": []interface{}{
+			map[string]interface{}{"name": "build", "failedHistoryLimit": int64(2)},
+		},
+	})
+
+	spec, err := namespaceSpecFromTektonPruner(item)
+	if err != nil {
+		t.Fatalf("failed to decode the spec: %v", err)
+	}
+	if spec.TTLSecondsAfterFinished == nil || *spec.TTLSecondsAfterFinished != 120 {
+		t.Errorf("ttlSecondsAfterFinished = %v, want 120", spec.TTLSecondsAfterFinished)
+	}
+	if spec.SuccessfulHistoryLimit == nil || *spec.SuccessfulHistoryLimit != 1 {
+		t.Errorf("successfulHistoryLimit = %v, want 1", spec.SuccessfulHistoryLimit)
+	}
+	if len(spec.PipelineRuns) != 1 || spec.PipelineRuns[0].Name != "build" ||
+		spec.PipelineRuns[0].FailedHistoryLimit == nil || *spec.PipelineRuns[0].FailedHistoryLimit != 2 {
+		t.Errorf("pipelineRuns = %+v, want the build spec with failedHistoryLimit 2", spec.PipelineRuns)
+	}
+
+	if _, err := namespaceSpecFromTektonPruner(newTektonPruner("dev", map[string]interface{}{"historyLimit": "many"})); err == nil {
+		t.Error("expected an error on an invalid spec")
+	}
+}
+
+func TestNamespacedConfigDrivesPruning(t *testing.T) {
+	tests := []struct {
+		name          string
+		globalConfig  string
+		wantRemaining int
+	}{
+		{
+			name:          "namespace level allows the TektonPruner",
+			globalConfig:  "enforcedConfigLevel: namespace\nsuccessfulHistoryLimit: 5",
+			wantRemaining: 1,
+		},
+		{
+			name:          "resource level allows the TektonPruner",
+			globalConfig:  "enforcedConfigLevel: resource\nsuccessfulHistoryLimit: 5",
+			wantRemaining: 1,
+		},
+		{
+			name:          "global level ignores the TektonPruner",
+			globalConfig:  "enforcedConfigLevel: global\nsuccessfulHistoryLimit: 5",
+			wantRemaining: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: config.PrunerConfigMapName, Namespace: "tekton-pipelines"},
+				Data:       map[string]string{config.PrunerGlobalConfigKey: tt.globalConfig},
+			}
+			if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, cm); err != nil {
+				t.Fatalf("failed to load the global config: %v", err)
+			}
+			spec, err := namespaceSpecFromTektonPruner(newTektonPruner("dev", map[string]interface{}{"successfulHistoryLimit": int64(1)}))
+			if err != nil {
+				t.Fatalf("failed to decode the spec: %v", err)
+			}
+			config.PrunerConfigStore.LoadNamespacedConfig(ctx, map[string]config.NamespaceSpec{"dev": spec})
+			t.Cleanup(func() {
+				config.PrunerConfigStore.LoadNamespacedConfig(ctx, nil)
+				_ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{})
+			})
+
+			var objects []runtime.Object
+			for index := 0; index < 3; index++ {
+				objects = append(objects, newSucceededPipelineRun("dev", fmt.Sprintf("build-%d", index), time.Duration(index)*time.Hour))
+			}
+			pipelineClient := fakepipelineclientset.NewSimpleClientset(objects...)
+
+			historyLimiter, err := config.NewHistoryLimiter(pipelinerun.NewPrFuncs(pipelineClient))
+			if err != nil {
+				t.Fatalf("failed to create the history limiter: %v", err)
+			}
+			if err := historyLimiter.ProcessEvent(ctx, objects[0].(*pipelinev1.PipelineRun)); err != nil {
+				t.Fatalf("failed to process the event: %v", err)
+			}
+
+			prs, err := pipelineClient.TektonV1().PipelineRuns("dev").List(ctx, metav1.ListOptions{})
+			if err != nil {
+				t.Fatalf("failed to list the PipelineRuns: %v", err)
+			}
+			if len(prs.Items) != tt.wantRemaining {
+				t.Errorf("remaining PipelineRuns = %d, want %d", len(prs.Items), tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestNamespacedConfigSyncerDeletion(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+	ctx = context.WithValue(ctx, kubeclient.Key{}, fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: config.PrunerConfigMapName, Namespace: system.Namespace()},
+		Data:       map[string]string{config.PrunerGlobalConfigKey: "enforcedConfigLevel: namespace\nsuccessfulHistoryLimit: 5"},
+	}))
+	t.Cleanup(func() {
+		config.PrunerConfigStore.LoadNamespacedConfig(ctx, nil)
+		_ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{})
+	})
+
+	limit := int32(1)
+	namespacedConfig := map[string]config.NamespaceSpec{"dev": {PrunerConfig: config.PrunerConfig{SuccessfulHistoryLimit: &limit}}}
+	sync := namespacedConfigSyncer(func(context.Context) (map[string]config.NamespaceSpec, error) {
+		return namespacedConfig, nil
+	}, nil, logtesting.TestLogger(t))
+
+	sync(ctx)
+	got, identifiedBy := config.PrunerConfigStore.GetPipelineSuccessHistoryLimitCount("dev", "build", config.SelectorSpec{})
+	if got == nil || *got != 1 || identifiedBy != "identified_by_ns" {
+		t.Fatalf("limit = %v (%s), want 1 identified by the namespace", got, identifiedBy)
+	}
+
+	// the TektonPruner of the namespace is deleted
+	namespacedConfig = map[string]config.NamespaceSpec{}
+	sync(ctx)
+	got, identifiedBy = config.PrunerConfigStore.GetPipelineSuccessHistoryLimitCount("dev", "build", config.SelectorSpec{})
+	if got == nil || *got != 5 || identifiedBy != "identified_by_global" {
+		t.Errorf("limit = %v (%s), want 5 identified by the global config", got, identifiedBy)
+	}
+}
+
+func TestNamespaceDeleteHandler(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+	if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{
+		Data: map[string]string{config.PrunerGlobalConfigKey: "enforcedConfigLevel: namespace\nsuccessfulHistoryLimit: 5"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		config.PrunerConfigStore.LoadNamespacedConfig(ctx, nil)
+		config.PrunerConfigStore.LoadNamespaceAnnotationConfig(ctx, nil)
+		_ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{})
+	})
+
+	limit := int32(1)
+	namespacedConfig := map[string]config.NamespaceSpec{
+		"dev": {PrunerConfig: config.PrunerConfig{SuccessfulHistoryLimit: &limit}},
+		"qa":  {PrunerConfig: config.PrunerConfig{SuccessfulHistoryLimit: &limit}},
+	}
+	config.PrunerConfigStore.LoadNamespacedConfig(ctx, namespacedConfig)
+	config.PrunerConfigStore.LoadNamespaceAnnotationConfig(ctx, map[string]config.NamespaceSpec{
+		"qa": {PrunerConfig: config.PrunerConfig{SuccessfulHistoryLimit: &limit}},
+	})
+
+	handler := namespaceDeleteHandler(ctx, logtesting.TestLogger(t))
+	handler(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev"}})
+	// the deletion missed by the informer is delivered as a tombstone
+	handler(cache.DeletedFinalStateUnknown{Key: "qa", Obj: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "qa"}}})
+
+	for _, namespace := range []string{"dev", "qa"} {
+		got, identifiedBy := config.PrunerConfigStore.GetPipelineSuccessHistoryLimitCount(namespace, "build", config.SelectorSpec{})
+		if got == nil || *got != 5 || identifiedBy != "identified_by_global" {
+			t.Errorf("limit of %s = %v (%s), want 5 identified by the global config", namespace, got, identifiedBy)
+		}
+	}
+	// the map loaded by the syncer is not altered, it is compared with the next poll
+	if _, found := namespacedConfig["dev"]; !found {
+		t.Errorf("the loaded namespaced config was modified")
+	}
+}
+
+func TestEffectiveConfigStatus(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+	loadGlobalConfig := func(globalConfig string) {
+		t.Helper()
+		cm := &corev1.ConfigMap{Data: map[string]string{config.PrunerGlobalConfigKey: globalConfig}}
+		if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, cm); err != nil {
+			t.Fatalf("failed to load the global config: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		config.PrunerConfigStore.LoadNamespacedConfig(ctx, nil)
+		_ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{})
+	})
+
+	item := newTektonPruner("dev", map[string]interface{}{"successfulHistoryLimit": int64(1)})
+	spec, err := namespaceSpecFromTektonPruner(item)
+	if err != nil {
+		t.Fatalf("failed to decode the spec: %v", err)
+	}
+	loadGlobalConfig("enforcedConfigLevel: namespace\nttlSecondsAfterFinished: 600\nfailedHistoryLimit: 5")
+	config.PrunerConfigStore.LoadNamespacedConfig(ctx, map[string]config.NamespaceSpec{"dev": spec})
+
+	// the namespace spec takes precedence over the global config
+	if changed, err := setEffectiveConfigStatus(item); err != nil || !changed {
+		t.Fatalf("setEffectiveConfigStatus() = %v, %v, want true, nil", changed, err)
+	}
+	assertStatusField(t, item, "pipelineRuns", "enforcedConfigLevel", "namespace")
+	assertStatusField(t, item, "pipelineRuns", "successfulHistoryLimit", int64(1))
+	assertStatusField(t, item, "taskRuns", "successfulHistoryLimit", int64(1))
+	if _, found, _ := unstructured.NestedFieldNoCopy(item.Object, "status", "effectiveConfig", "pipelineRuns", "ttlSecondsAfterFinished"); found {
+		t.Error("ttlSecondsAfterFinished is set, want the namespace spec to take precedence")
+	}
+
+	// an unchanged config does not update the status
+	if changed, err := setEffectiveConfigStatus(item); err != nil || changed {
+		t.Fatalf("setEffectiveConfigStatus() = %v, %v, want false, nil", changed, err)
+	}
+
+	// the namespace spec is ignored once the global config enforces the global level
+	loadGlobalConfig("enforcedConfigLevel: global\nttlSecondsAfterFinished: 300\nfailedHistoryLimit: 5")
+	if changed, err := setEffectiveConfigStatus(item); err != nil || !changed {
+		t.Fatalf("setEffectiveConfigStatus() = %v, %v, want true, nil", changed, err)
+	}
+	assertStatusField(t, item, "pipelineRuns", "enforcedConfigLevel", "global")
+	assertStatusField(t, item, "pipelineRuns", "ttlSecondsAfterFinished", int64(300))
+	assertStatusField(t, item, "taskRuns", "failedHistoryLimit", int64(5))
+	if _, found, _ := unstructured.NestedFieldNoCopy(item.Object, "status", "effectiveConfig", "pipelineRuns", "successfulHistoryLimit"); found {
+		t.Error("successfulHistoryLimit is set, want the namespace spec to be ignored")
+	}
+}
+
+func TestNamespacedConfigSyncerStatus(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+	ctx = context.WithValue(ctx, kubeclient.Key{}, fake.NewSimpleClientset())
+	t.Cleanup(func() { _ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{}) })
+
+	updates := 0
+	sync := namespacedConfigSyncer(func(context.Context) (map[string]config.NamespaceSpec, error) {
+		return map[string]config.NamespaceSpec{}, nil
+	}, func(context.Context) error {
+		updates++
+		return nil
+	}, logtesting.TestLogger(t))
+
+	sync(ctx)
+	sync(ctx)
+	if updates != 1 {
+		t.Fatalf("status updates = %d, want 1", updates)
+	}
+
+	// a reload of the global config updates the status on the next sync
+	cm := &corev1.ConfigMap{Data: map[string]string{config.PrunerGlobalConfigKey: "ttlSecondsAfterFinished: 42"}}
+	if err := config.PrunerConfigStore.LoadGlobalConfig(ctx, cm); err != nil {
+		t.Fatalf("failed to load the global config: %v", err)
+	}
+	sync(ctx)
+	if updates != 2 {
+		t.Errorf("status updates = %d, want 2", updates)
+	}
+}
+
+func assertStatusField(t *testing.T, item *unstructured.Unstructured, resourceType, field string, want interface{}) {
+	t.Helper()
+	got, found, err := unstructured.NestedFieldNoCopy(item.Object, "status", "effectiveConfig", resourceType, field)
+	if err != nil || !found {
+		t.Fatalf("status.effectiveConfig.%s.%s is not found: %v", resourceType, field, err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("status.effectiveConfig.%s.%s = %v, want %v", resourceType, field, got, want)
+	}
+}
+
+func TestListNamespaceAnnotationConfig(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev", Annotations: map[string]string{config.AnnotationTTLSecondsAfterFinished: "3600"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "invalid", Annotations: map[string]string{config.AnnotationTTLSecondsAfterFinished: "soon"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}},
+	)
+
+	annotationConfig, err := listNamespaceAnnotationConfig(ctx, client)
+	if err != nil {
+		t.Fatalf("listNamespaceAnnotationConfig() error = %v", err)
+	}
+	if len(annotationConfig) != 1 {
+		t.Fatalf("listNamespaceAnnotationConfig() = %v, want only the dev namespace", annotationConfig)
+	}
+	if ttl := annotationConfig["dev"].TTLSecondsAfterFinished; ttl == nil || *ttl != 3600 {
+		t.Errorf("ttl of dev = %v, want 3600", ttl)
+	}
+}
+
+func TestListNamespacedConfig(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	second := newTektonPruner("dev", map[string]interface{}{"ttlSecondsAfterFinished": int64(60)})
+	second.SetName("second")
+	for _, item := range []*unstructured.Unstructured{
+		second,
+		newTektonPruner("dev", map[string]interface{}{"ttlSecondsAfterFinished": int64(300)}),
+		newTektonPruner("invalid", map[string]interface{}{"ttlSecondsAfterFinished": "soon"}),
+	} {
+		if err := store.Add(item); err != nil {
+			t.Fatalf("failed to add the TektonPruner: %v", err)
+		}
+	}
+
+	namespacedConfig := listNamespacedConfig(ctx, store)
+	if len(namespacedConfig) != 1 {
+		t.Fatalf("namespaced config = %v, want the dev namespace only", namespacedConfig)
+	}
+	// the first TektonPruner by name is used
+	if ttl := namespacedConfig["dev"].TTLSecondsAfterFinished; ttl == nil || *ttl != 300 {
+		t.Errorf("ttl of dev = %v, want 300", ttl)
+	}
+}
+
+func TestTektonPrunerEventHandler(t *testing.T) {
+	enqueued := 0
+	handler := tektonPrunerEventHandler(func() { enqueued++ })
+	item := newTektonPruner("dev", map[string]interface{}{})
+
+	handler.OnAdd(item, false)
+	handler.OnUpdate(item, item)
+	handler.OnDelete(item)
+	if enqueued != 3 {
+		t.Errorf("enqueued = %d, want 3", enqueued)
+	}
+}
+
+func TestReconcileNamespacedConfig(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+	syncs := 0
+	r := &Reconciler{syncNamespacedConfig: func(context.Context) { syncs++ }}
+
+	if err := r.Reconcile(ctx, "dev/run"); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Reconcile(ctx, namespacedConfigKey.String()); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if syncs != 1 {
+		t.Errorf("syncs = %d, want 1", syncs)
+	}
+
+	// the key is ignored when the TektonPruner resources are not watched
+	if err := (&Reconciler{}).Reconcile(ctx, namespacedConfigKey.String()); err != nil {
+		t.Errorf("Reconcile() error = %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package tektonpruner
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// pruneRecordResource is the namespaced PruneRecord resource, written for each deletion when enabled
+var pruneRecordResource = schema.GroupVersionResource{Group: "pruner.tekton.dev", Version: "v1alpha1", Resource: "prunerecords"}
+
+// dynamicPruneRecordClient implements config.PruneRecordClient with the dynamic client
+type dynamicPruneRecordClient struct {
+	client dynamic.Interface
+}
+
+func (c dynamicPruneRecordClient) Create(ctx context.Context, namespace string, record *unstructured.Unstructured) error {
+	_, err := c.client.Resource(pruneRecordResource).Namespace(namespace).Create(ctx, record, metav1.CreateOptions{})
+	return err
+}
+
+func (c dynamicPruneRecordClient) List(ctx context.Context, namespace string) ([]unstructured.Unstructured, error) {
+	list, err := c.client.Resource(pruneRecordResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c dynamicPruneRecordClient) Delete(ctx context.Context, namespace, name string) error {
+	return c.client.Resource(pruneRecordResource).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
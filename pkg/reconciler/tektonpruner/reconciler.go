@@ -3,23 +3,31 @@ package tektonpruner
 import (
 	"context"
 
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"knative.dev/pkg/logging"
 )
 
+// namespacedConfigKey is the work queue key of the namespaced config sync, the events of all the
+// TektonPruner resources are coalesced into it
+var namespacedConfigKey = types.NamespacedName{Name: "tektonpruners"}
+
 // Reconciler includes the kubernetes client to interact with the cluster
 type Reconciler struct {
 	kubeclient kubernetes.Interface
+	// syncNamespacedConfig loads the TektonPruner resources into the config store, nil when they are not watched
+	syncNamespacedConfig func(context.Context)
 }
 
 // Reconcile is the method that will be called when resources change
 func (r *Reconciler) Reconcile(ctx context.Context, key string) error {
 	logger := logging.FromContext(ctx)
 
-	// Example logic: log the key of the changed resource (you can replace this with your custom logic)
-	logger.Infof("Reconcile called for key: %s", key)
+	logger.Debugw("Reconcile called", "key", key)
 
-	// Nothing to reconcile at the moment. We are just updating the configstore
+	if key == namespacedConfigKey.String() && r.syncNamespacedConfig != nil {
+		r.syncNamespacedConfig(ctx)
+	}
 
 	return nil // Return nil to indicate successful reconciliation
 }
@@ -0,0 +1,73 @@
+package tektonpruner
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+)
+
+const (
+	// statusKeyLastRunTime holds the time the last cleanup completed, in RFC3339 format
+	statusKeyLastRunTime = "lastRunTime"
+	// statusKeyTotalDeletions holds the number of runs deleted by the last cleanup
+	statusKeyTotalDeletions = "totalDeletions"
+	// statusKeyNamespaceDeletions holds the number of runs deleted by the last cleanup per namespace, in JSON format
+	statusKeyNamespaceDeletions = "namespaceDeletions"
+	// statusKeyErrors holds the errors occurred on the last cleanup, in JSON format
+	statusKeyErrors = "errors"
+)
+
+// isStatusConfigMapEnabled returns true when the status config map is enabled on the controller
+func isStatusConfigMapEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv(config.EnvStatusConfigMapEnabled))
+	return err == nil && enabled
+}
+
+// writeStatusConfigMap creates or updates the status config map on the given namespace with the summary of the cleanup
+func writeStatusConfigMap(ctx context.Context, client kubernetes.Interface, namespace string, summary *config.PruneSummary, completedAt time.Time) error {
+	namespaceDeletions, err := json.Marshal(summary.Deletions())
+	if err != nil {
+		return err
+	}
+	errs := summary.Errors()
+	if errs == nil {
+		errs = []string{}
+	}
+	errorsData, err := json.Marshal(errs)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{
+		statusKeyLastRunTime:        completedAt.UTC().Format(time.RFC3339),
+		statusKeyTotalDeletions:     strconv.FormatInt(summary.TotalDeletions(), 10),
+		statusKeyNamespaceDeletions: string(namespaceDeletions),
+		statusKeyErrors:             string(errorsData),
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Get(ctx, config.PrunerStatusConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: config.PrunerStatusConfigMapName, Namespace: namespace},
+			Data:       data,
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	configMap.Data = data
+	_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	return err
+}
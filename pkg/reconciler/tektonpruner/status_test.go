@@ -0,0 +1,104 @@
+package tektonpruner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	fakepipelineclientset "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	pipelineclient "github.com/tektoncd/pipeline/pkg/client/injection/client"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	"knative.dev/pkg/logging"
+	logtesting "knative.dev/pkg/logging/testing"
+	"knative.dev/pkg/system"
+
+	"github.com/openshift-pipelines/tektoncd-pruner/pkg/config"
+)
+
+func TestStatusConfigMap(t *testing.T) {
+	t.Setenv(config.EnvStatusConfigMapEnabled, "true")
+
+	ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: config.PrunerConfigMapName, Namespace: system.Namespace()},
+			Data:       map[string]string{config.PrunerGlobalConfigKey: "successfulHistoryLimit: 1"},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod"}},
+	)
+	ctx = context.WithValue(ctx, kubeclient.Key{}, kubeClient)
+	t.Cleanup(func() {
+		_ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{})
+	})
+
+	var objects []runtime.Object
+	for index := 0; index < 3; index++ {
+		objects = append(objects, newSucceededPipelineRun("dev", fmt.Sprintf("build-%d", index), time.Duration(index)*time.Hour))
+	}
+	objects = append(objects, newSucceededPipelineRun("prod", "build-0", time.Hour))
+	ctx = context.WithValue(ctx, pipelineclient.Key{}, fakepipelineclientset.NewSimpleClientset(objects...))
+
+	before := time.Now().Add(-time.Second)
+	runGarbageCollector(ctx)
+
+	statusConfigMap, err := kubeClient.CoreV1().ConfigMaps(system.Namespace()).Get(ctx, config.PrunerStatusConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the status ConfigMap: %v", err)
+	}
+
+	if got := statusConfigMap.Data[statusKeyTotalDeletions]; got != "2" {
+		t.Errorf("totalDeletions = %q, want %q", got, "2")
+	}
+	namespaceDeletions := map[string]int64{}
+	if err := json.Unmarshal([]byte(statusConfigMap.Data[statusKeyNamespaceDeletions]), &namespaceDeletions); err != nil {
+		t.Fatalf("failed to decode namespaceDeletions: %v", err)
+	}
+	if len(namespaceDeletions) != 1 || namespaceDeletions["dev"] != 2 {
+		t.Errorf("namespaceDeletions = %v, want map[dev:2]", namespaceDeletions)
+	}
+	if got := statusConfigMap.Data[statusKeyErrors]; got != "[]" {
+		t.Errorf("errors = %q, want %q", got, "[]")
+	}
+	lastRunTime, err := time.Parse(time.RFC3339, statusConfigMap.Data[statusKeyLastRunTime])
+	if err != nil {
+		t.Fatalf("failed to parse lastRunTime: %v", err)
+	}
+	if lastRunTime.Before(before.Truncate(time.Second)) || lastRunTime.After(time.Now()) {
+		t.Errorf("lastRunTime = %v, want the time of the cleanup", lastRunTime)
+	}
+
+	// the next cleanup updates the status
+	runGarbageCollector(ctx)
+	statusConfigMap, err = kubeClient.CoreV1().ConfigMaps(system.Namespace()).Get(ctx, config.PrunerStatusConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the status ConfigMap: %v", err)
+	}
+	if got := statusConfigMap.Data[statusKeyTotalDeletions]; got != "0" {
+		t.Errorf("totalDeletions after the next cleanup = %q, want %q", got, "0")
+	}
+}
+
+func TestStatusConfigMapDisabled(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), logtesting.TestLogger(t))
+	kubeClient := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: config.PrunerConfigMapName, Namespace: system.Namespace()},
+	})
+	ctx = context.WithValue(ctx, kubeclient.Key{}, kubeClient)
+	ctx = context.WithValue(ctx, pipelineclient.Key{}, fakepipelineclientset.NewSimpleClientset())
+	t.Cleanup(func() {
+		_ = config.PrunerConfigStore.LoadGlobalConfig(ctx, &corev1.ConfigMap{})
+	})
+
+	runGarbageCollector(ctx)
+
+	if _, err := kubeClient.CoreV1().ConfigMaps(system.Namespace()).Get(ctx, config.PrunerStatusConfigMapName, metav1.GetOptions{}); err == nil {
+		t.Error("status ConfigMap should not be written when it is disabled")
+	}
+}
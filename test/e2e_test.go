@@ -3,6 +3,7 @@ package test
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -110,6 +111,15 @@ func TestPrunerE2E(t *testing.T) {
 	t.Run("TestPipelineRunConfigurationOverrides", func(t *testing.T) {
 		testPipelineRunConfigurationOverrides(ctx, t, kubeClient, tektonClient)
 	})
+
+	// TestConfigMapValidationWebhook
+	// Tests the validating webhook of the pruner config map
+	// - Applies a config with an unsupported enforcedConfigLevel and a negative TTL
+	// - Verifies that the API server rejects it with the webhook's error message
+	// - Verifies that a valid config applies cleanly
+	t.Run("TestConfigMapValidationWebhook", func(t *testing.T) {
+		testConfigMapValidationWebhook(ctx, t, kubeClient)
+	})
 }
 
 func testTTLBasedPruning(ctx context.Context, t *testing.T, kubeClient *kubernetes.Clientset, tektonClient *clientset.Clientset) {
@@ -560,6 +570,74 @@ namespaces:
 	}
 }
 
+func testConfigMapValidationWebhook(ctx context.Context, t *testing.T, kubeClient *kubernetes.Clientset) {
+	newConfigMap := func(globalConfig string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      prunerConfigName,
+				Namespace: prunerNamespace,
+			},
+			Data: map[string]string{
+				"global-config": globalConfig,
+			},
+		}
+	}
+
+	// the invalid config is applied on dry run, it is not persisted even if the webhook does not reject it.
+	// The webhook fails open, it is retried until the webhook is serving
+	invalidConfig := newConfigMap(`enforcedConfigLevel: bogus
+ttlSecondsAfterFinished: -5`)
+	err := waitForWebhookRejection(ctx, kubeClient, invalidConfig)
+	if err == nil {
+		t.Fatalf("invalid config was not rejected by the webhook")
+	}
+	for _, want := range []string{
+		"validation.webhook.pruner.tekton.dev",
+		`enforcedConfigLevel: Unsupported value: "bogus"`,
+		"ttlSecondsAfterFinished: Invalid value: -5",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("rejection %q does not contain %q", err.Error(), want)
+		}
+	}
+
+	// Update or create the valid config
+	validConfig := newConfigMap(`enforcedConfigLevel: global
+ttlSecondsAfterFinished: 60`)
+	_, err = kubeClient.CoreV1().ConfigMaps(prunerNamespace).Update(ctx, validConfig, metav1.UpdateOptions{})
+	if errors.IsNotFound(err) {
+		_, err = kubeClient.CoreV1().ConfigMaps(prunerNamespace).Create(ctx, validConfig, metav1.CreateOptions{})
+	}
+	if err != nil {
+		t.Fatalf("valid config was rejected: %v", err)
+	}
+}
+
+// waitForWebhookRejection applies the config map on dry run until it is rejected, the rejection is returned.
+// nil is returned when the config map is still accepted on timeout
+func waitForWebhookRejection(ctx context.Context, kubeClient *kubernetes.Clientset, configMap *corev1.ConfigMap) error {
+	timeout := time.After(waitForDeletion)
+	ticker := time.NewTicker(pollingInterval)
+	defer ticker.Stop()
+
+	dryRun := []string{metav1.DryRunAll}
+	for {
+		_, err := kubeClient.CoreV1().ConfigMaps(prunerNamespace).Update(ctx, configMap, metav1.UpdateOptions{DryRun: dryRun})
+		if errors.IsNotFound(err) {
+			_, err = kubeClient.CoreV1().ConfigMaps(prunerNamespace).Create(ctx, configMap, metav1.CreateOptions{DryRun: dryRun})
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-timeout:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
 func waitForTaskRunDeletion(ctx context.Context, client *clientset.Clientset, name, namespace string) error {
 	timeout := time.After(waitForDeletion)
 	ticker := time.NewTicker(pollingInterval)